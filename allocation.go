@@ -0,0 +1,228 @@
+package hashring
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// PointAllocation describes how the ring calculates the number of points of
+// each item.
+type PointAllocation int
+
+const (
+	// AllocateLinear gives MagicFactor points to the item having maximum
+	// weight and linearly interpolates the number of points of other items
+	// between it and the item having minimum weight. The number of points of
+	// an item changes only when minimum or maximum weight of the ring
+	// changes.
+	//
+	// This is the default method.
+	AllocateLinear PointAllocation = iota
+
+	// AllocateExact requires weights to be integers and distributes the
+	// budget of MagicFactor points per item proportionally to the weights
+	// using the largest remainder method. The budget is rounded to a multiple
+	// of the sum of weights divided by their greatest common divisor (as long
+	// as the sum doesn't exceed the budget), which makes ratios of the
+	// numbers of points exactly equal to ratios of weights. That is, an item
+	// having weight 2 gets exactly twice as many points as an item having
+	// weight 1.
+	//
+	// Note that the number of points of every item depends on the sum of all
+	// weights, thus any mutation of the ring changes points of all items.
+	AllocateExact
+)
+
+func (a PointAllocation) String() string {
+	switch a {
+	case AllocateLinear:
+		return "linear"
+	case AllocateExact:
+		return "exact"
+	default:
+		return fmt.Sprintf("PointAllocation(%d)", int(a))
+	}
+}
+
+// PointAllocator calculates the number of points of the ring items. It makes
+// it possible to use allocation methods other than provided by
+// PointAllocation, e.g. logarithmic or capped ones for rings having highly
+// skewed weights.
+//
+// The number of points must depend only on the arguments, otherwise rings
+// having the same items are not guaranteed to be equal.
+type PointAllocator interface {
+	// Points returns the number of points of an item having weight w on the
+	// ring described by s. Negative result is treated as zero.
+	Points(w float64, s AllocationState) int
+}
+
+// AllocationState describes the ring items for PointAllocator. Tombstones
+// (see Remove()) are counted as regular items.
+type AllocationState struct {
+	// MagicFactor is the ring's magic factor (or DefaultMagicFactor if it's
+	// zero).
+	MagicFactor float64
+
+	// MinWeight and MaxWeight are the minimum and maximum weights of items.
+	MinWeight, MaxWeight float64
+
+	// TotalWeight is the sum of weights of items.
+	TotalWeight float64
+
+	// Items is the number of items.
+	Items int
+}
+
+// PointAllocatorFunc is an adapter to allow the use of ordinary functions as
+// PointAllocator.
+type PointAllocatorFunc func(w float64, s AllocationState) int
+
+// Points implements PointAllocator interface.
+func (f PointAllocatorFunc) Points(w float64, s AllocationState) int {
+	return f(w, s)
+}
+
+// LinearAllocator is a PointAllocator implementing AllocateLinear method.
+type LinearAllocator struct{}
+
+// Points implements PointAllocator interface.
+func (LinearAllocator) Points(w float64, s AllocationState) int {
+	if s.MaxWeight == 0 {
+		return 0
+	}
+	n := line(
+		s.MaxWeight, s.MagicFactor,
+		s.MinWeight, math.Ceil(s.MagicFactor)*(s.MinWeight/s.MaxWeight),
+	)
+	return n(w)
+}
+
+// allocationState returns the state of the ring items for PointAllocator.
+//
+// r.mu must be held.
+func (r *Ring) allocationState() AllocationState {
+	s := AllocationState{
+		MagicFactor: r.magicFactor(),
+		MinWeight:   r.minWeight,
+		MaxWeight:   r.maxWeight,
+	}
+	for _, b := range r.buckets {
+		if b.weight > 0 {
+			s.TotalWeight += b.weight
+			s.Items++
+		}
+	}
+	for _, t := range r.tombs {
+		s.TotalWeight += t.weight
+		s.Items++
+	}
+	return s
+}
+
+// customPoints returns a function calculating the number of points of a
+// bucket using r.Allocator.
+//
+// r.mu must be held.
+func (r *Ring) customPoints() func(*bucket) int {
+	var (
+		a = r.conf.Allocator
+		s = r.allocationState()
+	)
+	return func(b *bucket) int {
+		if b.weight == 0 {
+			return 0
+		}
+		if n := a.Points(b.weight, s); n > 0 {
+			return n
+		}
+		return 0
+	}
+}
+
+// exactPoints returns a function calculating the number of points of a bucket
+// under AllocateExact method. Tombstones take their part of the budget as
+// regular items, keeping points of other items unchanged.
+//
+// r.mu must be held.
+func (r *Ring) exactPoints() func(*bucket) int {
+	type share struct {
+		id     uint64
+		weight uint64
+		points int
+		rem    float64
+	}
+	var (
+		shares []share
+		total  uint64
+		gcd    uint64
+	)
+	add := func(id uint64, w float64) {
+		x := uint64(w)
+		shares = append(shares, share{
+			id:     id,
+			weight: x,
+		})
+		total += x
+		gcd = gcdUint64(gcd, x)
+	}
+	for id, b := range r.buckets {
+		if b.weight > 0 {
+			add(id, b.weight)
+		}
+	}
+	for id, t := range r.tombs {
+		add(id, t.weight)
+	}
+	if total == 0 {
+		return func(*bucket) int { return 0 }
+	}
+	var (
+		budget = r.magicFactor() * float64(len(shares))
+		unit   = float64(total / gcd)
+		points = make(map[uint64]int, len(shares))
+	)
+	if unit <= budget {
+		// Every item gets integer number of points in this case.
+		k := uint64(math.Round(budget / unit))
+		for _, s := range shares {
+			points[s.id] = int(k * (s.weight / gcd))
+		}
+	} else {
+		var sum int
+		for i := range shares {
+			s := &shares[i]
+			q := budget * float64(s.weight) / float64(total)
+			s.points = int(q)
+			s.rem = q - float64(s.points)
+			sum += s.points
+		}
+		sort.Slice(shares, func(i, j int) bool {
+			if shares[i].rem != shares[j].rem {
+				return shares[i].rem > shares[j].rem
+			}
+			return shares[i].id < shares[j].id
+		})
+		for i := 0; sum < int(budget); i++ {
+			shares[i%len(shares)].points++
+			sum++
+		}
+		for _, s := range shares {
+			points[s.id] = s.points
+		}
+	}
+	return func(b *bucket) int {
+		if b.weight == 0 {
+			return 0
+		}
+		return points[b.id]
+	}
+}
+
+func gcdUint64(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,164 @@
+package hashring
+
+import (
+	"fmt"
+	"hash"
+	"sync"
+)
+
+// Anchor implements AnchorHash consistent hashing algorithm.
+//
+// Unlike Ring, Anchor maps objects to bucket numbers in range [0, capacity)
+// which are managed by Anchor itself. It has O(1) expected lookup time and
+// requires O(capacity) memory regardless of the number of mappings.
+//
+// Buckets are removed in arbitrary order and added back in reverse order of
+// their removal. That is, removing bucket and adding it back restores the
+// exact previous mapping.
+//
+// For more details about the algorithm please see the paper:
+// https://arxiv.org/abs/1812.09674
+//
+// Anchor is goroutine safe. Anchor instances must not be copied.
+type Anchor struct {
+	// Hash is an optional function used to build up a new 64-bit hash function
+	// for further hash values calculation.
+	// It must not be changed after Anchor's first use.
+	Hash func() hash.Hash64
+
+	hashPool sync.Pool
+
+	mu sync.RWMutex
+
+	// a holds the removal state of each bucket. It's zero for working bucket
+	// and the size of working set right after bucket removal otherwise.
+	a []int
+	// w holds working buckets in its first n elements.
+	w []int
+	// l holds the location of each bucket within w.
+	l []int
+	// k holds the successor of each removed bucket.
+	k []int
+	// r is a stack of removed buckets.
+	r []int
+	// n is the size of working set.
+	n int
+}
+
+// NewAnchor creates new Anchor able to hold at most capacity buckets, with
+// buckets from 0 to size-1 initially working.
+// It panics if size is not in (0, capacity] range.
+func NewAnchor(capacity, size int) *Anchor {
+	if size <= 0 || size > capacity {
+		panic(fmt.Sprintf(
+			"hashring: malformed anchor size: %d of %d",
+			size, capacity,
+		))
+	}
+	x := &Anchor{
+		a: make([]int, capacity),
+		w: make([]int, capacity),
+		l: make([]int, capacity),
+		k: make([]int, capacity),
+		r: make([]int, 0, capacity),
+		n: size,
+	}
+	for b := capacity - 1; b >= size; b-- {
+		x.r = append(x.r, b)
+		x.a[b] = b
+	}
+	for b := 0; b < capacity; b++ {
+		x.w[b] = b
+		x.l[b] = b
+		x.k[b] = b
+	}
+	return x
+}
+
+// Get returns bucket number which v maps to.
+func (x *Anchor) Get(v Item) int {
+	d, err := sum64(&x.hashPool, x.Hash, v, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	b := int(d % uint64(len(x.a)))
+	for x.a[b] > 0 {
+		// Bucket b was removed; rehash v among buckets which were working
+		// right after b's removal.
+		h := int(mix64(d, uint64(b)) % uint64(x.a[b]))
+		for x.a[h] >= x.a[b] {
+			// Bucket h was removed before b; step to its successor.
+			h = x.k[h]
+		}
+		b = h
+	}
+	return b
+}
+
+// Add adds previously removed bucket back and returns its number.
+// It returns non-nil error if there are no removed buckets left.
+func (x *Anchor) Add() (int, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	n := len(x.r)
+	if n == 0 {
+		return 0, fmt.Errorf("hashring: anchor is full")
+	}
+	b := x.r[n-1]
+	x.r = x.r[:n-1]
+
+	x.a[b] = 0
+	x.l[x.w[x.n]] = x.n
+	x.w[x.l[b]] = b
+	x.k[b] = b
+	x.n++
+
+	return b, nil
+}
+
+// Remove removes bucket b.
+// It returns non-nil error if b is not a working bucket or it is the last
+// working bucket.
+func (x *Anchor) Remove(b int) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if b < 0 || b >= len(x.a) || x.a[b] != 0 {
+		return fmt.Errorf("hashring: bucket %d doesn't exist", b)
+	}
+	if x.n == 1 {
+		return fmt.Errorf("hashring: can't remove last bucket")
+	}
+	x.r = append(x.r, b)
+	x.n--
+	x.a[b] = x.n
+	x.w[x.l[b]] = x.w[x.n]
+	x.l[x.w[x.n]] = x.l[b]
+	x.k[b] = x.w[x.n]
+
+	return nil
+}
+
+// Has reports whether b is a working bucket.
+func (x *Anchor) Has(b int) bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return b >= 0 && b < len(x.a) && x.a[b] == 0
+}
+
+// Size returns the number of working buckets.
+func (x *Anchor) Size() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.n
+}
+
+// Capacity returns the maximum number of buckets.
+func (x *Anchor) Capacity() int {
+	return len(x.a)
+}
@@ -0,0 +1,86 @@
+package hashring
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnchorDistribution(t *testing.T) {
+	const (
+		size   = 10
+		numGet = 1e5
+	)
+	a := NewAnchor(100, size)
+	dist := make(map[int]int)
+	for i := 0; i < numGet; i++ {
+		dist[a.Get(IntItem(i))]++
+	}
+	if n := len(dist); n != size {
+		t.Fatalf("unexpected number of buckets: %d; want %d", n, size)
+	}
+	for b, n := range dist {
+		act := float64(n) / numGet * 100
+		if math.Abs(act-100/size) > 1 {
+			t.Errorf("unexpected distribution for bucket %d: %.2f%%", b, act)
+		}
+	}
+}
+
+func TestAnchorRelocation(t *testing.T) {
+	const numGet = 1e4
+
+	a := NewAnchor(20, 10)
+	get := func() []int {
+		ret := make([]int, numGet)
+		for i := range ret {
+			ret[i] = a.Get(IntItem(i))
+		}
+		return ret
+	}
+	base := get()
+
+	for _, b := range []int{3, 7, 0} {
+		prev := get()
+		if err := a.Remove(b); err != nil {
+			t.Fatal(err)
+		}
+		for i, b1 := range get() {
+			if b1 == b {
+				t.Fatalf("key %d maps to removed bucket %d", i, b)
+			}
+			if b0 := prev[i]; b0 != b && b0 != b1 {
+				t.Fatalf("key %d relocated from %d to %d", i, b0, b1)
+			}
+		}
+	}
+	for _, exp := range []int{0, 7, 3} {
+		b, err := a.Add()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b != exp {
+			t.Fatalf("unexpected added bucket: %d; want %d", b, exp)
+		}
+	}
+	for i, b := range get() {
+		if base[i] != b {
+			t.Fatalf("key %d relocated from %d to %d", i, base[i], b)
+		}
+	}
+}
+
+func TestAnchorBounds(t *testing.T) {
+	a := NewAnchor(2, 1)
+	if err := a.Remove(0); err == nil {
+		t.Errorf("want error on last bucket removal; got nothing")
+	}
+	if err := a.Remove(1); err == nil {
+		t.Errorf("want error on removed bucket removal; got nothing")
+	}
+	if b, err := a.Add(); err != nil || b != 1 {
+		t.Errorf("unexpected Add() result: %d, %v", b, err)
+	}
+	if _, err := a.Add(); err == nil {
+		t.Errorf("want error on full anchor; got nothing")
+	}
+}
@@ -0,0 +1,140 @@
+// Package autoweight gradually adjusts weights of hashring items to equalize
+// their load.
+//
+// Load of an item is any caller provided metric which grows as the item gets
+// more objects, such as requests rate, CPU usage or latency. Controller moves
+// weights of overloaded items down and weights of underloaded items up, a
+// bounded step at a time, so that the ring converges without oscillation.
+package autoweight
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gobwas/hashring"
+)
+
+// Default values of the Controller options.
+const (
+	DefaultStep     = 0.1
+	DefaultInterval = 10 * time.Second
+)
+
+// Controller adjusts weights of the ring items based on their load.
+//
+// Controller is goroutine safe. Controller instances must not be copied.
+type Controller struct {
+	// Ring is a ring which weights are adjusted. It must not be nil.
+	Ring *hashring.Ring
+
+	// Load is a function returning current load of the ring items. Items
+	// which are not returned (or don't exist on the ring) are not adjusted.
+	// Load must not be nil.
+	Load func() map[hashring.Item]float64
+
+	// MinWeight and MaxWeight are optional bounds of the adjusted weights.
+	// If MaxWeight is zero, weights are not bounded from above.
+	MinWeight float64
+	MaxWeight float64
+
+	// Step is an optional maximum relative change of the item's weight
+	// made by a single adjustment. That is, weight w becomes at most
+	// w*(1+Step) and at least w/(1+Step).
+	// If Step is zero, then DefaultStep is used.
+	Step float64
+
+	// Interval is an interval between adjustments made by Run().
+	// If Interval is zero, then DefaultInterval is used.
+	Interval time.Duration
+
+	// OnError is an optional function called by Run() when adjustment
+	// fails.
+	OnError func(error)
+
+	mu sync.Mutex
+}
+
+// Run calls Adjust() with c.Interval intervals until ctx is done.
+// It returns the ctx error.
+func (c *Controller) Run(ctx context.Context) error {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		if err := c.Adjust(); err != nil && c.OnError != nil {
+			c.OnError(err)
+		}
+	}
+}
+
+// Adjust makes a single adjustment of the ring weights. Weight of each item
+// is changed proportionally to the ratio of the mean load to the item's load,
+// limited by c.Step and the weight bounds.
+// The ring is rebuilt once per Adjust() call (if any weight changed).
+func (c *Controller) Adjust() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	step := c.Step
+	if step == 0 {
+		step = DefaultStep
+	}
+	if step < 0 || c.MinWeight < 0 || (c.MaxWeight != 0 && c.MaxWeight < c.MinWeight) {
+		panic(fmt.Sprintf(
+			"autoweight: malformed options: step %v, weight bounds [%v, %v]",
+			step, c.MinWeight, c.MaxWeight,
+		))
+	}
+	var (
+		loads   = c.Load()
+		weights = make(map[hashring.Item]float64, len(loads))
+		mean    float64
+	)
+	for x, l := range loads {
+		w, has := c.Ring.Weight(x)
+		if !has || l < 0 {
+			continue
+		}
+		weights[x] = w
+		mean += l
+	}
+	if len(weights) < 2 {
+		return nil
+	}
+	mean /= float64(len(weights))
+	if mean == 0 {
+		return nil
+	}
+	next := make(map[hashring.Item]float64, len(weights))
+	for x, w := range weights {
+		ratio := 1 + step
+		if l := loads[x]; l > 0 {
+			ratio = math.Max(1/(1+step), math.Min(1+step, mean/l))
+		}
+		n := w * ratio
+		if n < c.MinWeight {
+			n = c.MinWeight
+		}
+		if c.MaxWeight != 0 && n > c.MaxWeight {
+			n = c.MaxWeight
+		}
+		if n != w {
+			next[x] = n
+		}
+	}
+	if len(next) == 0 {
+		return nil
+	}
+	return c.Ring.SetWeights(next)
+}
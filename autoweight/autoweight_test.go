@@ -0,0 +1,86 @@
+package autoweight
+
+import (
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/gobwas/hashring"
+)
+
+type item string
+
+func (s item) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(s))
+	return int64(n), err
+}
+
+func TestControllerAdjust(t *testing.T) {
+	var r hashring.Ring
+	for _, s := range []string{"a", "b", "c"} {
+		if err := r.Insert(item(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := Controller{
+		Ring: &r,
+		Load: func() map[hashring.Item]float64 {
+			return map[hashring.Item]float64{
+				item("a"): 2,
+				item("b"): 1,
+				item("c"): 1,
+				item("d"): 1, // Not on the ring.
+			}
+		},
+		MaxWeight: 1.05,
+	}
+	if err := c.Adjust(); err != nil {
+		t.Fatal(err)
+	}
+	for s, exp := range map[string]float64{
+		"a": 1 / (1 + DefaultStep),
+		"b": 1.05,
+		"c": 1.05,
+	} {
+		if act, _ := r.Weight(item(s)); act != exp {
+			t.Errorf("unexpected weight of %q: %v; want %v", s, act, exp)
+		}
+	}
+}
+
+func TestControllerConverge(t *testing.T) {
+	var r hashring.Ring
+	capacity := map[hashring.Item]float64{
+		item("a"): 2,
+		item("b"): 1,
+		item("c"): 1,
+	}
+	for x := range capacity {
+		if err := r.Insert(x, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := Controller{
+		Ring: &r,
+		Load: func() map[hashring.Item]float64 {
+			load := make(map[hashring.Item]float64, len(capacity))
+			for i := 0; i < 10000; i++ {
+				x := r.Get(item(strconv.Itoa(i)))
+				load[x] += 1 / capacity[x]
+			}
+			return load
+		},
+	}
+	for i := 0; i < 50; i++ {
+		if err := c.Adjust(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _ := r.Weight(item("a"))
+	for _, s := range []string{"b", "c"} {
+		w, _ := r.Weight(item(s))
+		if ratio := a / w; ratio < 1.6 || ratio > 2.4 {
+			t.Errorf("unexpected weights ratio of %q to %q: %.2f; want ~2", "a", s, ratio)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package hashring
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// benchSizes are the numbers of items of the rings used by benchmarks.
+var benchSizes = []int{10, 100, 1000}
+
+// benchRing returns a ring having n items with equal weights.
+func benchRing(b *testing.B, n, magic int) *Ring {
+	r := &Ring{
+		MagicFactor: magic,
+	}
+	r.Begin()
+	for i := 0; i < n; i++ {
+		if err := r.Insert(StringItem("item-"+strconv.Itoa(i)), 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := r.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	return r
+}
+
+// benchKeys returns n keys ordered according to the distribution: uniform
+// keys are all distinct, while Zipf keys are drawn from a set of 1<<20 keys
+// with the most popular ones drawn more often.
+func benchKeys(dist string, n int) []Item {
+	var (
+		keys = make([]Item, n)
+		rnd  = rand.New(rand.NewSource(0))
+		zipf = rand.NewZipf(rnd, 1.1, 1, 1<<20-1)
+	)
+	for i := range keys {
+		k := uint64(i)
+		if dist == "zipf" {
+			k = zipf.Uint64()
+		}
+		keys[i] = IntItem(k)
+	}
+	return keys
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, dist := range []string{"uniform", "zipf"} {
+		keys := benchKeys(dist, 1<<16)
+		for _, n := range benchSizes {
+			b.Run(dist+"/"+strconv.Itoa(n), func(b *testing.B) {
+				r := benchRing(b, n, 0)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					r.Get(keys[i&(len(keys)-1)])
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	keys := benchKeys("uniform", 1<<16)
+	for _, n := range []int{100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			r := benchRing(b, n, 0)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					r.Get(keys[i&(len(keys)-1)])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkGetHotParallel measures parallel lookups of a single hot key with
+// load counting enabled.
+func BenchmarkGetHotParallel(b *testing.B) {
+	r := Ring{
+		CountLoads: true,
+	}
+	for i := 0; i < 100; i++ {
+		if err := r.Insert(StringItem("item-"+strconv.Itoa(i)), 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+	key := IntItem(42)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.Get(key)
+		}
+	})
+}
+
+// BenchmarkInsertDelete measures the cost of adding an item to the ring of
+// given size and removing it back.
+func BenchmarkInsertDelete(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			var (
+				r = benchRing(b, n, 0)
+				x = StringItem("extra")
+			)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := r.Insert(x, 1); err != nil {
+					b.Fatal(err)
+				}
+				if err := r.Delete(x); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRebuild measures the cost of rebuilding the ring from scratch,
+// which happens when magic factor of the ring changes.
+func BenchmarkRebuild(b *testing.B) {
+	for _, magic := range []int{DefaultMagicFactor, 10 * DefaultMagicFactor} {
+		for _, n := range []int{10, 100} {
+			name := "magic=" + strconv.Itoa(magic) + "/" + strconv.Itoa(n)
+			b.Run(name, func(b *testing.B) {
+				r := benchRing(b, n, magic)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// Rebuild twice per iteration to end up with the
+					// original magic factor.
+					if _, err := r.SetMagicFactor(magic + 1); err != nil {
+						b.Fatal(err)
+					}
+					if _, err := r.SetMagicFactor(magic); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
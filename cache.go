@@ -0,0 +1,62 @@
+package hashring
+
+import "sync/atomic"
+
+// cache is a fixed size lock-free cache of lookup results of a single ring
+// state. Since ring state is immutable, cache entries are never invalidated;
+// instead, each new version of the state gets its own empty cache.
+//
+// Each slot holds the most recently stored entry which digest is mapped to
+// the slot. Concurrent stores to the same slot are resolved by the last one.
+type cache struct {
+	mask  uint64
+	slots []atomic.Value // *cacheEntry
+}
+
+type cacheEntry struct {
+	d     value
+	id    uint64
+	item  Item
+	loads *loads
+}
+
+// newCache creates cache having at least n slots. It returns nil if n is not
+// positive.
+func newCache(n int) *cache {
+	if n <= 0 {
+		return nil
+	}
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	return &cache{
+		mask:  uint64(size - 1),
+		slots: make([]atomic.Value, size),
+	}
+}
+
+// empty returns new empty cache of the same size as c. It returns nil if c is
+// nil.
+func (c *cache) empty() *cache {
+	if c == nil {
+		return nil
+	}
+	return newCache(len(c.slots))
+}
+
+func (c *cache) slot(d value) *atomic.Value {
+	return &c.slots[mix64(d.hi^d.lo, 0)&c.mask]
+}
+
+func (c *cache) get(d value) *cacheEntry {
+	e, _ := c.slot(d).Load().(*cacheEntry)
+	if e == nil || e.d != d {
+		return nil
+	}
+	return e
+}
+
+func (c *cache) put(e *cacheEntry) {
+	c.slot(e.d).Store(e)
+}
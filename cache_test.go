@@ -0,0 +1,83 @@
+package hashring
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRingCache(t *testing.T) {
+	var (
+		r Ring
+		c = Ring{
+			CacheSize:  64,
+			CountLoads: true,
+		}
+	)
+	check := func() {
+		t.Helper()
+		// Keys are looked up twice, so the second lookup hits the cache
+		// unless the slot was taken by other key.
+		for i := 0; i < 2*100; i++ {
+			key := IntItem(i % 100)
+			if act, exp := c.Get(key), r.Get(key); act != exp {
+				t.Fatalf("unexpected item for %v: %v; want %v", key, act, exp)
+			}
+		}
+	}
+	for i := 0; i < 10; i++ {
+		x := StringItem("item-" + strconv.Itoa(i))
+		for _, r := range []*Ring{&r, &c} {
+			if err := r.Insert(x, float64(1+i%3)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		check()
+	}
+	for i := 0; i < 10; i += 2 {
+		x := StringItem("item-" + strconv.Itoa(i))
+		for _, r := range []*Ring{&r, &c} {
+			if err := r.Delete(x); err != nil {
+				t.Fatal(err)
+			}
+		}
+		check()
+	}
+	for _, r := range []*Ring{&r, &c} {
+		if err := r.Pin(IntItem(42), StringItem("item-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check()
+	if x := c.Get(IntItem(42)); x != StringItem("item-1") {
+		t.Fatalf("unexpected item for pinned key: %v", x)
+	}
+
+	// Cached lookups are counted as well.
+	var total uint64
+	for _, l := range c.Loads() {
+		total += l.Count
+	}
+	if total == 0 {
+		t.Fatalf("no loads counted")
+	}
+}
+
+func BenchmarkRingGetCache(b *testing.B) {
+	for _, size := range []int{0, 1024} {
+		b.Run("size="+strconv.Itoa(size), func(b *testing.B) {
+			r := Ring{
+				CacheSize: size,
+			}
+			r.Begin()
+			for i := 0; i < 1000; i++ {
+				r.Insert(IntItem(i), 1)
+			}
+			r.Commit()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Popular keys only.
+				r.Get(IntItem(i % 256))
+			}
+		})
+	}
+}
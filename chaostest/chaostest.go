@@ -0,0 +1,395 @@
+// Package chaostest provides a harness which drives randomized concurrent
+// mutations and lookups against a ring and checks that readers never observe
+// inconsistent state.
+//
+// Mutations are made by writer goroutines, while reader goroutines take
+// snapshots of the ring and make lookups. The harness maintains a model of
+// the ring and records expected set of items for each published version. It
+// then checks that:
+//   - versions observed by each reader never decrease;
+//   - each snapshot has exactly the items recorded for its version (that is,
+//     there are no torn reads);
+//   - each lookup returns an item which was on the ring at some version
+//     published during the lookup.
+//
+// To stress collision handling the ring is expected to use a hash function
+// with small number of significant bits, such as one returned by Hash().
+package chaostest
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/hashring"
+)
+
+// Target is a ring under test. It is implemented by wrappers around
+// hashring.Ring; use Ring() to test hashring.Ring itself.
+//
+// Each successful mutation must publish exactly one new version of the ring
+// and failed mutation must leave the ring unchanged.
+type Target interface {
+	Insert(x hashring.Item, w float64) error
+	Update(x hashring.Item, w float64) error
+	Delete(x hashring.Item) error
+	Get(v hashring.Item) hashring.Item
+	View() *hashring.View
+}
+
+// Ring returns a Target which makes calls to the given ring.
+func Ring(r *hashring.Ring) Target {
+	return ringTarget{r}
+}
+
+type ringTarget struct {
+	*hashring.Ring
+}
+
+func (t ringTarget) Insert(x hashring.Item, w float64) error {
+	return t.Ring.Insert(x, w)
+}
+
+// Hash returns a hash function constructor which leaves only given number of
+// lower bits of the FNV-1a hash. Small number of bits makes ring points
+// collide often.
+func Hash(bits int) func() hash.Hash64 {
+	mask := uint64(1)<<uint(bits) - 1
+	if bits >= 64 {
+		mask = ^uint64(0)
+	}
+	return func() hash.Hash64 {
+		return maskHash{fnv.New64a(), mask}
+	}
+}
+
+type maskHash struct {
+	hash.Hash64
+	mask uint64
+}
+
+func (h maskHash) Sum64() uint64 { return h.Hash64.Sum64() & h.mask }
+
+// Item is an item type used by the harness.
+type Item string
+
+// WriteTo implements hashring.Item interface.
+func (x Item) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(x))
+	return int64(n), err
+}
+
+// Config contains options of the harness.
+type Config struct {
+	// Items is the number of distinct items writers operate on.
+	// If Items is zero then 16 is used.
+	Items int
+
+	// MaxWeight is the maximum weight given to the items. Weights are
+	// integers from 1 to MaxWeight.
+	// If MaxWeight is zero then 4 is used.
+	MaxWeight int
+
+	// Writers and Readers are the numbers of goroutines making mutations
+	// and lookups respectively.
+	// If Writers is zero then 2 is used. If Readers is zero then 4 is used.
+	Writers int
+	Readers int
+
+	// Duration is the duration of the run.
+	// If Duration is zero then one second is used.
+	Duration time.Duration
+
+	// Seed is a seed of the pseudo-random generator used by writers and
+	// readers.
+	Seed int64
+}
+
+func (c Config) withDefaults() Config {
+	if c.Items <= 0 {
+		c.Items = 16
+	}
+	if c.MaxWeight <= 0 {
+		c.MaxWeight = 4
+	}
+	if c.Writers <= 0 {
+		c.Writers = 2
+	}
+	if c.Readers <= 0 {
+		c.Readers = 4
+	}
+	if c.Duration <= 0 {
+		c.Duration = time.Second
+	}
+	return c
+}
+
+// Stats contains statistics of the run.
+type Stats struct {
+	Mutations int // Number of successful mutations.
+	Failures  int // Number of mutations which returned an error.
+	Snapshots int // Number of snapshots checked by readers.
+	Lookups   int // Number of lookups checked by readers.
+}
+
+// Run drives mutations and lookups against t for the configured duration.
+// The target must be empty and must not be mutated by anyone else while Run()
+// is in progress.
+// It returns non-nil error describing the first violation found.
+func Run(t Target, c Config) (Stats, error) {
+	c = c.withDefaults()
+	h := harness{
+		target:  t,
+		config:  c,
+		model:   make(map[Item]float64),
+		history: make(map[uint64]string),
+		stop:    make(chan struct{}),
+	}
+	v := t.View()
+	if n := len(v.Items()); n != 0 {
+		return Stats{}, fmt.Errorf("chaostest: target has %d items", n)
+	}
+	h.latest = v.Version()
+	h.history[h.latest] = ""
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.Writers; i++ {
+		rnd := rand.New(rand.NewSource(c.Seed + int64(i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.write(rnd)
+		}()
+	}
+	for i := 0; i < c.Readers; i++ {
+		rnd := rand.New(rand.NewSource(c.Seed + int64(c.Writers+i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.read(rnd)
+		}()
+	}
+	timer := time.AfterFunc(c.Duration, func() {
+		h.fail(nil)
+	})
+	wg.Wait()
+	timer.Stop()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats, h.err
+}
+
+type harness struct {
+	target Target
+	config Config
+
+	// wmu serializes mutations so the model follows the target.
+	wmu   sync.Mutex
+	model map[Item]float64
+
+	// mu protects fields below. It is held by writers during mutation, so
+	// readers can't check a version which is not recorded yet.
+	mu      sync.Mutex
+	history map[uint64]string // Version to sorted item names.
+	latest  uint64
+	stats   Stats
+	err     error
+	once    sync.Once
+	stop    chan struct{}
+}
+
+func (h *harness) fail(err error) {
+	h.once.Do(func() {
+		h.err = err
+		close(h.stop)
+	})
+}
+
+func (h *harness) stopped() bool {
+	select {
+	case <-h.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *harness) write(rnd *rand.Rand) {
+	for !h.stopped() {
+		if err := h.mutate(rnd); err != nil {
+			h.mu.Lock()
+			h.fail(err)
+			h.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (h *harness) mutate(rnd *rand.Rand) error {
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+
+	var (
+		x    = Item("item-" + strconv.Itoa(rnd.Intn(h.config.Items)))
+		w    = float64(1 + rnd.Intn(h.config.MaxWeight))
+		op   string
+		err  error
+		prev = h.model[x]
+	)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case prev == 0:
+		op = "insert"
+		err = h.target.Insert(x, w)
+	case rnd.Intn(2) == 0:
+		op = "update"
+		err = h.target.Update(x, w)
+	default:
+		op = "delete"
+		w = 0
+		err = h.target.Delete(x)
+	}
+	v := h.target.View().Version()
+	if err != nil {
+		// Under hashring.CollisionError mutations may legitimately fail.
+		h.stats.Failures++
+		if v != h.latest {
+			return fmt.Errorf(
+				"chaostest: failed %s of %s published version %d",
+				op, x, v,
+			)
+		}
+		return nil
+	}
+	if v != h.latest+1 {
+		return fmt.Errorf(
+			"chaostest: %s of %s published version %d; want %d",
+			op, x, v, h.latest+1,
+		)
+	}
+	if w == 0 {
+		delete(h.model, x)
+	} else {
+		h.model[x] = w
+	}
+	h.latest = v
+	h.history[v] = h.snapshot()
+	h.stats.Mutations++
+	return nil
+}
+
+// snapshot returns sorted names of the model items.
+//
+// h.wmu must be held.
+func (h *harness) snapshot() string {
+	names := make([]string, 0, len(h.model))
+	for x := range h.model {
+		names = append(names, string(x))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (h *harness) read(rnd *rand.Rand) {
+	var last uint64
+	for !h.stopped() {
+		v0 := h.target.View()
+		x := h.target.Get(Item(strconv.Itoa(rnd.Int())))
+		v1 := h.target.View()
+
+		err := h.check(last, v0, v1, x)
+		if err != nil {
+			h.mu.Lock()
+			h.fail(err)
+			h.mu.Unlock()
+			return
+		}
+		last = v1.Version()
+	}
+}
+
+func (h *harness) check(last uint64, v0, v1 *hashring.View, x hashring.Item) error {
+	a, b := v0.Version(), v1.Version()
+	if a < last || b < a {
+		return fmt.Errorf(
+			"chaostest: observed versions %d and %d after %d", a, b, last,
+		)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, v := range [...]*hashring.View{v0, v1} {
+		exp, has := h.history[v.Version()]
+		if !has {
+			return fmt.Errorf(
+				"chaostest: observed unknown version %d", v.Version(),
+			)
+		}
+		if act := names(v.Items()); act != exp {
+			return fmt.Errorf(
+				"chaostest: torn read at version %d: items are [%s]; want [%s]",
+				v.Version(), act, exp,
+			)
+		}
+		h.stats.Snapshots++
+	}
+	if x != nil && !h.seen(x, a, b) {
+		return fmt.Errorf(
+			"chaostest: lookup returned %v which was not on the ring at "+
+				"versions %d through %d",
+			x, a, b,
+		)
+	}
+	if x == nil {
+		for v := a; v <= b; v++ {
+			if h.history[v] == "" {
+				h.stats.Lookups++
+				return nil
+			}
+		}
+		return fmt.Errorf(
+			"chaostest: lookup returned nil while ring was not empty at "+
+				"versions %d through %d",
+			a, b,
+		)
+	}
+	h.stats.Lookups++
+	return nil
+}
+
+// seen reports whether x was on the ring at some version from a to b.
+//
+// h.mu must be held.
+func (h *harness) seen(x hashring.Item, a, b uint64) bool {
+	s, ok := x.(Item)
+	if !ok {
+		return false
+	}
+	for v := a; v <= b; v++ {
+		for _, name := range strings.Split(h.history[v], ",") {
+			if name == string(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func names(items []hashring.Item) string {
+	ss := make([]string, len(items))
+	for i, x := range items {
+		ss[i] = fmt.Sprint(x)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
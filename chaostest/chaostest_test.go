@@ -0,0 +1,40 @@
+package chaostest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gobwas/hashring"
+)
+
+func TestRun(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		collision hashring.CollisionPolicy
+	}{
+		{"rehash", hashring.CollisionRehash},
+		{"tie-break", hashring.CollisionTieBreak},
+		{"stable", hashring.CollisionStable},
+		{"error", hashring.CollisionError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := &hashring.Ring{
+				Hash:        Hash(8),
+				MagicFactor: 8,
+				Collision:   test.collision,
+			}
+			stats, err := Run(Ring(r), Config{
+				Duration: 100 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Mutations == 0 || stats.Lookups == 0 {
+				t.Fatalf("no work done: %+v", stats)
+			}
+			if err := r.Verify(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package hashring
+
+// Close releases resources held by the ring, such as its items, points and
+// pooled hash functions, and marks the ring unusable. It's useful for
+// long-lived processes creating ephemeral rings.
+//
+// After Close() lookup methods (such as Get()) behave as for an empty ring,
+// while mutation methods and methods inspecting ring internals panic.
+// Close() waits for the running mutation (if any) to finish. Calling Close()
+// more than once is a no-op. It always returns nil error and exists to
+// implement io.Closer.
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.wait()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.configure()
+
+	r.buckets = nil
+	r.collisions = nil
+	r.tombs = nil
+	r.log = nil
+	r.undo = nil
+	r.schedules = nil
+	r.fix.Init()
+	r.minWeight, r.maxWeight = 0, 0
+
+	prev := r.current()
+	// Previous state's hasher (along with its pool) is dropped. The new one
+	// is used only to digest keys of lookups made after Close().
+	h := r.shared
+	if h == nil {
+		h = newHasher(r.conf.Hash, r.conf.Hash128)
+	}
+	r.state.Store(&ringState{
+		version: prev.version,
+		hasher:  h,
+	})
+	return nil
+}
@@ -0,0 +1,28 @@
+package hashring
+
+import "testing"
+
+func TestRingClose(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+	})
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if x := r.Get(StringItem("key")); x != nil {
+		t.Errorf("unexpected item from closed ring: %v", x)
+	}
+	if n := r.Len(); n != 0 {
+		t.Errorf("unexpected length of closed ring: %d", n)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("no panic on mutation of closed ring")
+		}
+	}()
+	r.Insert(StringItem("baz"), 1)
+}
@@ -0,0 +1,294 @@
+// Command ringctl answers queries about a hashring built from a membership
+// file.
+//
+// Membership file lists ring items one per line, optionally followed by the
+// item's weight (1 by default). Empty lines and lines starting with # are
+// ignored:
+//
+//	# name weight
+//	server01 1
+//	server02 2.5
+//
+// Usage:
+//
+//	ringctl [flags] get <members> <key>
+//	ringctl [flags] owners [-n 3] <members> <key>
+//	ringctl [flags] dist <members>
+//	ringctl [flags] diff <old members> <new members>
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gobwas/hashring"
+)
+
+var magic = flag.Int("magic", 0, "magic factor of the ring (default is hashring.DefaultMagicFactor)")
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "get":
+		err = get(args)
+	case "owners":
+		err = owners(args)
+	case "dist":
+		err = dist(args)
+	case "diff":
+		err = diff(args)
+	default:
+		err = fmt.Errorf("unknown command: %q", cmd)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ringctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  ringctl [flags] get <members> <key>
+  ringctl [flags] owners [-n 3] <members> <key>
+  ringctl [flags] dist <members>
+  ringctl [flags] diff <old members> <new members>
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func get(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("get: want <members> <key> arguments")
+	}
+	r, _, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	x, rng := r.Owner(member(args[1]))
+	if x == nil {
+		return fmt.Errorf("get: ring is empty")
+	}
+	fmt.Printf("%s\t[%d, %d)\n", x, rng.Start, rng.End)
+	return nil
+}
+
+func owners(args []string) error {
+	flags := flag.NewFlagSet("owners", flag.ExitOnError)
+	n := flags.Int("n", 3, "number of owners")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return fmt.Errorf("owners: want <members> <key> arguments")
+	}
+	r, _, err := load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, x := range r.GetN(member(flags.Arg(1)), *n) {
+		fmt.Println(x)
+	}
+	return nil
+}
+
+func dist(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("dist: want <members> argument")
+	}
+	r, ms, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	share := make(map[hashring.Item]float64, len(ms))
+	for _, a := range arcs(r) {
+		share[a.item] += a.size()
+	}
+	total := r.TotalWeight()
+	fmt.Printf("%-20s\t%10s\t%10s\t%10s\n", "item", "weight", "expected", "actual")
+	for _, m := range ms {
+		w, _ := r.Weight(m)
+		fmt.Printf(
+			"%-20s\t%10.2f\t%9.4f%%\t%9.4f%%\n",
+			m, w, 100*w/total, 100*share[m],
+		)
+	}
+	return nil
+}
+
+func diff(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("diff: want <old members> <new members> arguments")
+	}
+	r0, _, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	r1, _, err := load(args[1])
+	if err != nil {
+		return err
+	}
+	type move struct {
+		from, to hashring.Item
+	}
+	var (
+		moved = make(map[move]float64)
+		total float64
+	)
+	sweep(arcs(r0), arcs(r1), func(size float64, from, to hashring.Item) {
+		if from != to {
+			moved[move{from, to}] += size
+			total += size
+		}
+	})
+	ms := make([]move, 0, len(moved))
+	for m := range moved {
+		ms = append(ms, m)
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return moved[ms[i]] > moved[ms[j]]
+	})
+	for _, m := range ms {
+		fmt.Printf("%s -> %s\t%9.4f%%\n", m.from, m.to, 100*moved[m])
+	}
+	fmt.Printf("total moved\t%9.4f%%\n", 100*total)
+	return nil
+}
+
+// arc is a half-open interval [start, end) of the ring owned by the item, the
+// same as hashring.Range. Arc having start equal to end covers the whole ring.
+type arc struct {
+	start, end uint64
+	item       hashring.Item
+}
+
+// size returns the share of the ring covered by the arc.
+func (a arc) size() float64 {
+	if a.start == a.end {
+		return 1
+	}
+	return float64(a.end-a.start) / math.Exp2(64)
+}
+
+// arcs returns arcs of the ring ordered by their ends.
+func arcs(r *hashring.Ring) []arc {
+	var ps []hashring.PointInfo
+	r.WalkRange(0, 0, func(p hashring.PointInfo) bool {
+		ps = append(ps, p)
+		return true
+	})
+	as := make([]arc, len(ps))
+	for i, p := range ps {
+		prev := ps[(i+len(ps)-1)%len(ps)]
+		as[i] = arc{
+			start: prev.Value,
+			end:   p.Value,
+			item:  p.Item,
+		}
+	}
+	return as
+}
+
+// sweep calls fn for each interval of the ring with the owners of the
+// interval within a and b arcs.
+func sweep(a, b []arc, fn func(size float64, from, to hashring.Item)) {
+	if len(a) == 0 || len(b) == 0 {
+		return
+	}
+	var (
+		i, j int
+		prev = a[len(a)-1].end
+	)
+	if p := b[len(b)-1].end; p > prev {
+		prev = p
+	}
+	// Note that the interval after the greatest end belongs to the owners of
+	// the first arcs.
+	for i < len(a) || j < len(b) {
+		var (
+			x = a[i%len(a)]
+			y = b[j%len(b)]
+			p uint64
+		)
+		switch {
+		case j == len(b) || (i < len(a) && x.end < y.end):
+			p = x.end
+			i++
+		case i == len(a) || y.end < x.end:
+			p = y.end
+			j++
+		default:
+			p = x.end
+			i++
+			j++
+		}
+		fn(arc{start: prev, end: p}.size(), x.item, y.item)
+		prev = p
+	}
+}
+
+// load builds up a ring from the membership file.
+func load(path string) (*hashring.Ring, []member, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	r := &hashring.Ring{
+		MagicFactor: *magic,
+	}
+	var ms []member
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		w := 1.0
+		switch len(fields) {
+		case 1:
+		case 2:
+			w, err = strconv.ParseFloat(fields[1], 64)
+			if err == nil && w <= 0 {
+				err = fmt.Errorf("weight must be greater than zero")
+			}
+		default:
+			err = fmt.Errorf("too many fields")
+		}
+		if err == nil {
+			m := member(fields[0])
+			err = r.Insert(m, w)
+			ms = append(ms, m)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+	return r, ms, nil
+}
+
+// member is a ring item identified by its name.
+type member string
+
+func (m member) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(m))
+	return int64(n), err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gobwas/hashring"
+)
+
+func TestArcSize(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		arc  arc
+		exp  float64
+	}{
+		{"whole", arc{start: 42, end: 42}, 1},
+		{"half", arc{start: 0, end: 1 << 63}, 0.5},
+		{"wraparound", arc{start: 1 << 63, end: 0}, 0.5},
+		{"small", arc{start: 10, end: 20}, 10 / math.Exp2(64)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if act := test.arc.size(); act != test.exp {
+				t.Fatalf("unexpected size: %v; want %v", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	const (
+		a = member("a")
+		b = member("b")
+	)
+	type interval struct {
+		size     float64
+		from, to hashring.Item
+	}
+	unit := 1 / math.Exp2(64)
+	for _, test := range []struct {
+		name string
+		a, b []arc
+		exp  []interval
+	}{
+		{
+			name: "empty",
+			a:    nil,
+			b:    []arc{{start: 0, end: 0, item: a}},
+		},
+		{
+			name: "single",
+			a:    []arc{{start: 5, end: 5, item: a}},
+			b:    []arc{{start: 7, end: 7, item: b}},
+			exp: []interval{
+				{arc{start: 7, end: 5}.size(), a, b},
+				{2 * unit, a, b},
+			},
+		},
+		{
+			name: "wraparound",
+			a: []arc{
+				{start: 200, end: 100, item: a},
+				{start: 100, end: 200, item: b},
+			},
+			b: []arc{
+				{start: 150, end: 50, item: a},
+				{start: 50, end: 150, item: b},
+			},
+			exp: []interval{
+				{arc{start: 200, end: 50}.size(), a, a},
+				{50 * unit, a, b},
+				{50 * unit, b, b},
+				{50 * unit, b, a},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var act []interval
+			sweep(test.a, test.b, func(size float64, from, to hashring.Item) {
+				act = append(act, interval{size, from, to})
+			})
+			if len(act) != len(test.exp) {
+				t.Fatalf("unexpected intervals: %v; want %v", act, test.exp)
+			}
+			for i := range act {
+				if act[i] != test.exp[i] {
+					t.Errorf(
+						"unexpected #%d interval: %v; want %v",
+						i, act[i], test.exp[i],
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestArcs(t *testing.T) {
+	var r hashring.Ring
+	if as := arcs(&r); len(as) != 0 {
+		t.Fatalf("unexpected arcs of empty ring: %v", as)
+	}
+	if err := r.Insert(member("a"), 1); err != nil {
+		t.Fatal(err)
+	}
+	as := arcs(&r)
+	if len(as) != r.NumPoints() {
+		t.Fatalf("unexpected number of arcs: %d; want %d", len(as), r.NumPoints())
+	}
+	var total float64
+	for i, a := range as {
+		if a.item != member("a") {
+			t.Fatalf("unexpected owner of #%d arc: %v", i, a.item)
+		}
+		if prev := as[(i+len(as)-1)%len(as)]; a.start != prev.end {
+			t.Fatalf("#%d arc is not adjacent to the previous one", i)
+		}
+		total += a.size()
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Fatalf("unexpected total size of arcs: %v; want 1", total)
+	}
+}
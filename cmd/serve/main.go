@@ -0,0 +1,258 @@
+// Command serve is a standalone consistent hashing routing daemon. It exposes
+// a hashring over HTTP, so services written in other languages can consume
+// the same mapping of keys to nodes.
+//
+// Initial membership may be loaded from a file which lists nodes one per
+// line, optionally followed by the node's weight (1 by default). Empty lines
+// and lines starting with # are ignored.
+//
+// API:
+//
+//	GET    /owners?key=K[&n=N]    nodes owning key K (JSON)
+//	GET    /nodes                 nodes and their weights (JSON)
+//	PUT    /nodes/NAME[?weight=W] add node or change its weight
+//	POST   /nodes/NAME/drain      drain node, keeping part of its keys
+//	DELETE /nodes/NAME            remove node
+//	GET    /debug/ring            ring visualization
+//
+// Usage:
+//
+//	serve [-addr :8080] [-members members.txt] [-magic N] [-drain 0.5]
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gobwas/hashring"
+	"github.com/gobwas/hashring/gossip"
+	"github.com/gobwas/hashring/viz"
+)
+
+var (
+	addr    = flag.String("addr", ":8080", "address to listen on")
+	members = flag.String("members", "", "optional file with initial membership")
+	magic   = flag.Int("magic", 0, "magic factor of the ring (default is hashring.DefaultMagicFactor)")
+	drain   = flag.Float64("drain", 0.5, "factor of the drained node weight")
+)
+
+func main() {
+	flag.Parse()
+
+	s := newServer(&hashring.Ring{
+		MagicFactor: *magic,
+	}, *drain)
+	if *members != "" {
+		if err := s.load(*members); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s.handler()))
+}
+
+type server struct {
+	ring       *hashring.Ring
+	membership gossip.Membership
+
+	mu      sync.Mutex
+	weights map[string]float64 // Nominal weights of the nodes.
+}
+
+// newServer creates a server maintaining membership of the ring r. Drain is
+// a factor of the drained node weight (see gossip.Membership.Drain).
+func newServer(r *hashring.Ring, drain float64) *server {
+	s := &server{
+		ring:    r,
+		weights: make(map[string]float64),
+	}
+	s.membership = gossip.Membership{
+		Ring:  r,
+		Drain: drain,
+	}
+	return s
+}
+
+// handler returns an http.Handler serving the API of the server.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/owners", s.owners)
+	mux.HandleFunc("/nodes", s.nodes)
+	mux.HandleFunc("/nodes/", s.node)
+	mux.Handle("/debug/ring", viz.Handler(s.ring, nil))
+	return mux
+}
+
+type node struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+}
+
+func (s *server) owners(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := req.URL.Query()
+	key := q.Get("key")
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	n := 1
+	if v := q.Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+			http.Error(w, "malformed n", http.StatusBadRequest)
+			return
+		}
+	}
+	owners := []string{}
+	for _, x := range s.ring.GetN(gossip.Member(key), n) {
+		owners = append(owners, string(x.(gossip.Member)))
+	}
+	reply(w, struct {
+		Key    string   `json:"key"`
+		Owners []string `json:"owners"`
+	}{key, owners})
+}
+
+func (s *server) nodes(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ns := []node{}
+	for _, x := range s.ring.View().Items() {
+		weight, _ := s.ring.Weight(x)
+		ns = append(ns, node{string(x.(gossip.Member)), weight})
+	}
+	reply(w, ns)
+}
+
+func (s *server) node(w http.ResponseWriter, req *http.Request) {
+	var (
+		path        = strings.TrimPrefix(req.URL.Path, "/nodes/")
+		name, op, _ = cut(path, "/")
+		err         error
+	)
+	if name == "" {
+		http.NotFound(w, req)
+		return
+	}
+	switch {
+	case op == "" && req.Method == http.MethodPut:
+		weight := 1.0
+		if v := req.URL.Query().Get("weight"); v != "" {
+			weight, err = strconv.ParseFloat(v, 64)
+			if err != nil || weight <= 0 {
+				http.Error(w, "malformed weight", http.StatusBadRequest)
+				return
+			}
+		}
+		err = s.update(name, weight, gossip.StateAlive)
+	case op == "" && req.Method == http.MethodDelete:
+		err = s.update(name, 0, gossip.StateLeft)
+	case op == "drain" && req.Method == http.MethodPost:
+		err = s.update(name, 0, gossip.StateSuspect)
+	case op == "" || op == "drain":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// update applies the state of the node named name. If weight is zero, the
+// last nominal weight of the node is used.
+func (s *server) update(name string, weight float64, state gossip.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if weight == 0 {
+		var has bool
+		weight, has = s.weights[name]
+		if !has {
+			return fmt.Errorf("node %q doesn't exist", name)
+		}
+	}
+	err := s.membership.Update(gossip.Node{
+		Name:   name,
+		State:  state,
+		Weight: weight,
+	})
+	if err != nil {
+		return err
+	}
+	if state == gossip.StateLeft {
+		delete(s.weights, name)
+	} else {
+		s.weights[name] = weight
+	}
+	return nil
+}
+
+func (s *server) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		w := 1.0
+		switch len(fields) {
+		case 1:
+		case 2:
+			w, err = strconv.ParseFloat(fields[1], 64)
+			if err == nil && w <= 0 {
+				err = fmt.Errorf("weight must be greater than zero")
+			}
+		default:
+			err = fmt.Errorf("too many fields")
+		}
+		if err == nil {
+			err = s.update(fields[0], w, gossip.StateAlive)
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+	return sc.Err()
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("can't write reply: %v", err)
+	}
+}
+
+// cut is the same as strings.Cut() which is not available in older Go
+// versions.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
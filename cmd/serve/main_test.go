@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gobwas/hashring"
+	"github.com/gobwas/hashring/gossip"
+)
+
+func TestServer(t *testing.T) {
+	s := newServer(new(hashring.Ring), 0.5)
+	h := s.handler()
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+	for _, test := range []struct {
+		method string
+		target string
+		status int
+	}{
+		{"PUT", "/nodes/foo", http.StatusNoContent},
+		{"PUT", "/nodes/bar?weight=3", http.StatusNoContent},
+		{"PUT", "/nodes/baz?weight=2", http.StatusNoContent},
+		{"PUT", "/nodes/baz?weight=x", http.StatusBadRequest},
+		{"PUT", "/nodes/baz?weight=-1", http.StatusBadRequest},
+		{"POST", "/nodes/bar/drain", http.StatusNoContent},
+		{"POST", "/nodes/qux/drain", http.StatusConflict},
+		{"DELETE", "/nodes/baz", http.StatusNoContent},
+		{"DELETE", "/nodes/baz", http.StatusConflict},
+		{"GET", "/nodes/foo", http.StatusMethodNotAllowed},
+		{"GET", "/nodes/foo/drain", http.StatusMethodNotAllowed},
+		{"POST", "/nodes/foo/bar", http.StatusNotFound},
+		{"PUT", "/nodes/", http.StatusNotFound},
+		{"POST", "/nodes", http.StatusMethodNotAllowed},
+		{"POST", "/owners?key=k", http.StatusMethodNotAllowed},
+		{"GET", "/owners", http.StatusBadRequest},
+		{"GET", "/owners?key=k&n=0", http.StatusBadRequest},
+		{"GET", "/owners?key=k&n=x", http.StatusBadRequest},
+	} {
+		if rec := do(test.method, test.target); rec.Code != test.status {
+			t.Fatalf(
+				"%s %s: unexpected status: %d; want %d (%s)",
+				test.method, test.target, rec.Code, test.status, rec.Body,
+			)
+		}
+	}
+
+	var ns []node
+	rec := do("GET", "/nodes")
+	if err := json.Unmarshal(rec.Body.Bytes(), &ns); err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]float64{
+		"foo": 1,
+		"bar": 1.5,
+	}
+	act := make(map[string]float64, len(ns))
+	for _, n := range ns {
+		act[n.Name] = n.Weight
+	}
+	if !reflect.DeepEqual(act, exp) {
+		t.Fatalf("unexpected nodes: %v; want %v", act, exp)
+	}
+
+	var owners struct {
+		Key    string   `json:"key"`
+		Owners []string `json:"owners"`
+	}
+	rec = do("GET", "/owners?key=k&n=5")
+	if err := json.Unmarshal(rec.Body.Bytes(), &owners); err != nil {
+		t.Fatal(err)
+	}
+	if owners.Key != "k" || len(owners.Owners) != 2 {
+		t.Fatalf("unexpected owners: %+v", owners)
+	}
+	if x := s.ring.Get(gossip.Member(owners.Key)); string(x.(gossip.Member)) != owners.Owners[0] {
+		t.Fatalf("unexpected first owner: %q; want %q", owners.Owners[0], x)
+	}
+
+	// Drained node gets its nominal weight back.
+	if rec := do("PUT", "/nodes/bar?weight=3"); rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if w, _ := s.ring.Weight(gossip.Member("bar")); w != 3 {
+		t.Fatalf("unexpected weight of restored node: %v; want 3", w)
+	}
+}
+
+func TestServerLoad(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		name string
+		data string
+		exp  map[string]float64
+		err  bool
+	}{
+		{
+			name: "ok",
+			data: "# nodes\nfoo\n\nbar 2\n",
+			exp: map[string]float64{
+				"foo": 1,
+				"bar": 2,
+			},
+		},
+		{
+			name: "malformed weight",
+			data: "foo x\n",
+			err:  true,
+		},
+		{
+			name: "zero weight",
+			data: "foo 0\n",
+			err:  true,
+		},
+		{
+			name: "too many fields",
+			data: "foo 1 2\n",
+			err:  true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "members.txt")
+			if err := os.WriteFile(path, []byte(test.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			s := newServer(new(hashring.Ring), 0.5)
+			err := s.load(path)
+			if test.err {
+				if err == nil {
+					t.Fatalf("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(s.weights, test.exp) {
+				t.Fatalf("unexpected weights: %v; want %v", s.weights, test.exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package hashring
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// CollisionPolicy describes how the ring resolves collisions of its points,
+// that is, the case when points of different items (or different points of
+// the same item) get the same hash value.
+type CollisionPolicy int
+
+const (
+	// CollisionRehash moves all collided points to the next generation, that
+	// is, recalculates their values with incremented generation until there
+	// are no collisions. All points stay on the ring and the resulting ring
+	// doesn't depend on the order of insertions.
+	//
+	// This is the default policy.
+	CollisionRehash CollisionPolicy = iota
+
+	// CollisionTieBreak keeps on the ring only the point of the item having
+	// the least digest (or the point having the least index, if points
+	// belong to the same item) among the collided points. Other points are
+	// hidden until the winning point is removed from the ring.
+	//
+	// Points never change their values under this policy, which makes it
+	// possible to build rings compatible with implementations having no
+	// notion of generations.
+	CollisionTieBreak
+
+	// CollisionError makes ring mutation methods to return an error if
+	// mutation leads to collision of points. The ring is left unchanged in
+	// that case.
+	CollisionError
+
+	// CollisionStable keeps all collided points on the ring and orders them
+	// by (value, item digest, index). That is, points with equal values are
+	// placed one after another and the one of the item having the least
+	// digest (or the one having the least index) owns the keys preceding
+	// them. Thus mapping is the same as under CollisionTieBreak policy, but
+	// collided points are still visited by GetN() and iteration methods.
+	//
+	// Points never change their values under this policy and no collision
+	// bookkeeping is needed, which makes rebuilds cheaper and mapping much
+	// simpler to port to other languages. The tradeoff is that collided
+	// points (which are rare for 64-bit hash functions) own no keys, so
+	// their items get slightly less keys than expected.
+	CollisionStable
+)
+
+func (c CollisionPolicy) String() string {
+	switch c {
+	case CollisionRehash:
+		return "rehash"
+	case CollisionTieBreak:
+		return "tie-break"
+	case CollisionError:
+		return "error"
+	case CollisionStable:
+		return "stable"
+	default:
+		return fmt.Sprintf("CollisionPolicy(%d)", int(c))
+	}
+}
+
+// checkCollisions returns non-nil error if points which are going to be added
+// to the tree by r.build() collide with each other or with points remaining on
+// the tree.
+//
+// r.mu must be held.
+func (r *Ring) checkCollisions(h *hasher, root avl.Tree, buckets map[uint64]*bucket) error {
+	size := r.numPoints()
+	seen := make(map[value]bool)
+	for _, b := range buckets {
+		n := size(b)
+		if len(b.points) >= n {
+			continue
+		}
+		sum, err := r.keySum(h, b)
+		if err != nil {
+			return err
+		}
+		for i := len(b.points); i < n; i++ {
+			v := sum(r.suffix(b.item, 0, i))
+			if seen[v] {
+				return fmt.Errorf("hashring: points collision")
+			}
+			seen[v] = true
+
+			x := root.Search(search(v))
+			if x == nil {
+				continue
+			}
+			// Collision with the point which is going to be removed is not a
+			// collision.
+			if p := x.(*point); p.index < size(p.bucket) {
+				return fmt.Errorf("hashring: points collision")
+			}
+		}
+	}
+	return nil
+}
+
+// insertPointTieBreak inserts p into the tree under CollisionTieBreak policy.
+//
+// r.mu must be held.
+func (r *Ring) insertPointTieBreak(tree avl.Tree, p *point) (_ avl.Tree, inserted bool) {
+	c := r.collisions[p.value()]
+	if c.Size() == 0 {
+		var existing avl.Item
+		tree, existing = tree.Insert(p)
+		if existing == nil {
+			return tree, true
+		}
+		c = mustInsertTree(c, collision{existing.(*point)})
+	}
+	r.collided(p, c.Min().(collision).point)
+	if r.collisions == nil {
+		r.collisions = make(map[value]avl.Tree)
+	}
+	c = mustInsertTree(c, collision{p})
+	r.collisions[p.value()] = c
+
+	if c.Min().(collision).point != p {
+		return tree, false
+	}
+	// Replace the previous winner.
+	tree, _ = tree.Delete(p)
+	tree = mustInsertTree(tree, p)
+
+	return tree, true
+}
+
+// deletePointTieBreak deletes p from the tree under CollisionTieBreak policy.
+//
+// r.mu must be held.
+func (r *Ring) deletePointTieBreak(tree avl.Tree, p *point) (_ avl.Tree, removed bool) {
+	c, has := r.collisions[p.value()]
+	if !has {
+		var item avl.Item
+		tree, item = tree.Delete(p)
+		return tree, item != nil
+	}
+	winner := c.Min().(collision).point == p
+	c = mustDeleteTree(c, collision{p})
+	if c.Size() > 1 {
+		r.collisions[p.value()] = c
+	} else {
+		delete(r.collisions, p.value())
+	}
+	if !winner {
+		return tree, false
+	}
+	tree = mustDeleteTree(tree, p)
+	tree = mustInsertTree(tree, c.Min().(collision).point)
+
+	return tree, true
+}
+
+// CollisionReport describes collisions of the ring points. See
+// Ring.CollisionReport() for details.
+type CollisionReport struct {
+	// Collisions holds collisions of the ring points ordered by the values
+	// points collided at.
+	Collisions []Collision
+
+	// Generations holds the number of the ring points per generation, that
+	// is, Generations[g] is the number of points having generation g.
+	// Points having non-zero generations were moved due to collisions (see
+	// CollisionRehash).
+	Generations []int
+}
+
+// Collision describes points collided at the same value.
+type Collision struct {
+	// Value is the value points collided at.
+	// For rings operating in 128-bit hash space it holds the high 64 bits of
+	// the value.
+	Value uint64
+
+	// Points holds the collided points ordered by their items digests and
+	// indexes. Note that under CollisionRehash policy the values of the
+	// points differ from Value, since points were moved to the next
+	// generations.
+	Points []PointInfo
+}
+
+// CollisionReport returns collisions of the ring points along with the
+// distribution of points generations.
+//
+// Collisions are practically impossible for good 64-bit hash functions, thus
+// a few of them are accidents, while lots of collisions or points having
+// large generations mean that the hash function (or Suffix) is weak for the
+// ring's items.
+//
+// Note that CollisionReport blocks write operations on the ring while
+// running.
+func (r *Ring) CollisionReport() CollisionReport {
+	r.lock()
+	defer r.mu.Unlock()
+
+	var rep CollisionReport
+	for _, b := range r.buckets {
+		for _, p := range b.points {
+			for len(rep.Generations) <= p.generation() {
+				rep.Generations = append(rep.Generations, 0)
+			}
+			rep.Generations[p.generation()]++
+		}
+	}
+	if r.conf.Collision == CollisionStable {
+		rep.Collisions = stableCollisions(r.current().tree)
+		return rep
+	}
+	for v, c := range r.collisions {
+		col := Collision{
+			Value:  v.hi,
+			Points: make([]PointInfo, 0, c.Size()),
+		}
+		c.InOrder(func(x avl.Item) bool {
+			col.Points = append(col.Points, x.(collision).point.info())
+			return true
+		})
+		rep.Collisions = append(rep.Collisions, col)
+	}
+	sort.Slice(rep.Collisions, func(i, j int) bool {
+		return rep.Collisions[i].Value < rep.Collisions[j].Value
+	})
+	return rep
+}
+
+// stableCollisions returns collisions of the points placed one after another
+// under CollisionStable policy.
+func stableCollisions(tree avl.Tree) []Collision {
+	var (
+		cs   []Collision
+		prev *point
+		run  bool
+	)
+	tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		switch {
+		case prev == nil || prev.val != p.val:
+			run = false
+		case !run:
+			run = true
+			cs = append(cs, Collision{
+				Value:  p.val.hi,
+				Points: []PointInfo{prev.info(), p.info()},
+			})
+		default:
+			c := &cs[len(cs)-1]
+			c.Points = append(c.Points, p.info())
+		}
+		prev = p
+		return true
+	})
+	return cs
+}
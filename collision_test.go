@@ -0,0 +1,71 @@
+package hashring
+
+import (
+	"hash"
+	"strconv"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestRingCollisionReport(t *testing.T) {
+	for _, policy := range []CollisionPolicy{
+		CollisionRehash,
+		CollisionTieBreak,
+		CollisionStable,
+	} {
+		t.Run(policy.String(), func(t *testing.T) {
+			r := Ring{
+				Hash: func() hash.Hash64 {
+					return maskHash{xxhash.New(), 0xfff}
+				},
+				MagicFactor: 16,
+				Collision:   policy,
+			}
+			var points int
+			for i := 0; i < 16; i++ {
+				x := StringItem("item-" + strconv.Itoa(i))
+				if err := r.Insert(x, 1); err != nil {
+					t.Fatal(err)
+				}
+				points += len(r.PointsOf(x))
+			}
+			rep := r.CollisionReport()
+			if len(rep.Collisions) == 0 {
+				t.Fatalf("no collisions reported")
+			}
+			if policy != CollisionStable {
+				if act, exp := len(rep.Collisions), r.expvarStats().Collisions; act != exp {
+					t.Fatalf("unexpected number of collisions: %d; want %d", act, exp)
+				}
+			}
+			for i, c := range rep.Collisions {
+				if i > 0 && rep.Collisions[i-1].Value >= c.Value {
+					t.Fatalf("collisions are not ordered by value")
+				}
+				if len(c.Points) < 2 {
+					t.Fatalf("collision at %x has %d points", c.Value, len(c.Points))
+				}
+				for _, p := range c.Points {
+					moved := p.Value != c.Value
+					if moved != (policy == CollisionRehash) {
+						t.Fatalf(
+							"unexpected value of point collided at %x: %x",
+							c.Value, p.Value,
+						)
+					}
+				}
+			}
+			var total int
+			for _, n := range rep.Generations {
+				total += n
+			}
+			if total != points {
+				t.Fatalf("generations cover %d points; want %d", total, points)
+			}
+			if moved := len(rep.Generations) > 1; moved != (policy == CollisionRehash) {
+				t.Fatalf("unexpected generations: %v", rep.Generations)
+			}
+		})
+	}
+}
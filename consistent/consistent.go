@@ -0,0 +1,163 @@
+// Package consistent provides a drop-in replacement of the
+// github.com/stathat/consistent package backed by the hashring.Ring.
+//
+// Unlike the original package, Consistent handles hash collisions of the
+// replicas. Note that elements are mapped differently than by the original
+// package.
+package consistent
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+
+	"github.com/gobwas/hashring"
+)
+
+// ErrEmptyCircle is the error returned when trying to get an element when
+// nothing has been added to hash.
+var ErrEmptyCircle = errors.New("empty circle")
+
+// Consistent holds the information about the members of the consistent hash
+// circle.
+//
+// Consistent is goroutine safe.
+type Consistent struct {
+	// NumberOfReplicas is the number of points of each element on the
+	// circle. It must not be changed after first use.
+	NumberOfReplicas int
+
+	// UseFnv makes circle to use FNV-1a hash function instead of the default
+	// one. It must not be changed after first use.
+	UseFnv bool
+
+	once sync.Once
+	ring hashring.Ring
+
+	// mu serializes changes of the circle, so Set() doesn't stage changes
+	// made by concurrent Add() or Remove() calls.
+	mu sync.Mutex
+}
+
+// New creates a new Consistent object with a default setting of 20 replicas
+// for each entry.
+func New() *Consistent {
+	return &Consistent{
+		NumberOfReplicas: 20,
+	}
+}
+
+// Add inserts a string element in the consistent hash.
+func (c *Consistent) Add(elt string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Error is returned only for already added elements.
+	_ = c.circle().Insert(member(elt), 1)
+}
+
+// Remove removes an element from the hash.
+func (c *Consistent) Remove(elt string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.circle().Delete(member(elt))
+}
+
+// Set sets all the elements in the hash. If there are existing elements not
+// present in elts, they will be removed.
+// It panics if the circle can't be rebuilt (see hashring.Ring.Apply()), since
+// the original API has no way to report errors. The circle is left unchanged
+// in that case.
+func (c *Consistent) Set(elts []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := c.circle()
+	err := r.Apply(func() error {
+		next := make(map[string]bool, len(elts))
+		for _, elt := range elts {
+			next[elt] = true
+		}
+		for _, x := range r.View().Items() {
+			if !next[string(x.(member))] {
+				_ = r.Delete(x)
+			}
+		}
+		for elt := range next {
+			_ = r.Insert(member(elt), 1)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("consistent: can't rebuild the circle: %v", err))
+	}
+}
+
+// Members returns elements of the hash.
+func (c *Consistent) Members() []string {
+	items := c.circle().View().Items()
+	ms := make([]string, len(items))
+	for i, x := range items {
+		ms[i] = string(x.(member))
+	}
+	return ms
+}
+
+// Get returns an element close to where name hashes to in the circle.
+func (c *Consistent) Get(name string) (string, error) {
+	x := c.circle().Get(member(name))
+	if x == nil {
+		return "", ErrEmptyCircle
+	}
+	return string(x.(member)), nil
+}
+
+// GetTwo returns the two closest distinct elements to the name input in the
+// circle. If there is only one element, the second one is empty.
+func (c *Consistent) GetTwo(name string) (string, string, error) {
+	xs, err := c.GetN(name, 2)
+	if err != nil {
+		return "", "", err
+	}
+	if len(xs) == 1 {
+		return xs[0], "", nil
+	}
+	return xs[0], xs[1], nil
+}
+
+// GetN returns the n closest distinct elements to the name input in the
+// circle. If there are less than n elements, all of them are returned.
+// If n is less or equal to zero, no elements are returned.
+func (c *Consistent) GetN(name string, n int) ([]string, error) {
+	r := c.circle()
+	xs := r.GetN(member(name), n)
+	if len(xs) == 0 {
+		if n <= 0 && r.Len() > 0 {
+			return nil, nil
+		}
+		return nil, ErrEmptyCircle
+	}
+	ms := make([]string, len(xs))
+	for i, x := range xs {
+		ms[i] = string(x.(member))
+	}
+	return ms, nil
+}
+
+func (c *Consistent) circle() *hashring.Ring {
+	c.once.Do(func() {
+		c.ring.MagicFactor = c.NumberOfReplicas
+		if c.UseFnv {
+			c.ring.Hash = fnv.New64a
+		}
+	})
+	return &c.ring
+}
+
+type member string
+
+func (m member) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(m))
+	return int64(n), err
+}
@@ -0,0 +1,74 @@
+package consistent
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConsistent(t *testing.T) {
+	c := New()
+	if _, err := c.Get("key"); err != ErrEmptyCircle {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrEmptyCircle)
+	}
+	c.Add("a")
+	a, b, err := c.GetTwo("key")
+	if err != nil || a != "a" || b != "" {
+		t.Fatalf("GetTwo() = %q, %q, %v; want %q, %q, nil", a, b, err, "a", "")
+	}
+	c.Set([]string{"b", "c", "d"})
+	ms := c.Members()
+	sort.Strings(ms)
+	if exp := []string{"b", "c", "d"}; !reflect.DeepEqual(ms, exp) {
+		t.Fatalf("unexpected members: %v; want %v", ms, exp)
+	}
+	xs, err := c.GetN("key", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(xs) != 3 {
+		t.Fatalf("unexpected GetN() result: %v", xs)
+	}
+	if xs, err := c.GetN("key", 0); xs != nil || err != nil {
+		t.Fatalf("GetN(0) = %v, %v; want nil, nil", xs, err)
+	}
+	if x, _ := c.Get("key"); x != xs[0] {
+		t.Fatalf("Get() = %q; want first of GetN() %q", x, xs[0])
+	}
+	c.Remove(xs[0])
+	if x, _ := c.Get("key"); x != xs[1] {
+		t.Fatalf("Get() after Remove() = %q; want %q", x, xs[1])
+	}
+}
+
+func TestConsistentConcurrentSet(t *testing.T) {
+	c := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Set([]string{"a", "b"})
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			elt := "x" + strconv.Itoa(i)
+			c.Add(elt)
+			c.Remove(elt)
+		}
+	}()
+	wg.Wait()
+
+	ms := c.Members()
+	sort.Strings(ms)
+	if exp := []string{"a", "b"}; !reflect.DeepEqual(ms, exp) {
+		t.Fatalf("unexpected members: %v; want %v", ms, exp)
+	}
+}
@@ -0,0 +1,129 @@
+// Package consistenthash provides an adapter exposing the API of the
+// github.com/golang/groupcache/consistenthash package backed by the
+// hashring.Ring.
+//
+// Unlike the original package, Map handles hash collisions of the replicas
+// and allows keys to be weighted and removed. Note that keys are mapped
+// differently than by the original package.
+package consistenthash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/gobwas/hashring"
+)
+
+// Hash maps bytes to uint32.
+type Hash func(data []byte) uint32
+
+// Map contains all hashed keys.
+//
+// Map is goroutine safe.
+type Map struct {
+	ring hashring.Ring
+
+	// mu serializes changes of the ring, so concurrent Add() and Remove()
+	// calls don't apply changes made by each other.
+	mu sync.Mutex
+}
+
+// New creates a new Map with given number of replicas (points) per key and
+// hash function. If fn is nil, the default hash function of the ring is used.
+func New(replicas int, fn Hash) *Map {
+	m := new(Map)
+	m.ring.MagicFactor = replicas
+	if fn != nil {
+		m.ring.Hash = func() hash.Hash64 {
+			return &hash32{fn: fn}
+		}
+	}
+	return m
+}
+
+// IsEmpty returns true if there are no items available.
+func (m *Map) IsEmpty() bool {
+	return m.ring.Len() == 0
+}
+
+// Add adds some keys to the hash. Keys which are already added are ignored.
+func (m *Map) Add(keys ...string) {
+	m.AddWeighted(1, keys...)
+}
+
+// AddWeighted adds some keys with weight w to the hash. Keys which are
+// already added are ignored.
+// It panics if the hash can't be rebuilt (see hashring.Ring.Apply()).
+func (m *Map) AddWeighted(w float64, keys ...string) {
+	m.apply(func() {
+		for _, k := range keys {
+			// Error is returned only for already added keys.
+			_ = m.ring.Insert(key(k), w)
+		}
+	})
+}
+
+// Remove removes some keys from the hash. Keys which don't exist are
+// ignored.
+// It panics if the hash can't be rebuilt (see hashring.Ring.Apply()).
+func (m *Map) Remove(keys ...string) {
+	m.apply(func() {
+		for _, k := range keys {
+			m.ring.Delete(key(k))
+		}
+	})
+}
+
+// apply rebuilds the ring once after changes made by fn. The original API has
+// no way to report errors, so it panics on failure, leaving the ring
+// unchanged.
+func (m *Map) apply(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.ring.Apply(func() error {
+		fn()
+		return nil
+	})
+	if err != nil {
+		panic(fmt.Sprintf("consistenthash: can't rebuild the ring: %v", err))
+	}
+}
+
+// Get gets the closest item in the hash to the provided key.
+// It returns empty string if the hash is empty.
+func (m *Map) Get(k string) string {
+	x := m.ring.Get(key(k))
+	if x == nil {
+		return ""
+	}
+	return string(x.(key))
+}
+
+type key string
+
+func (k key) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(k))
+	return int64(n), err
+}
+
+// hash32 adapts 32-bit Hash function to the hash.Hash64 interface.
+type hash32 struct {
+	fn  Hash
+	buf bytes.Buffer
+}
+
+func (h *hash32) Write(p []byte) (int, error) { return h.buf.Write(p) }
+func (h *hash32) Reset()                      { h.buf.Reset() }
+func (h *hash32) Size() int                   { return 8 }
+func (h *hash32) BlockSize() int              { return 1 }
+func (h *hash32) Sum64() uint64               { return uint64(h.fn(h.buf.Bytes())) }
+
+func (h *hash32) Sum(b []byte) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], h.Sum64())
+	return append(b, buf[:]...)
+}
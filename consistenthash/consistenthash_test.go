@@ -0,0 +1,64 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	for _, fn := range []Hash{nil, crc32.ChecksumIEEE} {
+		m := New(50, fn)
+		if !m.IsEmpty() {
+			t.Fatalf("new map is not empty")
+		}
+		if k := m.Get("key"); k != "" {
+			t.Fatalf("unexpected key of empty map: %q", k)
+		}
+		m.Add("a", "b", "c", "a")
+		if m.IsEmpty() {
+			t.Fatalf("map is empty after Add()")
+		}
+		before := make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			k := strconv.Itoa(i)
+			before[k] = m.Get(k)
+		}
+		m.Remove("b")
+		for k, v := range before {
+			act := m.Get(k)
+			switch {
+			case act == "b":
+				t.Fatalf("removed key is still returned")
+			case v != "b" && act != v:
+				t.Fatalf("key %q moved from %q to %q", k, v, act)
+			}
+		}
+	}
+}
+
+func TestMapConcurrentChanges(t *testing.T) {
+	m := New(50, nil)
+	m.Add("a", "b")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				k := strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				m.Add(k)
+				m.Remove(k)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 100; i++ {
+		if k := m.Get(strconv.Itoa(i)); k != "a" && k != "b" {
+			t.Fatalf("unexpected key: %q", k)
+		}
+	}
+}
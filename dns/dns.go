@@ -0,0 +1,224 @@
+// Package dns keeps membership of a hashring in sync with DNS records.
+package dns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gobwas/hashring"
+)
+
+// Resolver is the interface used to resolve DNS records.
+// It is implemented by *net.Resolver.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Target is an item of the ring which represents a resolved "host:port"
+// address.
+type Target string
+
+// WriteTo implements hashring.Item interface.
+func (t Target) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(t))
+	return int64(n), err
+}
+
+// Refresher periodically resolves DNS name and reconciles the ring against
+// the answer set.
+//
+// If Port is zero, Name is resolved as a SRV record. Otherwise Name is
+// resolved as a host name into A/AAAA records, each of which gets weight of 1
+// and the given Port.
+//
+// Refresher is goroutine safe. Refresher instances must not be copied.
+type Refresher struct {
+	// Ring is a ring which membership is maintained. It must not be nil.
+	// Ring must not be mutated by others while used by the Refresher.
+	Ring *hashring.Ring
+
+	// Name is a DNS name to resolve, e.g. "_memcache._tcp.example.com".
+	Name string
+
+	// Port is an optional port of the targets resolved from A/AAAA records.
+	Port int
+
+	// Weight is an optional function returning weight of the SRV record's
+	// target on the ring. Records having zero weight are skipped.
+	// If Weight is nil, only the records with the lowest priority are used
+	// and their weights are taken from the record's weight field (records
+	// having zero weight get weight of 1).
+	Weight func(*net.SRV) float64
+
+	// Resolver is an optional resolver used to resolve Name.
+	// If Resolver is nil, then net.DefaultResolver is used.
+	Resolver Resolver
+
+	// Interval is an interval between refreshes made by Run().
+	// If Interval is zero, then DefaultInterval is used.
+	Interval time.Duration
+
+	// OnError is an optional function called by Run() when refresh fails.
+	OnError func(error)
+
+	mu      sync.Mutex
+	targets map[Target]float64
+}
+
+// DefaultInterval is the default interval between refreshes.
+const DefaultInterval = 30 * time.Second
+
+// Run calls Refresh() with r.Interval intervals until ctx is done.
+// It returns the ctx error.
+func (r *Refresher) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := r.Refresh(ctx); err != nil && r.OnError != nil {
+			r.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Refresh resolves r.Name and reconciles the ring against the answer set.
+// The ring is rebuilt once per Refresh() call.
+// It returns non-nil error if resolution fails, the answer set is empty or
+// the ring can't be changed (see hashring.Ring.Commit()). In that case the
+// ring is left unchanged.
+func (r *Refresher) Refresh(ctx context.Context) (err error) {
+	next, err := r.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(next) == 0 {
+		return fmt.Errorf("dns: no targets resolved for %q", r.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev := r.targets
+	r.targets = make(map[Target]float64, len(next))
+	for t, w := range prev {
+		r.targets[t] = w
+	}
+	err = r.Ring.Apply(func() error {
+		for t := range prev {
+			if _, has := next[t]; has {
+				continue
+			}
+			if err := r.set(t, 0); err != nil {
+				return err
+			}
+		}
+		for t, w := range next {
+			if err := r.set(t, w); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.targets = prev
+	}
+	return err
+}
+
+// set changes weight of the target on the ring to w.
+//
+// r.mu must be held.
+func (r *Refresher) set(t Target, w float64) (err error) {
+	cur := r.targets[t]
+	switch {
+	case w == cur:
+		return nil
+	case w == 0:
+		err = r.Ring.Delete(t)
+	case cur == 0:
+		err = r.Ring.Insert(t, w)
+	default:
+		err = r.Ring.Update(t, w)
+	}
+	if err != nil {
+		return err
+	}
+	if w == 0 {
+		delete(r.targets, t)
+	} else {
+		r.targets[t] = w
+	}
+	return nil
+}
+
+func (r *Refresher) resolve(ctx context.Context) (map[Target]float64, error) {
+	var res Resolver = net.DefaultResolver
+	if r.Resolver != nil {
+		res = r.Resolver
+	}
+	if r.Port != 0 {
+		addrs, err := res.LookupIPAddr(ctx, r.Name)
+		if err != nil {
+			return nil, err
+		}
+		ts := make(map[Target]float64, len(addrs))
+		for _, a := range addrs {
+			t := net.JoinHostPort(a.String(), strconv.Itoa(r.Port))
+			ts[Target(t)] = 1
+		}
+		return ts, nil
+	}
+	_, srvs, err := res.LookupSRV(ctx, "", "", r.Name)
+	if err != nil {
+		return nil, err
+	}
+	weight := r.Weight
+	if weight == nil {
+		weight = priorityWeight(srvs)
+	}
+	ts := make(map[Target]float64, len(srvs))
+	for _, srv := range srvs {
+		w := weight(srv)
+		if w <= 0 {
+			continue
+		}
+		t := net.JoinHostPort(srv.Target, strconv.Itoa(int(srv.Port)))
+		ts[Target(t)] += w
+	}
+	return ts, nil
+}
+
+// priorityWeight returns weight function which accepts only the records
+// having the lowest priority among srvs.
+func priorityWeight(srvs []*net.SRV) func(*net.SRV) float64 {
+	var min uint16
+	for i, srv := range srvs {
+		if i == 0 || srv.Priority < min {
+			min = srv.Priority
+		}
+	}
+	return func(srv *net.SRV) float64 {
+		switch {
+		case srv.Priority != min:
+			return 0
+		case srv.Weight == 0:
+			return 1
+		default:
+			return float64(srv.Weight)
+		}
+	}
+}
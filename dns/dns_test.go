@@ -0,0 +1,169 @@
+package dns
+
+import (
+	"context"
+	"hash"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/gobwas/hashring"
+)
+
+type resolver struct {
+	srvs  []*net.SRV
+	addrs []net.IPAddr
+}
+
+func (r *resolver) LookupSRV(context.Context, string, string, string) (string, []*net.SRV, error) {
+	return "", r.srvs, nil
+}
+
+func (r *resolver) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	return r.addrs, nil
+}
+
+func TestRefresherSRV(t *testing.T) {
+	var (
+		ring hashring.Ring
+		res  = &resolver{
+			srvs: []*net.SRV{
+				{Target: "a.example.com.", Port: 11211, Priority: 10, Weight: 5},
+				{Target: "b.example.com.", Port: 11211, Priority: 10, Weight: 0},
+				{Target: "c.example.com.", Port: 11211, Priority: 20, Weight: 5},
+			},
+		}
+		r = Refresher{
+			Ring:     &ring,
+			Name:     "_memcache._tcp.example.com",
+			Resolver: res,
+		}
+	)
+	if err := r.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertWeights(t, &ring, map[Target]float64{
+		"a.example.com.:11211": 5,
+		"b.example.com.:11211": 1,
+	})
+
+	res.srvs = res.srvs[1:]
+	if err := r.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertWeights(t, &ring, map[Target]float64{
+		"b.example.com.:11211": 1,
+	})
+
+	res.srvs = nil
+	if err := r.Refresh(context.Background()); err == nil {
+		t.Fatalf("want error on empty answer")
+	}
+	assertWeights(t, &ring, map[Target]float64{
+		"b.example.com.:11211": 1,
+	})
+}
+
+func TestRefresherHost(t *testing.T) {
+	var (
+		ring hashring.Ring
+		r    = Refresher{
+			Ring: &ring,
+			Name: "memcache.example.com",
+			Port: 11211,
+			Resolver: &resolver{
+				addrs: []net.IPAddr{
+					{IP: net.ParseIP("10.0.0.1")},
+					{IP: net.ParseIP("::1")},
+				},
+			},
+		}
+	)
+	if err := r.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertWeights(t, &ring, map[Target]float64{
+		"10.0.0.1:11211": 1,
+		"[::1]:11211":    1,
+	})
+}
+
+// maskHash makes the ring points collide often.
+type maskHash struct {
+	hash.Hash64
+	mask uint64
+}
+
+func (h maskHash) Sum64() uint64 {
+	return h.Hash64.Sum64() & h.mask
+}
+
+func TestRefresherError(t *testing.T) {
+	var (
+		ring = hashring.Ring{
+			Hash: func() hash.Hash64 {
+				return maskHash{fnv.New64a(), 0xfff}
+			},
+			MagicFactor: 16,
+			Collision:   hashring.CollisionError,
+		}
+		res = &resolver{
+			srvs: []*net.SRV{
+				{Target: "a.example.com.", Port: 11211, Weight: 1},
+				{Target: "b.example.com.", Port: 11211, Weight: 1},
+			},
+		}
+		r = Refresher{
+			Ring:     &ring,
+			Name:     "_memcache._tcp.example.com",
+			Resolver: res,
+		}
+	)
+	if err := r.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	initial := res.srvs
+	for i := 0; ; i++ {
+		if i == 1000 {
+			t.Skip("no colliding target found")
+		}
+		res.srvs = []*net.SRV{
+			initial[1],
+			{Target: "node-" + strconv.Itoa(i) + ".", Port: 11211, Weight: 2},
+		}
+		if err := r.Refresh(context.Background()); err != nil {
+			break
+		}
+		// Restore the initial state and try again.
+		res.srvs = initial
+		if err := r.Refresh(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertWeights(t, &ring, map[Target]float64{
+		"a.example.com.:11211": 1,
+		"b.example.com.:11211": 1,
+	})
+
+	// Ring must not be left in deferred mode and targets must be restored.
+	res.srvs = initial[:1]
+	if err := r.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertWeights(t, &ring, map[Target]float64{
+		"a.example.com.:11211": 1,
+	})
+}
+
+func assertWeights(t *testing.T, r *hashring.Ring, exp map[Target]float64) {
+	t.Helper()
+	if n := r.Len(); n != len(exp) {
+		t.Fatalf("unexpected number of ring items: %d; want %d", n, len(exp))
+	}
+	for x, w := range exp {
+		if act, _ := r.Weight(x); act != w {
+			t.Errorf("unexpected weight of %q: %v; want %v", x, act, w)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package hashring
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// WriteDOT writes the ring in Graphviz DOT format to w. Each item is rendered
+// as a box connected to its points; points on the ring are connected
+// clockwise and points which values collided are connected to the collision
+// node. Points hidden by CollisionTieBreak policy are rendered dashed.
+//
+// It's intended for debugging and visualization of small rings.
+// Note that WriteDOT blocks write operations on the ring while running.
+func (r *Ring) WriteDOT(w io.Writer) error {
+	r.lock()
+	defer r.mu.Unlock()
+
+	var (
+		bw   = bufio.NewWriter(w)
+		tree = r.current().tree
+		buf  bytes.Buffer
+	)
+	ids := make([]uint64, 0, len(r.buckets))
+	for id := range r.buckets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	onRing := make(map[*point]bool, tree.Size())
+	tree.InOrder(func(x avl.Item) bool {
+		onRing[x.(*point)] = true
+		return true
+	})
+
+	fmt.Fprintln(bw, "digraph hashring {")
+	for _, id := range ids {
+		b := r.buckets[id]
+		buf.Reset()
+		if _, err := b.item.WriteTo(&buf); err != nil {
+			return err
+		}
+		fmt.Fprintf(bw,
+			"\tb%d [shape=box, label=%q];\n",
+			id, fmt.Sprintf("%s\nweight %g", buf.String(), b.weight),
+		)
+		for _, p := range b.points {
+			style := "solid"
+			if !onRing[p] {
+				style = "dashed"
+			}
+			fmt.Fprintf(bw,
+				"\t%s [shape=ellipse, style=%s, label=%q];\n",
+				dotPoint(p), style,
+				fmt.Sprintf("%#016x\nindex %d gen %d", p.val.hi, p.index, p.generation()),
+			)
+			fmt.Fprintf(bw, "\tb%d -> %s;\n", id, dotPoint(p))
+		}
+	}
+	var prev *point
+	tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		if prev != nil {
+			fmt.Fprintf(bw, "\t%s -> %s [style=dotted];\n", dotPoint(prev), dotPoint(p))
+		}
+		prev = p
+		return true
+	})
+	if min := tree.Min(); tree.Size() > 1 {
+		fmt.Fprintf(bw,
+			"\t%s -> %s [style=dotted];\n",
+			dotPoint(prev), dotPoint(min.(*point)),
+		)
+	}
+	vs := make([]value, 0, len(r.collisions))
+	for v := range r.collisions {
+		vs = append(vs, v)
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		return vs[i].compare(vs[j]) < 0
+	})
+	for i, v := range vs {
+		fmt.Fprintf(bw,
+			"\tc%d [shape=diamond, color=red, label=%q];\n",
+			i, fmt.Sprintf("collision\n%#016x", v.hi),
+		)
+		r.collisions[v].InOrder(func(x avl.Item) bool {
+			fmt.Fprintf(bw, "\t%s -> c%d [color=red];\n", dotPoint(x.(collision).point), i)
+			return true
+		})
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+func dotPoint(p *point) string {
+	return fmt.Sprintf("p%d_%d", p.bucket.id, p.index)
+}
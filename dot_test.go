@@ -0,0 +1,43 @@
+package hashring
+
+import (
+	"bytes"
+	"hash"
+	"hash/fnv"
+	"strings"
+	"testing"
+)
+
+func TestRingWriteDOT(t *testing.T) {
+	r := Ring{
+		Hash: func() hash.Hash64 {
+			return maskHash{fnv.New64a(), 0xff}
+		},
+		MagicFactor: 32,
+	}
+	for _, s := range []string{"foo", "bar", "baz"} {
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := r.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	if !strings.HasPrefix(dot, "digraph hashring {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Fatalf("malformed graph:\n%s", dot)
+	}
+	for _, s := range []string{
+		`label="foo\nweight 1"`,
+		`[style=dotted]`,
+		`[shape=diamond, color=red`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("graph doesn't contain %s", s)
+		}
+	}
+	if n := strings.Count(dot, "shape=ellipse"); n != r.tree().Size() {
+		t.Errorf("unexpected number of points: %d; want %d", n, r.tree().Size())
+	}
+}
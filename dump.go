@@ -0,0 +1,57 @@
+package hashring
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// Dump writes canonical textual representation of the ring's points to w.
+// Each point is written on its own line in the following format:
+//
+//	<value> <item> <index> <generation>
+//
+// Where value is a zero-padded lowercase hex value of the point (32 digits
+// for rings operating in 128-bit hash space and 16 digits otherwise), item
+// is a Go-quoted string of the item's bytes and index and generation are
+// decimal numbers. Points are written in ascending order of their values.
+//
+// The output depends only on the ring's items, weights and hash settings.
+// That is, it is stable across runs, processes and platforms (as long as
+// Suffix produces the same bytes on them) and doesn't depend on the order of
+// mutations, which makes it suitable to detect drifts between environments
+// by diffing dumps.
+func (r *Ring) Dump(w io.Writer) error {
+	var (
+		s     = r.load()
+		wide  = s.hasher.new128 != nil
+		bw    = bufio.NewWriter(w)
+		buf   bytes.Buffer
+		items = make(map[*bucket]string, len(s.members))
+		err   error
+	)
+	s.tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		item, has := items[p.bucket]
+		if !has {
+			buf.Reset()
+			if _, err = p.bucket.item.WriteTo(&buf); err != nil {
+				return false
+			}
+			item = strconv.Quote(buf.String())
+			items[p.bucket] = item
+		}
+		fmt.Fprintf(bw, "%s %s %d %d\n",
+			formatValue(p.val, wide), item, p.index, p.generation(),
+		)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,71 @@
+package hashring
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"strings"
+	"testing"
+)
+
+func TestRingDump(t *testing.T) {
+	newRing := func() *Ring {
+		return &Ring{
+			Hash: func() hash.Hash64 {
+				return maskHash{fnv.New64a(), 0xff}
+			},
+			MagicFactor: 32,
+		}
+	}
+	items := []string{"foo", "bar", "baz", "qux"}
+	var (
+		r0 = newRing()
+		r1 = newRing()
+	)
+	for i := range items {
+		if err := r0.Insert(StringItem(items[i]), 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := r1.Insert(StringItem(items[len(items)-i-1]), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var d0, d1 bytes.Buffer
+	if err := r0.Dump(&d0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.Dump(&d1); err != nil {
+		t.Fatal(err)
+	}
+	if d0.String() != d1.String() {
+		t.Fatalf("dumps are not equal:\n%s\nvs\n%s", d0.String(), d1.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(d0.String(), "\n"), "\n")
+	if n := r0.tree().Size(); len(lines) != n {
+		t.Fatalf("unexpected number of lines: %d; want %d", len(lines), n)
+	}
+	var (
+		prev  string
+		moved bool
+	)
+	for _, line := range lines {
+		var (
+			v     uint64
+			item  string
+			index int
+			gen   int
+		)
+		if _, err := fmt.Sscanf(line, "%016x %q %d %d", &v, &item, &index, &gen); err != nil {
+			t.Fatalf("malformed line %q: %v", line, err)
+		}
+		if line < prev {
+			t.Fatalf("lines are not ordered: %q goes after %q", line, prev)
+		}
+		prev = line
+		moved = moved || gen > 0
+	}
+	if !moved {
+		t.Fatalf("no collisions provoked")
+	}
+}
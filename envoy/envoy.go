@@ -0,0 +1,172 @@
+// Package envoy provides consistent hashing compatible with the RING_HASH load
+// balancer of the Envoy proxy.
+//
+// Ring places points the same way as Envoy does with xxHash hash function:
+// each host gets its share of the ring size proportional to its weight, and
+// the value of the host's i-th point is xxHash64 of "<address>_<i>" string.
+// Thus Go clients using the Ring route keys to the same hosts as Envoy
+// sidecars configured with the same hosts and ring size bounds.
+//
+// Note that keys are expected to be hashed the same way as by Envoy's hash
+// policy, that is, with xxHash64. Get() does it for the given key, while
+// GetHash() accepts already computed hash value.
+package envoy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Default ring size bounds used by Envoy.
+const (
+	DefaultMinRingSize = 1024
+	DefaultMaxRingSize = 8 * 1024 * 1024
+)
+
+// Host describes an upstream host.
+type Host struct {
+	// Address is the host's address as Envoy prints it, e.g. "10.0.0.1:80".
+	// If Envoy is configured to use hostnames for hashing, Address must
+	// hold the hostname instead.
+	Address string
+
+	// Weight is a load balancing weight of the host.
+	// If Weight is zero, then the weight of 1 is used.
+	Weight uint32
+}
+
+// Ring is an Envoy compatible consistent hashing ring.
+//
+// Ring is goroutine safe. Ring instances must not be copied.
+// The zero value for Ring is an empty ring ready to use.
+type Ring struct {
+	// MinRingSize and MaxRingSize are the optional bounds of the ring size,
+	// which match the minimum_ring_size and maximum_ring_size options of
+	// Envoy's RingHashLbConfig.
+	// If zero, DefaultMinRingSize and DefaultMaxRingSize are used
+	// respectively. They must not be changed after first use.
+	MinRingSize uint64
+	MaxRingSize uint64
+
+	mu   sync.RWMutex
+	ring []entry
+}
+
+type entry struct {
+	hash uint64
+	host string
+}
+
+// SetHosts replaces hosts of the ring. Note that hosts must be given in the
+// same order as Envoy's priority set lists them, since rounding of the hosts
+// shares depends on it.
+// It returns non-nil error if hosts are empty or have duplicate addresses.
+func (r *Ring) SetHosts(hosts []Host) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("envoy: no hosts")
+	}
+	var (
+		sum  float64
+		seen = make(map[string]bool, len(hosts))
+	)
+	for _, h := range hosts {
+		if seen[h.Address] {
+			return fmt.Errorf("envoy: duplicate host address: %q", h.Address)
+		}
+		seen[h.Address] = true
+		sum += weight(h)
+	}
+	minSize, maxSize := r.MinRingSize, r.MaxRingSize
+	if minSize == 0 {
+		minSize = DefaultMinRingSize
+	}
+	if maxSize == 0 {
+		maxSize = DefaultMaxRingSize
+	}
+	if minSize > maxSize {
+		return fmt.Errorf("envoy: malformed ring size bounds: [%d, %d]", minSize, maxSize)
+	}
+	min := math.Inf(1)
+	for _, h := range hosts {
+		min = math.Min(min, weight(h)/sum)
+	}
+	// Scale up the number of hashes per host such that the least weighted
+	// host gets a whole number of hashes on the ring.
+	scale := math.Min(
+		math.Ceil(min*float64(minSize))/min,
+		float64(maxSize),
+	)
+	var (
+		ring    = make([]entry, 0, int(math.Ceil(scale)))
+		current float64
+		target  float64
+		buf     []byte
+	)
+	for _, h := range hosts {
+		buf = append(buf[:0], h.Address...)
+		buf = append(buf, '_')
+		prefix := len(buf)
+
+		target += scale * weight(h) / sum
+		for i := uint64(0); current < target; i++ {
+			buf = strconv.AppendUint(buf[:prefix], i, 10)
+			ring = append(ring, entry{
+				hash: xxhash.Sum64(buf),
+				host: h.Address,
+			})
+			current++
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	r.mu.Lock()
+	r.ring = ring
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Get returns address of the host which key is routed to.
+// It returns empty string if the ring is empty.
+func (r *Ring) Get(key string) string {
+	return r.GetHash(xxhash.Sum64String(key))
+}
+
+// GetHash returns address of the host which hash value h is routed to. That
+// is, the host of the first point which value is greater or equal to h.
+// It returns empty string if the ring is empty.
+func (r *Ring) GetHash(h uint64) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.ring) == 0 {
+		return ""
+	}
+	i := sort.Search(len(r.ring), func(i int) bool {
+		return r.ring[i].hash >= h
+	})
+	if i == len(r.ring) {
+		i = 0
+	}
+	return r.ring[i].host
+}
+
+// Size returns the number of points on the ring.
+func (r *Ring) Size() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.ring)
+}
+
+func weight(h Host) float64 {
+	if h.Weight == 0 {
+		return 1
+	}
+	return float64(h.Weight)
+}
@@ -0,0 +1,69 @@
+package envoy
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestRingSetHosts(t *testing.T) {
+	var r Ring
+	err := r.SetHosts([]Host{
+		{Address: "10.0.0.1:80"},
+		{Address: "10.0.0.2:80"},
+		{Address: "10.0.0.3:80", Weight: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The least weighted host has 1/4 of the ring, which gets 256 hashes of
+	// the minimum ring size.
+	if n := r.Size(); n != 1024 {
+		t.Fatalf("unexpected ring size: %d; want %d", n, 1024)
+	}
+	count := make(map[string]int)
+	for _, e := range r.ring {
+		count[e.host]++
+	}
+	for host, exp := range map[string]int{
+		"10.0.0.1:80": 256,
+		"10.0.0.2:80": 256,
+		"10.0.0.3:80": 512,
+	} {
+		if act := count[host]; act != exp {
+			t.Errorf("unexpected number of %q hashes: %d; want %d", host, act, exp)
+		}
+	}
+	h := xxhash.Sum64String("10.0.0.3:80_511")
+	if act := r.GetHash(h); act != "10.0.0.3:80" {
+		t.Fatalf("GetHash() of the point's value = %q; want the point's host", act)
+	}
+	if act, exp := r.GetHash(r.ring[len(r.ring)-1].hash+1), r.ring[0].host; act != exp {
+		t.Fatalf("GetHash() past the last point = %q; want %q", act, exp)
+	}
+	if err := r.SetHosts([]Host{{Address: "a"}, {Address: "a"}}); err == nil {
+		t.Fatalf("want error on duplicate hosts")
+	}
+}
+
+func TestRingMaxSize(t *testing.T) {
+	r := Ring{
+		MinRingSize: 100,
+		MaxRingSize: 100,
+	}
+	hosts := make([]Host, 3)
+	for i := range hosts {
+		hosts[i] = Host{Address: strconv.Itoa(i)}
+	}
+	if err := r.SetHosts(hosts); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Size(); n != 100 {
+		t.Fatalf("unexpected ring size: %d; want %d", n, 100)
+	}
+	var empty Ring
+	if act := empty.Get("key"); act != "" {
+		t.Fatalf("unexpected host of empty ring: %q", act)
+	}
+}
@@ -0,0 +1,425 @@
+package hashring
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// stateFormat is the header line of the format written by ExportState().
+const stateFormat = "hashring-state 1"
+
+// ExportState writes the ring's items, weights, tombstones and points along
+// with their generations to w in a textual format, which is then read by
+// ImportState(). The format is the following:
+//
+//	hashring-state 1
+//	magic <magic factor>
+//	collision <collision policy>
+//	item <item> <weight>
+//	tomb <item> <weight>
+//	point <value> <item number> <index> <generation>
+//
+// Where items are Go-quoted strings of the items bytes written in ascending
+// order of their digests, item number is the zero-based number of the
+// point's item among the item lines and points are written in ascending
+// order of their values, formatted the same way as Dump() does.
+//
+// Like Dump(), the output depends only on the ring's items, weights and
+// settings, so two rings having equal exported states are byte-identical
+// regardless of the order of mutations made to them.
+func (r *Ring) ExportState(w io.Writer) error {
+	r.lock()
+	defer r.mu.Unlock()
+
+	if r.deferred {
+		return fmt.Errorf("hashring: can't export state in deferred mode")
+	}
+	var (
+		s    = r.current()
+		wide = s.hasher.new128 != nil
+		bw   = bufio.NewWriter(w)
+		buf  bytes.Buffer
+	)
+	quote := func(x Item) (string, error) {
+		buf.Reset()
+		if _, err := x.WriteTo(&buf); err != nil {
+			return "", err
+		}
+		return strconv.Quote(buf.String()), nil
+	}
+	fmt.Fprintln(bw, stateFormat)
+	fmt.Fprintf(bw, "magic %s\n", formatFloat(r.magicFactor()))
+	fmt.Fprintf(bw, "collision %s\n", r.conf.Collision)
+
+	ids := make([]uint64, 0, len(s.members))
+	for id := range s.members {
+		ids = append(ids, id)
+	}
+	sortUint64(ids)
+	num := make(map[uint64]int, len(ids))
+	for i, id := range ids {
+		m := s.members[id]
+		q, err := quote(m.item)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "item %s %s\n", q, formatFloat(m.weight))
+		num[id] = i
+	}
+
+	ids = ids[:0]
+	for id := range s.tombs {
+		ids = append(ids, id)
+	}
+	sortUint64(ids)
+	for _, id := range ids {
+		t := s.tombs[id]
+		q, err := quote(t.item)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "tomb %s %s\n", q, formatFloat(t.weight))
+	}
+
+	s.tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		fmt.Fprintf(bw, "point %s %d %d %d\n",
+			formatValue(p.val, wide), num[p.bucket.id], p.index, p.generation(),
+		)
+		return true
+	})
+	return bw.Flush()
+}
+
+// ImportState replaces items of the ring with the ones read from src, which
+// must be written by ExportState(). The decode function is called to convert
+// the items bytes back to the Item values.
+//
+// Generations of the points are a function of the ring's items and weights,
+// so the ring is rebuilt from the read items and then every point is checked
+// to have exactly the value and generation read from src. ImportState
+// returns non-nil error if some point differs, that is, if the exporting
+// ring has different hash function, Suffix or allocation settings. It also
+// returns non-nil error if magic factor or collision policy of the ring
+// differ from the exported ones, or if the ring is in deferred mode. The ring
+// is left unchanged in all these cases.
+//
+// Like other mutations ImportState increases the ring version and calls
+// r.OnRelocation.
+func (r *Ring) ImportState(src io.Reader, decode func([]byte) (Item, error)) error {
+	st, err := readState(src, decode)
+	if err != nil {
+		return err
+	}
+	r.lock()
+	defer r.mu.Unlock()
+
+	if r.deferred {
+		return fmt.Errorf("hashring: can't import state in deferred mode")
+	}
+	if m := formatFloat(r.magicFactor()); st.magic != m {
+		return fmt.Errorf(
+			"hashring: exported magic factor is %s; ring has %s",
+			st.magic, m,
+		)
+	}
+	if c := r.conf.Collision.String(); st.collision != c {
+		return fmt.Errorf(
+			"hashring: exported collision policy is %s; ring has %s",
+			st.collision, c,
+		)
+	}
+	var (
+		cur     = r.current()
+		buckets = make(map[uint64]*bucket, len(st.items))
+		tombs   map[uint64]tombstone
+		order   = make([]*bucket, len(st.items))
+		keys    = make(map[uint64]*bucket, len(st.items))
+	)
+	for i, it := range st.items {
+		if err := r.checkWeight(it.weight); err != nil {
+			return err
+		}
+		id, key, err := r.identify(it.item)
+		if err != nil {
+			return err
+		}
+		if _, has := buckets[id]; has {
+			return fmt.Errorf("hashring: duplicate item %v", it.item)
+		}
+		if o := keys[key]; o != nil {
+			same, err := sameBytes(o.item, it.item)
+			if err != nil {
+				return r.checkErr(err)
+			}
+			if same {
+				return fmt.Errorf(
+					"hashring: item %v has the same bytes as item %v",
+					it.item, o.item,
+				)
+			}
+		}
+		b := r.newBucket(id, key, it.item, it.weight)
+		keys[key] = b
+		if r.conf.CountLoads {
+			b.loads = new(loads)
+		}
+		buckets[id] = b
+		order[i] = b
+	}
+	for _, t := range st.tombs {
+		id, err := r.itemDigest(t.item)
+		if err != nil {
+			return err
+		}
+		tombs = withTomb(tombs, id, t)
+	}
+	if r.conf.Collision == CollisionError {
+		if err := r.checkCollisions(cur.hasher, avl.Tree{}, buckets); err != nil {
+			return err
+		}
+	}
+	var (
+		prevBuckets    = r.buckets
+		prevCollisions = r.collisions
+		prevTombs      = r.tombs
+	)
+	r.buckets = buckets
+	r.collisions = nil
+	r.tombs = tombs
+	r.resetWeights()
+
+	before := r.marks(cur.tree)
+	done := r.traceRebuild(cur.tree.Size())
+	// All points are replaced with the new ones.
+	r.removed = cur.tree.Size()
+	tree, err := r.build(cur.hasher, avl.Tree{})
+	done()
+	if err == nil {
+		err = st.compare(tree, order, cur.hasher.new128 != nil)
+	}
+	if err != nil {
+		// Points of the previous buckets are left untouched.
+		r.buckets = prevBuckets
+		r.collisions = prevCollisions
+		r.tombs = prevTombs
+		r.fix.Init()
+		r.resetWeights()
+		return err
+	}
+	r.publish(cur.hasher, tree)
+	r.relocate(before)
+
+	return nil
+}
+
+// exportedState is a ring state read by readState().
+type exportedState struct {
+	magic     string
+	collision string
+	items     []tombstone
+	tombs     []tombstone
+	points    []exportedPoint
+}
+
+type exportedPoint struct {
+	value string
+	item  int
+	index int
+	gen   int
+}
+
+// compare returns non-nil error if points of the tree differ from the
+// exported ones. Buckets are given in order of exported items.
+func (st *exportedState) compare(tree avl.Tree, order []*bucket, wide bool) error {
+	if n := tree.Size(); n != len(st.points) {
+		return fmt.Errorf(
+			"hashring: imported ring has %d points; exported %d",
+			n, len(st.points),
+		)
+	}
+	var (
+		i   int
+		err error
+	)
+	tree.InOrder(func(x avl.Item) bool {
+		var (
+			p   = x.(*point)
+			exp = st.points[i]
+		)
+		i++
+		if exp.value != formatValue(p.val, wide) ||
+			order[exp.item] != p.bucket ||
+			exp.index != p.index ||
+			exp.gen != p.generation() {
+			err = fmt.Errorf(
+				"hashring: imported point #%d of item %v has value %s and "+
+					"generation %d; exported point #%d of item %v has value "+
+					"%s and generation %d",
+				p.index, p.bucket.item, formatValue(p.val, wide), p.generation(),
+				exp.index, order[exp.item].item, exp.value, exp.gen,
+			)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// readState reads state written by ExportState() from src.
+func readState(src io.Reader, decode func([]byte) (Item, error)) (*exportedState, error) {
+	var (
+		st   exportedState
+		sc   = bufio.NewScanner(src)
+		line int
+	)
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf(
+			"hashring: malformed state at line %d: %s",
+			line, fmt.Sprintf(format, args...),
+		)
+	}
+	item := func(fields []string) (tombstone, error) {
+		if len(fields) != 3 {
+			return tombstone{}, fail("want item and weight")
+		}
+		s, err := strconv.Unquote(fields[1])
+		if err != nil {
+			return tombstone{}, fail("bad item: %v", err)
+		}
+		w, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return tombstone{}, fail("bad weight: %v", err)
+		}
+		x, err := decode([]byte(s))
+		if err != nil {
+			return tombstone{}, err
+		}
+		return tombstone{item: x, weight: w}, nil
+	}
+	for sc.Scan() {
+		line++
+		text := sc.Text()
+		if line == 1 {
+			if text != stateFormat {
+				return nil, fail("unexpected header %q", text)
+			}
+			continue
+		}
+		fields, err := splitStateLine(text)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "magic":
+			if len(fields) != 2 {
+				return nil, fail("want magic factor")
+			}
+			st.magic = fields[1]
+		case "collision":
+			if len(fields) != 2 {
+				return nil, fail("want collision policy")
+			}
+			st.collision = fields[1]
+		case "item":
+			it, err := item(fields)
+			if err != nil {
+				return nil, err
+			}
+			st.items = append(st.items, it)
+		case "tomb":
+			it, err := item(fields)
+			if err != nil {
+				return nil, err
+			}
+			st.tombs = append(st.tombs, it)
+		case "point":
+			if len(fields) != 5 {
+				return nil, fail("want value, item, index and generation")
+			}
+			var (
+				p    = exportedPoint{value: fields[1]}
+				nums = [...]*int{&p.item, &p.index, &p.gen}
+			)
+			for i, s := range fields[2:] {
+				n, err := strconv.Atoi(s)
+				if err != nil || n < 0 {
+					return nil, fail("bad number %q", s)
+				}
+				*nums[i] = n
+			}
+			if p.item >= len(st.items) {
+				return nil, fail("unknown item #%d", p.item)
+			}
+			st.points = append(st.points, p)
+		default:
+			return nil, fail("unexpected %q", fields[0])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if line == 0 {
+		return nil, fmt.Errorf("hashring: empty state")
+	}
+	return &st, nil
+}
+
+// splitStateLine splits line of the exported state into fields. Quoted item
+// is returned as a single field.
+func splitStateLine(line string) ([]string, error) {
+	var fields []string
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			return fields, nil
+		}
+		if line[0] == '"' {
+			i := 1
+			for i < len(line) && line[i] != '"' {
+				if line[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unterminated quoted item")
+			}
+			fields = append(fields, line[:i+1])
+			line = line[i+1:]
+			continue
+		}
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			i = len(line)
+		}
+		fields = append(fields, line[:i])
+		line = line[i:]
+	}
+}
+
+func formatValue(v value, wide bool) string {
+	if wide {
+		return fmt.Sprintf("%016x%016x", v.hi, v.lo)
+	}
+	return fmt.Sprintf("%016x", v.hi)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortUint64(xs []uint64) {
+	sort.Slice(xs, func(i, j int) bool {
+		return xs[i] < xs[j]
+	})
+}
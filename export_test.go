@@ -0,0 +1,145 @@
+package hashring
+
+import (
+	"bytes"
+	"hash"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestRingExportState(t *testing.T) {
+	newRing := func() *Ring {
+		return &Ring{
+			Hash: func() hash.Hash64 {
+				return maskHash{xxhash.New(), 0xfff}
+			},
+			MagicFactor: 32,
+		}
+	}
+	decode := func(p []byte) (Item, error) {
+		return StringItem(p), nil
+	}
+	export := func(t *testing.T, r *Ring) string {
+		var buf bytes.Buffer
+		if err := r.ExportState(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	var (
+		r0 = newRing()
+		r1 = newRing()
+	)
+	for _, s := range []string{"foo", "bar", "baz", "qux"} {
+		if err := r0.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r0.Remove(StringItem("qux"), Tombstone); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"qux", "baz", "bar", "foo", "quux"} {
+		if err := r1.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r1.Remove(StringItem("qux"), Tombstone); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.Delete(StringItem("quux")); err != nil {
+		t.Fatal(err)
+	}
+	s0, s1 := export(t, r0), export(t, r1)
+	if s0 != s1 {
+		t.Fatalf("exported states differ:\n%s\nvs\n%s", s0, s1)
+	}
+	if !strings.Contains(s0, "tomb \"qux\" 1\n") {
+		t.Fatalf("no tombstone exported:\n%s", s0)
+	}
+
+	r2 := newRing()
+	r2.Insert(StringItem("quux"), 2)
+	if err := r2.ImportState(strings.NewReader(s0), decode); err != nil {
+		t.Fatal(err)
+	}
+	if s2 := export(t, r2); s2 != s0 {
+		t.Fatalf("imported state differs:\n%s\nvs\n%s", s2, s0)
+	}
+	if r2.Has(StringItem("quux")) {
+		t.Fatalf("item is not replaced by import")
+	}
+	if err := r2.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		ring  func() *Ring
+		state string
+	}{
+		{
+			name: "magic factor",
+			ring: func() *Ring {
+				r := newRing()
+				r.MagicFactor = 16
+				return r
+			},
+			state: s0,
+		},
+		{
+			name: "collision policy",
+			ring: func() *Ring {
+				r := newRing()
+				r.Collision = CollisionStable
+				return r
+			},
+			state: s0,
+		},
+		{
+			name:  "hash function",
+			ring:  func() *Ring { return &Ring{MagicFactor: 32} },
+			state: s0,
+		},
+		{
+			name:  "generation",
+			ring:  newRing,
+			state: tamperGeneration(t, s0),
+		},
+		{
+			name:  "header",
+			ring:  newRing,
+			state: strings.Replace(s0, "hashring-state 1", "hashring-state 2", 1),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := test.ring()
+			r.Insert(StringItem("quux"), 1)
+			v := r.Version()
+			if err := r.ImportState(strings.NewReader(test.state), decode); err == nil {
+				t.Fatalf("want error")
+			}
+			if r.Version() != v || !r.Has(StringItem("quux")) || r.Len() != 1 {
+				t.Fatalf("ring is changed by failed import")
+			}
+			if err := r.Verify(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// tamperGeneration returns exported state s having generation of some point
+// of non-zero generation decreased.
+func tamperGeneration(t *testing.T, s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "point ") && !strings.HasSuffix(line, " 0") {
+			lines[i] = line[:strings.LastIndexByte(line, ' ')] + " 0"
+			return strings.Join(lines, "\n")
+		}
+	}
+	t.Fatalf("no collided points in state:\n%s", s)
+	return ""
+}
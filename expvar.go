@@ -0,0 +1,61 @@
+package hashring
+
+import "expvar"
+
+// ExpvarStats holds ring statistics published by ExpvarHandler().
+type ExpvarStats struct {
+	// Members is the number of items on the ring.
+	Members int `json:"members"`
+
+	// Points is the number of points on the ring.
+	Points int `json:"points"`
+
+	// Rebuilds is the number of ring rebuilds made since its creation.
+	Rebuilds uint64 `json:"rebuilds"`
+
+	// Collisions is the number of distinct values which points of the ring
+	// collided at (see CollisionRehash).
+	Collisions int `json:"collisions"`
+
+	// DigestCollisions is the number of items which bytes digests are equal
+	// to the bytes digest of some other item. See DigestCollisions() for
+	// details.
+	DigestCollisions int `json:"digest_collisions"`
+
+	// Clamped is the number of items which number of points was raised to
+	// Ring.MinPoints. See Clamped() for details.
+	Clamped int `json:"clamped"`
+
+	// Version is the ring version. See Version() for details.
+	Version uint64 `json:"version"`
+}
+
+// ExpvarHandler publishes the ring statistics through the expvar package
+// under the given name and returns the published variable. The variable is
+// rendered as a JSON object with ExpvarStats fields. Statistics are taken
+// from the current version of the ring on each read, which never blocks ring
+// mutations.
+//
+// It's useful for services exposing /debug/vars endpoint which don't run
+// other metrics systems. As with expvar.Publish(), it panics if the name is
+// already in use.
+func (r *Ring) ExpvarHandler(name string) expvar.Var {
+	v := expvar.Func(func() interface{} {
+		return r.expvarStats()
+	})
+	expvar.Publish(name, v)
+	return v
+}
+
+func (r *Ring) expvarStats() ExpvarStats {
+	s := r.load()
+	return ExpvarStats{
+		Members:          len(s.members),
+		Points:           s.tree.Size(),
+		Rebuilds:         s.rebuilds,
+		Collisions:       s.collisions,
+		DigestCollisions: s.digestCollisions,
+		Clamped:          s.clamped,
+		Version:          s.version,
+	}
+}
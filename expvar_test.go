@@ -0,0 +1,33 @@
+package hashring
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func TestRingExpvarHandler(t *testing.T) {
+	var r Ring
+	v := r.ExpvarHandler("test_ring")
+	if expvar.Get("test_ring") == nil {
+		t.Fatalf("variable is not published")
+	}
+	for _, s := range []string{"foo", "bar", "baz"} {
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var act ExpvarStats
+	if err := json.Unmarshal([]byte(v.String()), &act); err != nil {
+		t.Fatal(err)
+	}
+	exp := ExpvarStats{
+		Members:  3,
+		Points:   3 * DefaultMagicFactor,
+		Rebuilds: 3,
+		Version:  3,
+	}
+	if act != exp {
+		t.Fatalf("unexpected stats: %+v; want %+v", act, exp)
+	}
+}
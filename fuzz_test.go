@@ -0,0 +1,210 @@
+//go:build go1.18
+
+package hashring
+
+import (
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// fuzzItems is a set of items mutated by the fuzz targets. It's small to make
+// fuzzer to mutate the same items again and again.
+var fuzzItems = [...]string{"foo", "bar", "baz", "qux"}
+
+// fuzzPolicies is a set of collision policies under which rings must not
+// depend on the order of mutations.
+var fuzzPolicies = [...]CollisionPolicy{
+	CollisionRehash,
+	CollisionTieBreak,
+	CollisionStable,
+}
+
+// fuzzScript is a sequence of ring mutations decoded from fuzzer's input.
+type fuzzScript struct {
+	// bits is a number of bits of hash values.
+	// The less bits, the more collisions happen.
+	bits      int
+	collision CollisionPolicy
+	actions   []ringAction
+}
+
+// decodeFuzzScript decodes script from p. The first byte of p holds the
+// number of hash bits and the collision policy. Each next pair of bytes holds
+// an item index and its new weight. Zero weight means deletion of the item.
+func decodeFuzzScript(p []byte) (s fuzzScript, ok bool) {
+	if len(p) == 0 {
+		return s, false
+	}
+	s.bits = 8 + int(p[0]&0x07)
+	s.collision = fuzzPolicies[int(p[0]>>3)%len(fuzzPolicies)]
+
+	has := make(map[string]bool, len(fuzzItems))
+	for p = p[1:]; len(p) >= 2; p = p[2:] {
+		var (
+			item = fuzzItems[int(p[0])%len(fuzzItems)]
+			w    = float64(p[1] % 5)
+		)
+		switch {
+		case w == 0 && has[item]:
+			s.actions = append(s.actions, deleteItem(item))
+		case w == 0:
+			continue
+		case has[item]:
+			s.actions = append(s.actions, updateItem(item, w))
+		default:
+			s.actions = append(s.actions, insertItem(item, w))
+		}
+		has[item] = w != 0
+	}
+	return s, true
+}
+
+func (s fuzzScript) ring() *Ring {
+	mask := uint64(1)<<s.bits - 1
+	return &Ring{
+		Hash: func() hash.Hash64 {
+			return maskHash{xxhash.New(), mask}
+		},
+		MagicFactor:   8,
+		MaxGeneration: 1024,
+		Collision:     s.collision,
+	}
+}
+
+// weights returns items weights after all of the script actions applied.
+func (s fuzzScript) weights() map[string]float64 {
+	ws := make(map[string]float64)
+	for _, a := range s.actions {
+		switch a := a.(type) {
+		case *insertRingAction:
+			ws[a.s] = a.w
+		case *updateRingAction:
+			ws[a.s] = a.w
+		case *deleteRingAction:
+			delete(ws, a.s)
+		}
+	}
+	return ws
+}
+
+func (s fuzzScript) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d bits, %s collision:", s.bits, s.collision)
+	for _, a := range s.actions {
+		fmt.Fprintf(&sb, " %s;", a)
+	}
+	return sb.String()
+}
+
+func addFuzzSeeds(f *testing.F) {
+	f.Add([]byte{0x00, 0, 1, 1, 1, 2, 1, 3, 1})
+	f.Add([]byte{0x00, 0, 1, 1, 1, 2, 1, 1, 0, 0, 4})
+	f.Add([]byte{0x01, 0, 4, 1, 1, 0, 2, 2, 3, 0, 0})
+	f.Add([]byte{0x08, 0, 1, 1, 2, 2, 3, 3, 4, 1, 0})
+	f.Add([]byte{0x10, 3, 3, 2, 2, 1, 1, 0, 0, 2, 0})
+}
+
+// FuzzRingMutations applies arbitrary mutations to the ring and checks that
+// the resulting ring is consistent and equal to the ring built from scratch
+// with the same items.
+func FuzzRingMutations(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, p []byte) {
+		s, ok := decodeFuzzScript(p)
+		if !ok {
+			t.Skip()
+		}
+		r0 := s.ring()
+		for i, a := range s.actions {
+			if err := a.apply(r0); err != nil {
+				t.Fatalf("%s: #%d %s: %v", s, i, a, err)
+			}
+			if err := r0.Verify(); err != nil {
+				t.Fatalf("%s: after #%d %s: %v", s, i, a, err)
+			}
+		}
+		ws := s.weights()
+		items := make([]string, 0, len(ws))
+		for item := range ws {
+			items = append(items, item)
+		}
+		sort.Strings(items)
+
+		r1 := s.ring()
+		r1.Begin()
+		for _, item := range items {
+			if err := r1.Insert(StringItem(item), ws[item]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := r1.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := r1.Verify(); err != nil {
+			t.Fatalf("%s: built from scratch: %v", s, err)
+		}
+		assertRingsEqual(t, s.String(), r0, r1)
+	})
+}
+
+// FuzzRingReplay applies arbitrary mutations to the ring and then reverts
+// them one by one, checking that the ring is equal to its previous versions.
+func FuzzRingReplay(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, p []byte) {
+		s, ok := decodeFuzzScript(p)
+		if !ok {
+			t.Skip()
+		}
+		var (
+			r     = s.ring()
+			ws    = make(map[string]float64)
+			undo  = make([]ringAction, len(s.actions))
+			dumps = make([]string, len(s.actions))
+		)
+		for i, a := range s.actions {
+			switch a := a.(type) {
+			case *insertRingAction:
+				undo[i] = deleteItem(a.s)
+				ws[a.s] = a.w
+			case *updateRingAction:
+				undo[i] = updateItem(a.s, ws[a.s])
+				ws[a.s] = a.w
+			case *deleteRingAction:
+				undo[i] = insertItem(a.s, ws[a.s])
+				delete(ws, a.s)
+			}
+			dumps[i] = dumpRing(t, r)
+			if err := a.apply(r); err != nil {
+				t.Fatalf("%s: #%d %s: %v", s, i, a, err)
+			}
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i].apply(r); err != nil {
+				t.Fatalf("%s: undo #%d %s: %v", s, i, undo[i], err)
+			}
+			if err := r.Verify(); err != nil {
+				t.Fatalf("%s: after undo #%d %s: %v", s, i, undo[i], err)
+			}
+			if act, exp := dumpRing(t, r), dumps[i]; act != exp {
+				t.Fatalf(
+					"%s: after undo #%d %s: unexpected ring:\n%s\nwant:\n%s",
+					s, i, undo[i], act, exp,
+				)
+			}
+		}
+	})
+}
+
+func dumpRing(t *testing.T, r *Ring) string {
+	var sb strings.Builder
+	if err := r.Dump(&sb); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
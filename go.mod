@@ -2,7 +2,4 @@ module github.com/gobwas/hashring
 
 go 1.16
 
-require (
-	github.com/cespare/xxhash/v2 v2.1.1
-	github.com/gobwas/avl v0.2.1
-)
+require github.com/cespare/xxhash/v2 v2.1.1
@@ -0,0 +1,203 @@
+// Package gossip keeps membership of a hashring in sync with states of the
+// nodes of a gossip cluster, such as the one maintained by
+// github.com/hashicorp/memberlist.
+//
+// The caller owns the cluster and feeds node states into the Membership,
+// which puts alive nodes onto the ring, drains suspected ones (see
+// Membership.Drain) and removes dead and left ones.
+//
+// When built with the hashring_memberlist tag, the package provides
+// EventDelegate, which feeds node events of memberlist into the Membership:
+//
+//	m := &gossip.Membership{Ring: r, Drain: 0.5}
+//	events := &gossip.EventDelegate{Membership: m}
+//	conf := memberlist.DefaultLANConfig()
+//	conf.Events = events
+//	list, err := memberlist.Create(conf)
+//	...
+//	_, err = list.Join(peers)
+//
+// memberlist doesn't notify the delegate when a node becomes suspected, so
+// the events alone never drain nodes. To drain them, events.Sync(list) must
+// be called periodically.
+//
+// Without the tag the package doesn't depend on memberlist, and node states
+// may be fed by any gossip library through Update() and Sync().
+package gossip
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gobwas/hashring"
+)
+
+// State is a state of the cluster node. Its values match the values of
+// memberlist.NodeStateType.
+type State int
+
+// Node states.
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+	StateLeft
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Node describes a node of the cluster.
+type Node struct {
+	// Name is a unique name of the node.
+	Name string
+
+	// State is a state of the node.
+	State State
+
+	// Weight is a weight of the node on the ring.
+	// If Weight is zero, then the weight of 1 is used.
+	Weight float64
+}
+
+// Member is an item of the ring which represents a cluster node.
+type Member string
+
+// WriteTo implements hashring.Item interface.
+func (m Member) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(m))
+	return int64(n), err
+}
+
+// Membership reconciles membership of the ring with the nodes of the cluster.
+// Alive nodes are put onto the ring with their weights, suspected nodes are
+// drained and dead (or left) nodes are removed from the ring.
+//
+// Membership is goroutine safe. Membership instances must not be copied.
+type Membership struct {
+	// Ring is a ring which membership is maintained. It must not be nil.
+	// Ring must not be mutated by others while used by the Membership.
+	Ring *hashring.Ring
+
+	// Drain is a factor in range [0, 1) by which the weight of a suspected
+	// node is multiplied. That is, suspected node keeps only part of its
+	// objects until it's considered alive again. If Drain is zero, then
+	// suspected nodes are removed from the ring.
+	Drain float64
+
+	mu      sync.Mutex
+	weights map[string]float64
+}
+
+// Update applies the state of the node to the ring.
+func (m *Membership) Update(n Node) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.apply(n)
+}
+
+// Sync reconciles the ring with the full list of cluster nodes. Nodes which
+// are on the ring but are not listed are removed from it.
+// The ring is rebuilt once per Sync() call. If some node can't be applied or
+// the rebuild fails (see hashring.Ring.Commit()), both the ring and the
+// Membership are left unchanged and the error is returned.
+func (m *Membership) Sync(nodes []Node) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prev := m.weights
+	m.weights = make(map[string]float64, len(prev))
+	for name, w := range prev {
+		m.weights[name] = w
+	}
+	err = m.Ring.Apply(func() error {
+		seen := make(map[string]bool, len(nodes))
+		for _, n := range nodes {
+			seen[n.Name] = true
+			if err := m.apply(n); err != nil {
+				return err
+			}
+		}
+		for name := range m.weights {
+			if seen[name] {
+				continue
+			}
+			err := m.apply(Node{
+				Name:  name,
+				State: StateLeft,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		m.weights = prev
+	}
+	return err
+}
+
+// m.mu must be held.
+func (m *Membership) apply(n Node) error {
+	if m.Drain < 0 || m.Drain >= 1 {
+		panic(fmt.Sprintf("gossip: malformed drain factor: %v", m.Drain))
+	}
+	w := n.Weight
+	if w == 0 {
+		w = 1
+	}
+	switch n.State {
+	case StateAlive:
+	case StateSuspect:
+		w *= m.Drain
+	default:
+		w = 0
+	}
+	return m.set(n.Name, w)
+}
+
+// set changes weight of the named node on the ring to w.
+//
+// m.mu must be held.
+func (m *Membership) set(name string, w float64) (err error) {
+	var (
+		x   = Member(name)
+		cur = m.weights[name]
+	)
+	switch {
+	case w == cur:
+		return nil
+	case w == 0:
+		err = m.Ring.Delete(x)
+	case cur == 0:
+		err = m.Ring.Insert(x, w)
+	default:
+		err = m.Ring.Update(x, w)
+	}
+	if err != nil {
+		return err
+	}
+	if m.weights == nil {
+		m.weights = make(map[string]float64)
+	}
+	if w == 0 {
+		delete(m.weights, name)
+	} else {
+		m.weights[name] = w
+	}
+	return nil
+}
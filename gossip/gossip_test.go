@@ -0,0 +1,119 @@
+package gossip
+
+import (
+	"hash"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/gobwas/hashring"
+)
+
+func TestMembership(t *testing.T) {
+	var r hashring.Ring
+	m := Membership{
+		Ring:  &r,
+		Drain: 0.5,
+	}
+	for _, n := range []Node{
+		{Name: "a"},
+		{Name: "b", Weight: 2},
+		{Name: "c"},
+	} {
+		if err := m.Update(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertWeights(t, &r, map[string]float64{"a": 1, "b": 2, "c": 1})
+
+	m.Update(Node{Name: "b", Weight: 2, State: StateSuspect})
+	m.Update(Node{Name: "c", State: StateDead})
+	assertWeights(t, &r, map[string]float64{"a": 1, "b": 1})
+
+	err := m.Sync([]Node{
+		{Name: "b", Weight: 2},
+		{Name: "d", State: StateSuspect},
+		{Name: "e", State: StateLeft},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertWeights(t, &r, map[string]float64{"b": 2, "d": 0.5})
+}
+
+func assertWeights(t *testing.T, r *hashring.Ring, exp map[string]float64) {
+	t.Helper()
+	if n := r.Len(); n != len(exp) {
+		t.Fatalf("unexpected number of ring items: %d; want %d", n, len(exp))
+	}
+	for name, w := range exp {
+		if act, _ := r.Weight(Member(name)); act != w {
+			t.Errorf("unexpected weight of %q: %v; want %v", name, act, w)
+		}
+	}
+}
+
+// maskHash makes the ring points collide often.
+type maskHash struct {
+	hash.Hash64
+	mask uint64
+}
+
+func (h maskHash) Sum64() uint64 {
+	return h.Hash64.Sum64() & h.mask
+}
+
+func TestMembershipSyncError(t *testing.T) {
+	r := hashring.Ring{
+		Hash: func() hash.Hash64 {
+			return maskHash{fnv.New64a(), 0xfff}
+		},
+		MagicFactor: 16,
+		Collision:   hashring.CollisionError,
+	}
+	m := Membership{
+		Ring: &r,
+	}
+	nodes := []Node{
+		{Name: "a"},
+		{Name: "b"},
+	}
+	if err := m.Sync(nodes); err != nil {
+		t.Fatal(err)
+	}
+	points := pointsOf(&r, "a", "b")
+	for i := 0; ; i++ {
+		if i == 1000 {
+			t.Skip("no colliding node found")
+		}
+		err := m.Sync([]Node{
+			{Name: "b"},
+			{Name: "node-" + strconv.Itoa(i), Weight: 2},
+		})
+		if err != nil {
+			break
+		}
+		// Restore the initial state and try again.
+		if err := m.Sync(nodes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertWeights(t, &r, map[string]float64{"a": 1, "b": 1})
+	if !reflect.DeepEqual(pointsOf(&r, "a", "b"), points) {
+		t.Fatalf("ring points changed after failed Sync()")
+	}
+	// Ring must not be left in deferred mode.
+	if err := m.Update(Node{Name: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	assertWeights(t, &r, map[string]float64{"a": 1, "b": 1, "c": 1})
+}
+
+func pointsOf(r *hashring.Ring, names ...string) [][]uint64 {
+	ps := make([][]uint64, len(names))
+	for i, name := range names {
+		ps[i] = r.PointsOf(Member(name))
+	}
+	return ps
+}
@@ -0,0 +1,75 @@
+//go:build hashring_memberlist
+// +build hashring_memberlist
+
+package gossip
+
+import "github.com/hashicorp/memberlist"
+
+// EventDelegate is a memberlist.EventDelegate applying node events of the
+// cluster to the Membership. It's set as memberlist.Config.Events (see the
+// package doc for example).
+//
+// EventDelegate is available only when built with the hashring_memberlist
+// tag, so the module doesn't depend on memberlist otherwise.
+type EventDelegate struct {
+	// Membership is a membership which node events are applied to. It must
+	// not be nil.
+	Membership *Membership
+
+	// Weight returns the weight of the node on the ring, e.g. the one
+	// decoded from node's metadata. If Weight is nil, nodes get the weight
+	// of 1.
+	Weight func(*memberlist.Node) float64
+
+	// OnError, if non-nil, is called when the node event can't be applied
+	// to the ring. memberlist gives no way to report such errors.
+	OnError func(n *memberlist.Node, err error)
+}
+
+var _ memberlist.EventDelegate = (*EventDelegate)(nil)
+
+// NotifyJoin implements memberlist.EventDelegate.
+func (d *EventDelegate) NotifyJoin(n *memberlist.Node) {
+	d.notify(n)
+}
+
+// NotifyLeave implements memberlist.EventDelegate.
+func (d *EventDelegate) NotifyLeave(n *memberlist.Node) {
+	d.notify(n)
+}
+
+// NotifyUpdate implements memberlist.EventDelegate.
+func (d *EventDelegate) NotifyUpdate(n *memberlist.Node) {
+	d.notify(n)
+}
+
+// Sync reconciles the ring with all members of the list. memberlist doesn't
+// notify the delegate when a node becomes suspected, so Sync must be called
+// periodically to drain suspected nodes.
+func (d *EventDelegate) Sync(list *memberlist.Memberlist) error {
+	members := list.Members()
+	nodes := make([]Node, len(members))
+	for i, n := range members {
+		nodes[i] = d.node(n)
+	}
+	return d.Membership.Sync(nodes)
+}
+
+func (d *EventDelegate) notify(n *memberlist.Node) {
+	err := d.Membership.Update(d.node(n))
+	if err != nil && d.OnError != nil {
+		d.OnError(n, err)
+	}
+}
+
+func (d *EventDelegate) node(n *memberlist.Node) Node {
+	var w float64
+	if d.Weight != nil {
+		w = d.Weight(n)
+	}
+	return Node{
+		Name:   n.Name,
+		State:  State(n.State),
+		Weight: w,
+	}
+}
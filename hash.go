@@ -1,7 +1,14 @@
 package hashring
 
 import (
+	"encoding"
 	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
 )
 
 const (
@@ -9,15 +16,384 @@ const (
 )
 
 func encodeSuffix(xs ...int) []byte {
-	p := make([]byte, intSize*len(xs))
-	for i, x := range xs {
-		dst := p[i*intSize:]
+	return appendSuffix(make([]byte, 0, intSize*len(xs)), xs...)
+}
+
+func appendSuffix(p []byte, xs ...int) []byte {
+	var buf [8]byte
+	for _, x := range xs {
 		switch intSize {
 		case 4:
-			binary.LittleEndian.PutUint32(dst, uint32(x))
+			binary.LittleEndian.PutUint32(buf[:], uint32(x))
 		case 8:
-			binary.LittleEndian.PutUint64(dst, uint64(x))
+			binary.LittleEndian.PutUint64(buf[:], uint64(x))
 		}
+		p = append(p, buf[:intSize]...)
 	}
 	return p
 }
+
+// FixedSuffix is a point suffix encoding function which encodes generation
+// and index of a point as 64-bit little-endian integers regardless of the
+// machine's int size. It can be used as Ring.Suffix to make rings built on
+// 32-bit and 64-bit architectures map keys identically.
+//
+// Note that on 64-bit architectures rings using FixedSuffix are identical to
+// rings using the default encoding.
+func FixedSuffix(_ Item, gen, index int) []byte {
+	p := make([]byte, 16)
+	binary.LittleEndian.PutUint64(p[0:], uint64(gen))
+	binary.LittleEndian.PutUint64(p[8:], uint64(index))
+	return p
+}
+
+// hasher is a pool of reusable hash functions built by the same constructor.
+//
+// Note that sync.Pool keeps a private cache of hash functions per each P, so
+// digests made in parallel on different cores don't contend for a shared
+// freelist and sharding of the pool gives nothing (see
+// BenchmarkHasherParallel).
+type hasher struct {
+	new    func() hash.Hash64
+	new128 func() Hash128
+	pool   sync.Pool
+	bufs   sync.Pool // *[]byte
+}
+
+// newHasher creates new hasher using fn128 if it's non-nil or fn otherwise.
+func newHasher(fn func() hash.Hash64, fn128 func() Hash128) *hasher {
+	return &hasher{
+		new:    fn,
+		new128: fn128,
+	}
+}
+
+// maxKeyBuffer is the maximum capacity of the digester's key buffer which
+// is returned to the pool.
+const maxKeyBuffer = 4096
+
+// keyChunkSize is the size of the digester's buffer used to read bytes of
+// KeyReader items.
+const keyChunkSize = 32 << 10
+
+// digester holds reusable hash function along with a buffer for the bytes of
+// KeyAppender items and a buffer for reading bytes of KeyReader items.
+type digester struct {
+	h64   hash.Hash64
+	h128  Hash128
+	buf   []byte
+	chunk []byte
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	if d.h128 != nil {
+		return d.h128.Write(p)
+	}
+	return d.h64.Write(p)
+}
+
+// readKey writes bytes of x read in chunks to the hash function.
+func (d *digester) readKey(x KeyReader) error {
+	r, err := x.OpenKey()
+	if err != nil {
+		return err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	if d.chunk == nil {
+		d.chunk = make([]byte, keyChunkSize)
+	}
+	for {
+		n, err := r.Read(d.chunk)
+		if n > 0 {
+			d.Write(d.chunk[:n])
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *digester) hash() interface{} {
+	if d.h128 != nil {
+		return d.h128
+	}
+	return d.h64
+}
+
+// stateful reports whether the hash function state can be saved and
+// restored.
+func (d *digester) stateful() bool {
+	h := d.hash()
+	_, m := h.(encoding.BinaryMarshaler)
+	_, u := h.(encoding.BinaryUnmarshaler)
+	return m && u
+}
+
+// state returns the hash function state.
+// Hash function must be stateful.
+func (d *digester) state() ([]byte, bool) {
+	p, err := d.hash().(encoding.BinaryMarshaler).MarshalBinary()
+	return p, err == nil
+}
+
+// restore sets the hash function state to the one returned by state().
+func (d *digester) restore(p []byte) {
+	if err := d.hash().(encoding.BinaryUnmarshaler).UnmarshalBinary(p); err != nil {
+		panic(fmt.Sprintf("hashring: can't restore hash state: %v", err))
+	}
+}
+
+func (d *digester) sum() value {
+	if d.h128 != nil {
+		hi, lo := d.h128.Sum128()
+		return value{hi, lo}
+	}
+	return value{hi: d.h64.Sum64()}
+}
+
+func (h *hasher) acquire() *digester {
+	d, _ := h.pool.Get().(*digester)
+	if d != nil {
+		return d
+	}
+	d = new(digester)
+	switch {
+	case h.new128 != nil:
+		d.h128 = h.new128()
+	case h.new != nil:
+		d.h64 = h.new()
+	default:
+		d.h64 = xxhash.New()
+	}
+	return d
+}
+
+func (h *hasher) release(d *digester) {
+	if d.h128 != nil {
+		d.h128.Reset()
+	} else {
+		d.h64.Reset()
+	}
+	if cap(d.buf) > maxKeyBuffer {
+		d.buf = nil
+	}
+	h.pool.Put(d)
+}
+
+// sum returns digest of src bytes followed by suffix bytes.
+func (h *hasher) sum(src io.WriterTo, suffix []byte) (value, error) {
+	if a, ok := src.(KeyAppender); ok && h.new == nil && h.new128 == nil {
+		return h.sumAppender(a, suffix), nil
+	}
+	d := h.acquire()
+	defer h.release(d)
+
+	var err error
+	switch x := src.(type) {
+	case KeyAppender:
+		d.buf = x.AppendKey(d.buf[:0])
+		_, err = d.Write(d.buf)
+	case KeyReader:
+		err = d.readKey(x)
+	default:
+		_, err = src.WriteTo(d)
+	}
+	if err == nil {
+		_, err = d.Write(suffix)
+	}
+	if err != nil {
+		return value{}, fmt.Errorf("hashring: digest error: %v", err)
+	}
+	return d.sum(), nil
+}
+
+// sumAppender returns digest of a's bytes followed by suffix bytes using
+// the default xxhash function. The digest is calculated on the stack, while
+// the bytes are appended to the pooled buffer: the buffer passed to the
+// interface method escapes to the heap, so using a stack array instead would
+// allocate on each call.
+func (h *hasher) sumAppender(a KeyAppender, suffix []byte) value {
+	p, _ := h.bufs.Get().(*[]byte)
+	if p == nil {
+		p = new([]byte)
+	}
+	*p = a.AppendKey((*p)[:0])
+	v := h.sumKey(*p, suffix)
+	if cap(*p) <= maxKeyBuffer {
+		h.bufs.Put(p)
+	}
+	return v
+}
+
+// sumKey returns digest of key bytes followed by suffix bytes.
+//
+// Unlike sum(), it doesn't use the pool of hash functions if h uses the
+// default xxhash function. In that case the digest is calculated on the
+// stack.
+func (h *hasher) sumKey(key, suffix []byte) value {
+	if h.new == nil && h.new128 == nil {
+		var d xxhash.Digest
+		d.Reset()
+		d.Write(key)
+		d.Write(suffix)
+		return value{hi: d.Sum64()}
+	}
+	d := h.acquire()
+	d.Write(key)
+	d.Write(suffix)
+	v := d.sum()
+	h.release(d)
+	return v
+}
+
+// keySum returns a function calculating digests of x bytes followed by given
+// suffix bytes. It's used to digest many points of the same item.
+//
+// Bytes of KeyReader items are read only once if the state of the hash
+// function can be saved and restored (as it can for xxhash and the hash
+// functions of the standard library). In that case stream is true and the
+// returned function holds only the state. Otherwise, as well as for other
+// items, the bytes are held in memory.
+// It returns non-nil error if x can't be read.
+func (h *hasher) keySum(x Item) (sum func(suffix []byte) value, stream bool, err error) {
+	if r, ok := x.(KeyReader); ok {
+		if _, ok := x.(KeyAppender); !ok {
+			fn, err := h.streamSum(r)
+			if err != nil {
+				return nil, false, err
+			}
+			if fn != nil {
+				return fn, true, nil
+			}
+		}
+	}
+	key, err := itemKey(x)
+	if err != nil {
+		return nil, false, err
+	}
+	return func(suffix []byte) value {
+		return h.sumKey(key, suffix)
+	}, false, nil
+}
+
+// streamSum returns keySum() function for x which reads x bytes once. It
+// returns nil function if hash function state can't be saved.
+func (h *hasher) streamSum(x KeyReader) (func(suffix []byte) value, error) {
+	d := h.acquire()
+	if !d.stateful() {
+		h.release(d)
+		return nil, nil
+	}
+	if err := d.readKey(x); err != nil {
+		h.release(d)
+		return nil, fmt.Errorf("hashring: digest error: %v", err)
+	}
+	state, ok := d.state()
+	h.release(d)
+	if !ok {
+		return nil, nil
+	}
+	return func(suffix []byte) value {
+		d := h.acquire()
+		d.restore(state)
+		d.Write(suffix)
+		v := d.sum()
+		h.release(d)
+		return v
+	}, nil
+}
+
+// digest is like sum() but panics on error.
+func (h *hasher) digest(src io.WriterTo, suffix ...byte) value {
+	d, err := h.sum(src, suffix)
+	if err != nil {
+		panic(err.Error())
+	}
+	return d
+}
+
+// sum64 returns 64-bit digest of src bytes followed by suffix bytes.
+// It uses hash function taken from the pool or creates new one by calling
+// newHash (or xxhash.New() if newHash is nil) if pool is empty.
+func sum64(pool *sync.Pool, newHash func() hash.Hash64, src io.WriterTo, suffix []byte) (uint64, error) {
+	h, _ := pool.Get().(hash.Hash64)
+	if h == nil {
+		if newHash != nil {
+			h = newHash()
+		} else {
+			h = xxhash.New()
+		}
+	}
+	defer func() {
+		h.Reset()
+		pool.Put(h)
+	}()
+
+	_, err := src.WriteTo(h)
+	if err == nil {
+		_, err = h.Write(suffix)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("hashring: digest error: %v", err)
+	}
+	return h.Sum64(), nil
+}
+
+// KeyAppender is an optional interface of an Item which is able to append its
+// bytes to a given slice. The appended bytes must be the same as the ones
+// written by the item's WriteTo() method.
+//
+// If an Item implements KeyAppender, Ring uses AppendKey() instead of
+// WriteTo() to digest the item, which avoids the hash-as-io.Writer
+// indirection and makes digesting of items allocation free. Along with
+// Ring.SkipList it makes Get() calls allocation free too.
+type KeyAppender interface {
+	AppendKey([]byte) []byte
+}
+
+// KeyReader is an optional interface of an Item which is able to provide its
+// bytes as a stream. The read bytes must be the same as the ones written by
+// the item's WriteTo() method. If the returned reader implements io.Closer,
+// it is closed once the bytes are read.
+//
+// If an Item implements KeyReader (and doesn't implement KeyAppender), Ring
+// reads its bytes in chunks using a pooled buffer to digest the item. It
+// makes it possible to use very large items, such as composite keys streamed
+// from disk, without holding their bytes in memory.
+type KeyReader interface {
+	OpenKey() (io.Reader, error)
+}
+
+// appendWriter is an io.Writer appending written bytes to the slice.
+type appendWriter []byte
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	*w = append(*w, p...)
+	return len(p), nil
+}
+
+// itemKey returns bytes of x.
+func itemKey(x Item) ([]byte, error) {
+	if a, ok := x.(KeyAppender); ok {
+		return a.AppendKey(nil), nil
+	}
+	var w appendWriter
+	if _, err := x.WriteTo(&w); err != nil {
+		return nil, fmt.Errorf("hashring: digest error: %v", err)
+	}
+	return w, nil
+}
+
+// mix64 returns a hash of digest d seeded by s.
+// It uses the SplitMix64 finalizer to mix the bits.
+func mix64(d, s uint64) uint64 {
+	x := d ^ (s+1)*0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,323 @@
+package hashring
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// readerItem is an item which bytes are the name repeated n times.
+type readerItem struct {
+	name string
+	n    int
+
+	opened *int
+	// limit is an optional number of times OpenKey() succeeds.
+	limit *int
+}
+
+func (x readerItem) String() string {
+	return strings.Repeat(x.name, x.n)
+}
+
+func (x readerItem) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, x.String())
+	return int64(n), err
+}
+
+func (x readerItem) OpenKey() (io.Reader, error) {
+	if x.limit != nil && *x.opened >= *x.limit {
+		return nil, errors.New("broken item")
+	}
+	*x.opened++
+	return io.LimitReader(
+		&repeatReader{s: x.name},
+		int64(len(x.name)*x.n),
+	), nil
+}
+
+type repeatReader struct {
+	s string
+	i int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.s[r.i%len(r.s)]
+		r.i++
+	}
+	return len(p), nil
+}
+
+func TestRingKeyReader(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		hash func() hash.Hash64
+		// opens is the number of times item bytes are read on insertion.
+		opens int
+	}{
+		{
+			name:  "default",
+			opens: 2,
+		},
+		{
+			// Masked hash can't save its state, so item bytes are held in
+			// memory while digesting its points.
+			name: "stateless",
+			hash: func() hash.Hash64 {
+				return maskHash{xxhash.New(), ^uint64(0)}
+			},
+			opens: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				r0 = Ring{Hash: test.hash, MagicFactor: 16}
+				r1 = Ring{Hash: test.hash, MagicFactor: 16}
+			)
+			for i := 0; i < 4; i++ {
+				var (
+					opened int
+					x      = readerItem{
+						name:   "item-" + strconv.Itoa(i) + "-",
+						n:      10000,
+						opened: &opened,
+					}
+				)
+				if err := r0.Insert(StringItem(x.String()), 1); err != nil {
+					t.Fatal(err)
+				}
+				if err := r1.Insert(x, 1); err != nil {
+					t.Fatal(err)
+				}
+				if opened != test.opens {
+					t.Fatalf(
+						"unexpected number of reads: %d; want %d",
+						opened, test.opens,
+					)
+				}
+				act := r1.PointsOf(x)
+				exp := r0.PointsOf(StringItem(x.String()))
+				if len(act) == 0 || !equalUint64(act, exp) {
+					t.Fatalf("points of streamed item differ")
+				}
+			}
+			if err := r1.Verify(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRingKeyReaderError(t *testing.T) {
+	var (
+		r = Ring{
+			MagicFactor: 16,
+			Strict:      true,
+		}
+		opened int
+		limit  int
+		x      = readerItem{
+			name:   "x",
+			n:      100,
+			opened: &opened,
+			limit:  &limit,
+		}
+	)
+	for _, s := range []string{"foo", "bar"} {
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	points := r.NumPoints()
+	// Item is digested once to be identified, and fails to be read for its
+	// points.
+	limit = opened + 1
+	if err := r.Insert(x, 1); err == nil {
+		t.Fatalf("want error on insertion of broken item; got nothing")
+	}
+	if r.Has(x) || r.NumPoints() != points {
+		t.Fatalf("ring changed after failed insertion")
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Begin()
+	limit = opened + 1
+	if err := r.Insert(x, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Commit(); err == nil {
+		t.Fatalf("want error on commit of broken item; got nothing")
+	}
+	limit = opened + 1
+	if err := r.Delete(x); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	limit = opened + 2
+	if err := r.Insert(x, 1); err != nil {
+		t.Fatal(err)
+	}
+	// Item bytes are read for its points once on insertion, so later
+	// rebuilds don't fail.
+	limit = opened + 1
+	if err := r.Update(x, 2); err != nil {
+		t.Fatal(err)
+	}
+	limit = opened
+	if err := r.Update(StringItem("foo"), 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("no panic on insertion of broken item into lax ring")
+		}
+	}()
+	var lax Ring
+	limit = opened + 1
+	lax.Insert(x, 1)
+}
+
+func equalUint64(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// cryptoHash64 makes hash.Hash64 from a cryptographic hash function by
+// taking the first 8 bytes of its sum.
+type cryptoHash64 struct {
+	hash.Hash
+}
+
+func (h cryptoHash64) Sum64() uint64 {
+	var buf [64]byte
+	return binary.BigEndian.Uint64(h.Sum(buf[:0]))
+}
+
+// mutexFreelist is a single freelist of hash functions guarded by a mutex.
+// It is used as a baseline for the hasher's pool.
+type mutexFreelist struct {
+	mu   sync.Mutex
+	new  func() hash.Hash64
+	free []hash.Hash64
+}
+
+func (f *mutexFreelist) sum(p []byte) uint64 {
+	f.mu.Lock()
+	var h hash.Hash64
+	if n := len(f.free); n > 0 {
+		h = f.free[n-1]
+		f.free = f.free[:n-1]
+	}
+	f.mu.Unlock()
+	if h == nil {
+		h = f.new()
+	}
+	h.Write(p)
+	x := h.Sum64()
+	h.Reset()
+	f.mu.Lock()
+	f.free = append(f.free, h)
+	f.mu.Unlock()
+	return x
+}
+
+// shardedFreelist is a set of mutex guarded freelists of hash functions. Each
+// digest takes the next freelist in round-robin order, which spreads the
+// contention over the shards. It is used as a baseline for the hasher's pool.
+type shardedFreelist struct {
+	next   uint32
+	shards [16]mutexFreelist
+}
+
+func (f *shardedFreelist) sum(p []byte) uint64 {
+	i := atomic.AddUint32(&f.next, 1) % uint32(len(f.shards))
+	return f.shards[i].sum(p)
+}
+
+// BenchmarkHasherParallel compares the hasher's pool with allocation of a
+// hash function per digest, with a single mutex guarded freelist and with
+// sharded freelists.
+//
+// Note that sync.Pool used by the hasher already keeps per-P caches of
+// hash functions, so digests made in parallel don't contend for a shared
+// freelist. Run it with -cpu flag to see how it scales with the number of
+// cores.
+func BenchmarkHasherParallel(b *testing.B) {
+	key := []byte("some-key-of-moderate-length")
+	for _, fn := range []struct {
+		name string
+		new  func() hash.Hash64
+	}{
+		{"md5", func() hash.Hash64 { return cryptoHash64{md5.New()} }},
+		{"sha1", func() hash.Hash64 { return cryptoHash64{sha1.New()} }},
+	} {
+		fn := fn
+		b.Run(fn.name+"/pool", func(b *testing.B) {
+			h := newHasher(fn.new, nil)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					h.sumKey(key, nil)
+				}
+			})
+		})
+		b.Run(fn.name+"/alloc", func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					h := fn.new()
+					h.Write(key)
+					h.Sum64()
+				}
+			})
+		})
+		b.Run(fn.name+"/mutex", func(b *testing.B) {
+			f := mutexFreelist{new: fn.new}
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					f.sum(key)
+				}
+			})
+		})
+		b.Run(fn.name+"/sharded", func(b *testing.B) {
+			var f shardedFreelist
+			for i := range f.shards {
+				f.shards[i].new = fn.new
+			}
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					f.sum(key)
+				}
+			})
+		})
+	}
+}
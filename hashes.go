@@ -0,0 +1,46 @@
+package hashring
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/crc64"
+	"hash/fnv"
+)
+
+// Murmur3 returns a constructor of the 64-bit Murmur3 hash function with zero
+// seed, suitable to be used as Ring.Hash. Hash value is the first 64 bits of
+// the x64 128-bit variant of Murmur3, as most Murmur3 libraries return from
+// their Sum64() functions.
+func Murmur3() func() hash.Hash64 {
+	return func() hash.Hash64 {
+		return new(murmur3x64)
+	}
+}
+
+// FNV64a returns a constructor of the 64-bit FNV-1a hash function, suitable
+// to be used as Ring.Hash.
+func FNV64a() func() hash.Hash64 {
+	return fnv.New64a
+}
+
+// CRC64 returns a constructor of the 64-bit CRC hash function using ECMA
+// polynomial, suitable to be used as Ring.Hash.
+func CRC64() func() hash.Hash64 {
+	table := crc64.MakeTable(crc64.ECMA)
+	return func() hash.Hash64 {
+		return crc64.New(table)
+	}
+}
+
+// murmur3x64 is a murmur3 hash function which Sum() returns 64-bit value.
+type murmur3x64 struct {
+	murmur3
+}
+
+func (h *murmur3x64) Sum(b []byte) []byte {
+	var p [8]byte
+	binary.BigEndian.PutUint64(p[:], h.Sum64())
+	return append(b, p[:]...)
+}
+
+func (h *murmur3x64) Size() int { return 8 }
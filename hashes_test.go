@@ -0,0 +1,184 @@
+package hashring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestHashes(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		hash func() hash.Hash64
+		exp  uint64
+	}{
+		{
+			name: "murmur3",
+			hash: Murmur3(),
+			exp:  0xcbd8a7b341bd9b02,
+		},
+		{
+			name: "fnv64a",
+			hash: FNV64a(),
+			exp:  0xa430d84680aabd0b,
+		},
+		{
+			name: "crc64",
+			hash: CRC64(),
+			exp:  0x9b1edae5dbb937b1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h := test.hash()
+			h.Write([]byte("hello"))
+			if act := h.Sum64(); act != test.exp {
+				t.Fatalf("unexpected sum: %#x; want %#x", act, test.exp)
+			}
+			sum := h.Sum(nil)
+			if n := h.Size(); len(sum) != n {
+				t.Fatalf("unexpected sum size: %d; want %d", len(sum), n)
+			}
+			if act := binary.BigEndian.Uint64(sum); act != test.exp {
+				t.Fatalf("unexpected sum bytes: %#x; want %#x", act, test.exp)
+			}
+
+			r := Ring{Hash: test.hash}
+			r.Insert(StringItem("a"), 1)
+			r.Insert(StringItem("b"), 1)
+			if r.Get(StringItem("key")) == nil {
+				t.Fatalf("unexpected nil item")
+			}
+		})
+	}
+}
+
+type appendItem string
+
+func (s appendItem) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(s))
+	return int64(n), err
+}
+
+func (s appendItem) AppendKey(p []byte) []byte {
+	return append(p, s...)
+}
+
+func TestHasherSumKey(t *testing.T) {
+	suffix := encodeSuffix(1, 2)
+	for _, test := range []struct {
+		name   string
+		hasher *hasher
+	}{
+		{
+			name:   "default",
+			hasher: newHasher(nil, nil),
+		},
+		{
+			name:   "custom",
+			hasher: newHasher(FNV64a(), nil),
+		},
+		{
+			name:   "128",
+			hasher: newHasher(nil, NewMurmur3x128),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, s := range []string{
+				"",
+				"hello",
+				strings.Repeat("x", 1024),
+			} {
+				exp, err := test.hasher.sum(StringItem(s), suffix)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, x := range []Item{StringItem(s), appendItem(s)} {
+					key, err := itemKey(x)
+					if err != nil {
+						t.Fatal(err)
+					}
+					act := test.hasher.sumKey(key, suffix)
+					if act != exp {
+						t.Errorf("unexpected digest of %T: %v; want %v", x, act, exp)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRingInsert(b *testing.B) {
+	for _, test := range []struct {
+		name string
+		hash func() hash.Hash64
+	}{
+		{"default", nil},
+		{"xxhash", func() hash.Hash64 { return xxhash.New() }},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r := Ring{Hash: test.hash}
+				r.Insert(StringItem("hello, world"), 1)
+			}
+		})
+	}
+}
+
+func TestRingKeyAppender(t *testing.T) {
+	var (
+		r0 Ring
+		r1 = Ring{SkipList: true}
+	)
+	for i := 0; i < 10; i++ {
+		s := fmt.Sprintf("item-%d", i)
+		r0.Insert(StringItem(s), 1)
+		r1.Insert(appendItem(s), 1)
+	}
+	for i := 0; i < 100; i++ {
+		s := fmt.Sprintf("key-%d", i)
+		a := itemString(r0.Get(StringItem(s)))
+		b := itemString(r1.Get(appendItem(s)))
+		if a != b {
+			t.Fatalf("unexpected owners mismatch for %q: %s vs %s", s, a, b)
+		}
+	}
+	var key Item = appendItem("key")
+	if n := testing.AllocsPerRun(100, func() {
+		r1.Get(key)
+	}); n != 0 {
+		t.Errorf("unexpected allocations: %v", n)
+	}
+}
+
+func BenchmarkRingGetKeyAppender(b *testing.B) {
+	for _, test := range []struct {
+		name string
+		key  func(int) Item
+	}{
+		{"writer", func(i int) Item { return StringItem(strconv.Itoa(i)) }},
+		{"appender", func(i int) Item { return appendItem(strconv.Itoa(i)) }},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			var r Ring
+			for i := 0; i < 100; i++ {
+				r.Insert(StringItem("item-"+strconv.Itoa(i)), 1)
+			}
+			keys := make([]Item, 1024)
+			for i := range keys {
+				keys[i] = test.key(i)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.Get(keys[i&(len(keys)-1)])
+			}
+		})
+	}
+}
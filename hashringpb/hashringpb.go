@@ -0,0 +1,125 @@
+// Package hashringpb provides protocol buffers encoding of the hashring state
+// described by hashring.proto schema.
+//
+// Package doesn't depend on any protocol buffers library. Messages are
+// encoded and decoded by hand following the protocol buffers wire format, so
+// snapshots can be exchanged with services written in other languages using
+// code generated from the schema.
+package hashringpb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+
+	"github.com/gobwas/hashring"
+)
+
+// Member corresponds to the Member message of the schema.
+type Member struct {
+	Item   []byte
+	Weight float64
+}
+
+// Ring corresponds to the Ring message of the schema.
+type Ring struct {
+	Members      []Member
+	MagicFactor  int64
+	PointsDigest uint64
+}
+
+// Item is an item of the ring built from the snapshot. It represents an
+// original item by its bytes.
+type Item string
+
+// WriteTo implements hashring.Item interface.
+func (x Item) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(x))
+	return int64(n), err
+}
+
+// FromRing returns snapshot of the ring r.
+// Note that r must not be mutated while snapshot is taken.
+func FromRing(r *hashring.Ring) (*Ring, error) {
+	var (
+		m   Ring
+		buf bytes.Buffer
+	)
+	for _, x := range r.View().Items() {
+		buf.Reset()
+		if _, err := x.WriteTo(&buf); err != nil {
+			return nil, err
+		}
+		w, _ := r.Weight(x)
+		m.Members = append(m.Members, Member{
+			Item:   append([]byte(nil), buf.Bytes()...),
+			Weight: w,
+		})
+	}
+	sort.Slice(m.Members, func(i, j int) bool {
+		return bytes.Compare(m.Members[i].Item, m.Members[j].Item) < 0
+	})
+	d, err := PointsDigest(r)
+	if err != nil {
+		return nil, err
+	}
+	m.MagicFactor = int64(r.MagicFactor)
+	m.PointsDigest = d
+
+	return &m, nil
+}
+
+// Build inserts members of the snapshot m into the ring r as Item items and
+// sets its magic factor. Ring r is expected to be empty and to have the same
+// hash settings as the ring the snapshot was taken from.
+func (m *Ring) Build(r *hashring.Ring) error {
+	if _, err := r.SetMagicFactor(int(m.MagicFactor)); err != nil {
+		return err
+	}
+	r.Begin()
+	for _, x := range m.Members {
+		if err := r.Insert(Item(x.Item), x.Weight); err != nil {
+			r.Commit()
+			return err
+		}
+	}
+	return r.Commit()
+}
+
+// Verify returns non-nil error if points of the ring r differ from the points
+// of the ring the snapshot was taken from.
+func (m *Ring) Verify(r *hashring.Ring) error {
+	d, err := PointsDigest(r)
+	if err != nil {
+		return err
+	}
+	if d != m.PointsDigest {
+		return fmt.Errorf(
+			"hashringpb: points digest mismatch: %#016x; want %#016x",
+			d, m.PointsDigest,
+		)
+	}
+	return nil
+}
+
+// PointsDigest returns the digest of points of the ring r as defined by the
+// schema.
+func PointsDigest(r *hashring.Ring) (d uint64, err error) {
+	var (
+		h = fnv.New64a()
+		b [8]byte
+	)
+	r.WalkRange(0, 0, func(p hashring.PointInfo) bool {
+		binary.LittleEndian.PutUint64(b[:], p.Value)
+		h.Write(b[:])
+		_, err = p.Item.WriteTo(h)
+		return err == nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return h.Sum64(), nil
+}
@@ -0,0 +1,76 @@
+package hashringpb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/gobwas/hashring"
+)
+
+func TestRingMarshal(t *testing.T) {
+	m := Ring{
+		Members: []Member{
+			{Item: []byte("a"), Weight: 1},
+		},
+		MagicFactor:  150,
+		PointsDigest: 1,
+	}
+	exp := []byte{
+		0x0a, 0x0c, // Field 1, 12 bytes.
+		0x0a, 0x01, 'a', // Field 1, 1 byte.
+		0x11, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // Field 2, double 1.0.
+		0x10, 0x96, 0x01, // Field 2, varint 150.
+		0x19, 1, 0, 0, 0, 0, 0, 0, 0, // Field 3, fixed64 1.
+	}
+	act := m.Marshal()
+	if !bytes.Equal(act, exp) {
+		t.Fatalf("unexpected encoding:\n%x\nwant:\n%x", act, exp)
+	}
+	var u Ring
+	if err := u.Unmarshal(append(act, 0x20, 0x01)); err != nil { // Unknown field 4.
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(u, m) {
+		t.Fatalf("unexpected decoded message: %+v; want %+v", u, m)
+	}
+	if err := u.Unmarshal(act[:len(act)-1]); err == nil {
+		t.Fatalf("want error on truncated message")
+	}
+}
+
+func TestRingSnapshot(t *testing.T) {
+	r0 := hashring.Ring{
+		MagicFactor: 100,
+	}
+	for x, w := range map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	} {
+		if err := r0.Insert(Item(x), w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m0, err := FromRing(&r0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m1 Ring
+	if err := m1.Unmarshal(m0.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	var r1 hashring.Ring
+	if err := m1.Build(&r1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m1.Verify(&r1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.Update(Item("foo"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m1.Verify(&r1); err == nil {
+		t.Fatalf("want verification error after ring mutation")
+	}
+}
@@ -0,0 +1,151 @@
+package hashringpb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Wire types of the protocol buffers encoding.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Marshal returns protocol buffers encoding of m.
+func (m *Ring) Marshal() []byte {
+	var b []byte
+	for _, x := range m.Members {
+		b = appendBytes(b, 1, x.marshal())
+	}
+	if m.MagicFactor != 0 {
+		b = appendTag(b, 2, wireVarint)
+		b = appendUvarint(b, uint64(m.MagicFactor))
+	}
+	if m.PointsDigest != 0 {
+		b = appendTag(b, 3, wireFixed64)
+		b = appendFixed64(b, m.PointsDigest)
+	}
+	return b
+}
+
+// Unmarshal parses protocol buffers encoding of the Ring message into m.
+// Unknown fields are skipped.
+func (m *Ring) Unmarshal(b []byte) error {
+	*m = Ring{}
+	return parse(b, func(num, typ int, v uint64, p []byte) error {
+		switch {
+		case num == 1 && typ == wireBytes:
+			var x Member
+			if err := x.unmarshal(p); err != nil {
+				return err
+			}
+			m.Members = append(m.Members, x)
+		case num == 2 && typ == wireVarint:
+			m.MagicFactor = int64(v)
+		case num == 3 && typ == wireFixed64:
+			m.PointsDigest = v
+		}
+		return nil
+	})
+}
+
+func (x *Member) marshal() []byte {
+	var b []byte
+	if len(x.Item) != 0 {
+		b = appendBytes(b, 1, x.Item)
+	}
+	if x.Weight != 0 {
+		b = appendTag(b, 2, wireFixed64)
+		b = appendFixed64(b, math.Float64bits(x.Weight))
+	}
+	return b
+}
+
+func (x *Member) unmarshal(b []byte) error {
+	return parse(b, func(num, typ int, v uint64, p []byte) error {
+		switch {
+		case num == 1 && typ == wireBytes:
+			x.Item = append([]byte(nil), p...)
+		case num == 2 && typ == wireFixed64:
+			x.Weight = math.Float64frombits(v)
+		}
+		return nil
+	})
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendTag(b []byte, num, typ int) []byte {
+	return appendUvarint(b, uint64(num)<<3|uint64(typ))
+}
+
+func appendBytes(b []byte, num int, p []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = appendUvarint(b, uint64(len(p)))
+	return append(b, p...)
+}
+
+// parse calls fn for each field of the encoded message b. For length-delimited
+// fields p holds the field's bytes; for other fields v holds its value.
+func parse(b []byte, fn func(num, typ int, v uint64, p []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("hashringpb: malformed tag")
+		}
+		b = b[n:]
+		var (
+			num = int(tag >> 3)
+			typ = int(tag & 7)
+			v   uint64
+			p   []byte
+		)
+		switch typ {
+		case wireVarint:
+			v, n = binary.Uvarint(b)
+			if n <= 0 {
+				return fmt.Errorf("hashringpb: malformed varint of field %d", num)
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return fmt.Errorf("hashringpb: malformed fixed64 of field %d", num)
+			}
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return fmt.Errorf("hashringpb: malformed fixed32 of field %d", num)
+			}
+			v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return fmt.Errorf("hashringpb: malformed length of field %d", num)
+			}
+			b = b[n:]
+			p, b = b[:size], b[size:]
+		default:
+			return fmt.Errorf("hashringpb: unsupported wire type %d of field %d", typ, num)
+		}
+		if num <= 0 {
+			return fmt.Errorf("hashringpb: malformed field number %d", num)
+		}
+		if err := fn(num, typ, v, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
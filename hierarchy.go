@@ -0,0 +1,335 @@
+package hashring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sync"
+)
+
+// Hierarchy is a tree of rings, where each ring selects a group of the next
+// level and the rings of the last level select items.
+//
+// For example, the first level ring may select a region, the second level
+// ring may select a zone within the region and the last level ring selects a
+// node within the zone. The weight of a group on its parent's ring is the sum
+// of weights of all its items.
+//
+// Hierarchy is goroutine safe. Hierarchy instances must not be copied.
+// The zero value for Hierarchy is an empty hierarchy ready to use.
+type Hierarchy struct {
+	// Hash is an optional function used to build up a new 64-bit hash function
+	// for rings of the hierarchy. See Ring.Hash for details.
+	Hash func() hash.Hash64
+
+	// MagicFactor is an optional magic factor used by rings of the hierarchy.
+	// See Ring.MagicFactor for details.
+	MagicFactor int
+
+	// wmu serializes write-only operations on the hierarchy.
+	wmu sync.Mutex
+
+	// mu protects root and children mappings of the nodes.
+	// Note that nodes rings are goroutine safe on their own.
+	mu   sync.RWMutex
+	root *hierarchyNode
+}
+
+type hierarchyNode struct {
+	// ring is a ring holding children of the node.
+	// It's nil for leaf nodes.
+	ring *Ring
+
+	// weight is a weight of the leaf node or a total weight of all leafs
+	// within the group node.
+	weight float64
+
+	// children is a mapping of a digest of a child's item to the child node.
+	children map[uint64]*hierarchyNode
+}
+
+func (n *hierarchyNode) sum() (w float64) {
+	for _, c := range n.children {
+		w += c.weight
+	}
+	return w
+}
+
+// Insert puts item x with weight w onto the ring addressed by the path of
+// groups. For example, Insert([]Item{region, zone}, node, w). Groups are
+// created if they don't exist.
+// It returns non-nil error when x already exists within the path's last
+// group or when some path item is not a group.
+// If weight is less or equal to zero Insert() panics.
+func (h *Hierarchy) Insert(path []Item, x Item, w float64) error {
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+
+	nodes, ids, err := h.descend(path, true)
+	if err != nil {
+		return err
+	}
+	last := nodes[len(nodes)-1]
+	if err := last.ring.checkWeight(w); err != nil {
+		return err
+	}
+	_, d, err := last.ring.locateItem(x)
+	if err != nil {
+		return err
+	}
+	id := d.hi
+	if _, has := last.children[id]; has {
+		return fmt.Errorf("hashring: item already exists")
+	}
+	h.link(last, id, &hierarchyNode{
+		weight: w,
+	})
+	if err := last.ring.Insert(x, w); err != nil {
+		h.unlink(last, id)
+		return err
+	}
+	return h.propagate(path, nodes, ids)
+}
+
+// Update updates weight of item x within the path's last group.
+// It returns non-nil error when x doesn't exist within the group.
+// If weight is less or equal to zero Update() panics.
+func (h *Hierarchy) Update(path []Item, x Item, w float64) error {
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+
+	nodes, ids, err := h.descend(path, false)
+	if err != nil {
+		return err
+	}
+	last := nodes[len(nodes)-1]
+	leaf, _, err := h.leaf(last, x)
+	if err != nil {
+		return err
+	}
+	if err := last.ring.Update(x, w); err != nil {
+		return err
+	}
+	leaf.weight = w
+
+	return h.propagate(path, nodes, ids)
+}
+
+// Delete removes item x from the path's last group.
+// Groups having no items left are removed as well.
+// It returns non-nil error when x doesn't exist within the group.
+func (h *Hierarchy) Delete(path []Item, x Item) error {
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+
+	nodes, ids, err := h.descend(path, false)
+	if err != nil {
+		return err
+	}
+	last := nodes[len(nodes)-1]
+	_, id, err := h.leaf(last, x)
+	if err != nil {
+		return err
+	}
+	if err := last.ring.Delete(x); err != nil {
+		return err
+	}
+	h.unlink(last, id)
+
+	return h.propagate(path, nodes, ids)
+}
+
+// Get returns mapping of v to previously inserted item.
+// Returned item is nil only when hierarchy is empty.
+func (h *Hierarchy) Get(v Item) Item {
+	var buf [4]Item
+	path := h.get(v, buf[:0])
+	if len(path) == 0 {
+		return nil
+	}
+	return path[len(path)-1]
+}
+
+// GetPath returns groups which v maps to on each level of the hierarchy
+// followed by the item v maps to.
+// Returned slice is empty only when hierarchy is empty.
+func (h *Hierarchy) GetPath(v Item) []Item {
+	return h.get(v, nil)
+}
+
+// get appends groups which v maps to on each level of the hierarchy followed
+// by the item v maps to to path.
+//
+// Groups are unlinked and their rings are emptied concurrently with get, thus
+// the walk from the root may end at a group instead of an item. In that case
+// the walk is retried, so that the returned path always ends with an item.
+func (h *Hierarchy) get(v Item, path []Item) []Item {
+	for {
+		ret, ok := h.walk(v, path)
+		if ok {
+			return ret
+		}
+	}
+}
+
+// walk is like get() but makes a single walk from the root. It returns false
+// if the walk ended at a group.
+func (h *Hierarchy) walk(v Item, path []Item) ([]Item, bool) {
+	h.mu.RLock()
+	node := h.root
+	h.mu.RUnlock()
+	if node == nil {
+		return path, true
+	}
+	// Each level gets its own salt (the first one is empty), so that key is
+	// placed independently on the rings of different levels.
+	var salt [8]byte
+	for level := 0; ; level++ {
+		var (
+			s   = node.ring.load()
+			d   value
+			err error
+		)
+		if level == 0 {
+			d, err = node.ring.check(s.hasher.sum(v, nil))
+		} else {
+			binary.LittleEndian.PutUint64(salt[:], uint64(level))
+			d, err = node.ring.check(s.hasher.sum(v, salt[:]))
+		}
+		if err != nil {
+			return path[:0], true
+		}
+		b := s.get(d)
+		if b == nil {
+			// Only the root ring is empty when the hierarchy is empty.
+			return path[:0], level == 0
+		}
+		path = append(path, b.item)
+
+		h.mu.RLock()
+		node = node.children[b.id]
+		h.mu.RUnlock()
+		switch {
+		case node == nil:
+			// Group was unlinked after it was selected.
+			return path[:0], false
+		case node.ring == nil:
+			return path, true
+		}
+	}
+}
+
+// descend returns nodes addressed by the path (starting from the root node)
+// along with digests of the path items. If create is true, it creates group
+// nodes which don't exist yet. Such nodes are not linked to their parents.
+//
+// h.wmu must be held.
+func (h *Hierarchy) descend(path []Item, create bool) ([]*hierarchyNode, []uint64, error) {
+	if h.root == nil {
+		h.mu.Lock()
+		h.root = h.newNode()
+		h.mu.Unlock()
+	}
+	var (
+		nodes = make([]*hierarchyNode, 1, len(path)+1)
+		ids   = make([]uint64, len(path))
+	)
+	nodes[0] = h.root
+	for i, g := range path {
+		parent := nodes[i]
+		_, d, err := parent.ring.locateItem(g)
+		if err != nil {
+			return nil, nil, err
+		}
+		id := d.hi
+		child := parent.children[id]
+		switch {
+		case child == nil && !create:
+			return nil, nil, fmt.Errorf("hashring: group doesn't exist")
+		case child == nil:
+			child = h.newNode()
+		case child.ring == nil:
+			return nil, nil, fmt.Errorf("hashring: path item is not a group")
+		}
+		ids[i] = id
+		nodes = append(nodes, child)
+	}
+	return nodes, ids, nil
+}
+
+// leaf returns leaf node of x within group node n.
+//
+// h.wmu must be held.
+func (h *Hierarchy) leaf(n *hierarchyNode, x Item) (*hierarchyNode, uint64, error) {
+	_, d, err := n.ring.locateItem(x)
+	if err != nil {
+		return nil, 0, err
+	}
+	id := d.hi
+	leaf := n.children[id]
+	if leaf == nil || leaf.ring != nil {
+		return nil, 0, fmt.Errorf("hashring: item doesn't exist")
+	}
+	return leaf, id, nil
+}
+
+// propagate updates weights of the groups addressed by the path after
+// mutation of the path's last group. It links new groups to their parents and
+// unlinks groups having no items.
+//
+// h.wmu must be held.
+func (h *Hierarchy) propagate(path []Item, nodes []*hierarchyNode, ids []uint64) (err error) {
+	for i := len(path) - 1; i >= 0 && err == nil; i-- {
+		var (
+			parent = nodes[i]
+			child  = nodes[i+1]
+			prev   = child.weight
+		)
+		child.weight = child.sum()
+
+		_, linked := parent.children[ids[i]]
+		switch {
+		case len(child.children) == 0:
+			if linked {
+				// Note that child must be deleted from the ring first to not
+				// let readers to get unlinked group.
+				err = parent.ring.Delete(path[i])
+				h.unlink(parent, ids[i])
+			}
+		case !linked:
+			// Note that child must be linked first to not let readers to get
+			// unlinked group.
+			h.link(parent, ids[i], child)
+			if err = parent.ring.Insert(path[i], child.weight); err != nil {
+				// Child is a new group, so dropping it drops the whole
+				// mutation made within it.
+				h.unlink(parent, ids[i])
+			}
+		case prev != child.weight:
+			err = parent.ring.Update(path[i], child.weight)
+		}
+	}
+	return err
+}
+
+func (h *Hierarchy) link(parent *hierarchyNode, id uint64, child *hierarchyNode) {
+	h.mu.Lock()
+	parent.children[id] = child
+	h.mu.Unlock()
+}
+
+func (h *Hierarchy) unlink(parent *hierarchyNode, id uint64) {
+	h.mu.Lock()
+	delete(parent.children, id)
+	h.mu.Unlock()
+}
+
+func (h *Hierarchy) newNode() *hierarchyNode {
+	return &hierarchyNode{
+		ring: &Ring{
+			Hash:        h.Hash,
+			MagicFactor: h.MagicFactor,
+		},
+		children: make(map[uint64]*hierarchyNode),
+	}
+}
@@ -0,0 +1,173 @@
+package hashring
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHierarchy(t *testing.T) {
+	var h Hierarchy
+	if x := h.Get(IntItem(42)); x != nil {
+		t.Fatalf("unexpected item from empty hierarchy")
+	}
+	for _, leaf := range []struct {
+		path []Item
+		item StringItem
+		w    float64
+	}{
+		{[]Item{StringItem("eu"), StringItem("eu-1")}, "n1", 1},
+		{[]Item{StringItem("eu"), StringItem("eu-1")}, "n2", 1},
+		{[]Item{StringItem("eu"), StringItem("eu-2")}, "n3", 2},
+		{[]Item{StringItem("us"), StringItem("us-1")}, "n4", 4},
+	} {
+		if err := h.Insert(leaf.path, leaf.item, leaf.w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Insert([]Item{StringItem("eu")}, StringItem("eu-1"), 1); err == nil {
+		t.Fatalf("want error on group insertion as an item; got nothing")
+	}
+	if err := h.Insert([]Item{StringItem("eu"), StringItem("eu-1"), StringItem("n1")}, StringItem("x"), 1); err == nil {
+		t.Fatalf("want error on item used as a group; got nothing")
+	}
+
+	const numGet = 1e5
+	dist := make(map[string]float64)
+	for i := 0; i < numGet; i++ {
+		path := h.GetPath(IntItem(i))
+		if n := len(path); n != 3 {
+			t.Fatalf("unexpected path length: %d", n)
+		}
+		if x := h.Get(IntItem(i)); x != path[2] {
+			t.Fatalf("Get() and GetPath() mismatch: %v vs %v", x, path)
+		}
+		dist[string(path[0].(StringItem))] += 100 / numGet
+		dist[string(path[2].(StringItem))] += 100 / numGet
+	}
+	assertDistribution(t, dist, map[string]float64{
+		"eu": 50,
+		"us": 50,
+		"n1": 12.5,
+		"n2": 12.5,
+		"n3": 25,
+		"n4": 50,
+	}, 3)
+
+	if err := h.Delete([]Item{StringItem("us"), StringItem("us-1")}, StringItem("n4")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if path := h.GetPath(IntItem(i)); path[0] != StringItem("eu") {
+			t.Fatalf("unexpected path after deletion: %v", path)
+		}
+	}
+	if err := h.Update([]Item{StringItem("us"), StringItem("us-1")}, StringItem("n4"), 1); err == nil {
+		t.Fatalf("want error on removed group update; got nothing")
+	}
+}
+
+func TestHierarchyLevelsIndependent(t *testing.T) {
+	var h Hierarchy
+	// Group rings are identical to the root ring, so without per level salt
+	// the key would always be mapped to the item named after its group.
+	for _, g := range []StringItem{"a", "b"} {
+		for _, x := range []StringItem{"a", "b"} {
+			if err := h.Insert([]Item{g}, x, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	const numGet = 1e5
+	dist := make(map[string]float64)
+	for i := 0; i < numGet; i++ {
+		path := h.GetPath(IntItem(i))
+		key := string(path[0].(StringItem)) + string(path[1].(StringItem))
+		dist[key] += 100 / numGet
+	}
+	assertDistribution(t, dist, map[string]float64{
+		"aa": 25,
+		"ab": 25,
+		"ba": 25,
+		"bb": 25,
+	}, 3)
+}
+
+func TestHierarchyInsertGroupError(t *testing.T) {
+	var (
+		h  Hierarchy
+		g0 = idItem{id: "g0", key: "group"}
+		// Group having different identity but the same bytes can't be put on
+		// the ring along with g0.
+		g1 = idItem{id: "g1", key: "group"}
+	)
+	if err := h.Insert([]Item{g0}, StringItem("x"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Insert([]Item{g1}, StringItem("y"), 1); err == nil {
+		t.Fatalf("want error on failed group insertion; got nothing")
+	}
+	if n := len(h.root.children); n != 1 {
+		t.Fatalf("unexpected number of groups: %d; want 1", n)
+	}
+	for i := 0; i < 1000; i++ {
+		path := h.GetPath(IntItem(i))
+		if len(path) != 2 || path[0] != g0 || path[1] != StringItem("x") {
+			t.Fatalf("unexpected path after failed insertion: %v", path)
+		}
+	}
+	if err := h.Delete([]Item{g1}, StringItem("y")); err == nil {
+		t.Fatalf("want error on deletion from unlinked group; got nothing")
+	}
+}
+
+func TestHierarchyConcurrentGet(t *testing.T) {
+	var (
+		h    Hierarchy
+		keep = []Item{StringItem("group-keep")}
+		flap = []Item{StringItem("group-flap")}
+	)
+	if err := h.Insert(keep, StringItem("node-keep"), 1); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Group is linked and unlinked over and over again, as well as its
+		// ring is filled and emptied.
+		for i := 0; i < 100; i++ {
+			if err := h.Insert(flap, StringItem("node-flap"), 1); err != nil {
+				t.Error(err)
+				break
+			}
+			if err := h.Delete(flap, StringItem("node-flap")); err != nil {
+				t.Error(err)
+				break
+			}
+		}
+		close(done)
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				x := h.Get(IntItem(j))
+				if s, _ := x.(StringItem); !strings.HasPrefix(string(s), "node-") {
+					t.Errorf("Get() returned non-leaf item: %v", x)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,115 @@
+package hashring
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// ArcHistogram describes distribution of the lengths of arcs between
+// consecutive points of the ring. Lengths are fractions of the hash space, so
+// they sum up to one.
+//
+// For a good hash function lengths are distributed approximately
+// exponentially with mean of one divided by the number of points.
+type ArcHistogram struct {
+	// Arcs is the number of arcs, which is equal to the number of points.
+	Arcs int
+
+	// Min, Max and Mean are the minimum, maximum and mean lengths of arcs.
+	Min, Max, Mean float64
+
+	// Stddev is the standard deviation of lengths of arcs.
+	Stddev float64
+
+	// Bins holds the number of arcs having length within equal intervals
+	// between Min and Max.
+	Bins []ArcBin
+}
+
+// ArcBin is a single interval of the ArcHistogram.
+type ArcBin struct {
+	// Lo and Hi are the bounds of the interval. Lo is inclusive, and Hi is
+	// exclusive for all bins except the last one.
+	Lo, Hi float64
+
+	// Count is the number of arcs having length within the interval.
+	Count int
+}
+
+// ArcHistogram returns distribution of the lengths of arcs between
+// consecutive points of the ring split into given number of bins.
+// Arc of the point is the part of the hash space from the previous point
+// (exclusive) to the point itself (inclusive), i.e. the keys mapped to it.
+// It returns zero ArcHistogram if the ring is empty.
+// If bins is less or equal to zero ArcHistogram() panics.
+func (r *Ring) ArcHistogram(bins int) ArcHistogram {
+	if bins <= 0 {
+		panic(fmt.Sprintf("hashring: malformed number of bins: %d", bins))
+	}
+	s := r.load()
+	arcs := s.arcLengths()
+	if len(arcs) == 0 {
+		return ArcHistogram{}
+	}
+	h := ArcHistogram{
+		Arcs: len(arcs),
+		Min:  math.Inf(1),
+		Max:  math.Inf(-1),
+		Bins: make([]ArcBin, bins),
+	}
+	var sum float64
+	for _, a := range arcs {
+		h.Min = math.Min(h.Min, a)
+		h.Max = math.Max(h.Max, a)
+		sum += a
+	}
+	h.Mean = sum / float64(len(arcs))
+	var dev float64
+	for _, a := range arcs {
+		dev += (a - h.Mean) * (a - h.Mean)
+	}
+	h.Stddev = math.Sqrt(dev / float64(len(arcs)))
+
+	width := (h.Max - h.Min) / float64(bins)
+	for i := range h.Bins {
+		h.Bins[i].Lo = h.Min + width*float64(i)
+		h.Bins[i].Hi = h.Min + width*float64(i+1)
+	}
+	h.Bins[bins-1].Hi = h.Max
+	for _, a := range arcs {
+		i := bins - 1
+		if width > 0 {
+			i = int((a - h.Min) / width)
+		}
+		if i >= bins {
+			i = bins - 1
+		}
+		h.Bins[i].Count++
+	}
+	return h
+}
+
+// arcLengths returns lengths of the arcs of the ring points in order of the
+// points values.
+func (s *ringState) arcLengths() []float64 {
+	max := s.tree.Max()
+	if max == nil {
+		return nil
+	}
+	if s.tree.Size() == 1 {
+		return []float64{1}
+	}
+	var (
+		arcs = make([]float64, 0, s.tree.Size())
+		prev = max.(*point).val.hi
+	)
+	s.tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		arcs = append(arcs, float64(p.val.hi-prev)/(1<<64))
+		prev = p.val.hi
+		return true
+	})
+	return arcs
+}
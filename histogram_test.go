@@ -0,0 +1,66 @@
+package hashring
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRingArcHistogram(t *testing.T) {
+	var empty Ring
+	if h := empty.ArcHistogram(10); h.Arcs != 0 || h.Bins != nil {
+		t.Fatalf("unexpected histogram of empty ring: %+v", h)
+	}
+
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	})
+	h := r.ArcHistogram(10)
+	if n := r.tree().Size(); h.Arcs != n {
+		t.Fatalf("unexpected number of arcs: %d; want %d", h.Arcs, n)
+	}
+	if len(h.Bins) != 10 {
+		t.Fatalf("unexpected number of bins: %d", len(h.Bins))
+	}
+	if exp := 1 / float64(h.Arcs); math.Abs(h.Mean-exp) > 1e-9 {
+		t.Errorf("unexpected mean: %g; want %g", h.Mean, exp)
+	}
+	if h.Min > h.Mean || h.Mean > h.Max {
+		t.Errorf("mean %g is not within [%g, %g]", h.Mean, h.Min, h.Max)
+	}
+	var count int
+	for i, b := range h.Bins {
+		if b.Lo > b.Hi {
+			t.Errorf("bin #%d has malformed bounds: [%g, %g]", i, b.Lo, b.Hi)
+		}
+		count += b.Count
+	}
+	if count != h.Arcs {
+		t.Errorf("bins hold %d arcs; want %d", count, h.Arcs)
+	}
+	if h.Bins[0].Lo != h.Min || h.Bins[9].Hi != h.Max {
+		t.Errorf("bins don't span [%g, %g]", h.Min, h.Max)
+	}
+	if h.Bins[0].Count == 0 || h.Bins[9].Count == 0 {
+		t.Errorf("edge bins are empty: %+v", h.Bins)
+	}
+
+	var single Ring
+	single.MagicFactor = 1
+	single.Insert(StringItem("foo"), 1)
+	h = single.ArcHistogram(3)
+	if h.Arcs != 1 || h.Min != 1 || h.Max != 1 || h.Bins[2].Count != 1 {
+		t.Fatalf("unexpected histogram of single point ring: %+v", h)
+	}
+}
+
+func TestRingArcHistogramPanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("want panic")
+		}
+	}()
+	var r Ring
+	r.ArcHistogram(0)
+}
@@ -1,5 +1,7 @@
 package hashring
 
+import "time"
+
 //go:generate gtrace -tag hashring_trace
 
 //gtrace:gen
@@ -8,6 +10,7 @@ type traceRing struct {
 	OnDelete    func(*point) traceRingDelete
 	OnFix       func(*point) traceRingFix
 	OnFixNeeded func(*point)
+	OnRebuild   func(points int) traceRingRebuild
 }
 
 //gtrace:gen
@@ -28,3 +31,8 @@ type traceRingDelete struct {
 type traceRingFix struct {
 	OnDone func()
 }
+
+//gtrace:gen
+type traceRingRebuild struct {
+	OnDone func(added, removed int, duration time.Duration)
+}
@@ -7,8 +7,9 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
-	"github.com/gobwas/avl"
+	"github.com/gobwas/hashring/internal/avl"
 )
 
 const debug = true
@@ -97,12 +98,22 @@ func setupRingTrace(r *Ring) {
 				},
 			}
 		},
+		OnRebuild: func(points int) traceRingRebuild {
+			log.Printf("rebuilding %d points", points)
+			enter()
+			return traceRingRebuild{
+				OnDone: func(added, removed int, d time.Duration) {
+					leave()
+					log.Printf("rebuilt: +%d -%d points in %s", added, removed, d)
+				},
+			}
+		},
 	})
 }
 
 func pointInfo(p *point) string {
 	return fmt.Sprintf(
 		"%p: %s[%d] %v %d",
-		p, p.bucket.item, p.index, p.stack, p.val,
+		p, p.bucket.item, p.index, p.stack(), p.val,
 	)
 }
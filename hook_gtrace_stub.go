@@ -5,6 +5,10 @@
 
 package hashring
 
+import (
+	"time"
+)
+
 // Compose returns a new traceRing which has functional fields composed
 // both from t and x.
 func (t traceRing) Compose(x traceRing) (ret traceRing) {
@@ -84,6 +88,27 @@ func (t traceRing) Compose(x traceRing) (ret traceRing) {
 			h2(p)
 		}
 	}
+	switch {
+	case t.OnRebuild == nil:
+		ret.OnRebuild = x.OnRebuild
+	case x.OnRebuild == nil:
+		ret.OnRebuild = t.OnRebuild
+	default:
+		h1 := t.OnRebuild
+		h2 := x.OnRebuild
+		ret.OnRebuild = func(i int) traceRingRebuild {
+			r1 := h1(i)
+			r2 := h2(i)
+			switch {
+			case r1.isZero():
+				return r2
+			case r2.isZero():
+				return r1
+			default:
+				return r1.Compose(r2)
+			}
+		}
+	}
 	return ret
 }
 
@@ -107,6 +132,12 @@ func (traceRing) onFix(*point) traceRingFix {
 func (traceRing) onFixNeeded(*point) {
 }
 
+var gtraceNoopTraceRingRebuild6c1b7f2e traceRingRebuild
+
+func (traceRing) onRebuild(int) traceRingRebuild {
+	return gtraceNoopTraceRingRebuild6c1b7f2e
+}
+
 // Compose returns a new traceRingInsert which has functional fields composed
 // both from t and x.
 func (t traceRingInsert) Compose(x traceRingInsert) (ret traceRingInsert) {
@@ -279,3 +310,32 @@ func (t traceRingFix) isZero() bool {
 }
 func (traceRingFix) onDone() {
 }
+
+// Compose returns a new traceRingRebuild which has functional fields composed
+// both from t and x.
+func (t traceRingRebuild) Compose(x traceRingRebuild) (ret traceRingRebuild) {
+	switch {
+	case t.OnDone == nil:
+		ret.OnDone = x.OnDone
+	case x.OnDone == nil:
+		ret.OnDone = t.OnDone
+	default:
+		h1 := t.OnDone
+		h2 := x.OnDone
+		ret.OnDone = func(i int, i1 int, d time.Duration) {
+			h1(i, i1, d)
+			h2(i, i1, d)
+		}
+	}
+	return ret
+}
+
+// isZero checks whether t is empty
+func (t traceRingRebuild) isZero() bool {
+	if t.OnDone != nil {
+		return false
+	}
+	return true
+}
+func (traceRingRebuild) onDone(int, int, time.Duration) {
+}
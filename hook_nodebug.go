@@ -6,7 +6,7 @@ package hashring
 import (
 	"io"
 
-	"github.com/gobwas/avl"
+	"github.com/gobwas/hashring/internal/avl"
 )
 
 const debug = false
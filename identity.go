@@ -0,0 +1,202 @@
+package hashring
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Identifier is an optional interface of an Item which has an identity
+// distinct from its bytes.
+//
+// By default an item is identified by the digest of its bytes, thus two
+// distinct items whose bytes digests are equal can't be put on the same
+// ring. If an Item implements Identifier, it is identified by its ID()
+// instead, while its bytes are still used to calculate values of its points.
+// That is, distinct items having equal bytes digests can coexist on the ring
+// and their points collide, which is handled according to Ring.Collision.
+// The number of such items is reported by Ring.DigestCollisions().
+//
+// Items having equal IDs are considered equal by the ring. IDs share the
+// digest space with the bytes of the items not implementing Identifier, so
+// such an item and an Identifier having ID equal to its bytes are also
+// considered equal.
+//
+// Note that items having equal bytes but distinct IDs can't be put on the
+// same ring, since all of their points would have exactly the same values.
+type Identifier interface {
+	ID() string
+}
+
+// ident returns digest identifying x, which is the digest of x.ID() if x
+// implements Identifier or the digest of x's bytes otherwise.
+func (h *hasher) ident(x Item) (value, error) {
+	if i, ok := x.(Identifier); ok {
+		return h.sumKey([]byte(i.ID()), nil), nil
+	}
+	return h.sum(x, nil)
+}
+
+// identify returns digest identifying x along with the digest of its bytes.
+// Both are equal if x doesn't implement Identifier.
+func (h *hasher) identify(x Item) (id, key uint64, err error) {
+	d, err := h.sum(x, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if i, ok := x.(Identifier); ok {
+		return h.sumKey([]byte(i.ID()), nil).hi, d.hi, nil
+	}
+	return d.hi, d.hi, nil
+}
+
+// locateItem is like locate() but returns digest identifying x.
+func (r *Ring) locateItem(x Item) (*ringState, value, error) {
+	s := r.load()
+	d, err := r.check(s.hasher.ident(x))
+	return s, d, err
+}
+
+// identify returns digest identifying x along with the digest of its bytes
+// calculated by the current hash function.
+//
+// r.mu must be held.
+func (r *Ring) identify(x Item) (id, key uint64, err error) {
+	id, key, err = r.current().hasher.identify(x)
+	if err != nil && !r.conf.Strict {
+		panic(err.Error())
+	}
+	return id, key, err
+}
+
+// checkIdentity returns non-nil error if x having bytes digest key can't be
+// put on the ring along with the items of r.buckets. Existing bucket
+// identified by the same digest as x (if any) is given as b.
+//
+// r.mu must be held.
+func (r *Ring) checkIdentity(x Item, key uint64, b *bucket) error {
+	_, identified := x.(Identifier)
+	if b != nil && b.weight != 0 {
+		if !identified && b.key == key {
+			same, err := sameBytes(x, b.item)
+			if err != nil {
+				return r.checkErr(err)
+			}
+			if same {
+				return fmt.Errorf("hashring: item already exists")
+			}
+			return fmt.Errorf(
+				"hashring: digest of item %v collides with digest of item %v; "+
+					"implement Identifier to put both items on the ring",
+				x, b.item,
+			)
+		}
+		return fmt.Errorf("hashring: item already exists")
+	}
+	if !identified && r.identified == 0 {
+		// Items having equal bytes digests are identified by the same
+		// digest, so b is the only item which may have the same bytes.
+		return nil
+	}
+	var p []byte
+	for _, o := range r.buckets {
+		if o == b || o.weight == 0 || o.key != key {
+			continue
+		}
+		if p == nil {
+			var err error
+			if p, err = itemKey(x); err != nil {
+				return r.checkErr(err)
+			}
+		}
+		q, err := itemKey(o.item)
+		if err != nil {
+			return r.checkErr(err)
+		}
+		if bytes.Equal(p, q) {
+			return fmt.Errorf(
+				"hashring: item %v has the same bytes as item %v", x, o.item,
+			)
+		}
+	}
+	return nil
+}
+
+// sameBytes reports whether items x and y have equal bytes.
+func sameBytes(x, y Item) (bool, error) {
+	p, err := itemKey(x)
+	if err != nil {
+		return false, err
+	}
+	q, err := itemKey(y)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(p, q), nil
+}
+
+// UpdateByID updates weight of the item identified by id on the ring. It is
+// like Update() but doesn't need the item itself, which is useful when items
+// are tracked by their IDs, e.g. by service discovery.
+//
+// An item is identified by id if it implements Identifier and its ID()
+// returns id, or if it doesn't implement Identifier and its bytes are equal
+// to id.
+// If weight is less or equal to zero UpdateByID() panics (or returns an
+// error if r.Strict is true).
+func (r *Ring) UpdateByID(id string, w float64) error {
+	if err := r.checkWeight(w); err != nil {
+		return err
+	}
+	return r.updateByID(id, w)
+}
+
+// DeleteByID removes the item identified by id from the ring. It is like
+// Delete() but doesn't need the item itself. See UpdateByID() for details.
+func (r *Ring) DeleteByID(id string) error {
+	return r.updateByID(id, 0)
+}
+
+func (r *Ring) updateByID(id string, w float64) error {
+	r.lock()
+	defer r.mu.Unlock()
+
+	d := r.current().hasher.sumKey([]byte(id), nil)
+	b, has := r.buckets[d.hi]
+	if !has || b.weight == 0 {
+		return fmt.Errorf("hashring: item doesn't exist")
+	}
+	return r.setWeight(b.item, w)
+}
+
+// DigestCollisions returns the number of items on the ring whose bytes
+// digests are equal to the bytes digest of some other item on the ring.
+// Such items must implement Identifier to coexist on the ring (see
+// Identifier for details).
+func (r *Ring) DigestCollisions() int {
+	return r.load().digestCollisions
+}
+
+// digestCollisions returns the number of buckets having equal bytes digests
+// and the number of buckets of items implementing Identifier.
+//
+// r.mu must be held.
+func (r *Ring) digestCollisions() (collisions, identified int) {
+	for _, b := range r.buckets {
+		if b.key != b.id {
+			identified++
+		}
+	}
+	if identified == 0 {
+		return 0, 0
+	}
+	keys := make(map[uint64]int, len(r.buckets))
+	for _, b := range r.buckets {
+		keys[b.key]++
+	}
+	for _, n := range keys {
+		if n > 1 {
+			collisions += n
+		}
+	}
+	return collisions, identified
+}
@@ -0,0 +1,174 @@
+package hashring
+
+import (
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+type idItem struct {
+	id  string
+	key string
+}
+
+func (x idItem) ID() string { return x.id }
+
+func (x idItem) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, x.key)
+	return int64(n), err
+}
+
+func (x idItem) String() string { return x.id }
+
+// collidingKeys returns two distinct keys having equal digests under h.
+func collidingKeys(h func() hash.Hash64) (string, string) {
+	seen := make(map[uint64]string)
+	for i := 0; ; i++ {
+		key := "key-" + strconv.Itoa(i)
+		d := h()
+		io.WriteString(d, key)
+		if prev, has := seen[d.Sum64()]; has {
+			return prev, key
+		}
+		seen[d.Sum64()] = key
+	}
+}
+
+func TestRingIdentifier(t *testing.T) {
+	h := func() hash.Hash64 {
+		return maskHash{xxhash.New(), 0xfff}
+	}
+	k0, k1 := collidingKeys(h)
+
+	plain := Ring{
+		Hash:        h,
+		MagicFactor: 16,
+		Strict:      true,
+	}
+	if err := plain.Insert(StringItem(k0), 1); err != nil {
+		t.Fatal(err)
+	}
+	err := plain.Insert(StringItem(k1), 1)
+	if err == nil || !strings.Contains(err.Error(), "collides") {
+		t.Fatalf("unexpected error: %v; want digest collision error", err)
+	}
+	if err := plain.Insert(StringItem(k0), 1); err == nil ||
+		!strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("unexpected error: %v; want duplicate error", err)
+	}
+
+	var (
+		a = idItem{"a", k0}
+		b = idItem{"b", k1}
+	)
+	r := Ring{
+		Hash:        h,
+		MagicFactor: 16,
+		Strict:      true,
+	}
+	for _, x := range []Item{a, b} {
+		if err := r.Insert(x, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []Item{a, b} {
+		if !r.Has(x) {
+			t.Fatalf("item %v is not on the ring", x)
+		}
+		if n := len(r.PointsOf(x)); n == 0 {
+			t.Fatalf("item %v has no points", x)
+		}
+	}
+	// Identity doesn't depend on the bytes.
+	if !r.Has(idItem{"a", "other"}) {
+		t.Fatalf("item is not found by its id")
+	}
+	if n := r.DigestCollisions(); n != 2 {
+		t.Fatalf("unexpected number of digest collisions: %d; want 2", n)
+	}
+	if n := r.expvarStats().DigestCollisions; n != 2 {
+		t.Fatalf("unexpected number of digest collisions in stats: %d; want 2", n)
+	}
+
+	for _, test := range []struct {
+		name string
+		item Item
+		err  string
+	}{
+		{"same id", idItem{"a", "other"}, "already exists"},
+		{"same bytes", idItem{"c", k0}, "same bytes"},
+		{"plain same bytes", StringItem(k1), "same bytes"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := r.Insert(test.item, 1)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("unexpected error: %v; want %q", err, test.err)
+			}
+		})
+	}
+
+	if err := r.Delete(idItem{"b", ""}); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.DigestCollisions(); n != 0 {
+		t.Fatalf("unexpected number of digest collisions: %d; want 0", n)
+	}
+	if err := r.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Has(b) || r.DigestCollisions() != 2 {
+		t.Fatalf("rollback didn't restore identified item")
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRingUpdateByID(t *testing.T) {
+	var (
+		a = idItem{"a", "foo"}
+		b = idItem{"b", "bar"}
+		c = StringItem("baz")
+	)
+	var r Ring
+	for _, x := range []Item{a, b, c} {
+		if err := r.Insert(x, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.UpdateByID("a", 3); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := r.Weight(a); w != 3 {
+		t.Fatalf("unexpected weight: %v; want 3", w)
+	}
+	// Items not implementing Identifier are identified by their bytes.
+	if err := r.UpdateByID("baz", 2); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := r.Weight(c); w != 2 {
+		t.Fatalf("unexpected weight: %v; want 2", w)
+	}
+	if err := r.DeleteByID("foo"); err == nil {
+		t.Fatalf("want error on deletion by item bytes")
+	}
+	if err := r.DeleteByID("b"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Has(b) {
+		t.Fatalf("deleted item is still on the ring")
+	}
+	if err := r.DeleteByID("b"); err == nil {
+		t.Fatalf("want error on deletion of missing item")
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
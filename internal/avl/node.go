@@ -0,0 +1,367 @@
+package avl
+
+import "unsafe"
+
+// NodeSize is the size in bytes of a single tree node.
+const NodeSize = int(unsafe.Sizeof(node{}))
+
+// node is a node of a tree.
+type node struct {
+	value Item
+	left  *node
+	right *node
+	h     int // Subtree height.
+	n     int // Subtree size.
+}
+
+// build builds a perfectly balanced tree of sorted items.
+func build(items []Item) *node {
+	if len(items) == 0 {
+		return nil
+	}
+	m := len(items) / 2
+	n := &node{
+		value: items[m],
+		left:  build(items[:m]),
+		right: build(items[m+1:]),
+	}
+	n.adjust()
+	return n
+}
+
+func (n *node) size() int {
+	if n == nil {
+		return 0
+	}
+	return n.n
+}
+
+func (n *node) insert(x Item) (root *node, existing Item) {
+	if n == nil {
+		return &node{
+			value: x,
+			h:     1,
+			n:     1,
+		}, nil
+	}
+	cmp := x.Compare(n.value)
+	switch {
+	case cmp < 0:
+		var m *node
+		m, existing = n.left.insert(x)
+		if existing == nil {
+			root = n.clone()
+			root.left = m
+		}
+	case cmp > 0:
+		var m *node
+		m, existing = n.right.insert(x)
+		if existing == nil {
+			root = n.clone()
+			root.right = m
+		}
+	default:
+		existing = n.value
+	}
+	if root == nil {
+		// x is not inserted.
+		return n, existing
+	}
+
+	root.adjust()
+
+	return root.rebalance(), nil
+}
+
+func (n *node) delete(x Item) (root *node, existed Item) {
+	if n == nil {
+		return nil, nil
+	}
+	cmp := x.Compare(n.value)
+	switch {
+	case cmp < 0:
+		var m *node
+		m, existed = n.left.delete(x)
+		if existed != nil {
+			root = n.clone()
+			root.left = m
+		}
+	case cmp > 0:
+		var m *node
+		m, existed = n.right.delete(x)
+		if existed != nil {
+			root = n.clone()
+			root.right = m
+		}
+	default:
+		root = n.destroy()
+		existed = n.value
+	}
+	if existed == nil {
+		// x is not present in n.
+		return n, nil
+	}
+	if root == nil {
+		// x was the last element of n.
+		return nil, existed
+	}
+
+	root.adjust()
+
+	return root.rebalance(), existed
+}
+
+func (n *node) max() Item {
+	if n == nil {
+		return nil
+	}
+	for n.right != nil {
+		n = n.right
+	}
+	return n.value
+}
+
+func (n *node) min() Item {
+	if n == nil {
+		return nil
+	}
+	for n.left != nil {
+		n = n.left
+	}
+	return n.value
+}
+
+func (n *node) search(x Item) Item {
+	for n != nil {
+		cmp := x.Compare(n.value)
+		switch {
+		case cmp < 0:
+			n = n.left
+		case cmp > 0:
+			n = n.right
+		default:
+			return n.value
+		}
+	}
+	return nil
+}
+
+func (n *node) predecessor(x Item) (p Item) {
+	for n != nil {
+		cmp := x.Compare(n.value)
+		switch {
+		case cmp < 0:
+			n = n.left
+		case cmp > 0:
+			p = n.value
+			n = n.right
+		default:
+			if n.left != nil {
+				return n.left.max()
+			}
+			return p
+		}
+	}
+	return p
+}
+
+func (n *node) successor(x Item) (s Item) {
+	for n != nil {
+		cmp := x.Compare(n.value)
+		switch {
+		case cmp < 0:
+			s = n.value
+			n = n.left
+		case cmp > 0:
+			n = n.right
+		default:
+			if n.right != nil {
+				return n.right.min()
+			}
+			return s
+		}
+	}
+	return s
+}
+
+func (n *node) select_(i int) Item {
+	if i < 0 || i >= n.size() {
+		return nil
+	}
+	for {
+		l := n.left.size()
+		switch {
+		case i < l:
+			n = n.left
+		case i > l:
+			i -= l + 1
+			n = n.right
+		default:
+			return n.value
+		}
+	}
+}
+
+func (n *node) rank(x Item) (r int) {
+	for n != nil {
+		if x.Compare(n.value) <= 0 {
+			n = n.left
+		} else {
+			r += n.left.size() + 1
+			n = n.right
+		}
+	}
+	return r
+}
+
+func (n *node) inOrder(fn func(Item) bool) bool {
+	if n == nil {
+		return true
+	}
+	return n.left.inOrder(fn) && fn(n.value) && n.right.inOrder(fn)
+}
+
+func (n *node) destroy() *node {
+	switch {
+	case n.left != nil && n.right != nil:
+		//    (a)           e
+		//    / \          / \
+		//   b   c  =>    b   c
+		//  / \          /
+		// d  [e]       d
+		m := n.left.max()
+
+		root := new(node)
+		root.value = m
+		root.left, _ = n.left.delete(m)
+		root.right = n.right
+
+		return root
+
+	case n.left != nil:
+		return n.left
+
+	case n.right != nil:
+		return n.right
+
+	default:
+		return nil
+	}
+}
+
+// adjust updates height and size of n after its children change.
+func (n *node) adjust() {
+	n.h = max(n.left.height(), n.right.height()) + 1
+	n.n = n.left.size() + n.right.size() + 1
+}
+
+func (n *node) height() int {
+	if n == nil {
+		return 0
+	}
+	return n.h
+}
+
+func (n *node) balance() int {
+	if n == nil {
+		return 0
+	}
+	return n.right.height() - n.left.height()
+}
+
+func (n *node) rebalance() (root *node) {
+	// b is greater than 1 when tree is right-heavy.
+	// b is less than -1 when tree is left-heavy.
+	// note that balance is simply right.height() - left.height().
+	b := n.balance()
+	switch {
+	case b < -1 && n.left.balance() <= 0:
+		//     (a)      b
+		//     /       / \
+		//    b   =>  c   a
+		//   /
+		//  c
+		return n.rotateRight()
+
+	case b > 1 && n.right.balance() >= 0:
+		//  (a)           b
+		//    \          / \
+		//     b    =>  a   c
+		//      \
+		//       c
+		return n.rotateLeft()
+
+	case b < -1 && n.left.balance() > 0:
+		//     a        (a)        b
+		//    /         /         / \
+		//  (c)   =>   b     =>  c   a
+		//    \       /
+		//     b     c
+		n = n.clone()
+		n.left = n.left.rotateLeft()
+		return n.rotateRight()
+
+	case b > 1 && n.right.balance() < 0:
+		//  a       (a)           b
+		//   \        \          / \
+		//   (c) =>    b    =>  a   c
+		//   /          \
+		//  b            c
+		n = n.clone()
+		n.right = n.right.rotateRight()
+		return n.rotateLeft()
+
+	case b > 1 || b < -1:
+		panic("avl: internal error: balancing error")
+	}
+	return n
+}
+
+func (n *node) rotateRight() *node {
+	//     (a)        b
+	//     / \       / \
+	//    b   c =>  d   a
+	//   / \           / \
+	//  d   e         e   c
+	root := n.left.clone()
+	node := n.clone()
+	node.left = root.right
+	root.right = node
+
+	node.adjust()
+	root.adjust()
+
+	return root
+}
+
+func (n *node) rotateLeft() *node {
+	//     c         (a)
+	//    / \        / \
+	//   a   e  <=  b   c
+	//  / \            / \
+	// b   d          d   e
+	root := n.right.clone()
+	node := n.clone()
+	node.right = root.left
+	root.left = node
+
+	node.adjust()
+	root.adjust()
+
+	return root
+}
+
+func (n *node) clone() *node {
+	if n == nil {
+		return nil
+	}
+	cp := *n
+	return &cp
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
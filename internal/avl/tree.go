@@ -0,0 +1,105 @@
+// Package avl implements an immutable AVL tree.
+//
+// It is derived from the github.com/gobwas/avl package and extends it with
+// size-annotated nodes, which allows rank and select operations to run in
+// O(log n) time.
+package avl
+
+// Item holds a piece of information needed to be stored (or searched by) in a
+// tree.
+//
+// It's common to use different Item types for store and lookup while all of
+// the types are consistent in comparisons.
+type Item interface {
+	// Compare compares item itself with another item usually stored in a tree.
+	// It reports whether the receiver is less, greater or equal to the given
+	// Item by returning values less than, greater than or equal to zero
+	// respectively.
+	Compare(Item) int
+}
+
+// Tree is an immutable container holding root of an AVL tree.
+// Modifying operations (Insert() and Delete()) are immutable and return copy
+// of the tree.
+//
+// Note that Tree holds pointer to the root of an AVL tree internally, which
+// makes Tree so called reference type. That is, there is no cases when you may
+// need to pass pointer to instance of the Tree.
+type Tree struct {
+	root *node
+}
+
+// Build returns a tree holding given items, which must be sorted in
+// ascending order and must not contain equal items.
+// The time complexity is O(n).
+func Build(items []Item) Tree {
+	return Tree{root: build(items)}
+}
+
+// Size returns the size of a tree.
+// The time complexity is O(1).
+func (t Tree) Size() int {
+	return t.root.size()
+}
+
+// Insert inserts a new node with value x in the tree.
+// It returns a copy of the tree and already existing item, which non-nil value
+// means that x was not inserted.
+func (t Tree) Insert(x Item) (_ Tree, existing Item) {
+	t.root, existing = t.root.insert(x)
+	return t, existing
+}
+
+// Delete deletes a node having value x from the tree.
+// It returns a copy of the tree and a value of deleted node if such node was
+// present.
+func (t Tree) Delete(x Item) (_ Tree, existed Item) {
+	t.root, existed = t.root.delete(x)
+	return t, existed
+}
+
+// Max returns max value of the tree.
+func (t Tree) Max() Item {
+	return t.root.max()
+}
+
+// Min returns min value of the tree.
+func (t Tree) Min() Item {
+	return t.root.min()
+}
+
+// Search searches for a node having value x and return its value.
+// Note that x and node's value essentially can be a different types sharing
+// comparison logic.
+func (t Tree) Search(x Item) Item {
+	return t.root.search(x)
+}
+
+// Predecessor finds a node in the tree which is an in-order predecessor of a
+// node having value x. It returns value of found node or nil.
+func (t Tree) Predecessor(x Item) Item {
+	return t.root.predecessor(x)
+}
+
+// Successor finds a node in the tree which is an in-order successor of a node
+// having value x. It returns value of found node or nil.
+func (t Tree) Successor(x Item) Item {
+	return t.root.successor(x)
+}
+
+// Select returns i-th smallest value of the tree (starting from zero).
+// It returns nil if i is out of [0, t.Size()) range.
+func (t Tree) Select(i int) Item {
+	return t.root.select_(i)
+}
+
+// Rank returns the number of values of the tree which are less than x.
+func (t Tree) Rank(x Item) int {
+	return t.root.rank(x)
+}
+
+// InOrder prepares in-order traversal of the tree and calls fn with value of
+// each visited node. If fn returns false it stops traversal.
+func (t Tree) InOrder(fn func(Item) bool) {
+	t.root.inOrder(fn)
+}
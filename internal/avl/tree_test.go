@@ -0,0 +1,151 @@
+package avl
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type intItem int
+
+func (x intItem) Compare(y Item) int {
+	return int(x) - int(y.(intItem))
+}
+
+func TestTree(t *testing.T) {
+	var (
+		tree Tree
+		set  = make(map[int]bool)
+		prev []Tree
+	)
+	for i := 0; i < 5000; i++ {
+		x := rand.Intn(1000)
+		if rand.Intn(3) == 0 {
+			var existed Item
+			tree, existed = tree.Delete(intItem(x))
+			if (existed != nil) != set[x] {
+				t.Fatalf("unexpected deletion result of %d: %v", x, existed)
+			}
+			delete(set, x)
+		} else {
+			var existing Item
+			tree, existing = tree.Insert(intItem(x))
+			if (existing != nil) != set[x] {
+				t.Fatalf("unexpected insertion result of %d: %v", x, existing)
+			}
+			set[x] = true
+		}
+		if i%100 == 0 {
+			prev = append(prev, tree)
+		}
+		assertTree(t, tree, set)
+	}
+	// Check that previous versions of the tree are still valid.
+	for _, p := range prev {
+		assertBalanced(t, p.root)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 10, 1000} {
+		var (
+			items = make([]Item, n)
+			set   = make(map[int]bool, n)
+		)
+		for i := range items {
+			items[i] = intItem(i * 2)
+			set[i*2] = true
+		}
+		tree := Build(items)
+		assertTree(t, tree, set)
+
+		// Check that built tree is valid for further modifications.
+		tree, _ = tree.Insert(intItem(1))
+		set[1] = true
+		assertTree(t, tree, set)
+	}
+}
+
+func assertTree(t *testing.T, tree Tree, set map[int]bool) {
+	t.Helper()
+
+	exp := make([]int, 0, len(set))
+	for x := range set {
+		exp = append(exp, x)
+	}
+	sort.Ints(exp)
+
+	if n := tree.Size(); n != len(exp) {
+		t.Fatalf("unexpected size: %d; want %d", n, len(exp))
+	}
+	var act []int
+	tree.InOrder(func(x Item) bool {
+		act = append(act, int(x.(intItem)))
+		return true
+	})
+	for i := range exp {
+		if act[i] != exp[i] {
+			t.Fatalf("unexpected in-order values: %v; want %v", act, exp)
+		}
+		if x := tree.Select(i); int(x.(intItem)) != exp[i] {
+			t.Fatalf("unexpected Select(%d): %v; want %v", i, x, exp[i])
+		}
+		if r := tree.Rank(intItem(exp[i])); r != i {
+			t.Fatalf("unexpected Rank(%d): %d; want %d", exp[i], r, i)
+		}
+	}
+	if tree.Select(-1) != nil || tree.Select(len(exp)) != nil {
+		t.Fatalf("unexpected Select() result out of range")
+	}
+	for _, x := range []int{-1, 0, 500, 999, 1000} {
+		i := sort.SearchInts(exp, x)
+		if r := tree.Rank(intItem(x)); r != i {
+			t.Fatalf("unexpected Rank(%d): %d; want %d", x, r, i)
+		}
+		j := sort.SearchInts(exp, x+1)
+		if s := tree.Successor(intItem(x)); (s == nil) != (j == len(exp)) || (s != nil && int(s.(intItem)) != exp[j]) {
+			t.Fatalf("unexpected Successor(%d): %v", x, s)
+		}
+		if p := tree.Predecessor(intItem(x)); (p == nil) != (i == 0) || (p != nil && int(p.(intItem)) != exp[i-1]) {
+			t.Fatalf("unexpected Predecessor(%d): %v", x, p)
+		}
+		if s := tree.Search(intItem(x)); (s != nil) != set[x] {
+			t.Fatalf("unexpected Search(%d): %v", x, s)
+		}
+	}
+	if len(exp) > 0 {
+		if x := tree.Min(); int(x.(intItem)) != exp[0] {
+			t.Fatalf("unexpected Min(): %v", x)
+		}
+		if x := tree.Max(); int(x.(intItem)) != exp[len(exp)-1] {
+			t.Fatalf("unexpected Max(): %v", x)
+		}
+	}
+	var n int
+	tree.InOrder(func(Item) bool {
+		n++
+		return n < 3
+	})
+	if exp := len(exp); n != 3 && n != exp {
+		t.Fatalf("InOrder() didn't stop")
+	}
+	assertBalanced(t, tree.root)
+}
+
+func assertBalanced(t *testing.T, n *node) {
+	t.Helper()
+	if n == nil {
+		return
+	}
+	if b := n.balance(); b < -1 || b > 1 {
+		t.Fatalf("node is not balanced: %d", b)
+	}
+	if h := max(n.left.height(), n.right.height()) + 1; n.h != h {
+		t.Fatalf("unexpected height: %d; want %d", n.h, h)
+	}
+	if s := n.left.size() + n.right.size() + 1; n.n != s {
+		t.Fatalf("unexpected size: %d; want %d", n.n, s)
+	}
+	assertBalanced(t, n.left)
+	assertBalanced(t, n.right)
+}
@@ -1,7 +1,7 @@
 package hashring
 
 import (
-	"github.com/gobwas/avl"
+	"github.com/gobwas/hashring/internal/avl"
 )
 
 func compare(x0, x1 uint64) int {
@@ -17,20 +17,91 @@ func compare(x0, x1 uint64) int {
 type bucket struct {
 	id     uint64
 	points []*point
+
+	// key is a non-suffixed digest of the item bytes. It differs from id
+	// only if the item implements Identifier.
+	key uint64
+
+	// stacks holds a history of values of the bucket's points which were
+	// moved due to collisions, indexed by point index.
+	// It's non-nil only if some point collided with another one.
+	stacks map[int][]value
+
 	item   Item
 	weight float64
+	meta   interface{}
+	loads  *loads
+
+	// stable is true if bucket's points are ordered under CollisionStable
+	// policy.
+	stable bool
+
+	// stream is an optional function calculating digests of the item's bytes
+	// followed by a suffix, which holds the state of the hash function built
+	// by streamHasher after reading the bytes of KeyReader item.
+	stream       func(suffix []byte) value
+	streamHasher *hasher
 }
 
 func newBucket(id uint64, item Item, weight float64) *bucket {
 	return &bucket{
 		id:     id,
+		key:    id,
 		item:   item,
 		weight: weight,
 	}
 }
 
-type search uint64
+// member holds an item on the ring along with its weight and metadata.
+// Unlike bucket, member is never changed once created.
+type member struct {
+	item   Item
+	key    uint64
+	weight float64
+	meta   interface{}
+	loads  *loads
+}
+
+// value represents a position on the ring.
+// Note that lo is always zero for rings operating in 64-bit hash space.
+type value struct {
+	hi, lo uint64
+}
+
+func (v value) compare(x value) int {
+	if c := compare(v.hi, x.hi); c != 0 {
+		return c
+	}
+	return compare(v.lo, x.lo)
+}
+
+type search value
 
 func (s search) Compare(x avl.Item) int {
-	return compare(uint64(s), x.(*point).val)
+	return value(s).compare(x.(*point).val)
+}
+
+// upper is a search key which is greater than any point having the same
+// value. It is used to find the point owning the value, which is the first
+// point having greater value even if there are points with equal values
+// (under CollisionStable policy).
+type upper value
+
+func (u upper) Compare(x avl.Item) int {
+	if c := value(u).compare(x.(*point).val); c != 0 {
+		return c
+	}
+	return 1
+}
+
+// lower is a search key which is less than any point having the same value.
+// It is used to find the first point having the value (under CollisionStable
+// policy).
+type lower value
+
+func (l lower) Compare(x avl.Item) int {
+	if c := value(l).compare(x.(*point).val); c != 0 {
+		return c
+	}
+	return -1
 }
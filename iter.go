@@ -0,0 +1,37 @@
+//go:build go1.23
+
+package hashring
+
+import "iter"
+
+// All returns an iterator over items on the ring along with their weights.
+// Items are yielded in unspecified order.
+//
+// Note that iterator yields items of the ring's version taken at the moment
+// of the All call. That is, loop body is free to call ring's methods.
+func (r *Ring) All() iter.Seq2[Item, float64] {
+	s := r.load()
+	return func(yield func(Item, float64) bool) {
+		for _, m := range s.members {
+			if !yield(m.item, m.weight) {
+				return
+			}
+		}
+	}
+}
+
+// Points returns an iterator over points on the ring in clockwise order,
+// starting from the point having the lowest value.
+//
+// Note that iterator yields points of the ring's version taken at the moment
+// of the Points call. That is, loop body is free to call ring's methods.
+func (r *Ring) Points() iter.Seq[PointInfo] {
+	tree := r.tree()
+	return func(yield func(PointInfo) bool) {
+		for x := tree.Min(); x != nil; x = tree.Successor(x) {
+			if !yield(x.(*point).info()) {
+				return
+			}
+		}
+	}
+}
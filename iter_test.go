@@ -0,0 +1,53 @@
+//go:build go1.23
+
+package hashring
+
+import "testing"
+
+func TestRingAll(t *testing.T) {
+	items := map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	}
+	r := makeRing(t, items)
+	var n int
+	for x, w := range r.All() {
+		if exp := items[string(x.(StringItem))]; w != exp {
+			t.Errorf("unexpected weight of %s: %v; want %v", x, w, exp)
+		}
+		n++
+	}
+	if n != len(items) {
+		t.Errorf("unexpected number of items: %d", n)
+	}
+}
+
+func TestRingPoints(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	})
+	var (
+		ps   = ringPoints(r)
+		i    int
+		prev uint64
+	)
+	for p := range r.Points() {
+		if i > 0 && p.Value < prev {
+			t.Fatalf("points are not ordered")
+		}
+		if exp := ps[i].info(); p != exp {
+			t.Fatalf("unexpected point #%d: %+v; want %+v", i, p, exp)
+		}
+		prev = p.Value
+		i++
+	}
+	if i != len(ps) {
+		t.Fatalf("unexpected number of points: %d; want %d", i, len(ps))
+	}
+	for range r.Points() {
+		break
+	}
+}
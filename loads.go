@@ -0,0 +1,59 @@
+package hashring
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// loadStripes is a number of counters each loads counter consists of.
+// Striping reduces contention of concurrent Get() calls for the same item.
+const loadStripes = 8
+
+// loads counts Get() calls resolved to an item.
+type loads struct {
+	stripes [loadStripes]struct {
+		n uint64
+		_ [56]byte // Padding to avoid false sharing.
+	}
+}
+
+// add increments one of the counter stripes. The stripe is chosen by the
+// stack address of the calling goroutine, so concurrent calls made by
+// different goroutines (even for the same hot key) are likely to hit
+// different stripes.
+func (l *loads) add() {
+	var x byte
+	i := mix64(uint64(uintptr(unsafe.Pointer(&x))), 0) % loadStripes
+	atomic.AddUint64(&l.stripes[i].n, 1)
+}
+
+func (l *loads) load() (n uint64) {
+	for i := range l.stripes {
+		n += atomic.LoadUint64(&l.stripes[i].n)
+	}
+	return n
+}
+
+// Load holds the number of lookups resolved to an item.
+type Load struct {
+	Item  Item
+	Count uint64
+}
+
+// Loads returns a number of Get() and GetSpread() calls resolved to each item
+// of the ring since it was inserted, in no particular order.
+// It returns nil if r.CountLoads is false.
+func (r *Ring) Loads() []Load {
+	if !r.countLoads() {
+		return nil
+	}
+	s := r.load()
+	ls := make([]Load, 0, len(s.members))
+	for _, x := range s.members {
+		ls = append(ls, Load{
+			Item:  x.item,
+			Count: x.loads.load(),
+		})
+	}
+	return ls
+}
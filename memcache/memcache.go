@@ -0,0 +1,428 @@
+// Package memcache provides memcached servers selection backed by the
+// consistent hashing ring.
+//
+// ServerList implements the ServerSelector interface of the
+// github.com/bradfitz/gomemcache/memcache package, so it can be used as:
+//
+//	var ss memcache.ServerList
+//	ss.SetServers("10.0.0.1:11211", "10.0.0.2:11211")
+//	client := gomemcache.NewFromSelector(&ss)
+//
+// Pool in turn maintains clients (connections) to the servers of the list,
+// creating and closing them on membership changes.
+package memcache
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gobwas/hashring"
+)
+
+// ErrNoServers is returned when there are no servers to pick from.
+var ErrNoServers = fmt.Errorf("memcache: no servers configured or available")
+
+// ServerList is a list of memcached servers which picks a server for the key
+// using consistent hashing.
+//
+// ServerList is goroutine safe. ServerList instances must not be copied.
+// The zero value for ServerList is an empty list ready to use.
+type ServerList struct {
+	// Ketama makes ServerList to pick servers the same way as libketama and
+	// its derivatives (libmemcached, twemproxy and others) do. That is,
+	// servers picked for keys are compatible with other clients which use
+	// ketama consistent hashing.
+	// It must not be changed after first use.
+	Ketama bool
+
+	// OnChange is an optional function which is called after the list was
+	// changed with the servers added to and removed from it.
+	OnChange func(added, removed []net.Addr)
+
+	ring hashring.Ring
+
+	mu      sync.RWMutex
+	servers map[string]*server
+	ketama  continuum
+}
+
+type server struct {
+	name   string
+	addr   net.Addr
+	weight float64
+}
+
+func (s *server) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, s.name)
+	return int64(n), err
+}
+
+// SetServers changes the list of servers to the given ones having equal
+// weights. See SetWeightedServers() for details.
+func (ss *ServerList) SetServers(servers ...string) error {
+	ws := make(map[string]float64, len(servers))
+	for _, s := range servers {
+		ws[s] = 1
+	}
+	return ss.SetWeightedServers(ws)
+}
+
+// SetWeightedServers changes the list of servers to the given ones. Servers
+// are given as a mapping of server address to its weight. Addresses in form
+// of "host:port" are resolved as TCP addresses; addresses containing a slash
+// are treated as unix socket paths.
+//
+// Only the servers which were added, removed or changed their weights
+// relocate keys. Server which address resolves differently than before keeps
+// its keys, but is reported to OnChange as removed with the previous address
+// and added with the new one.
+// If some address can't be resolved, weight is not positive or the ring can't
+// be changed (see hashring.Ring.Apply()) the list is left unchanged.
+func (ss *ServerList) SetWeightedServers(servers map[string]float64) error {
+	next, err := resolveServers(servers)
+	if err != nil {
+		return err
+	}
+	return ss.set(next)
+}
+
+// resolveServers returns servers made of the mapping of server address to its
+// weight.
+func resolveServers(servers map[string]float64) (map[string]*server, error) {
+	next := make(map[string]*server, len(servers))
+	for name, w := range servers {
+		if w <= 0 {
+			return nil, fmt.Errorf("memcache: malformed weight of %q: %v", name, w)
+		}
+		addr, err := resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		next[name] = &server{
+			name:   name,
+			addr:   addr,
+			weight: w,
+		}
+	}
+	return next, nil
+}
+
+// set changes the list of servers to the next ones.
+func (ss *ServerList) set(next map[string]*server) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var added, removed []net.Addr
+	for name, prev := range ss.servers {
+		if s, has := next[name]; !has || !sameAddr(s, prev) {
+			removed = append(removed, prev.addr)
+		}
+	}
+	for name, s := range next {
+		if prev, has := ss.servers[name]; !has || !sameAddr(s, prev) {
+			added = append(added, s.addr)
+		}
+	}
+	if ss.Ketama {
+		ss.ketama = newContinuum(next)
+	} else if err := ss.reconcile(next); err != nil {
+		return err
+	}
+	ss.servers = next
+	if ss.OnChange != nil && (len(added) > 0 || len(removed) > 0) {
+		ss.OnChange(added, removed)
+	}
+	return nil
+}
+
+// reconcile makes the ring to hold next servers. If it returns non-nil error
+// the ring is left unchanged.
+//
+// ss.mu must be held.
+func (ss *ServerList) reconcile(next map[string]*server) error {
+	cur := make(map[string]*server, len(ss.servers))
+	for name, s := range ss.servers {
+		cur[name] = s
+	}
+	return ss.ring.Apply(func() error {
+		return ss.apply(cur, next)
+	})
+}
+
+// apply changes the ring holding cur servers to hold next ones. It updates
+// cur as changes are made, so it holds the servers on the ring even if apply
+// fails.
+//
+// ss.mu must be held.
+func (ss *ServerList) apply(cur, next map[string]*server) (err error) {
+	for name, prev := range cur {
+		if _, has := next[name]; has {
+			continue
+		}
+		if err := ss.ring.Delete(prev); err != nil {
+			return err
+		}
+		delete(cur, name)
+	}
+	for name, s := range next {
+		prev, has := cur[name]
+		switch {
+		case !has:
+			err = ss.ring.Insert(s, s.weight)
+		case !sameAddr(s, prev):
+			// Server is inserted again to make the ring hold its new
+			// address. Its points are the same, since they are made of
+			// the server's name.
+			if err = ss.ring.Delete(prev); err == nil {
+				err = ss.ring.Insert(s, s.weight)
+			}
+		case prev.weight != s.weight:
+			err = ss.ring.Update(s, s.weight)
+		}
+		if err != nil {
+			return err
+		}
+		cur[name] = s
+	}
+	return nil
+}
+
+// sameAddr reports whether servers a and b have the same address.
+func sameAddr(a, b *server) bool {
+	return a.addr.String() == b.addr.String()
+}
+
+// PickServer returns the server address that a given item should be sharded
+// onto.
+func (ss *ServerList) PickServer(key string) (net.Addr, error) {
+	if ss.Ketama {
+		ss.mu.RLock()
+		s := ss.ketama.get(key)
+		ss.mu.RUnlock()
+		if s == nil {
+			return nil, ErrNoServers
+		}
+		return s.addr, nil
+	}
+	x := ss.ring.Get(stringKey(key))
+	if x == nil {
+		return nil, ErrNoServers
+	}
+	return x.(*server).addr, nil
+}
+
+// Each iterates over each server calling the given function.
+// It stops the iteration and returns the first non-nil error returned by fn.
+func (ss *ServerList) Each(fn func(net.Addr) error) error {
+	ss.mu.RLock()
+	addrs := make([]net.Addr, 0, len(ss.servers))
+	for _, s := range ss.servers {
+		addrs = append(addrs, s.addr)
+	}
+	ss.mu.RUnlock()
+
+	for _, addr := range addrs {
+		if err := fn(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Client is a client of a single memcached server.
+type Client interface {
+	Close() error
+}
+
+// Pool maintains clients of the memcached servers and picks a client for the
+// key using consistent hashing.
+//
+// Pool is goroutine safe. Pool instances must not be copied.
+type Pool struct {
+	// Servers is a list of servers which clients are maintained by the pool.
+	// Note that Servers.OnChange field is used by the pool and must not be
+	// set.
+	Servers ServerList
+
+	// Dial is a function used to create client of the server with given
+	// address. It must not be nil.
+	Dial func(addr net.Addr) (Client, error)
+
+	mu      sync.RWMutex
+	clients map[string]Client
+}
+
+// SetServers changes the list of pool's servers to the given ones having
+// equal weights. See SetWeightedServers() for details.
+func (p *Pool) SetServers(servers ...string) error {
+	ws := make(map[string]float64, len(servers))
+	for _, s := range servers {
+		ws[s] = 1
+	}
+	return p.SetWeightedServers(ws)
+}
+
+// SetWeightedServers changes the list of pool's servers to the given ones.
+// Clients of the new servers are created with p.Dial; clients of the removed
+// servers are closed. Each address is resolved once, so the clients are
+// created for the same addresses as the list picks.
+// If some client can't be created the list is left unchanged.
+func (p *Pool) SetWeightedServers(servers map[string]float64) error {
+	next, err := resolveServers(servers)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.clients == nil {
+		p.clients = make(map[string]Client)
+	}
+	var dialed []string
+	for _, s := range next {
+		key := s.addr.String()
+		if _, has := p.clients[key]; has {
+			continue
+		}
+		c, err := p.Dial(s.addr)
+		if err != nil {
+			p.drop(dialed)
+			return err
+		}
+		p.clients[key] = c
+		dialed = append(dialed, key)
+	}
+	p.Servers.OnChange = func(_, removed []net.Addr) {
+		keys := make([]string, len(removed))
+		for i, addr := range removed {
+			keys[i] = addr.String()
+		}
+		p.drop(keys)
+	}
+	if err := p.Servers.set(next); err != nil {
+		p.drop(dialed)
+		return err
+	}
+	return nil
+}
+
+// drop closes and removes clients with given keys.
+//
+// p.mu must be held.
+func (p *Pool) drop(keys []string) {
+	for _, key := range keys {
+		if c, has := p.clients[key]; has {
+			c.Close()
+			delete(p.clients, key)
+		}
+	}
+}
+
+// Get returns client of the server that a given item should be sharded onto.
+func (p *Pool) Get(key string) (Client, error) {
+	addr, err := p.Servers.PickServer(key)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.RLock()
+	c, has := p.clients[addr.String()]
+	p.mu.RUnlock()
+	if !has {
+		return nil, ErrNoServers
+	}
+	return c, nil
+}
+
+// Close closes all clients of the pool and empties its servers list.
+func (p *Pool) Close() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, c := range p.clients {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(p.clients, key)
+	}
+	p.Servers.OnChange = nil
+	p.Servers.SetServers()
+	return err
+}
+
+// resolve resolves the server address. It's a variable to be replaced in
+// tests.
+var resolve = func(name string) (net.Addr, error) {
+	if strings.Contains(name, "/") {
+		return net.ResolveUnixAddr("unix", name)
+	}
+	return net.ResolveTCPAddr("tcp", name)
+}
+
+type stringKey string
+
+func (s stringKey) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(s))
+	return int64(n), err
+}
+
+// continuum is a ketama compatible consistent hashing continuum.
+type continuum []ketamaPoint
+
+type ketamaPoint struct {
+	value  uint32
+	server *server
+}
+
+// ketamaPoints is the number of points per server (multiplied by the number of
+// servers and weight ratio) used by libketama.
+const ketamaPoints = 160
+
+func newContinuum(servers map[string]*server) continuum {
+	var total float64
+	for _, s := range servers {
+		total += s.weight
+	}
+	var c continuum
+	for _, s := range servers {
+		pct := s.weight / total
+		n := int(pct * ketamaPoints / 4 * float64(len(servers)))
+		for i := 0; i < n; i++ {
+			d := md5.Sum([]byte(s.name + "-" + strconv.Itoa(i)))
+			for h := 0; h < 4; h++ {
+				c = append(c, ketamaPoint{
+					value:  binary.LittleEndian.Uint32(d[h*4:]),
+					server: s,
+				})
+			}
+		}
+	}
+	sort.Slice(c, func(i, j int) bool {
+		if c[i].value != c[j].value {
+			return c[i].value < c[j].value
+		}
+		return c[i].server.name < c[j].server.name
+	})
+	return c
+}
+
+func (c continuum) get(key string) *server {
+	if len(c) == 0 {
+		return nil
+	}
+	d := md5.Sum([]byte(key))
+	h := binary.LittleEndian.Uint32(d[:4])
+	i := sort.Search(len(c), func(i int) bool {
+		return c[i].value >= h
+	})
+	if i == len(c) {
+		i = 0
+	}
+	return c[i].server
+}
@@ -0,0 +1,244 @@
+package memcache
+
+import (
+	"hash"
+	"hash/fnv"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/gobwas/hashring"
+)
+
+func TestServerList(t *testing.T) {
+	for _, ketama := range []bool{false, true} {
+		name := "ring"
+		if ketama {
+			name = "ketama"
+		}
+		t.Run(name, func(t *testing.T) {
+			ss := ServerList{
+				Ketama: ketama,
+			}
+			if _, err := ss.PickServer("foo"); err != ErrNoServers {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err := ss.SetServers(
+				"127.0.0.1:11211",
+				"127.0.0.2:11211",
+				"127.0.0.3:11211",
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var n int
+			ss.Each(func(net.Addr) error {
+				n++
+				return nil
+			})
+			if n != 3 {
+				t.Fatalf("unexpected number of servers: %d", n)
+			}
+
+			const keys = 10000
+			prev := make([]string, keys)
+			dist := make(map[string]int)
+			for i := range prev {
+				addr, err := ss.PickServer(strconv.Itoa(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				prev[i] = addr.String()
+				dist[prev[i]]++
+			}
+			for addr, n := range dist {
+				if n < keys/5 {
+					t.Errorf("too few keys on %s: %d", addr, n)
+				}
+			}
+
+			err = ss.SetServers(
+				"127.0.0.1:11211",
+				"127.0.0.2:11211",
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range prev {
+				addr, _ := ss.PickServer(strconv.Itoa(i))
+				if prev[i] != "127.0.0.3:11211" && addr.String() != prev[i] {
+					t.Fatalf("key %d moved from %s to %s", i, prev[i], addr)
+				}
+			}
+		})
+	}
+}
+
+// maskHash makes the ring points collide often.
+type maskHash struct {
+	hash.Hash64
+	mask uint64
+}
+
+func (h maskHash) Sum64() uint64 {
+	return h.Hash64.Sum64() & h.mask
+}
+
+func TestServerListError(t *testing.T) {
+	var ss ServerList
+	ss.ring.Hash = func() hash.Hash64 {
+		return maskHash{fnv.New64a(), 0xfff}
+	}
+	ss.ring.MagicFactor = 16
+	ss.ring.Collision = hashring.CollisionError
+
+	initial := []string{"127.0.0.1:11211", "127.0.0.2:11211"}
+	if err := ss.SetServers(initial...); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; ; i++ {
+		if i == 256 {
+			t.Skip("no colliding server found")
+		}
+		addr := "127.0.1." + strconv.Itoa(i) + ":11211"
+		err := ss.SetWeightedServers(map[string]float64{
+			initial[1]: 1,
+			addr:       2,
+		})
+		if err != nil {
+			break
+		}
+		// Restore the initial state and try again.
+		if err := ss.SetServers(initial...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var addrs []string
+	ss.Each(func(addr net.Addr) error {
+		addrs = append(addrs, addr.String())
+		return nil
+	})
+	sort.Strings(addrs)
+	if !reflect.DeepEqual(addrs, initial) {
+		t.Fatalf("unexpected servers after failed change: %v; want %v", addrs, initial)
+	}
+	if n := ss.ring.Len(); n != len(initial) {
+		t.Fatalf("unexpected number of ring items: %d; want %d", n, len(initial))
+	}
+	// Ring must not be left in deferred mode.
+	if err := ss.SetServers(initial[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n := ss.ring.Len(); n != 1 {
+		t.Fatalf("unexpected number of ring items: %d; want 1", n)
+	}
+}
+
+type client struct {
+	addr   net.Addr
+	closed bool
+}
+
+func (c *client) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestPool(t *testing.T) {
+	clients := make(map[string]*client)
+	p := Pool{
+		Dial: func(addr net.Addr) (Client, error) {
+			c := &client{addr: addr}
+			clients[addr.String()] = c
+			return c, nil
+		},
+	}
+	if err := p.SetServers("127.0.0.1:11211", "127.0.0.2:11211"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := p.Servers.PickServer("foo")
+	if c.(*client).addr.String() != addr.String() {
+		t.Fatalf("unexpected client: %v; want %v", c.(*client).addr, addr)
+	}
+	if err := p.SetServers("127.0.0.2:11211", "127.0.0.3:11211"); err != nil {
+		t.Fatal(err)
+	}
+	if !clients["127.0.0.1:11211"].closed {
+		t.Errorf("client of removed server is not closed")
+	}
+	if clients["127.0.0.2:11211"].closed {
+		t.Errorf("client of remaining server is closed")
+	}
+	if len(clients) != 3 {
+		t.Errorf("unexpected number of dialed clients: %d", len(clients))
+	}
+	p.Close()
+	for addr, c := range clients {
+		if !c.closed {
+			t.Errorf("client of %s is not closed", addr)
+		}
+	}
+	if _, err := p.Get("foo"); err != ErrNoServers {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPoolChangingAddresses(t *testing.T) {
+	// Each resolution of the name gives a new address, as DNS may answer
+	// differently on each query.
+	var n int
+	defer func(fn func(string) (net.Addr, error)) {
+		resolve = fn
+	}(resolve)
+	resolve = func(name string) (net.Addr, error) {
+		n++
+		return &net.TCPAddr{
+			IP:   net.IPv4(10, 0, byte(n>>8), byte(n)),
+			Port: 11211,
+		}, nil
+	}
+
+	clients := make(map[string]*client)
+	p := Pool{
+		Dial: func(addr net.Addr) (Client, error) {
+			c := &client{addr: addr}
+			clients[addr.String()] = c
+			return c, nil
+		},
+	}
+	names := []string{"a:11211", "b:11211", "c:11211"}
+	for i := 0; i < 2; i++ {
+		if err := p.SetServers(names...); err != nil {
+			t.Fatal(err)
+		}
+		if m := len(clients); m != (i+1)*len(names) {
+			t.Fatalf("unexpected number of dialed clients: %d", m)
+		}
+		for j := 0; j < 100; j++ {
+			key := strconv.Itoa(j)
+			c, err := p.Get(key)
+			if err != nil {
+				t.Fatalf("can't get client of %q: %v", key, err)
+			}
+			if c.(*client).closed {
+				t.Fatalf("got closed client of %q", key)
+			}
+		}
+	}
+	var closed int
+	for _, c := range clients {
+		if c.closed {
+			closed++
+		}
+	}
+	if closed != len(names) {
+		t.Fatalf("unexpected number of closed clients: %d; want %d", closed, len(names))
+	}
+	p.Close()
+}
@@ -0,0 +1,84 @@
+package hashring
+
+import (
+	"unsafe"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// mapEntryOverhead is a rough estimate of the per-entry overhead of Go maps,
+// that is, tophash byte, bucket overflow pointer and load factor slack.
+const mapEntryOverhead = 8
+
+// MemStats describes estimated memory used by the ring. All values are in
+// bytes.
+//
+// Estimates take into account only ring's own data structures. Memory used by
+// the items, their metadata and by the previous versions of the ring which
+// are still referenced by readers is not counted.
+type MemStats struct {
+	// Points is the memory used by the points and by the tree nodes holding
+	// them.
+	Points int
+
+	// Stacks is the memory used by the history of values of the points which
+	// were moved due to hash collisions.
+	Stacks int
+
+	// Buckets is the memory used to hold items of the ring along with their
+	// weights and load counters.
+	Buckets int
+
+	// Collisions is the memory used by the trees of collided points.
+	Collisions int
+
+	// Index is the memory used by the skip list if Ring.SkipList is true.
+	Index int
+}
+
+// Total returns total estimated memory used by the ring.
+func (m MemStats) Total() int {
+	return m.Points + m.Stacks + m.Buckets + m.Collisions + m.Index
+}
+
+// MemStats returns an estimate of memory used by the ring.
+// It takes O(n) time, where n is the number of ring's points.
+func (r *Ring) MemStats() (m MemStats) {
+	const (
+		ptrSize    = int(unsafe.Sizeof(uintptr(0)))
+		pointSize  = int(unsafe.Sizeof(point{}))
+		valueSize  = int(unsafe.Sizeof(value{}))
+		bucketSize = int(unsafe.Sizeof(bucket{}))
+		memberSize = int(unsafe.Sizeof(member{}))
+		loadsSize  = int(unsafe.Sizeof(loads{}))
+		treeSize   = int(unsafe.Sizeof(avl.Tree{}))
+		sliceSize  = int(unsafe.Sizeof([]value(nil)))
+	)
+	r.lock()
+	defer r.mu.Unlock()
+
+	s := r.current()
+	m.Points = s.tree.Size() * avl.NodeSize
+	for _, b := range r.buckets {
+		m.Points += cap(b.points)*ptrSize + len(b.points)*pointSize
+		for _, stack := range b.stacks {
+			m.Stacks += cap(stack)*valueSize + 8 + sliceSize + mapEntryOverhead
+		}
+		m.Buckets += bucketSize + ptrSize + 8 + mapEntryOverhead
+		if b.loads != nil {
+			m.Buckets += loadsSize
+		}
+	}
+	m.Buckets += len(s.members) * (memberSize + 8 + mapEntryOverhead)
+
+	for _, c := range r.collisions {
+		m.Collisions += c.Size()*avl.NodeSize + valueSize + treeSize + mapEntryOverhead
+	}
+	if x := s.index; x != nil {
+		m.Index = cap(x.points) * ptrSize
+		for _, keys := range x.levels {
+			m.Index += cap(keys) * valueSize
+		}
+	}
+	return m
+}
@@ -0,0 +1,60 @@
+package hashring
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"testing"
+)
+
+func TestRingMemStats(t *testing.T) {
+	var items []string
+	for i := 0; i < 10; i++ {
+		items = append(items, fmt.Sprintf("item%02d", i))
+	}
+	build := func(r *Ring, items []string) MemStats {
+		for _, s := range items {
+			if err := r.Insert(StringItem(s), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return r.MemStats()
+	}
+	small := build(&Ring{MagicFactor: 10}, items)
+	large := build(&Ring{MagicFactor: 100}, items)
+	if small.Points == 0 || small.Buckets == 0 {
+		t.Fatalf("unexpected zero stats: %+v", small)
+	}
+	if large.Points < 9*small.Points {
+		t.Errorf(
+			"unexpected points memory growth: %d vs %d",
+			small.Points, large.Points,
+		)
+	}
+	if large.Buckets != small.Buckets {
+		t.Errorf(
+			"unexpected buckets memory change: %d vs %d",
+			small.Buckets, large.Buckets,
+		)
+	}
+	if small.Stacks != 0 || small.Collisions != 0 || small.Index != 0 {
+		t.Errorf("unexpected non-zero stats: %+v", small)
+	}
+
+	collided := build(&Ring{
+		Hash: func() hash.Hash64 {
+			return maskHash{fnv.New64a(), 0xff}
+		},
+		MagicFactor: 32,
+		SkipList:    true,
+	}, []string{"foo", "bar", "baz", "qux"})
+	if collided.Stacks == 0 {
+		t.Errorf("unexpected zero stacks memory: %+v", collided)
+	}
+	if collided.Index == 0 {
+		t.Errorf("unexpected zero index memory: %+v", collided)
+	}
+	if m := collided; m.Total() != m.Points+m.Stacks+m.Buckets+m.Collisions+m.Index {
+		t.Errorf("unexpected total: %d", m.Total())
+	}
+}
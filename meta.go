@@ -0,0 +1,29 @@
+package hashring
+
+// InsertOption is an option of the Ring.Insert() method.
+type InsertOption func(*insertConfig)
+
+type insertConfig struct {
+	meta interface{}
+}
+
+// WithMeta returns an option attaching opaque metadata v (e.g. address or
+// zone) to the inserted item. Metadata is preserved on item's weight updates
+// and can be retrieved later with Ring.Meta().
+func WithMeta(v interface{}) InsertOption {
+	return func(c *insertConfig) {
+		c.meta = v
+	}
+}
+
+// Meta returns metadata attached to item x with WithMeta() option.
+// It returns false if x doesn't exist on the ring or, if r.Strict is true,
+// when x can't be digested.
+func (r *Ring) Meta(x Item) (interface{}, bool) {
+	s, d, err := r.locateItem(x)
+	if err != nil {
+		return nil, false
+	}
+	m, has := s.members[d.hi]
+	return m.meta, has
+}
@@ -0,0 +1,149 @@
+package hashring
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// Hash128 is the common interface implemented by all 128-bit hash functions.
+type Hash128 interface {
+	hash.Hash
+
+	// Sum128 returns high and low 64 bits of the hash value.
+	Sum128() (hi, lo uint64)
+}
+
+// NewMurmur3x128 returns new 128-bit Murmur3 (x64 variant) hash function with
+// zero seed.
+func NewMurmur3x128() Hash128 {
+	return new(murmur3)
+}
+
+// murmur3 is a streaming implementation of the x64 128-bit variant of
+// the Murmur3 hash function.
+type murmur3 struct {
+	h1, h2 uint64
+
+	// buf holds n bytes of the last incomplete block.
+	buf [16]byte
+	n   int
+
+	// size is a total number of bytes written.
+	size uint64
+}
+
+const (
+	murmur3c1 = 0x87c37b91114253d5
+	murmur3c2 = 0x4cf5ad432745937f
+)
+
+func (h *murmur3) Reset() {
+	*h = murmur3{}
+}
+
+func (h *murmur3) Write(p []byte) (int, error) {
+	n := len(p)
+	h.size += uint64(n)
+	if h.n > 0 {
+		m := copy(h.buf[h.n:], p)
+		h.n += m
+		p = p[m:]
+		if h.n < len(h.buf) {
+			return n, nil
+		}
+		h.block(h.buf[:])
+		h.n = 0
+	}
+	for ; len(p) >= 16; p = p[16:] {
+		h.block(p)
+	}
+	h.n = copy(h.buf[:], p)
+	return n, nil
+}
+
+func (h *murmur3) Sum128() (hi, lo uint64) {
+	h1, h2 := h.h1, h.h2
+
+	var k1, k2 uint64
+	tail := h.buf[:h.n]
+	for i := len(tail) - 1; i >= 8; i-- {
+		k2 |= uint64(tail[i]) << (8 * uint(i-8))
+	}
+	if len(tail) > 8 {
+		k2 *= murmur3c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= murmur3c1
+		h2 ^= k2
+		tail = tail[:8]
+	}
+	for i := len(tail) - 1; i >= 0; i-- {
+		k1 |= uint64(tail[i]) << (8 * uint(i))
+	}
+	if len(tail) > 0 {
+		k1 *= murmur3c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= murmur3c2
+		h1 ^= k1
+	}
+
+	h1 ^= h.size
+	h2 ^= h.size
+	h1 += h2
+	h2 += h1
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+	h1 += h2
+	h2 += h1
+
+	return h1, h2
+}
+
+// Sum64 returns the high 64 bits of the hash value.
+func (h *murmur3) Sum64() uint64 {
+	hi, _ := h.Sum128()
+	return hi
+}
+
+func (h *murmur3) Sum(b []byte) []byte {
+	var p [16]byte
+	hi, lo := h.Sum128()
+	binary.BigEndian.PutUint64(p[:8], hi)
+	binary.BigEndian.PutUint64(p[8:], lo)
+	return append(b, p[:]...)
+}
+
+func (h *murmur3) Size() int      { return 16 }
+func (h *murmur3) BlockSize() int { return 16 }
+
+func (h *murmur3) block(p []byte) {
+	k1 := binary.LittleEndian.Uint64(p[0:8])
+	k2 := binary.LittleEndian.Uint64(p[8:16])
+
+	k1 *= murmur3c1
+	k1 = bits.RotateLeft64(k1, 31)
+	k1 *= murmur3c2
+	h.h1 ^= k1
+
+	h.h1 = bits.RotateLeft64(h.h1, 27)
+	h.h1 += h.h2
+	h.h1 = h.h1*5 + 0x52dce729
+
+	k2 *= murmur3c2
+	k2 = bits.RotateLeft64(k2, 33)
+	k2 *= murmur3c1
+	h.h2 ^= k2
+
+	h.h2 = bits.RotateLeft64(h.h2, 31)
+	h.h2 += h.h1
+	h.h2 = h.h2*5 + 0x38495ab5
+}
+
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
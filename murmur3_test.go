@@ -0,0 +1,40 @@
+package hashring
+
+import (
+	"testing"
+)
+
+func TestMurmur3x128(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		hi, lo uint64
+	}{
+		{"", 0, 0},
+		{"hello", 0xcbd8a7b341bd9b02, 0x5b1e906a48ae1d19},
+		{"hello, world", 0x342fac623a5ebc8e, 0x4cdcbc079642414d},
+		{
+			"The quick brown fox jumps over the lazy dog.",
+			0xcd99481f9ee902c9, 0x695da1a38987b6e7,
+		},
+	} {
+		t.Run(test.in, func(t *testing.T) {
+			h := NewMurmur3x128()
+			// Write input in small chunks to test buffering.
+			for p := []byte(test.in); len(p) > 0; {
+				n := 3
+				if n > len(p) {
+					n = len(p)
+				}
+				h.Write(p[:n])
+				p = p[n:]
+			}
+			hi, lo := h.Sum128()
+			if hi != test.hi || lo != test.lo {
+				t.Fatalf(
+					"unexpected sum: %#x %#x; want %#x %#x",
+					hi, lo, test.hi, test.lo,
+				)
+			}
+		})
+	}
+}
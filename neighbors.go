@@ -0,0 +1,136 @@
+package hashring
+
+import "github.com/gobwas/hashring/internal/avl"
+
+// Neighbors returns items adjacent to item x on the ring. Prev is the item
+// owning the biggest part of the hash space right before x's arcs, that is,
+// the item which hands off keys to x. Next is the item which receives the
+// biggest part of x's keys when x is removed from the ring.
+// Both prev and next are nil when x owns all points of the ring, when x
+// doesn't exist on the ring or, if r.Strict is true, when x can't be
+// digested.
+func (r *Ring) Neighbors(x Item) (prev, next Item) {
+	s, d, err := r.locateItem(x)
+	if err != nil {
+		return nil, nil
+	}
+	arcs, _ := s.arcs(d.hi)
+	var (
+		prevSize = make(map[uint64]float64, len(arcs))
+		nextSize = make(map[uint64]float64, len(arcs))
+	)
+	for _, a := range arcs {
+		prevSize[a.prev.id] += a.size()
+		nextSize[a.next.id] += a.size()
+	}
+	return s.biggest(prevSize), s.biggest(nextSize)
+}
+
+// ArcCount returns the number of contiguous arcs of the ring owned by item x.
+// Consecutive points of x make up a single arc.
+// It returns zero if x doesn't exist on the ring or, if r.Strict is true, when
+// x can't be digested.
+func (r *Ring) ArcCount(x Item) int {
+	s, d, err := r.locateItem(x)
+	if err != nil {
+		return 0
+	}
+	arcs, whole := s.arcs(d.hi)
+	if whole {
+		return 1
+	}
+	return len(arcs)
+}
+
+// arc is a contiguous part of the hash space owned by a single item.
+type arc struct {
+	// prev is a bucket owning the hash space right before the arc.
+	prev *bucket
+	// next is a bucket owning the hash space right after the arc.
+	next *bucket
+	// rng is the range of the hash space covered by the arc.
+	rng Range
+}
+
+// size returns the size of the arc.
+func (a arc) size() float64 {
+	return float64(a.rng.End - a.rng.Start)
+}
+
+// arcs returns arcs owned by the item having non-suffixed digest id. It
+// returns nil if the item has no points on the ring. If all points of the
+// ring belong to the item (e.g. when it's the only item on the ring or other
+// items got no points due to their small weights), it returns nil arcs and
+// whole set to true, meaning that the item owns the whole ring.
+func (s *ringState) arcs(id uint64) (arcs []arc, whole bool) {
+	if _, has := s.members[id]; !has {
+		return nil, false
+	}
+	var (
+		ps    = make([]*point, 0, s.tree.Size())
+		own   int
+		start = -1
+	)
+	s.tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		if p.bucket.id == id {
+			own++
+		} else if start == -1 {
+			// Start from some point of other item, so arcs are not split
+			// across the end of the slice.
+			start = len(ps)
+		}
+		ps = append(ps, p)
+		return true
+	})
+	if own == 0 {
+		return nil, false
+	}
+	if start == -1 {
+		return nil, true
+	}
+	n := len(ps)
+	for i := 1; i < n; i++ {
+		j := (start + i) % n
+		if ps[j].bucket.id != id {
+			continue
+		}
+		var (
+			first = ps[(j+n-1)%n]
+			last  = ps[j]
+		)
+		for ps[(j+1)%n].bucket.id == id {
+			j = (j + 1) % n
+			i++
+			last = ps[j]
+		}
+		arcs = append(arcs, arc{
+			prev: first.bucket,
+			next: ps[(j+1)%n].bucket,
+			rng: Range{
+				Start: first.val.hi,
+				End:   last.val.hi,
+			},
+		})
+	}
+	return arcs, false
+}
+
+// biggest returns the item having the biggest size in sizes. Ties are broken
+// in favor of the item having the least digest.
+func (s *ringState) biggest(sizes map[uint64]float64) Item {
+	var (
+		max  float64
+		best uint64
+		has  bool
+	)
+	for id, size := range sizes {
+		if !has || size > max || (size == max && id < best) {
+			max, best, has = size, id, true
+		}
+	}
+	if !has {
+		return nil
+	}
+	return s.members[best].item
+}
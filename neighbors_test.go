@@ -0,0 +1,99 @@
+package hashring
+
+import (
+	"testing"
+)
+
+func TestRingNeighbors(t *testing.T) {
+	items := map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+		"qux": 4,
+	}
+	for item := range items {
+		t.Run(item, func(t *testing.T) {
+			r := makeRing(t, items)
+			x := StringItem(item)
+
+			var (
+				arcs  int
+				first Item
+				prev  Item
+			)
+			r.WalkRange(0, 0, func(p PointInfo) bool {
+				if first == nil {
+					first = p.Item
+				}
+				if p.Item == x && prev != x {
+					arcs++
+				}
+				prev = p.Item
+				return true
+			})
+			if first == x && prev == x {
+				arcs-- // Arc wraps around the ring.
+			}
+			if act := r.ArcCount(x); act != arcs {
+				t.Errorf("unexpected arc count: %d; want %d", act, arcs)
+			}
+
+			_, next := r.Neighbors(x)
+			received := make(map[Item]float64)
+			r.OnRelocation = func(moves []RangeMove) {
+				for _, m := range moves {
+					received[m.To] += partitionSize(m.Range)
+				}
+			}
+			if err := r.Delete(x); err != nil {
+				t.Fatal(err)
+			}
+			var exp Item
+			for y, size := range received {
+				if exp == nil || size > received[exp] {
+					exp = y
+				}
+			}
+			if next != exp {
+				t.Errorf(
+					"unexpected next neighbor: %v; want %v (received: %v)",
+					next, exp, received,
+				)
+			}
+		})
+	}
+}
+
+func TestRingNeighborsSingle(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+	})
+	if prev, next := r.Neighbors(StringItem("foo")); prev != nil || next != nil {
+		t.Errorf("unexpected neighbors: %v, %v", prev, next)
+	}
+	if n := r.ArcCount(StringItem("foo")); n != 1 {
+		t.Errorf("unexpected arc count: %d", n)
+	}
+	if n := r.ArcCount(StringItem("bar")); n != 0 {
+		t.Errorf("unexpected arc count of missing item: %d", n)
+	}
+}
+
+func TestRingNeighborsNoPoints(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 10000,
+		"bar": 1,
+	})
+	if n := len(r.PointsOf(StringItem("bar"))); n != 0 {
+		t.Fatalf("unexpected number of points of %q: %d; want 0", "bar", n)
+	}
+	if prev, next := r.Neighbors(StringItem("foo")); prev != nil || next != nil {
+		t.Errorf("unexpected neighbors: %v, %v", prev, next)
+	}
+	if n := r.ArcCount(StringItem("foo")); n != 1 {
+		t.Errorf("unexpected arc count: %d; want 1", n)
+	}
+	if n := r.ArcCount(StringItem("bar")); n != 0 {
+		t.Errorf("unexpected arc count of item without points: %d; want 0", n)
+	}
+}
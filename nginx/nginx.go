@@ -0,0 +1,152 @@
+// Package nginx provides consistent hashing compatible with the nginx
+// upstream hashing configured as "hash $key consistent".
+//
+// Ring places points the same way as nginx does: each server gets 160 points
+// per unit of its weight, and values of the points are CRC32 checksums chained
+// from the server's host and port. Keys are hashed with CRC32 as well. Thus
+// migration from nginx upstream hashing to in-app hashing doesn't remap keys
+// as long as servers are named the same way as in the nginx configuration.
+package nginx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PointsPerWeight is the number of points per unit of the server weight used
+// by nginx.
+const PointsPerWeight = 160
+
+// Server describes an upstream server.
+type Server struct {
+	// Name is the server's name as written in the nginx configuration, e.g.
+	// "10.0.0.1:80", "backend.example.com" or "unix:/tmp/backend.sock".
+	Name string
+
+	// Weight is the weight of the server.
+	// If Weight is zero, then the weight of 1 is used.
+	Weight int
+}
+
+// Ring is an nginx compatible consistent hashing ring.
+//
+// Ring is goroutine safe. Ring instances must not be copied.
+// The zero value for Ring is an empty ring ready to use.
+type Ring struct {
+	mu     sync.RWMutex
+	points []point
+}
+
+type point struct {
+	hash   uint32
+	server string
+}
+
+// SetServers replaces servers of the ring.
+// It returns non-nil error if some weight is negative.
+func (r *Ring) SetServers(servers []Server) error {
+	var n int
+	for _, s := range servers {
+		if s.Weight < 0 {
+			return fmt.Errorf("nginx: malformed weight of %q: %d", s.Name, s.Weight)
+		}
+		n += weight(s) * PointsPerWeight
+	}
+	var (
+		points = make([]point, 0, n)
+		buf    []byte
+	)
+	for _, s := range servers {
+		host, port := split(s.Name)
+		buf = append(buf[:0], host...)
+		buf = append(buf, 0)
+		buf = append(buf, port...)
+		base := crc32.ChecksumIEEE(buf)
+
+		var prev [4]byte
+		for j := 0; j < weight(s)*PointsPerWeight; j++ {
+			h := crc32.Update(base, crc32.IEEETable, prev[:])
+			points = append(points, point{
+				hash:   h,
+				server: s.Name,
+			})
+			binary.LittleEndian.PutUint32(prev[:], h)
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+	// Remove points having the same values as nginx does.
+	if len(points) > 0 {
+		i := 0
+		for j := 1; j < len(points); j++ {
+			if points[i].hash != points[j].hash {
+				i++
+				points[i] = points[j]
+			}
+		}
+		points = points[:i+1]
+	}
+
+	r.mu.Lock()
+	r.points = points
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Get returns name of the server which key is routed to.
+// It returns empty string if the ring is empty.
+func (r *Ring) Get(key string) string {
+	return r.GetHash(crc32.ChecksumIEEE([]byte(key)))
+}
+
+// GetHash returns name of the server which hash value h is routed to. That is,
+// the server of the first point which value is greater or equal to h.
+// It returns empty string if the ring is empty.
+func (r *Ring) GetHash(h uint32) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return ""
+	}
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	return r.points[i%len(r.points)].server
+}
+
+// Size returns the number of points on the ring.
+func (r *Ring) Size() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.points)
+}
+
+// split splits server name into host and port the same way as nginx does.
+func split(name string) (host, port string) {
+	if len(name) >= 5 && strings.EqualFold(name[:5], "unix:") {
+		return name[5:], ""
+	}
+	for j := 0; j < len(name); j++ {
+		c := name[len(name)-j-1]
+		if c == ':' {
+			return name[:len(name)-j-1], name[len(name)-j:]
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+	}
+	return name, ""
+}
+
+func weight(s Server) int {
+	if s.Weight == 0 {
+		return 1
+	}
+	return s.Weight
+}
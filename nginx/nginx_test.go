@@ -0,0 +1,59 @@
+package nginx
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	for _, test := range []struct {
+		name, host, port string
+	}{
+		{"10.0.0.1:80", "10.0.0.1", "80"},
+		{"backend.example.com", "backend.example.com", ""},
+		{"[::1]:8080", "[::1]", "8080"},
+		{"UNIX:/tmp/sock", "/tmp/sock", ""},
+		{"host:http", "host:http", ""},
+	} {
+		host, port := split(test.name)
+		if host != test.host || port != test.port {
+			t.Errorf(
+				"split(%q) = %q, %q; want %q, %q",
+				test.name, host, port, test.host, test.port,
+			)
+		}
+	}
+}
+
+func TestRing(t *testing.T) {
+	var r Ring
+	err := r.SetServers([]Server{
+		{Name: "10.0.0.1:80"},
+		{Name: "10.0.0.2:80", Weight: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Size(); n != 3*PointsPerWeight {
+		t.Fatalf("unexpected number of points: %d; want %d", n, 3*PointsPerWeight)
+	}
+	// The second point of the server is chained from the first one.
+	first := crc32.ChecksumIEEE([]byte("10.0.0.1\x0080\x00\x00\x00\x00"))
+	var prev [4]byte
+	binary.LittleEndian.PutUint32(prev[:], first)
+	second := crc32.ChecksumIEEE(append([]byte("10.0.0.1\x0080"), prev[:]...))
+	for _, h := range []uint32{first, second} {
+		if s := r.GetHash(h); s != "10.0.0.1:80" {
+			t.Fatalf("GetHash(%d) = %q; want %q", h, s, "10.0.0.1:80")
+		}
+	}
+	last := r.points[len(r.points)-1]
+	if s := r.GetHash(last.hash + 1); last.hash != ^uint32(0) && s != r.points[0].server {
+		t.Fatalf("GetHash() past the last point = %q; want %q", s, r.points[0].server)
+	}
+	var empty Ring
+	if s := empty.Get("key"); s != "" {
+		t.Fatalf("unexpected server of empty ring: %q", s)
+	}
+}
@@ -0,0 +1,196 @@
+package hashring
+
+import (
+	"hash"
+	"time"
+)
+
+// Option configures the ring created by New().
+//
+// Option is a function changing the ring's configuration fields, thus any
+// field can be set by a custom Option, e.g.:
+//
+//	hashring.New(func(r *hashring.Ring) {
+//		r.SkipList = true
+//	})
+type Option func(*Ring)
+
+// WithHash sets Ring.Hash.
+func WithHash(fn func() hash.Hash64) Option {
+	return func(r *Ring) {
+		r.Hash = fn
+	}
+}
+
+// WithHash128 sets Ring.Hash128.
+func WithHash128(fn func() Hash128) Option {
+	return func(r *Ring) {
+		r.Hash128 = fn
+	}
+}
+
+// WithSeed sets Ring.Hash to SeededHash(seed), making the ring's hashing
+// randomized by the seed. Rings using the same seed (e.g. persisted one
+// returned by NewSeed()) map keys identically across processes. Note that
+// the seed gives a 64-bit key strength (see SeededHash()):
+//
+//	seed := hashring.NewSeed() // Saved along with the ring's items.
+//	r := hashring.New(hashring.WithSeed(seed))
+func WithSeed(seed uint64) Option {
+	return WithHash(SeededHash(seed))
+}
+
+// WithMagicFactor sets Ring.MagicFactor.
+func WithMagicFactor(m int) Option {
+	return func(r *Ring) {
+		r.MagicFactor = m
+	}
+}
+
+// WithCollision sets Ring.Collision.
+func WithCollision(c CollisionPolicy) Option {
+	return func(r *Ring) {
+		r.Collision = c
+	}
+}
+
+// WithSuffix sets Ring.Suffix. For example, WithSuffix(FixedSuffix) makes the
+// ring map keys identically on 32-bit and 64-bit architectures.
+func WithSuffix(fn func(x Item, gen, index int) []byte) Option {
+	return func(r *Ring) {
+		r.Suffix = fn
+	}
+}
+
+// WithStrict sets Ring.Strict to true.
+func WithStrict() Option {
+	return func(r *Ring) {
+		r.Strict = true
+	}
+}
+
+// WithCapacity makes the ring to preallocate space for n items.
+func WithCapacity(n int) Option {
+	return func(r *Ring) {
+		r.buckets = make(map[uint64]*bucket, n)
+	}
+}
+
+// New creates new ring configured by given options.
+//
+// Unlike the zero Ring, which is initialized lazily on first use, the ring
+// returned by New() is initialized eagerly and its configuration is frozen:
+// the ring's exported fields are copied once New() applies the options, and
+// the ring never reads them again. Changes of the fields made after New()
+// returns have no effect, so they can't race with lookups or mutations of the
+// ring. Methods which change configuration, such as SetHash() or
+// SetMagicFactor(), are still allowed.
+func New(opts ...Option) *Ring {
+	r := new(Ring)
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addr = r
+	r.conf = r.fields()
+	r.frozen = true
+	r.current()
+
+	return r
+}
+
+// config holds configuration of the ring, that is, copies of the ring's
+// exported fields. See Ring for fields description.
+type config struct {
+	Hash            func() hash.Hash64
+	Hash128         func() Hash128
+	MagicFactor     int
+	Allocation      PointAllocation
+	Allocator       PointAllocator
+	MinPoints       int
+	Probation       time.Duration
+	ProbationFactor float64
+	Suffix          func(x Item, gen, index int) []byte
+	Collision       CollisionPolicy
+	MaxGeneration   int
+	RebuildBudget   time.Duration
+	Strict          bool
+	OnRelocation    func(moves []RangeMove)
+	SkipList        bool
+	CacheSize       int
+	CountLoads      bool
+	ChangeLog       int
+	Trace           RingTrace
+}
+
+// fields returns configuration made of the ring's exported fields.
+func (r *Ring) fields() config {
+	return config{
+		Hash:            r.Hash,
+		Hash128:         r.Hash128,
+		MagicFactor:     r.MagicFactor,
+		Allocation:      r.Allocation,
+		Allocator:       r.Allocator,
+		MinPoints:       r.MinPoints,
+		Probation:       r.Probation,
+		ProbationFactor: r.ProbationFactor,
+		Suffix:          r.Suffix,
+		Collision:       r.Collision,
+		MaxGeneration:   r.MaxGeneration,
+		RebuildBudget:   r.RebuildBudget,
+		Strict:          r.Strict,
+		OnRelocation:    r.OnRelocation,
+		SkipList:        r.SkipList,
+		CacheSize:       r.CacheSize,
+		CountLoads:      r.CountLoads,
+		ChangeLog:       r.ChangeLog,
+		Trace:           r.Trace,
+	}
+}
+
+// configure makes r.conf up to date with the ring's exported fields unless
+// the ring's configuration is frozen by New().
+//
+// r.mu must be held.
+func (r *Ring) configure() {
+	if !r.frozen {
+		r.conf = r.fields()
+	}
+}
+
+// strict returns Strict field of the ring's configuration. Unlike r.conf, it
+// may be read without r.mu held.
+func (r *Ring) strict() bool {
+	if r.frozen {
+		return r.conf.Strict
+	}
+	return r.Strict
+}
+
+// countLoads is like strict() but returns CountLoads field.
+func (r *Ring) countLoads() bool {
+	if r.frozen {
+		return r.conf.CountLoads
+	}
+	return r.CountLoads
+}
+
+// onGet is like strict() but returns Trace.OnGet hook.
+func (r *Ring) onGet() func(uint64) func(Item) {
+	if r.frozen {
+		return r.conf.Trace.OnGet
+	}
+	return r.Trace.OnGet
+}
+
+// exactWeights reports whether weights of the items must be integers, that
+// is, whether points are allocated by AllocateExact method. Like strict(), it
+// may be called without r.mu held.
+func (r *Ring) exactWeights() bool {
+	if r.frozen {
+		return r.conf.Allocator == nil && r.conf.Allocation == AllocateExact
+	}
+	return r.Allocator == nil && r.Allocation == AllocateExact
+}
@@ -0,0 +1,114 @@
+package hashring
+
+import (
+	"hash"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestNew(t *testing.T) {
+	fn := func() hash.Hash64 { return xxhash.New() }
+	r := New(
+		WithHash(fn),
+		WithMagicFactor(64),
+		WithCollision(CollisionTieBreak),
+		WithSuffix(FixedSuffix),
+		WithStrict(),
+		WithCapacity(16),
+		func(r *Ring) {
+			r.SkipList = true
+		},
+	)
+	if r.MagicFactor != 64 || r.Collision != CollisionTieBreak ||
+		!r.Strict || !r.SkipList || r.Hash == nil || r.Suffix == nil {
+		t.Fatalf("options are not applied: %+v", r)
+	}
+	for _, s := range []string{"foo", "bar", "baz"} {
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(r.PointsOf(StringItem("foo"))); n != 64 {
+		t.Fatalf("unexpected number of points: %d; want 64", n)
+	}
+
+	// Configuration changes made by the ring's methods are allowed.
+	if _, err := r.SetMagicFactor(32); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetHash(fn); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(StringItem("baz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewFrozen(t *testing.T) {
+	r := New(WithStrict(), WithMagicFactor(16))
+	if err := r.Insert(StringItem("foo"), 1); err != nil {
+		t.Fatal(err)
+	}
+	exp := r.PointsOf(StringItem("foo"))
+
+	// Lookups made concurrently with the changes below don't race with them.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			r.Get(IntItem(i))
+		}
+	}()
+	// Changes of the exported fields made after New() are ignored.
+	r.MagicFactor = 10
+	r.Strict = false
+	r.Hash = FNV64a()
+	r.Allocation = AllocateExact
+	r.Trace.OnGet = func(uint64) func(Item) {
+		t.Fatalf("unexpected OnGet() call")
+		return nil
+	}
+	<-done
+	if err := r.Insert(StringItem("bar"), 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Insert(StringItem("baz"), -1); err == nil {
+		t.Fatalf("want error on malformed weight; got nothing")
+	}
+	if act := r.PointsOf(StringItem("foo")); !equalUint64(act, exp) {
+		t.Fatalf("points changed after changing the ring's fields")
+	}
+	if n := len(r.PointsOf(StringItem("bar"))); n != 8 {
+		t.Fatalf("unexpected number of points: %d; want 8", n)
+	}
+	if r.Get(IntItem(42)) == nil {
+		t.Fatalf("unexpected nil item")
+	}
+}
+
+func TestWithSeed(t *testing.T) {
+	var (
+		s0 = NewSeed()
+		s1 = NewSeed()
+	)
+	points := func(seed uint64) []uint64 {
+		r := New(WithSeed(seed), WithMagicFactor(8))
+		if err := r.Insert(StringItem("foo"), 1); err != nil {
+			t.Fatal(err)
+		}
+		return r.PointsOf(StringItem("foo"))
+	}
+	if a, b := points(s0), points(s0); !equalUint64(a, b) {
+		t.Fatalf("unexpected points mismatch for the same seed")
+	}
+	if a, b := points(s0), points(s1); equalUint64(a, b) {
+		t.Fatalf("unexpected points match for different seeds")
+	}
+}
@@ -0,0 +1,161 @@
+package hashring
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// PartitionAssignment describes ownership of a partition of the ring's hash
+// space.
+type PartitionAssignment struct {
+	// Range is a range of the hash space covered by the partition.
+	Range Range
+
+	// Item is an item owning the largest part of the partition.
+	// It's nil if the ring is empty.
+	Item Item
+
+	// Share is a fraction of the partition owned by Item.
+	Share float64
+}
+
+// Partitions splits the 64-bit hash space into n partitions of equal size and
+// reports which item owns each of them. Partitions are ordered by their
+// starting positions, the first partition starts at zero.
+//
+// Ownership is calculated exactly from the ring's points, not by sampling.
+// If n is less or equal to zero Partitions() panics.
+func (r *Ring) Partitions(n int) []PartitionAssignment {
+	if n <= 0 {
+		panic(fmt.Sprintf("hashring: malformed number of partitions: %d", n))
+	}
+	starts := make([]uint64, n)
+	for i := range starts {
+		// Start of i-th partition is i * 2^64 / n.
+		starts[i], _ = bits.Div64(uint64(i), 0, uint64(n))
+	}
+	ps := make([]PartitionAssignment, n)
+	for i := range ps {
+		ps[i].Range = Range{
+			Start: starts[i],
+			End:   starts[(i+1)%n],
+		}
+	}
+	var (
+		tree   = r.tree()
+		points = make([]*point, 0, tree.Size())
+	)
+	tree.InOrder(func(x avl.Item) bool {
+		points = append(points, x.(*point))
+		return true
+	})
+	if len(points) == 0 {
+		return ps
+	}
+
+	// Split the hash space by the partition starts and the point values into
+	// segments. Each segment belongs to exactly one partition and is owned by
+	// exactly one point.
+	var (
+		shares = make(map[*bucket]float64)
+		part   = 0
+		owner  = 0
+	)
+	flush := func() {
+		size := partitionSize(ps[part].Range)
+		for b, s := range shares {
+			if s /= size; s > ps[part].Share {
+				ps[part].Item = b.item
+				ps[part].Share = s
+			}
+			delete(shares, b)
+		}
+	}
+	for i, j, a := 0, 0, uint64(0); ; {
+		// Find the end of the segment starting at a.
+		var (
+			b    uint64
+			last bool
+		)
+		for i < n && starts[i] <= a {
+			i++
+		}
+		for j < len(points) && points[j].val.hi <= a {
+			j++
+		}
+		switch {
+		case i < n && (j == len(points) || starts[i] <= points[j].val.hi):
+			b = starts[i]
+		case j < len(points):
+			b = points[j].val.hi
+		default:
+			last = true
+		}
+		// Segment [a, b) is owned by the first point which value is
+		// greater or equal to b.
+		for owner < len(points) && (last || points[owner].val.hi < b) {
+			owner++
+		}
+		o := points[owner%len(points)].bucket
+		if last {
+			shares[o] += float64(-a)
+			if a == 0 {
+				shares[o] += math.Exp2(64)
+			}
+			flush()
+			return ps
+		}
+		shares[o] += float64(b - a)
+		if i < n && b == starts[i] {
+			flush()
+			part = i
+		}
+		a = b
+	}
+}
+
+// partitionSize returns size of the range as a float number.
+func partitionSize(r Range) float64 {
+	if r.Start == r.End {
+		return math.Exp2(64)
+	}
+	return float64(r.End - r.Start)
+}
+
+// SlotTable returns a dense table mapping each of the slots of equal size to
+// the item owning the largest part of it. That is, i-th element of the table
+// is an item of i-th partition returned by Partitions(slots).
+//
+// Slot of the hash value v is v / (2^64 / slots) rounded down, e.g. for 16384
+// slots it's v >> 50.
+// Elements of the table are nil if the ring is empty.
+// If slots is less or equal to zero SlotTable() panics.
+func (r *Ring) SlotTable(slots int) []Item {
+	ps := r.Partitions(slots)
+	table := make([]Item, len(ps))
+	for i, p := range ps {
+		table[i] = p.Item
+	}
+	return table
+}
+
+// DiffSlotTables returns indexes of the slots which items differ in tables a
+// and b. Tables must be of equal size and their items must be comparable.
+func DiffSlotTables(a, b []Item) []int {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf(
+			"hashring: slot tables sizes mismatch: %d vs %d",
+			len(a), len(b),
+		))
+	}
+	var diff []int
+	for i := range a {
+		if a[i] != b[i] {
+			diff = append(diff, i)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,107 @@
+package hashring
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+func TestRingPartitions(t *testing.T) {
+	var r Ring
+	if ps := r.Partitions(4); len(ps) != 4 || ps[0].Item != nil {
+		t.Fatalf("unexpected partitions of empty ring: %+v", ps)
+	}
+	r = Ring{
+		MagicFactor: 3,
+	}
+	r.Insert(StringItem("foo"), 1)
+	for _, p := range r.Partitions(3) {
+		if p.Item != StringItem("foo") || p.Share != 1 {
+			t.Fatalf("unexpected partition of single item ring: %+v", p)
+		}
+	}
+	r.Insert(StringItem("bar"), 1)
+	r.Insert(StringItem("baz"), 1)
+
+	var ps []PointInfo
+	r.WalkRange(0, 0, func(p PointInfo) bool {
+		ps = append(ps, p)
+		return true
+	})
+	owner := func(v uint64) Item {
+		i := sort.Search(len(ps), func(i int) bool {
+			return ps[i].Value > v
+		})
+		return ps[i%len(ps)].Item
+	}
+	for _, n := range []int{1, 2, 7, 64} {
+		const samples = 10000
+		parts := r.Partitions(n)
+		if len(parts) != n {
+			t.Fatalf("unexpected number of partitions: %d", len(parts))
+		}
+		for i, p := range parts {
+			size := partitionSize(p.Range)
+			if exp := math.Exp2(64) / float64(n); math.Abs(size-exp) > 1 {
+				t.Fatalf("unexpected size of partition #%d: %v; want %v", i, size, exp)
+			}
+			shares := make(map[Item]float64)
+			for j := 0; j < samples; j++ {
+				v := p.Range.Start + uint64(float64(j)/samples*size)
+				shares[owner(v)] += 1.0 / samples
+			}
+			if exp := shares[p.Item]; math.Abs(p.Share-exp) > 0.01 {
+				t.Errorf(
+					"unexpected share of %s in partition #%d: %v; want %v",
+					p.Item, i, p.Share, exp,
+				)
+			}
+			for x, s := range shares {
+				if s > p.Share+0.01 {
+					t.Errorf(
+						"partition #%d is owned by %s (%v) rather than %s (%v)",
+						i, x, s, p.Item, p.Share,
+					)
+				}
+			}
+		}
+	}
+}
+
+func TestRingSlotTable(t *testing.T) {
+	r0 := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 1,
+		"baz": 1,
+	})
+	const slots = 16384
+	t0 := r0.SlotTable(slots)
+	for i, p := range r0.Partitions(slots) {
+		if t0[i] != p.Item {
+			t.Fatalf("unexpected item of slot #%d: %v; want %v", i, t0[i], p.Item)
+		}
+	}
+	if err := r0.Delete(StringItem("baz")); err != nil {
+		t.Fatal(err)
+	}
+	t1 := r0.SlotTable(slots)
+	diff := DiffSlotTables(t0, t1)
+	if len(diff) == 0 {
+		t.Fatalf("no slots moved")
+	}
+	moved := make(map[int]bool, len(diff))
+	for _, i := range diff {
+		moved[i] = true
+		if t1[i] == StringItem("baz") {
+			t.Fatalf("slot #%d is owned by deleted item", i)
+		}
+	}
+	for i := range t0 {
+		if t0[i] == StringItem("baz") && !moved[i] {
+			t.Fatalf("slot #%d of deleted item is not moved", i)
+		}
+	}
+	if exp := slots / 3; math.Abs(float64(len(diff)-exp)) > slots/10 {
+		t.Errorf("unexpected number of moved slots: %d; want about %d", len(diff), exp)
+	}
+}
@@ -0,0 +1,152 @@
+package hashring
+
+import "fmt"
+
+// Change describes a change of the item on the ring.
+type Change struct {
+	// Item is an item to be changed.
+	Item Item
+
+	// Weight is a new weight of the item. If Weight is zero, the item is
+	// deleted from the ring. If the item doesn't exist on the ring, it is
+	// inserted.
+	Weight float64
+}
+
+// Pending is a prepared but not yet published version of the ring.
+// See Ring.Prepare() for details.
+type Pending struct {
+	ring  *Ring
+	base  *ringState
+	next  *Ring
+	moves []RangeMove
+	done  bool
+}
+
+// Prepare computes the version of the ring with changes applied, without
+// publishing it. The returned Pending may be inspected and then published
+// with Commit() or dropped with Abort().
+//
+// It returns non-nil error when some change is malformed (that is, when
+// weight is negative or an item to delete doesn't exist) or when the ring is
+// in deferred mode. Items are digested as by Insert() and errors are reported
+// in the same way.
+func (r *Ring) Prepare(changes []Change) (*Pending, error) {
+	r.lock()
+	defer r.mu.Unlock()
+
+	if r.deferred {
+		return nil, fmt.Errorf("hashring: can't prepare changes in deferred mode")
+	}
+	base := r.current()
+	next := &Ring{
+		Hash:          r.conf.Hash,
+		Hash128:       r.conf.Hash128,
+		MagicFactor:   r.conf.MagicFactor,
+		Allocation:    r.conf.Allocation,
+		Allocator:     r.conf.Allocator,
+		MinPoints:     r.conf.MinPoints,
+		Suffix:        r.conf.Suffix,
+		Collision:     r.conf.Collision,
+		MaxGeneration: r.conf.MaxGeneration,
+		Strict:        r.conf.Strict,
+		SkipList:      r.conf.SkipList,
+		CacheSize:     r.conf.CacheSize,
+		CountLoads:    r.conf.CountLoads,
+	}
+	next.Begin()
+	next.tombs = r.tombs
+	for _, b := range r.buckets {
+		if err := next.Insert(b.item, b.weight, WithMeta(b.meta)); err != nil {
+			return nil, err
+		}
+		next.buckets[b.id].loads = b.loads
+	}
+	for _, c := range changes {
+		if c.Weight < 0 {
+			return nil, fmt.Errorf("hashring: weight must not be negative")
+		}
+		id, err := next.itemDigest(c.Item)
+		if err != nil {
+			return nil, err
+		}
+		b, has := next.buckets[id]
+		has = has && b.weight != 0
+		switch {
+		case has && c.Weight == 0:
+			err = next.Delete(c.Item)
+		case has:
+			err = next.Update(c.Item, c.Weight)
+		case c.Weight == 0:
+			err = fmt.Errorf("hashring: item doesn't exist")
+		default:
+			err = next.Insert(c.Item, c.Weight)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := next.Commit(); err != nil {
+		return nil, err
+	}
+	return &Pending{
+		ring:  r,
+		base:  base,
+		next:  next,
+		moves: relocations(treeMarks(base.tree), treeMarks(next.tree())),
+	}, nil
+}
+
+// Moves returns ranges of the hash space which change their owners when p is
+// committed.
+func (p *Pending) Moves() []RangeMove {
+	return p.moves
+}
+
+// View returns a read-only view of the prepared version of the ring. It may
+// be used to look up new owners of keys before the version is published.
+func (p *Pending) View() *View {
+	return p.next.View()
+}
+
+// Commit publishes the prepared version of the ring. Ring's OnRelocation is
+// called as for any other mutation.
+//
+// It returns non-nil error if the ring was changed since Prepare() call or if
+// p was already committed or aborted. In that case the ring is left
+// unchanged.
+func (p *Pending) Commit() error {
+	r := p.ring
+	r.lock()
+	defer r.mu.Unlock()
+
+	if p.done {
+		return fmt.Errorf("hashring: pending changes are already done")
+	}
+	if r.deferred || r.current() != p.base {
+		return fmt.Errorf("hashring: ring changed since Prepare()")
+	}
+	p.done = true
+
+	n := p.next
+	r.buckets = n.buckets
+	r.collisions = n.collisions
+	r.tombs = n.tombs
+	r.minWeight = n.minWeight
+	r.maxWeight = n.maxWeight
+
+	before := r.marks(p.base.tree)
+	r.publish(p.base.hasher, n.tree())
+	r.relocate(before)
+
+	return nil
+}
+
+// Abort drops the prepared version of the ring. Calling Abort() after
+// Commit() is a no-op.
+func (p *Pending) Abort() {
+	r := p.ring
+	r.lock()
+	defer r.mu.Unlock()
+	p.done = true
+}
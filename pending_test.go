@@ -0,0 +1,80 @@
+package hashring
+
+import "testing"
+
+func TestRingPrepare(t *testing.T) {
+	var reported []RangeMove
+	r0 := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	})
+	r0.OnRelocation = func(ms []RangeMove) {
+		reported = ms
+	}
+	changes := []Change{
+		{StringItem("foo"), 0},
+		{StringItem("bar"), 1},
+		{StringItem("qux"), 2},
+		{StringItem("foo"), 4},
+	}
+	before := ringPoints(r0)
+	p, err := r0.Prepare(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pt := range ringPoints(r0) {
+		if pt != before[i] {
+			t.Fatalf("ring changed after Prepare()")
+		}
+	}
+	v := p.View()
+	for i := 0; i < 1000; i++ {
+		var (
+			key  = IntItem(i)
+			d    = r0.digest(key).hi
+			from = r0.Get(key)
+			to   = v.Get(key)
+			move *RangeMove
+		)
+		for j, m := range p.Moves() {
+			if m.Range.Contains(d) {
+				move = &p.Moves()[j]
+				break
+			}
+		}
+		if (from != to) != (move != nil) {
+			t.Fatalf("key %d: moves don't match the prepared view", i)
+		}
+	}
+	if err := p.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != len(p.Moves()) {
+		t.Fatalf("OnRelocation was not called with prepared moves")
+	}
+	r1 := makeRing(t, map[string]float64{
+		"foo": 4,
+		"bar": 1,
+		"baz": 3,
+		"qux": 2,
+	})
+	assertRingsEqual(t, "committed ?= built", r0, r1)
+
+	if err := p.Commit(); err == nil {
+		t.Fatalf("want error on second Commit()")
+	}
+	p, err = r0.Prepare([]Change{{StringItem("foo"), 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r0.Delete(StringItem("baz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Commit(); err == nil {
+		t.Fatalf("want error on Commit() of stale changes")
+	}
+	if _, err := r0.Prepare([]Change{{StringItem("baz"), 0}}); err == nil {
+		t.Fatalf("want error on deletion of not existing item")
+	}
+}
@@ -0,0 +1,127 @@
+package hashring
+
+import "fmt"
+
+// pin is an override of the key's owner on the ring.
+type pin struct {
+	key    Item
+	target uint64 // Non-suffixed digest of the target item.
+}
+
+// Pin makes Get(), GetN() and Owner() to map key to the target item
+// regardless of the ring's topology. It's useful to steer a few problem keys
+// to a designated item without changing the ring.
+// Pins are removed with Unpin() or when the target item is deleted from the
+// ring.
+// It returns non-nil error when target doesn't exist on the ring or, if
+// r.Strict is true, when key or target can't be digested.
+func (r *Ring) Pin(key, target Item) error {
+	r.lock()
+	defer r.mu.Unlock()
+
+	s := r.current()
+	d, err := r.check(s.hasher.sum(key, nil))
+	if err != nil {
+		return err
+	}
+	id, err := r.itemDigest(target)
+	if err != nil {
+		return err
+	}
+	if b, has := r.buckets[id]; !has || b.weight == 0 {
+		return fmt.Errorf("hashring: item doesn't exist")
+	}
+	pins := make(map[value]pin, len(s.pins)+1)
+	for v, p := range s.pins {
+		pins[v] = p
+	}
+	pins[d] = pin{
+		key:    key,
+		target: id,
+	}
+	r.state.Store(s.withPins(pins))
+
+	return nil
+}
+
+// Unpin removes the pin of the key made by Pin().
+// It returns non-nil error when key is not pinned or, if r.Strict is true,
+// when key can't be digested.
+func (r *Ring) Unpin(key Item) error {
+	r.lock()
+	defer r.mu.Unlock()
+
+	s := r.current()
+	d, err := r.check(s.hasher.sum(key, nil))
+	if err != nil {
+		return err
+	}
+	if _, has := s.pins[d]; !has {
+		return fmt.Errorf("hashring: key is not pinned")
+	}
+	pins := make(map[value]pin, len(s.pins)-1)
+	for v, p := range s.pins {
+		if v != d {
+			pins[v] = p
+		}
+	}
+	r.state.Store(s.withPins(pins))
+
+	return nil
+}
+
+// pinned returns the member which hash value d is pinned to.
+func (s *ringState) pinned(d value) (member, bool) {
+	if len(s.pins) == 0 {
+		return member{}, false
+	}
+	p, has := s.pins[d]
+	if !has {
+		return member{}, false
+	}
+	m, has := s.members[p.target]
+	return m, has
+}
+
+// withPins returns a copy of s with pins replaced by given ones.
+func (s *ringState) withPins(pins map[value]pin) *ringState {
+	c := *s
+	c.pins = pins
+	c.cache = s.cache.empty()
+	return &c
+}
+
+// pins returns pins of the current state which targets still exist on the
+// ring, digesting their keys and targets with h if it differs from the current
+// one.
+//
+// r.mu must be held.
+func (r *Ring) pins(h *hasher) map[value]pin {
+	s := r.current()
+	if len(s.pins) == 0 {
+		return nil
+	}
+	pins := make(map[value]pin, len(s.pins))
+	for v, p := range s.pins {
+		if h != s.hasher {
+			m, has := s.members[p.target]
+			if !has {
+				continue
+			}
+			id, err := h.ident(m.item)
+			if err != nil {
+				continue
+			}
+			d, err := h.sum(p.key, nil)
+			if err != nil {
+				continue
+			}
+			v, p.target = d, id.hi
+		}
+		if b, has := r.buckets[p.target]; !has || b.weight == 0 {
+			continue
+		}
+		pins[v] = p
+	}
+	return pins
+}
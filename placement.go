@@ -0,0 +1,111 @@
+package hashring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Placement maps objects to replica groups of ring items, similar to Ceph's
+// placement groups.
+//
+// Each object is statically mapped to one of Groups placement groups. Each
+// placement group in turn is mapped to Replicas distinct items of the ring.
+// Since the number of groups is fixed, only groups having changed items
+// membership get remapped when ring changes, and the objects of the group
+// move together.
+//
+// Placement is goroutine safe as long as its fields are not changed after
+// first use.
+type Placement struct {
+	// Ring is a ring which items are used to form replica groups.
+	Ring *Ring
+
+	// Groups is a number of placement groups. It must be greater than zero and
+	// should not be changed once objects were placed.
+	Groups int
+
+	// Replicas is a number of items in each placement group.
+	Replicas int
+
+	// Domain is an optional function returning failure domain of an item
+	// (e.g. rack or zone name). If Domain is not nil then items of the same
+	// group are picked from distinct domains whenever possible.
+	Domain func(Item) string
+}
+
+// Group returns placement group number of object v.
+// It returns -1 if Ring.Strict is true and v can't be digested.
+func (p *Placement) Group(v Item) int {
+	if p.Groups <= 0 {
+		panic(fmt.Sprintf("hashring: malformed placement groups number: %d", p.Groups))
+	}
+	_, d, err := p.Ring.locate(v)
+	if err != nil {
+		return -1
+	}
+	return int(d.hi % uint64(p.Groups))
+}
+
+// Get returns replica group items of object v.
+// The first item of the group is its primary replica.
+func (p *Placement) Get(v Item) []Item {
+	g := p.Group(v)
+	if g < 0 {
+		return nil
+	}
+	return p.Members(g)
+}
+
+// Members returns items of placement group g.
+// The first item of the group is its primary replica. Returned slice contains
+// less than p.Replicas items only if the ring has not enough items.
+func (p *Placement) Members(g int) []Item {
+	n := p.Replicas
+	if n <= 0 {
+		return nil
+	}
+	s, d, err := p.Ring.locate(groupKey(g))
+	if err != nil {
+		return nil
+	}
+	var (
+		items   []Item
+		spare   []Item
+		seen    = make(map[uint64]bool, n)
+		domains = make(map[string]bool, n)
+	)
+	s.walk(d, func(x *point) bool {
+		b := x.bucket
+		if seen[b.id] {
+			return true
+		}
+		seen[b.id] = true
+		if p.Domain != nil {
+			dom := p.Domain(b.item)
+			if domains[dom] {
+				spare = append(spare, b.item)
+				return true
+			}
+			domains[dom] = true
+		}
+		items = append(items, b.item)
+		return len(items) < n
+	})
+	// If there were not enough domains fill up the group with items from
+	// already used domains.
+	for i := 0; len(items) < n && i < len(spare); i++ {
+		items = append(items, spare[i])
+	}
+	return items
+}
+
+// groupKey is an Item representing placement group on the ring.
+type groupKey int
+
+func (g groupKey) WriteTo(w io.Writer) (int64, error) {
+	var p [8]byte
+	binary.LittleEndian.PutUint64(p[:], uint64(g))
+	n, err := w.Write(p[:])
+	return int64(n), err
+}
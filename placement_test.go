@@ -0,0 +1,73 @@
+package hashring
+
+import (
+	"testing"
+)
+
+func TestPlacementMembers(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"a1": 1,
+		"a2": 1,
+		"b1": 1,
+		"b2": 1,
+		"c1": 1,
+	})
+	p := Placement{
+		Ring:     r,
+		Groups:   64,
+		Replicas: 3,
+		Domain: func(x Item) string {
+			return string(x.(StringItem)[:1])
+		},
+	}
+	for g := 0; g < p.Groups; g++ {
+		ms := p.Members(g)
+		if n := len(ms); n != p.Replicas {
+			t.Fatalf("unexpected size of group %d: %d", g, n)
+		}
+		domains := make(map[string]bool)
+		for _, m := range ms {
+			domains[p.Domain(m)] = true
+		}
+		if n := len(domains); n != 3 {
+			t.Fatalf("group %d members %v are from %d domains", g, ms, n)
+		}
+	}
+}
+
+func TestPlacementStability(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 1,
+		"baz": 1,
+		"baq": 1,
+	})
+	p := Placement{
+		Ring:     r,
+		Groups:   64,
+		Replicas: 2,
+	}
+	prev := make([][]Item, p.Groups)
+	for g := range prev {
+		prev[g] = p.Members(g)
+	}
+	if err := r.Delete(StringItem("baz")); err != nil {
+		t.Fatal(err)
+	}
+	for g := range prev {
+		next := p.Members(g)
+		var k int
+		for _, x := range prev[g] {
+			if x == StringItem("baz") {
+				continue
+			}
+			if next[k] != x {
+				t.Fatalf(
+					"group %d is remapped unexpectedly: %v vs %v",
+					g, prev[g], next,
+				)
+			}
+			k++
+		}
+	}
+}
@@ -1,6 +1,6 @@
 package hashring
 
-import "github.com/gobwas/avl"
+import "github.com/gobwas/hashring/internal/avl"
 
 // point represents a point on the ring.
 // To handle collisions properly it may change its value to another one,
@@ -12,44 +12,85 @@ type point struct {
 	// index is a constant index of the point within bucket.
 	index int
 
+	// gen is a generation of the point, that is, the number of times the
+	// point was moved due to collisions with other points. History of point
+	// values is held by the bucket.
+	gen int
+
 	// val is a current value of the point.
 	// It might be changed if point collides with another one.
-	val uint64
-
-	// stack holds a history of point values.
-	// It's non-nil only if point collides with another one.
-	stack []uint64
+	val value
 }
 
-func newPoint(b *bucket, i int, v uint64) *point {
-	return &point{
-		bucket: b,
-		index:  i,
-		val:    v,
-	}
+// PointInfo holds information about a point on the ring.
+type PointInfo struct {
+	// Value is a hash value of the point.
+	// For rings operating in 128-bit hash space it holds the high 64 bits of
+	// the value.
+	Value uint64
+
+	// Item is an item which point belongs to.
+	Item Item
+
+	// Index is a constant index of the point within item's points.
+	Index int
+
+	// Generation is a number of times point's value was changed due to hash
+	// collisions with other points.
+	Generation int
 }
 
 func (p *point) generation() int {
-	return len(p.stack)
+	return p.gen
 }
 
-func (p *point) proceed(v uint64) {
-	p.stack = append(p.stack, p.val)
+func (p *point) proceed(v value) {
+	b := p.bucket
+	if b.stacks == nil {
+		b.stacks = make(map[int][]value)
+	}
+	b.stacks[p.index] = append(b.stacks[p.index], p.val)
+	p.gen++
 	p.val = v
 }
 
 func (p *point) rewind() {
-	n := len(p.stack)
-	p.val = p.stack[n-1]
-	p.stack = p.stack[:n-1]
+	b := p.bucket
+	stack := b.stacks[p.index]
+	n := len(stack)
+	p.val = stack[n-1]
+	p.gen--
+	if n > 1 {
+		b.stacks[p.index] = stack[:n-1]
+	} else {
+		delete(b.stacks, p.index)
+	}
+}
+
+// stack returns a history of point values.
+func (p *point) stack() []value {
+	return p.bucket.stacks[p.index]
 }
 
-func (p *point) value() uint64 {
+func (p *point) value() value {
 	return p.val
 }
 
+func (p *point) info() PointInfo {
+	return PointInfo{
+		Value:      p.val.hi,
+		Item:       p.bucket.item,
+		Index:      p.index,
+		Generation: p.generation(),
+	}
+}
+
 func (p *point) Compare(x avl.Item) int {
-	return compare(p.val, x.(*point).val)
+	q := x.(*point)
+	if c := p.val.compare(q.val); c != 0 || !p.bucket.stable {
+		return c
+	}
+	return collision{p}.Compare(collision{q})
 }
 
 type collision struct {
@@ -0,0 +1,53 @@
+package hashring
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultProbationFactor is the default factor applied to the weights of the
+// items on probation. See Ring.Probation for details.
+const DefaultProbationFactor = 0.1
+
+// probationWeight returns reduced weight of the item on probation having
+// weight w.
+//
+// r.mu must be held.
+func (r *Ring) probationWeight(w float64) float64 {
+	f := r.conf.ProbationFactor
+	if f <= 0 {
+		f = DefaultProbationFactor
+	}
+	p := w * f
+	if r.exactWeights() {
+		p = math.Max(1, math.Floor(p))
+	}
+	return math.Min(p, w)
+}
+
+// startProbation schedules the change of weight of item x having digest id
+// to w when r.Probation passes.
+//
+// r.mu must be held.
+func (r *Ring) startProbation(x Item, id uint64, w float64) {
+	r.schedule(ScheduledWeight{
+		Item:      x,
+		Weight:    w,
+		At:        time.Now().Add(r.conf.Probation),
+		Probation: true,
+		digest:    id,
+	})
+}
+
+// endProbation cancels the pending change of the item having digest id which
+// ends its probation, if any.
+//
+// r.mu must be held.
+func (r *Ring) endProbation(id uint64) {
+	for i, s := range r.schedules {
+		if s.Probation && s.digest == id {
+			r.schedules = append(r.schedules[:i], r.schedules[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package hashring
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRingProbation(t *testing.T) {
+	var (
+		foo = StringItem("foo")
+		bar = StringItem("bar")
+		baz = StringItem("baz")
+	)
+	r := Ring{
+		Probation: time.Hour,
+	}
+	for _, x := range []Item{foo, bar, baz} {
+		if err := r.Insert(x, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, x := range []Item{foo, bar, baz} {
+		if w, _ := r.Weight(x); w != 1 {
+			t.Fatalf("unexpected weight of %v on probation: %v; want 1", x, w)
+		}
+	}
+	ss := r.Schedules()
+	if n := len(ss); n != 3 {
+		t.Fatalf("unexpected number of schedules: %d; want 3", n)
+	}
+	for _, s := range ss {
+		if !s.Probation || s.Weight != 10 {
+			t.Fatalf("unexpected schedule: %+v", s)
+		}
+	}
+
+	// Explicit weight change ends probation.
+	if err := r.Update(bar, 5); err != nil {
+		t.Fatal(err)
+	}
+	// Deleted item doesn't get its weight back.
+	if err := r.Delete(baz); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Schedules()); n != 1 {
+		t.Fatalf("unexpected number of schedules: %d; want 1", n)
+	}
+
+	if n, err := r.Tick(time.Now()); err != nil || n != 0 {
+		t.Fatalf("unexpected Tick() result before probation end: %d, %v", n, err)
+	}
+	if n, err := r.Tick(time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("unexpected Tick() result after probation end: %d, %v", n, err)
+	}
+	for x, exp := range map[Item]float64{foo: 10, bar: 5, baz: 0} {
+		if w, _ := r.Weight(x); w != exp {
+			t.Errorf("unexpected weight of %v: %v; want %v", x, w, exp)
+		}
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRingProbationWeight(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		ring   *Ring
+		weight float64
+		exp    float64
+	}{
+		{"default", &Ring{}, 10, 1},
+		{"factor", &Ring{ProbationFactor: 0.5}, 3, 1.5},
+		{"exact", &Ring{Allocation: AllocateExact, ProbationFactor: 0.5}, 3, 1},
+		{"exact-min", &Ring{Allocation: AllocateExact}, 3, 1},
+		{"greater", &Ring{ProbationFactor: 2}, 3, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ring.configure()
+			if act := test.ring.probationWeight(test.weight); act != test.exp {
+				t.Fatalf("unexpected weight: %v; want %v", act, test.exp)
+			}
+		})
+	}
+}
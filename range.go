@@ -0,0 +1,123 @@
+package hashring
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Range represents a half-open interval [Start, End) of the ring's hash
+// space.
+//
+// Range may wrap around the ring, which means that End is less than Start. If
+// Start is equal to End then range covers the whole ring.
+type Range struct {
+	Start uint64
+	End   uint64
+}
+
+// Contains reports whether hash value v belongs to the range.
+func (r Range) Contains(v uint64) bool {
+	switch {
+	case r.Start < r.End:
+		return r.Start <= v && v < r.End
+	case r.Start > r.End:
+		return r.Start <= v || v < r.End
+	default:
+		return true
+	}
+}
+
+// WalkRange calls fn for each point on the ring which value belongs to the
+// half-open interval [from, to). Points are visited clockwise, that is, if to
+// is less than from the interval wraps around the ring. If from is equal to to
+// then all points of the ring are visited.
+// If fn returns false WalkRange stops the iteration.
+//
+// Note that fn is called on the ring's version taken at the moment of the
+// WalkRange call. That is, fn is free to call ring's methods.
+func (r *Ring) WalkRange(from, to uint64, fn func(PointInfo) bool) {
+	var (
+		rng = Range{Start: from, End: to}
+		// Note that the point which owns the greatest value having from-1 high
+		// bits is the first point having value greater or equal to from.
+		start = value{
+			hi: from - 1,
+			lo: math.MaxUint64,
+		}
+	)
+	r.load().walk(start, func(p *point) bool {
+		return rng.Contains(p.val.hi) && fn(p.info())
+	})
+}
+
+// PointAt returns the point of the ring having given rank, that is, the
+// number of points having less values. Points are ranked in the same order
+// they are visited by WalkRange(0, 0, fn).
+// It returns zero PointInfo if rank is out of [0, NumPoints()) range.
+//
+// It takes O(log n) time, thus PointAt() along with NumPoints() is useful to
+// visit random or evenly spaced points of large rings.
+func (r *Ring) PointAt(rank int) PointInfo {
+	x := r.load().tree.Select(rank)
+	if x == nil {
+		return PointInfo{}
+	}
+	return x.(*point).info()
+}
+
+// RandomPoint returns a point of the ring chosen uniformly at random using
+// rng (or the default source of math/rand package if rng is nil). Since each
+// point owns the single arc preceding it, it is also a uniform sample of the
+// ring's arcs, which is useful for probing and for empirical estimation of
+// items ownership.
+// It returns zero PointInfo if the ring is empty.
+func (r *Ring) RandomPoint(rng *rand.Rand) PointInfo {
+	tree := r.load().tree
+	n := tree.Size()
+	if n == 0 {
+		return PointInfo{}
+	}
+	var i int
+	if rng != nil {
+		i = rng.Intn(n)
+	} else {
+		i = rand.Intn(n)
+	}
+	return tree.Select(i).(*point).info()
+}
+
+// RangesOf returns ranges of the hash space owned by item x, that is, the
+// ranges of keys which x owns. Adjacent points of x make up a single range.
+// Ranges are ordered by their starts. The item owning all points of the ring
+// (e.g. the only item of the ring) owns the whole ring, which is described by
+// a single range having Start equal to End.
+// Note that keys pinned with Pin() are not taken into account.
+//
+// It's useful to enumerate keys which must be moved when x is scheduled for
+// removal from the ring.
+//
+// It returns nil if x doesn't exist on the ring or, if r.Strict is true, when
+// x can't be digested.
+func (r *Ring) RangesOf(x Item) []Range {
+	s, d, err := r.locateItem(x)
+	if err != nil {
+		return nil
+	}
+	arcs, whole := s.arcs(d.hi)
+	if whole {
+		return []Range{{}}
+	}
+	var rs []Range
+	for _, a := range arcs {
+		// Points having equal values (under CollisionStable policy) may give
+		// empty ranges, which must not be confused with the whole ring.
+		if a.rng.Start != a.rng.End {
+			rs = append(rs, a.rng)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Start < rs[j].Start
+	})
+	return rs
+}
@@ -0,0 +1,140 @@
+package hashring
+
+import (
+	"encoding/json"
+	"hash"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Registry manages a set of named rings, e.g. one per tenant or per cache
+// cluster. Rings created by the registry share the pool of hash functions
+// and their statistics are available aggregated.
+//
+// Registry is goroutine safe. Registry instances must not be copied.
+// The zero value for Registry is an empty registry ready to use.
+type Registry struct {
+	// Hash is an optional function used to build up a new 64-bit hash function
+	// for rings of the registry. See Ring.Hash for details.
+	// It must not be changed after registry's first use.
+	Hash func() hash.Hash64
+
+	// Configure is an optional function called to configure a new ring with
+	// given name before its first use. It must not change ring's Hash and
+	// Hash128 fields.
+	Configure func(name string, r *Ring)
+
+	mu     sync.RWMutex
+	rings  map[string]*Ring
+	hasher *hasher
+}
+
+// RegistryStats holds statistics of the registry's rings.
+type RegistryStats struct {
+	// Rings maps name of a ring to its statistics.
+	Rings map[string]ExpvarStats `json:"rings"`
+
+	// Total holds the sums of statistics of all rings.
+	Total ExpvarStats `json:"total"`
+}
+
+// Ring returns the ring with given name, creating it if it doesn't exist.
+func (g *Registry) Ring(name string) *Ring {
+	g.mu.RLock()
+	r, has := g.rings[name]
+	g.mu.RUnlock()
+	if has {
+		return r
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if r, has := g.rings[name]; has {
+		return r
+	}
+	if g.hasher == nil {
+		g.hasher = newHasher(g.Hash, nil)
+	}
+	r = &Ring{
+		Hash:   g.Hash,
+		shared: g.hasher,
+	}
+	if fn := g.Configure; fn != nil {
+		fn(name, r)
+	}
+	if g.rings == nil {
+		g.rings = make(map[string]*Ring)
+	}
+	g.rings[name] = r
+
+	return r
+}
+
+// Lookup returns the ring with given name, if any.
+func (g *Registry) Lookup(name string) (*Ring, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	r, has := g.rings[name]
+	return r, has
+}
+
+// Remove removes the ring with given name from the registry. It returns false
+// if there is no such ring.
+func (g *Registry) Remove(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, has := g.rings[name]
+	delete(g.rings, name)
+	return has
+}
+
+// Names returns sorted names of the registry's rings.
+func (g *Registry) Names() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	names := make([]string, 0, len(g.rings))
+	for name := range g.rings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats returns statistics of the registry's rings. Statistics are taken
+// from the current versions of the rings without blocking their mutations.
+func (g *Registry) Stats() RegistryStats {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	stats := RegistryStats{
+		Rings: make(map[string]ExpvarStats, len(g.rings)),
+	}
+	for name, r := range g.rings {
+		s := r.expvarStats()
+		stats.Rings[name] = s
+
+		t := &stats.Total
+		t.Members += s.Members
+		t.Points += s.Points
+		t.Rebuilds += s.Rebuilds
+		t.Collisions += s.Collisions
+		t.DigestCollisions += s.DigestCollisions
+		t.Clamped += s.Clamped
+		t.Version += s.Version
+	}
+	return stats
+}
+
+// ServeHTTP implements http.Handler. It responds with JSON encoded
+// RegistryStats, which makes it possible to mount the registry as a single
+// admin endpoint for all of its rings.
+func (g *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(g.Stats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,62 @@
+package hashring
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	var g Registry
+	g.Configure = func(name string, r *Ring) {
+		r.MagicFactor = 10
+	}
+	for _, name := range []string{"foo", "bar"} {
+		r := g.Ring(name)
+		if g.Ring(name) != r {
+			t.Fatalf("registry returned different rings for %q", name)
+		}
+		if err := r.Insert(StringItem("a"), 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Insert(StringItem("b"), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if act, exp := g.Names(), []string{"bar", "foo"}; !reflect.DeepEqual(act, exp) {
+		t.Fatalf("unexpected names: %v; want %v", act, exp)
+	}
+	foo, _ := g.Lookup("foo")
+	bar, _ := g.Lookup("bar")
+	if foo.load().hasher != bar.load().hasher {
+		t.Errorf("rings don't share hasher")
+	}
+	if foo.Get(StringItem("key")) == nil {
+		t.Errorf("ring lookup failed")
+	}
+
+	rec := httptest.NewRecorder()
+	g.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var act RegistryStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &act); err != nil {
+		t.Fatal(err)
+	}
+	exp := RegistryStats{
+		Rings: map[string]ExpvarStats{
+			"foo": {Members: 2, Points: 20, Rebuilds: 2, Version: 2},
+			"bar": {Members: 2, Points: 20, Rebuilds: 2, Version: 2},
+		},
+		Total: ExpvarStats{Members: 4, Points: 40, Rebuilds: 4, Version: 4},
+	}
+	if !reflect.DeepEqual(act, exp) {
+		t.Fatalf("unexpected stats: %+v; want %+v", act, exp)
+	}
+
+	if !g.Remove("foo") || g.Remove("foo") {
+		t.Fatalf("unexpected Remove() results")
+	}
+	if _, has := g.Lookup("foo"); has {
+		t.Fatalf("ring is not removed")
+	}
+}
@@ -0,0 +1,160 @@
+package hashring
+
+import "github.com/gobwas/hashring/internal/avl"
+
+// RangeMove describes a range of the ring's hash space which changed its
+// owner after the ring mutation.
+type RangeMove struct {
+	// Range is a range of the hash space which changed its owner.
+	Range Range
+
+	// From is an item which owned the range before the mutation.
+	// It's nil if the ring was empty.
+	From Item
+
+	// To is an item which owns the range after the mutation.
+	// It's nil if the ring became empty.
+	To Item
+}
+
+// mark holds the position of a point on the ring along with the item which
+// point belongs to. Unlike points, marks are not changed by ring mutations.
+type mark struct {
+	pos  uint64
+	id   uint64
+	item Item
+}
+
+// marks returns marks of all points of the tree in order of their positions.
+// It returns nil if r.OnRelocation is nil.
+func (r *Ring) marks(tree avl.Tree) []mark {
+	if r.conf.OnRelocation == nil {
+		return nil
+	}
+	return treeMarks(tree)
+}
+
+// treeMarks returns marks of all points of the tree in order of their
+// positions.
+func treeMarks(tree avl.Tree) []mark {
+	ms := make([]mark, 0, tree.Size())
+	tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		ms = append(ms, mark{
+			pos:  p.val.hi,
+			id:   p.bucket.id,
+			item: p.bucket.item,
+		})
+		return true
+	})
+	return ms
+}
+
+// relocate calls r.OnRelocation with ranges of the hash space which changed
+// their owners since the ring had points marked by before.
+//
+// r.mu must be held.
+func (r *Ring) relocate(before []mark) {
+	if r.conf.OnRelocation == nil {
+		return
+	}
+	moves := relocations(before, r.marks(r.current().tree))
+	if len(moves) > 0 {
+		r.conf.OnRelocation(moves)
+	}
+}
+
+// relocations returns ranges of the hash space which changed their owners
+// when the ring's points were changed from a to b.
+//
+// Both a and b must be sorted by positions. Hash value v belongs to the first
+// point which position is greater than v (or to the first point of the ring if
+// there is no such point).
+func relocations(a, b []mark) (moves []RangeMove) {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	// Collect all distinct positions. Positions of each ring split the hash
+	// space into the ranges having the same owner before and after the
+	// mutation.
+	pos := make([]uint64, 0, len(a)+len(b))
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		var p uint64
+		switch {
+		case j == len(b) || (i < len(a) && a[i].pos < b[j].pos):
+			p = a[i].pos
+			i++
+		case i == len(a) || b[j].pos < a[i].pos:
+			p = b[j].pos
+			j++
+		default:
+			p = a[i].pos
+			i++
+			j++
+		}
+		if n := len(pos); n == 0 || pos[n-1] != p {
+			pos = append(pos, p)
+		}
+	}
+	owner := func(ms []mark, i *int, p uint64) *mark {
+		for *i < len(ms) && ms[*i].pos < p {
+			*i++
+		}
+		switch {
+		case len(ms) == 0:
+			return nil
+		case *i < len(ms):
+			return &ms[*i]
+		default:
+			return &ms[0]
+		}
+	}
+	var (
+		i, j   int
+		owners [][2]*mark
+	)
+	for k, end := range pos {
+		start := pos[(k+len(pos)-1)%len(pos)]
+		from := owner(a, &i, end)
+		to := owner(b, &j, end)
+		if sameOwner(from, to) {
+			continue
+		}
+		if n := len(moves); n > 0 && moves[n-1].Range.End == start &&
+			sameOwner(owners[n-1][0], from) &&
+			sameOwner(owners[n-1][1], to) {
+			moves[n-1].Range.End = end
+			continue
+		}
+		m := RangeMove{
+			Range: Range{
+				Start: start,
+				End:   end,
+			},
+		}
+		if from != nil {
+			m.From = from.item
+		}
+		if to != nil {
+			m.To = to.item
+		}
+		moves = append(moves, m)
+		owners = append(owners, [2]*mark{from, to})
+	}
+	// Merge the last move with the first one if it wraps around the ring
+	// towards the first one.
+	if n := len(moves); n > 1 && moves[n-1].Range.End == moves[0].Range.Start &&
+		sameOwner(owners[n-1][0], owners[0][0]) &&
+		sameOwner(owners[n-1][1], owners[0][1]) {
+		moves[0].Range.Start = moves[n-1].Range.Start
+		moves = moves[:n-1]
+	}
+	return moves
+}
+
+func sameOwner(x, y *mark) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return x.id == y.id
+}
@@ -0,0 +1,133 @@
+package hashring
+
+import "testing"
+
+func TestRingOnRelocation(t *testing.T) {
+	var moves []RangeMove
+	r := Ring{
+		OnRelocation: func(ms []RangeMove) {
+			moves = ms
+		},
+	}
+	for _, s := range []string{"foo", "bar", "baz"} {
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, mutate := range []func(){
+		func() { r.Insert(StringItem("qux"), 2) },
+		func() { r.Update(StringItem("foo"), 3) },
+		func() { r.Delete(StringItem("bar")) },
+	} {
+		const keys = 10000
+		before := make([]Item, keys)
+		for i := range before {
+			before[i] = r.Get(IntItem(i))
+		}
+		moves = nil
+		mutate()
+		if len(moves) == 0 {
+			t.Fatalf("no moves reported")
+		}
+		for i := range before {
+			var (
+				key   = IntItem(i)
+				d     = r.digest(key).hi
+				after = r.Get(key)
+				move  *RangeMove
+			)
+			for j := range moves {
+				if moves[j].Range.Contains(d) {
+					move = &moves[j]
+					break
+				}
+			}
+			switch {
+			case before[i] == after && move != nil:
+				t.Fatalf(
+					"key %d didn't move but is within move %+v",
+					i, *move,
+				)
+			case before[i] != after && move == nil:
+				t.Fatalf(
+					"key %d moved from %s to %s but is not within moves",
+					i, before[i], after,
+				)
+			case before[i] != after && (move.From != before[i] || move.To != after):
+				t.Fatalf(
+					"key %d moved from %s to %s but is within move %+v",
+					i, before[i], after, *move,
+				)
+			}
+		}
+	}
+}
+
+func TestRelocations(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		a, b []mark
+		exp  []RangeMove
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "from empty",
+			b:    []mark{{10, 1, StringItem("a")}},
+			exp: []RangeMove{
+				{Range{10, 10}, nil, StringItem("a")},
+			},
+		},
+		{
+			name: "to empty",
+			a:    []mark{{10, 1, StringItem("a")}},
+			exp: []RangeMove{
+				{Range{10, 10}, StringItem("a"), nil},
+			},
+		},
+		{
+			name: "insert",
+			a: []mark{
+				{10, 1, StringItem("a")},
+				{20, 2, StringItem("b")},
+			},
+			b: []mark{
+				{10, 1, StringItem("a")},
+				{15, 3, StringItem("c")},
+				{20, 2, StringItem("b")},
+			},
+			exp: []RangeMove{
+				{Range{10, 15}, StringItem("b"), StringItem("c")},
+			},
+		},
+		{
+			name: "wrap",
+			a: []mark{
+				{10, 1, StringItem("a")},
+				{20, 2, StringItem("b")},
+			},
+			b: []mark{
+				{5, 3, StringItem("c")},
+				{10, 1, StringItem("a")},
+				{20, 2, StringItem("b")},
+				{30, 3, StringItem("c")},
+			},
+			exp: []RangeMove{
+				{Range{20, 5}, StringItem("a"), StringItem("c")},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			act := relocations(test.a, test.b)
+			if len(act) != len(test.exp) {
+				t.Fatalf("unexpected moves: %+v; want %+v", act, test.exp)
+			}
+			for i := range act {
+				if act[i] != test.exp[i] {
+					t.Fatalf("unexpected moves: %+v; want %+v", act, test.exp)
+				}
+			}
+		})
+	}
+}
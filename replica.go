@@ -0,0 +1,89 @@
+package hashring
+
+// Replica describes an item which key maps to along with its position on
+// the ring relative to the key.
+type Replica struct {
+	// Item is the item which key maps to.
+	Item Item
+
+	// Distance is the clockwise distance from the key's hash value to the
+	// first met point of the item, in hash space units. For rings operating
+	// in 128-bit hash space it's calculated over the high 64 bits of values.
+	//
+	// Distance is zero for the item the key is pinned to with Pin().
+	Distance uint64
+
+	// Pinned is true if key is pinned to the item with Pin().
+	Pinned bool
+}
+
+// GetReplicas is like GetN() but returns replicas along with their distances
+// from v on the ring. Replicas are ordered primary-first (that is, the first
+// one is the same as returned by Get()) and then by increasing distance,
+// which makes it possible for callers to prefer nearby replicas, e.g. for
+// read-repair.
+func (r *Ring) GetReplicas(v Item, n int) (rs []Replica) {
+	s, d, err := r.locate(v)
+	if err != nil || n <= 0 {
+		return nil
+	}
+	if done := r.traceGet(d); done != nil {
+		defer func() {
+			done(primary(rs))
+		}()
+	}
+	return s.lookupReplicas(d, n)
+}
+
+// GetReplicas returns at most n replicas of the snapshot which x maps to.
+// See Ring.GetReplicas() for details.
+func (v *View) GetReplicas(x Item, n int) (rs []Replica) {
+	d, err := v.ring.check(v.state.hasher.sum(x, nil))
+	if err != nil || n <= 0 {
+		return nil
+	}
+	if done := v.ring.traceGet(d); done != nil {
+		defer func() {
+			done(primary(rs))
+		}()
+	}
+	return v.state.lookupReplicas(d, n)
+}
+
+// primary returns the item of the first replica or nil if rs is empty.
+func primary(rs []Replica) Item {
+	if len(rs) == 0 {
+		return nil
+	}
+	return rs[0].Item
+}
+
+// lookupReplicas returns at most n distinct replicas which hash value d is
+// mapped to.
+func (s *ringState) lookupReplicas(d value, n int) []Replica {
+	var (
+		rs   []Replica
+		seen = make(map[uint64]bool, n)
+	)
+	if m, has := s.pinned(d); has {
+		rs = append(rs, Replica{
+			Item:   m.item,
+			Pinned: true,
+		})
+		seen[s.pins[d].target] = true
+	}
+	if len(rs) == n {
+		return rs
+	}
+	s.walk(d, func(p *point) bool {
+		if !seen[p.bucket.id] {
+			seen[p.bucket.id] = true
+			rs = append(rs, Replica{
+				Item:     p.bucket.item,
+				Distance: p.val.hi - d.hi,
+			})
+		}
+		return len(rs) < n
+	})
+	return rs
+}
@@ -2,14 +2,20 @@ package hashring
 
 import (
 	"container/list"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
 	"math"
+	"math/rand"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/cespare/xxhash/v2"
-	"github.com/gobwas/avl"
+	"github.com/gobwas/hashring/internal/avl"
 )
 
 const DefaultMagicFactor = 1020
@@ -19,13 +25,24 @@ type Item interface {
 }
 
 // Ring is a consistent hashing hashring.
-// It is goroutine safe. Ring instances must not be copied.
+// It is goroutine safe. Ring instances must not be copied. Copying is
+// reported by go vet's copylocks check and mutating a copy of the ring which
+// was already used panics.
 // The zero value for Ring is an empty ring ready to use.
 type Ring struct {
 	// Hash is an optional function used to build up a new 64-bit hash function
 	// for further hash values calculation.
 	Hash func() hash.Hash64
 
+	// Hash128 is an optional function used to build up a new 128-bit hash
+	// function for further hash values calculation. If Hash128 is not nil, it
+	// is used instead of Hash and the ring operates in 128-bit hash space,
+	// making hash collisions practically impossible.
+	//
+	// Note that public methods of the ring still represent positions on the
+	// ring as 64-bit numbers, which are the high 64 bits of the hash values.
+	Hash128 func() Hash128
+
 	// MagicFactor is an optional number of "virtual" points on the ring per
 	// item. The higher this number, the more equal distribution of objects
 	// this ring produces and the more time is needed to update the ring.
@@ -36,10 +53,144 @@ type Ring struct {
 	//
 	// If MagicFactor is zero, then the DefaultMagicFactor is used. For most
 	// applications the default value is fine enough.
+	//
+	// MagicFactor must not be changed directly after ring's first use. Use
+	// SetMagicFactor() instead.
 	MagicFactor int
 
-	// hashPool is a pool of reusable hash functions.
-	hashPool sync.Pool
+	// Allocation is a method of calculating the number of points of each
+	// item. The default method is AllocateLinear.
+	// It must not be changed after ring's first use.
+	Allocation PointAllocation
+
+	// Allocator is an optional custom method of calculating the number of
+	// points of each item. If Allocator is non-nil, Allocation is ignored.
+	// It must not be changed after ring's first use.
+	Allocator PointAllocator
+
+	// MinPoints is an optional minimum number of points of each item. With
+	// extreme weight ratios (like 1 to 10000) items having small weights get
+	// only a few points (or even none), making their share of the hash space
+	// very noisy. MinPoints raises the number of points of such items, so
+	// extreme ratios degrade gracefully at the cost of giving them more keys
+	// than their weights imply. The number of such items is reported by
+	// Clamped().
+	//
+	// If MinPoints is zero, there is no minimum.
+	// It must not be changed after ring's first use.
+	MinPoints int
+
+	// Probation is an optional duration for which items inserted with
+	// Insert() are held at weight reduced by ProbationFactor. When it passes,
+	// items get their weights as scheduled changes (see ScheduleWeight()),
+	// that is, they must be applied with Tick() or RunSchedules(). Explicit
+	// change of the item's weight during probation ends it.
+	//
+	// Probation protects the ring from a misconfigured item getting its full
+	// share of keys at once.
+	Probation time.Duration
+
+	// ProbationFactor is a factor applied to the weights of the items on
+	// probation. Under AllocateExact method the reduced weight is rounded
+	// down, but not less than one.
+	// If ProbationFactor is zero, then DefaultProbationFactor is used.
+	ProbationFactor float64
+
+	// Suffix is an optional function returning bytes which are appended to
+	// the item's bytes when calculating value of the item's point with given
+	// index and generation. Generation is the number of times the point was
+	// moved due to hash collisions with other points.
+	//
+	// If Suffix is nil, generation and index are encoded as machine-sized
+	// little-endian integers. Custom suffix is useful to build rings
+	// compatible with other implementations, e.g. the ones using text point
+	// keys like "server01#42".
+	//
+	// Suffix must return distinct values for distinct pairs of generation and
+	// index. It must not be changed after ring's first use.
+	Suffix func(x Item, gen, index int) []byte
+
+	// Collision is a policy of points collisions resolution. The default
+	// policy is CollisionRehash.
+	// It must not be changed after ring's first use.
+	Collision CollisionPolicy
+
+	// MaxGeneration is an optional limit of the number of times a point can
+	// be moved due to hash collisions with other points (see
+	// CollisionRehash). If some point exceeds the limit, ring mutation
+	// methods return an error and the ring is left unchanged. It protects the
+	// ring from looping for too long with poor hash functions.
+	//
+	// If MaxGeneration is zero, then there is no limit.
+	MaxGeneration int
+
+	// RebuildBudget is an optional maximum duration of holding the ring's
+	// lock while rebuilding the ring after mutation. If rebuild takes longer,
+	// the lock is released for a while after each budget interval, so
+	// goroutines waiting for it (such as ChangesSince() callers) are not
+	// delayed by the whole rebuild. Get() and other lookup methods are never
+	// blocked by rebuild and keep using the previous version of the ring
+	// until the new one is published at the end of rebuild. Other mutations
+	// and methods inspecting ring internals (such as PointsOf()) wait until
+	// the rebuild finishes.
+	//
+	// If RebuildBudget is zero, then the lock is held during the whole
+	// rebuild.
+	RebuildBudget time.Duration
+
+	// Strict makes ring methods to return errors instead of panics when given
+	// weight is not positive or an item can't be digested (that is, its
+	// WriteTo() method returns non-nil error or, for KeyReader items, its
+	// bytes can't be read). Mutations failed due to digest errors leave the
+	// ring unchanged.
+	//
+	// Note that Get() returns nil item in case of digest error when Strict is
+	// true.
+	Strict bool
+
+	// OnRelocation is an optional function which is called after ring
+	// mutation changed owners of some ranges of the hash space. Moves are
+	// ordered clockwise, starting from the lowest hash values.
+	//
+	// Note that SetHash() changes positions of all objects on the ring, thus
+	// OnRelocation is not called for it.
+	//
+	// OnRelocation is called while the ring is locked for writes. That is, it
+	// must not call ring's Insert(), Update(), Delete() or SetHash() methods.
+	// It must not be changed after ring's first use.
+	OnRelocation func(moves []RangeMove)
+
+	// SkipList makes the ring to maintain a read-only skip list of the points
+	// along with the tree. Lookups in the skip list cause less cache misses
+	// than the tree descent, which makes Get() faster for read-mostly
+	// workloads at the cost of additional memory and O(n) time spent on each
+	// ring mutation.
+	// It must not be changed after ring's first use.
+	SkipList bool
+
+	// CacheSize is the number of entries of an optional lock-free cache of
+	// Get() results keyed by digests of the keys. The cache is dropped on
+	// each ring mutation, so it's useful for read-mostly workloads where
+	// most of lookups are made for a small set of popular keys. Lookups of
+	// other keys pay for the cache with an allocation.
+	// If CacheSize is zero, lookups are not cached.
+	// It must not be changed after ring's first use.
+	CacheSize int
+
+	// CountLoads makes the ring to count Get() and GetSpread() calls resolved
+	// to each item. Counters are available through Loads() method.
+	// It must not be changed after ring's first use.
+	CountLoads bool
+
+	// ChangeLog is an optional maximum number of change sets kept by the ring
+	// to be returned by ChangesSince(). If ChangeLog is zero, changes are not
+	// recorded.
+	// It must not be changed after ring's first use.
+	ChangeLog int
+
+	// Trace is an optional set of hooks called by the ring methods.
+	// It must not be changed after ring's first use.
+	Trace RingTrace
 
 	// mu serializes write-only opearations on the ring.
 	// It should be held when doing insert/update/delete operations, which in
@@ -53,113 +204,941 @@ type Ring struct {
 	// collisions is a mapping of collided point value to a tree of all points
 	// having same value in their generations.
 	// It is protected by r.mu mutex.
-	collisions map[uint64]avl.Tree // tree<collision>
+	collisions map[value]avl.Tree // tree<collision>
 
 	// fix is a list of points required to be fixed.
 	// It's filled only during ring mutation and drained in the end of it.
 	// It is protected by r.mu mutex.
 	fix list.List // list<*point>
 
-	// minWeight holds minimum weight of item on the ring.
+	// deferred is true when ring is in deferred mode, that is, between Begin()
+	// and Commit() calls.
+	// It is protected by r.mu mutex.
+	deferred bool
+
+	// tombs is a mapping of a non-suffixed digest of an item removed with
+	// Tombstone mode to its tombstone. It's never changed in place.
+	// It is protected by r.mu mutex.
+	tombs map[uint64]tombstone
+
+	// minWeight holds minimum weight of item on the ring (or of a tombstone).
 	// It is protected by r.mu mutex.
 	minWeight float64
 	// maxWeight holds maximum weight of item on the ring.
 	// It is protected by r.mu mutex.
 	maxWeight float64
 
-	// ringMu serializes read & write operations on the tree holding bucket
-	// points.
-	// It's read-end should be held when reading the tree data.
-	// It's write-end should be held when tree pointer is being updated.
-	ringMu sync.RWMutex
+	// log holds at most ChangeLog recent change sets.
+	// It is protected by r.mu mutex.
+	log []ChangeSet
+
+	// undo holds the previous version of the state to be restored by
+	// Rollback(). It's nil if there is nothing to roll back.
+	// It is protected by r.mu mutex.
+	undo *ringState
+
+	// identified is the number of buckets of items implementing Identifier
+	// whose identity differs from the bytes. It may be greater than actual
+	// number in deferred mode, but never less.
+	// It is protected by r.mu mutex.
+	identified int
+
+	// conf holds configuration of the ring read by its methods. For rings
+	// created by New() it's made once by New() and frozen is true. Otherwise
+	// it's made of the exported fields each time the ring is locked.
+	// It is protected by r.mu mutex (see strict() for the exceptions).
+	conf   config
+	frozen bool
+
+	// state holds current version of the ring observed by readers.
+	// It's initialized lazily and replaced as a whole on each ring mutation.
+	// Note that r.mu mutex should be held while preparing and storing new
+	// version of the state.
+	state atomic.Value // *ringState
+
+	// added and removed hold the number of points added and removed by the
+	// current rebuild. Restored holds the number of twins (that is, points
+	// which collided with removed points) moved back to their previous
+	// generations by the current rebuild.
+	added, removed, restored int
 
-	// ring is a tree holding bucket points.
-	// It's protected by r.mu and r.ringMu mutex.
-	// Note that r.mu mutex should be held while preparing new (mutated)
-	// version of the tree.
-	ring avl.Tree // tree<*point>
+	// rebuilds holds the number of rebuilds made since the ring creation.
+	// It is protected by r.mu mutex.
+	rebuilds uint64
+
+	// rebuilding is true while cooperative rebuild is in progress (see
+	// RebuildBudget). Methods which lock the ring wait on idle condition
+	// until it becomes false.
+	rebuilding bool
+	idle       sync.Cond
+	// locked holds the time when rebuild acquired the lock last time.
+	locked time.Time
+
+	// addr holds the address of the ring on its first mutation. It's used
+	// to detect copies of the ring.
+	addr *Ring
+
+	// closed is true after Close() call.
+	// It is protected by r.mu mutex.
+	closed bool
+
+	// schedules holds pending weight changes ordered by their time (see
+	// ScheduleWeight()), and scheduleID is the id of the last one.
+	// They are protected by r.mu mutex.
+	schedules  []ScheduledWeight
+	scheduleID uint64
+
+	// shared is an optional hasher shared with other rings (see Registry).
+	// It's used instead of a new hasher built of r.Hash and r.Hash128 on
+	// ring's first use.
+	shared *hasher
 
 	trace traceRing
 }
 
+// ringState is an immutable version of the ring published to readers.
+type ringState struct {
+	// hasher holds hash functions used to calculate values of the points on
+	// the ring.
+	hasher *hasher
+
+	// tree is a tree holding bucket points.
+	tree avl.Tree // tree<*point>
+
+	// index is an optional skip list of the tree points used for lookups.
+	// It's nil if r.SkipList is false.
+	index *skiplist
+
+	// cache is an optional cache of lookups results.
+	// It's nil if r.CacheSize is zero.
+	cache *cache
+
+	// members is a mapping of a non-suffixed digest of an item on the ring to
+	// the item and its weight.
+	members map[uint64]member
+
+	// filtered is true if members hold only a subset of items of the tree.
+	// Points of other items are skipped during lookups. See Ring.Filter().
+	filtered bool
+
+	// total is a sum of all members weights.
+	total float64
+
+	// tombs holds tombstones of the ring at this version.
+	tombs map[uint64]tombstone
+
+	// rebuilds is the number of rebuilds made before this version was
+	// published.
+	rebuilds uint64
+
+	// collisions is the number of distinct values points collided at.
+	collisions int
+
+	// clamped is the number of items which number of points was raised to
+	// Ring.MinPoints.
+	clamped int
+
+	// digestCollisions is the number of members which bytes digests are
+	// equal to the bytes digest of other member.
+	digestCollisions int
+
+	// pins is a mapping of a key digest to the item it is pinned to.
+	pins map[value]pin
+
+	// version is a number of mutations made to the ring.
+	version uint64
+
+	// magicFactor is the ring's magic factor the state was built with.
+	magicFactor int
+}
+
 // Insert puts item x with weight w onto the ring.
-// It returns non-nil error when x already exists on the ring.
-// If weight is less or equal to zero Insert() panics.
-func (r *Ring) Insert(x Item, w float64) error {
-	if w <= 0 {
-		panic("hashring: weight must be greater than zero")
+// It returns non-nil error when x already exists on the ring, when digest of
+// x's bytes is equal to the one of other item and x doesn't implement
+// Identifier or when its points collide with other points and r.Collision is
+// CollisionError.
+// If weight is less or equal to zero Insert() panics (or returns an error if
+// r.Strict is true).
+func (r *Ring) Insert(x Item, w float64, opts ...InsertOption) error {
+	if err := r.checkWeight(w); err != nil {
+		return err
 	}
-	r.mu.Lock()
+	var c insertConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	r.lock()
 	defer r.mu.Unlock()
 
-	id := r.digest(x)
-	_, has := r.buckets[id]
-	if has {
-		return fmt.Errorf("hashring: item already exists")
+	target := w
+	if r.conf.Probation > 0 {
+		w = r.probationWeight(w)
 	}
 
-	if r.buckets == nil {
-		r.buckets = make(map[uint64]*bucket)
+	id, key, err := r.identify(x)
+	if err != nil {
+		return err
+	}
+	var prev bucket
+	b, has := r.buckets[id]
+	if err := r.checkIdentity(x, key, b); err != nil {
+		return err
+	}
+	switch {
+	case has && b.key != key:
+		return fmt.Errorf(
+			"hashring: item %v has different bytes than deleted item %v",
+			x, b.item,
+		)
+	case has:
+		// Item was deleted in deferred mode and its points are still on the
+		// ring. Revive it.
+		prev = *b
+		b.item = x
+		b.weight = w
+		b.meta = c.meta
+	default:
+		if r.buckets == nil {
+			r.buckets = make(map[uint64]*bucket)
+		}
+		b = r.newBucket(id, key, x, w)
+		b.meta = c.meta
+		if r.conf.CountLoads {
+			b.loads = new(loads)
+		}
+		r.buckets[id] = b
+		if key != id {
+			r.identified++
+		}
+	}
+	tombs := r.tombs
+	if _, tombed := tombs[id]; tombed {
+		r.tombs = withTomb(tombs, id, tombstone{})
+		r.resetWeights()
+	} else {
+		r.updateWeight(w)
+	}
+	if err := r.rebuild(); err != nil {
+		if has {
+			*b = prev
+		} else {
+			delete(r.buckets, id)
+		}
+		r.tombs = tombs
+		r.resetWeights()
+		return err
+	}
+	r.endProbation(id)
+	if w != target {
+		r.startProbation(x, id, target)
 	}
-	r.buckets[id] = newBucket(id, x, w)
-	r.updateWeight(w)
-	r.rebuild()
-
 	return nil
 }
 
 // Update updates item's x weight on the ring.
-// It returns non-nil error when x doesn't exist on the ring.
-// If weight is less or equal to zero Update() panics.
+// It returns non-nil error when x doesn't exist on the ring or when new
+// points of the ring collide and r.Collision is CollisionError.
+// If weight is less or equal to zero Update() panics (or returns an error if
+// r.Strict is true).
 func (r *Ring) Update(x Item, w float64) error {
-	if w <= 0 {
-		panic("hashring: weight must be greater than zero")
+	if err := r.checkWeight(w); err != nil {
+		return err
 	}
 	return r.update(x, w)
 }
 
+// AdjustWeight changes weight of item x on the ring by delta and returns the
+// new weight. Unlike calling Weight() and then Update(), reading and updating
+// the weight is made atomically under the ring's lock, so concurrent
+// adjustments are never lost.
+// It returns non-nil error when x doesn't exist on the ring, when the new
+// weight is not greater than zero or when new points of the ring collide and
+// r.Collision is CollisionError. In that case the weight is left unchanged.
+func (r *Ring) AdjustWeight(x Item, delta float64) (float64, error) {
+	r.lock()
+	defer r.mu.Unlock()
+
+	id, err := r.itemDigest(x)
+	if err != nil {
+		return 0, err
+	}
+	b, has := r.buckets[id]
+	if !has || b.weight == 0 {
+		return 0, fmt.Errorf("hashring: item doesn't exist")
+	}
+	w := b.weight + delta
+	if w <= 0 {
+		return b.weight, fmt.Errorf(
+			"hashring: weight must be greater than zero: %g%+g",
+			b.weight, delta,
+		)
+	}
+	if err := r.checkWeight(w); err != nil {
+		return b.weight, err
+	}
+	prev := b.weight
+	if err := r.setWeight(x, w); err != nil {
+		return prev, err
+	}
+	return w, nil
+}
+
 // Delete removes item x from the ring.
-// It returns non-nil error when x doesn't exist on the ring.
+// It returns non-nil error when x doesn't exist on the ring or when new
+// points of the ring collide and r.Collision is CollisionError (that may
+// happen when the number of points of other items grows).
 func (r *Ring) Delete(x Item) error {
 	return r.update(x, 0)
 }
 
-// Get returns mapping of v to previously inserted item.
-// Returned item is nil only when ring is empty.
-func (r *Ring) Get(v Item) Item {
-	d := r.digest(v)
+// DeleteSummary describes the impact of item deletion on the ring.
+type DeleteSummary struct {
+	// Removed is the number of points removed from the ring. It includes
+	// points of other items if their number decreased due to deletion.
+	Removed int
 
-	r.ringMu.RLock()
-	item := r.ring.Successor(search(d))
-	if item == nil {
-		item = r.ring.Min()
+	// Added is the number of points added to the ring when the number of
+	// points of other items increased due to deletion.
+	Added int
+
+	// Restored is the number of points which collided with removed points
+	// and thus were moved back to their previous generations.
+	Restored int
+
+	// Moved is the fraction of the hash space which changed its owner.
+	Moved float64
+}
+
+// DeleteReport is like Delete() but also returns a summary of the deletion
+// impact, which is useful to log operational impact of topology changes.
+// Summary is empty if the ring is in deferred mode.
+func (r *Ring) DeleteReport(x Item) (sum DeleteSummary, err error) {
+	r.lock()
+	defer r.mu.Unlock()
+
+	before := treeMarks(r.current().tree)
+	if err := r.setWeight(x, 0); err != nil {
+		return sum, err
+	}
+	if r.deferred {
+		return sum, nil
+	}
+	for _, move := range relocations(before, treeMarks(r.current().tree)) {
+		sum.Moved += partitionSize(move.Range)
 	}
-	r.ringMu.RUnlock()
+	sum.Moved /= math.Exp2(64)
+	sum.Removed = r.removed
+	sum.Added = r.added
+	sum.Restored = r.restored
 
-	if item == nil {
+	return sum, nil
+}
+
+// SetWeights updates weights of multiple items on the ring at once. Unlike
+// calling Update() for each item, it rebuilds the ring only once and readers
+// never observe partially updated ring.
+// It returns non-nil error when some item doesn't exist on the ring or when
+// new points of the ring collide and r.Collision is CollisionError. In that
+// case none of the weights are updated.
+// If some weight is less or equal to zero SetWeights() panics (or returns an
+// error if r.Strict is true).
+func (r *Ring) SetWeights(ws map[Item]float64) error {
+	for _, w := range ws {
+		if err := r.checkWeight(w); err != nil {
+			return err
+		}
+	}
+	r.lock()
+	defer r.mu.Unlock()
+
+	bs := make(map[*bucket]float64, len(ws))
+	for x, w := range ws {
+		id, err := r.itemDigest(x)
+		if err != nil {
+			return err
+		}
+		b, has := r.buckets[id]
+		if !has || b.weight == 0 {
+			return fmt.Errorf("hashring: item doesn't exist")
+		}
+		bs[b] = w
+	}
+	if err := r.setWeights(bs); err != nil {
+		return err
+	}
+	for b := range bs {
+		r.endProbation(b.id)
+	}
+	return nil
+}
+
+// setWeights sets weights of the given buckets and rebuilds the ring once.
+// Weights are left unchanged if rebuild fails.
+//
+// r.mu must be held.
+func (r *Ring) setWeights(bs map[*bucket]float64) error {
+	for b, w := range bs {
+		bs[b], b.weight = b.weight, w
+	}
+	r.resetWeights()
+	if err := r.rebuild(); err != nil {
+		for b, w := range bs {
+			b.weight = w
+		}
+		r.resetWeights()
+		return err
+	}
+	return nil
+}
+
+// Begin switches the ring into deferred mode. In deferred mode Insert(),
+// Update(), Delete() and SetWeights() only stage the changes, and the ring is
+// rebuilt once when Commit() is called. Readers observe the ring as it was
+// before Begin() until then.
+//
+// Note that SetHash() rebuilds the ring immediately, applying staged changes
+// as well.
+//
+// Calling Begin() on the ring which is already in deferred mode is a no-op.
+func (r *Ring) Begin() {
+	r.lock()
+	defer r.mu.Unlock()
+	r.deferred = true
+}
+
+// Commit applies changes staged since Begin() and switches the ring back from
+// deferred mode.
+//
+// It returns non-nil error when staged changes lead to points collision and
+// r.Collision is CollisionError. In that case the ring stays in deferred mode
+// with all changes staged, so the caller may revert some of them and call
+// Commit() again.
+//
+// Calling Commit() on the ring which is not in deferred mode is a no-op.
+func (r *Ring) Commit() error {
+	r.lock()
+	defer r.mu.Unlock()
+	if !r.deferred {
 		return nil
 	}
-	return item.(*point).bucket.item
+	r.deferred = false
+	if err := r.rebuild(); err != nil {
+		r.deferred = true
+		return err
+	}
+	return nil
 }
 
-func (r *Ring) Has(x Item) bool {
-	d := r.digest(x)
+// Apply calls fn in deferred mode (see Begin()) and commits the changes fn
+// staged, so the ring is rebuilt once and readers observe either none or all
+// of them. It's useful to reconcile the ring with the list of items received
+// from service discovery.
+//
+// If fn or Commit() returns non-nil error, all changes staged since Apply()
+// was called are discarded, the ring is left as it was before Apply() and
+// the error is returned.
+//
+// Note that changes made by other goroutines while fn is running are staged
+// (and possibly discarded) along with the changes made by fn.
+// It returns non-nil error if the ring is already in deferred mode.
+func (r *Ring) Apply(fn func() error) error {
+	r.lock()
+	if r.deferred {
+		r.mu.Unlock()
+		return fmt.Errorf("hashring: can't apply changes in deferred mode")
+	}
+	r.deferred = true
+	magicFactor := r.conf.MagicFactor
+	r.mu.Unlock()
+
+	err := fn()
+
+	r.lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.deferred = false
+		if err = r.rebuild(); err == nil {
+			return nil
+		}
+	}
+	r.discard(magicFactor)
+	return err
+}
+
+// discard drops the changes staged in deferred mode and switches the ring
+// back from it. Magic factor is set to the given one.
+//
+// r.mu must be held.
+func (r *Ring) discard(magicFactor int) {
+	s := r.current()
+	for id, b := range r.buckets {
+		m, has := s.members[id]
+		if !has {
+			// Staged items have no points on the ring.
+			delete(r.buckets, id)
+			r.endProbation(id)
+			continue
+		}
+		b.item = m.item
+		b.weight = m.weight
+		b.meta = m.meta
+	}
+	r.tombs = s.tombs
+	r.MagicFactor, r.conf.MagicFactor = magicFactor, magicFactor
+	r.resetWeights()
+	r.deferred = false
+}
+
+// Get returns mapping of v to previously inserted item (or to the item which
+// v is pinned to with Pin()).
+// Returned item is nil only when ring is empty or, if r.Strict is true, when v
+// can't be digested.
+func (r *Ring) Get(v Item) (x Item) {
+	s, d, err := r.locate(v)
+	if err != nil {
+		return nil
+	}
+	if done := r.traceGet(d); done != nil {
+		defer func() {
+			done(x)
+		}()
+	}
+	return s.lookup(d)
+}
+
+// GetCounterClockwise is like Get() but maps v to the item owning the first
+// point met while walking the ring counter-clockwise from v's hash value,
+// that is, to the point having the greatest value less or equal to it. This
+// is the convention of some Dynamo-style stores, and rings mixing the two
+// conventions map keys differently.
+// If v is pinned with Pin(), the pinned item is returned.
+// Returned item is nil only when ring is empty or, if r.Strict is true, when
+// v can't be digested.
+func (r *Ring) GetCounterClockwise(v Item) (x Item) {
+	s, d, err := r.locate(v)
+	if err != nil {
+		return nil
+	}
+	if done := r.traceGet(d); done != nil {
+		defer func() {
+			done(x)
+		}()
+	}
+	if m, has := s.pinned(d); has {
+		if m.loads != nil {
+			m.loads.add()
+		}
+		return m.item
+	}
+	b := getCounterClockwise(s.tree, d)
+	if b == nil {
+		return nil
+	}
+	if b.loads != nil {
+		b.loads.add()
+	}
+	return b.item
+}
+
+// GetSpread returns mapping of v salted with one of spread salts, chosen
+// pseudo-randomly on each call. That is, GetSpread spreads a single (hot) key
+// across up to spread items of the ring, while mapping of each salted key
+// remains consistent.
+// The first salt is an empty one, so GetSpread(v, 1) is the same as Get(v).
+// If v is pinned with Pin(), the pinned item is returned regardless of the
+// salt.
+// Returned item is nil only when ring is empty or, if r.Strict is true, when
+// v can't be digested.
+// If spread is less or equal to zero GetSpread() panics.
+func (r *Ring) GetSpread(v Item, spread int) (x Item) {
+	if spread <= 0 {
+		panic(fmt.Sprintf("hashring: malformed spread: %d", spread))
+	}
+	s, d, err := r.locate(v)
+	if err != nil {
+		return nil
+	}
+	if done := r.traceGet(d); done != nil {
+		defer func() {
+			done(x)
+		}()
+	}
+	if _, pinned := s.pinned(d); pinned {
+		return s.lookup(d)
+	}
+	if i := rand.Intn(spread); i > 0 {
+		salt := make([]byte, 8)
+		binary.LittleEndian.PutUint64(salt, uint64(i))
+		d, err = r.check(s.hasher.sum(v, salt))
+		if err != nil {
+			return nil
+		}
+	}
+	return s.lookup(d)
+}
+
+// GetN returns at most n distinct items which v maps to.
+// The first item is the same as returned by Get(); the rest are the next
+// distinct items met while walking the ring clockwise.
+// If v is pinned with Pin(), the pinned item goes first.
+// Returned slice is empty only when ring is empty or, if r.Strict is true,
+// when v can't be digested.
+func (r *Ring) GetN(v Item, n int) (xs []Item) {
+	s, d, err := r.locate(v)
+	if err != nil || n <= 0 {
+		return nil
+	}
+	if done := r.traceGet(d); done != nil {
+		defer func() {
+			done(first(xs))
+		}()
+	}
+	return s.lookupN(d, n)
+}
+
+// first returns the first item of xs or nil if xs is empty.
+func first(xs []Item) Item {
+	if len(xs) == 0 {
+		return nil
+	}
+	return xs[0]
+}
+
+// GetChain returns the first item accepted by accept among the distinct items
+// which v maps to, in the same order as GetN() returns them. That is, it
+// falls back to the next owners of v while accept rejects the previous ones
+// (e.g. when their circuit breakers are open).
+// Each item of the ring is offered to accept at most once, and the walk is
+// made over a single version of the ring.
+// Returned item is nil when accept rejects all items, when ring is empty or,
+// if r.Strict is true, when v can't be digested.
+func (r *Ring) GetChain(v Item, accept func(Item) bool) (x Item) {
+	s, d, err := r.locate(v)
+	if err != nil {
+		return nil
+	}
+	if done := r.traceGet(d); done != nil {
+		defer func() {
+			done(x)
+		}()
+	}
+	return s.lookupChain(d, accept)
+}
+
+// PointsOf returns values of the points of item x on the ring, ordered by the
+// points indexes. Values reflect collision-adjusted generations of the points.
+// For rings operating in 128-bit hash space values are the high 64 bits of
+// the points values.
+// It returns nil when x doesn't exist on the ring or, if r.Strict is true,
+// when x can't be digested.
+//
+// Note that PointsOf blocks write operations on the ring while running.
+func (r *Ring) PointsOf(x Item) []uint64 {
+	r.lock()
+	defer r.mu.Unlock()
 
-	r.ringMu.RLock()
-	defer r.ringMu.RUnlock()
+	id, err := r.itemDigest(x)
+	if err != nil {
+		return nil
+	}
+	b := r.buckets[id]
+	if b == nil {
+		return nil
+	}
+	ps := make([]uint64, len(b.points))
+	for i, p := range b.points {
+		ps[i] = p.val.hi
+	}
+	return ps
+}
 
-	_, has := r.buckets[d]
+// Owner returns mapping of key to previously inserted item along with the hash
+// range of the ring's arc which key falls into.
+// If key is pinned with Pin(), the pinned item is returned along with the zero
+// Range, since the key is mapped regardless of the ring's arcs.
+// Returned item is nil only when ring is empty or, if r.Strict is true, when
+// key can't be digested.
+func (r *Ring) Owner(key Item) (x Item, _ Range) {
+	s, d, err := r.locate(key)
+	if err != nil {
+		return nil, Range{}
+	}
+	if done := r.traceGet(d); done != nil {
+		defer func() {
+			done(x)
+		}()
+	}
+	if m, has := s.pinned(d); has {
+		return m.item, Range{}
+	}
+	tree := s.tree
+	n := tree.Successor(upper(d))
+	if n == nil {
+		n = tree.Min()
+	}
+	if n == nil {
+		return nil, Range{}
+	}
+	p := n.(*point)
+	prev := tree.Predecessor(p)
+	if prev == nil {
+		prev = tree.Max()
+	}
+	return p.bucket.item, Range{
+		Start: prev.(*point).val.hi,
+		End:   p.val.hi,
+	}
+}
+
+// Has reports whether item x is on the ring.
+// It returns false if r.Strict is true and x can't be digested.
+func (r *Ring) Has(x Item) bool {
+	s, d, err := r.locateItem(x)
+	if err != nil {
+		return false
+	}
+	_, has := s.members[d.hi]
 	return has
 }
 
-func (r *Ring) update(x Item, w float64) error {
-	id := r.digest(x)
+// HasDigest reports whether an item having digest d is on the ring.
+// The digest is a 64-bit sum of item's bytes calculated by the ring's hash
+// function (xxhash by default). For rings operating in 128-bit hash space it
+// is the high 64 bits of the sum.
+//
+// HasDigest is useful when the digest of an item is already known, e.g. when
+// it's received from other node, and the item itself is not available.
+func (r *Ring) HasDigest(d uint64) bool {
+	_, has := r.load().members[d]
+	return has
+}
+
+// Weight returns weight of item x on the ring.
+// It returns false if x doesn't exist on the ring or, if r.Strict is true,
+// when x can't be digested.
+func (r *Ring) Weight(x Item) (float64, bool) {
+	s, d, err := r.locateItem(x)
+	if err != nil {
+		return 0, false
+	}
+	m, has := s.members[d.hi]
+	return m.weight, has
+}
+
+// TotalWeight returns sum of weights of all items on the ring.
+func (r *Ring) TotalWeight() float64 {
+	return r.load().total
+}
+
+// Len returns the number of items on the ring.
+func (r *Ring) Len() int {
+	return len(r.load().members)
+}
+
+// NumPoints returns the number of points on the ring.
+func (r *Ring) NumPoints() int {
+	return r.load().tree.Size()
+}
+
+// SetHash replaces hash function of the ring and rebuilds the ring using it.
+// Items and their weights are preserved. Readers observe either the previous
+// or the rebuilt version of the ring, but never a partially rebuilt one.
+//
+// Note that if ring was operating in 128-bit hash space, it is switched to
+// 64-bit hash space and r.Hash128 is reset.
+//
+// It returns non-nil error if some item can't be digested by the new hash
+// function or if digests of two distinct items become equal. In that case
+// the ring is left unchanged.
+func (r *Ring) SetHash(fn func() hash.Hash64) error {
+	r.lock()
+	defer r.mu.Unlock()
+
+	h := newHasher(fn, nil)
+	buckets := make(map[uint64]*bucket, len(r.buckets))
+	for _, b := range r.buckets {
+		id, key, err := h.identify(b.item)
+		if err != nil {
+			return err
+		}
+		if _, has := buckets[id]; has {
+			return fmt.Errorf("hashring: items digest collision")
+		}
+		nb := r.newBucket(id, key, b.item, b.weight)
+		nb.meta = b.meta
+		nb.loads = b.loads
+		buckets[id] = nb
+	}
+	tombs, err := r.tombsWithHash(h)
+	if err != nil {
+		return err
+	}
+	if r.conf.Collision == CollisionError {
+		if err := r.checkCollisions(h, avl.Tree{}, buckets); err != nil {
+			return err
+		}
+	}
+	prevBuckets, prevCollisions := r.buckets, r.collisions
+	r.buckets = buckets
+	r.collisions = nil
+	points := r.current().tree.Size()
+	done := r.traceRebuild(points)
+	// All points are replaced with the new ones.
+	r.removed = points
+	tree, err := r.build(h, avl.Tree{})
+	done()
+	if err != nil {
+		// Points of the previous buckets are left untouched.
+		r.buckets = prevBuckets
+		r.collisions = prevCollisions
+		r.fix.Init()
+		return err
+	}
+	r.Hash, r.conf.Hash = fn, fn
+	r.Hash128, r.conf.Hash128 = nil, nil
+	r.tombs = tombs
+	r.publish(h, tree)
 
+	return nil
+}
+
+// SetMagicFactor changes r.MagicFactor to m and rebuilds the ring. It returns
+// the fraction of the hash space which changed its owner.
+// Unlike assigning r.MagicFactor directly, it is safe to call SetMagicFactor()
+// at any time.
+// It returns non-nil error when new points of the ring collide and
+// r.Collision is CollisionError. In that case the ring is left unchanged.
+// If m is less than zero SetMagicFactor() panics (or returns an error if
+// r.Strict is true).
+func (r *Ring) SetMagicFactor(m int) (moved float64, err error) {
+	if m < 0 {
+		msg := fmt.Sprintf("hashring: malformed magic factor: %d", m)
+		if !r.strict() {
+			panic(msg)
+		}
+		return 0, errors.New(msg)
+	}
+	r.lock()
+	defer r.mu.Unlock()
+
+	before := treeMarks(r.current().tree)
+	prev := r.conf.MagicFactor
+	r.conf.MagicFactor = m
+	if err := r.rebuild(); err != nil {
+		r.conf.MagicFactor = prev
+		return 0, err
+	}
+	r.MagicFactor = m
+	if r.deferred {
+		// Changes are applied by Commit().
+		return 0, nil
+	}
+	for _, move := range relocations(before, treeMarks(r.current().tree)) {
+		moved += partitionSize(move.Range)
+	}
+	return moved / math.Exp2(64), nil
+}
+
+// load returns current version of the ring state.
+func (r *Ring) load() *ringState {
+	if s, _ := r.state.Load().(*ringState); s != nil {
+		return s
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	return r.current()
+}
+
+// current returns current version of the ring state, initializing it if
+// needed.
+//
+// r.mu must be held.
+func (r *Ring) current() *ringState {
+	s, _ := r.state.Load().(*ringState)
+	if s == nil {
+		r.configure()
+		h := r.shared
+		if h == nil {
+			h = newHasher(r.conf.Hash, r.conf.Hash128)
+		}
+		s = &ringState{
+			hasher: h,
+		}
+		r.state.Store(s)
+	}
+	return s
+}
+
+// publish makes tree built using hash functions from h the current version of
+// the ring state.
+//
+// r.mu must be held.
+func (r *Ring) publish(h *hasher, tree avl.Tree) {
+	prev := r.current()
+	s := &ringState{
+		version:     prev.version + 1,
+		magicFactor: r.conf.MagicFactor,
+		hasher:      h,
+		tombs:       r.tombs,
+		rebuilds:    r.rebuilds,
+		collisions:  len(r.collisions),
+		clamped:     r.clamped(),
+		tree:        tree,
+		members:     make(map[uint64]member, len(r.buckets)),
+		pins:        r.pins(h),
+	}
+	if r.conf.SkipList {
+		s.index = newSkipList(tree)
+	}
+	s.cache = newCache(r.conf.CacheSize)
+	for id, b := range r.buckets {
+		s.members[id] = member{
+			item:   b.item,
+			key:    b.key,
+			weight: b.weight,
+			meta:   b.meta,
+			loads:  b.loads,
+		}
+		s.total += b.weight
+	}
+	s.digestCollisions, r.identified = r.digestCollisions()
+	r.record(prev, s)
+	r.undo = prev
+	r.state.Store(s)
+}
+
+// tree returns current version of the tree holding bucket points.
+func (r *Ring) tree() avl.Tree {
+	return r.load().tree
+}
+
+// locate returns current version of the ring state along with the digest of v
+// calculated by the hash function used to build the state's tree.
+// It panics on digest error if r.Strict is false.
+func (r *Ring) locate(v Item) (*ringState, value, error) {
+	s := r.load()
+	d, err := r.check(s.hasher.sum(v, nil))
+	return s, d, err
+}
+
+func (r *Ring) update(x Item, w float64) error {
+	r.lock()
+	defer r.mu.Unlock()
+	return r.setWeight(x, w)
+}
+
+// setWeight sets weight of existing item x to w and rebuilds the ring. Zero w
+// means deletion of x.
+//
+// r.mu must be held.
+func (r *Ring) setWeight(x Item, w float64) error {
+	id, err := r.itemDigest(x)
+	if err != nil {
+		return err
+	}
 
 	b, has := r.buckets[id]
-	if !has {
+	if !has || b.weight == 0 {
 		return fmt.Errorf("hashring: item doesn't exist")
 	}
 
@@ -167,17 +1146,32 @@ func (r *Ring) update(x Item, w float64) error {
 	b.weight = w
 
 	r.changeWeight(prev, w)
-	r.rebuild()
-
+	if err := r.rebuild(); err != nil {
+		b.weight = prev
+		r.resetWeights()
+		return err
+	}
+	r.endProbation(id)
 	return nil
 }
 
 // r.mu must be held.
 func (r *Ring) changeWeight(prev, next float64) {
-	if prev != r.minWeight && prev != r.maxWeight {
+	switch {
+	case prev == r.minWeight || prev == r.maxWeight:
+		r.resetWeights()
+	case next > 0:
+		// Zero weight means deletion, which can't change min and max weights
+		// here.
 		r.updateWeight(next)
-		return
 	}
+}
+
+// resetWeights recalculates min and max weights of the ring's items and
+// tombstones.
+//
+// r.mu must be held.
+func (r *Ring) resetWeights() {
 	r.minWeight = 0
 	r.maxWeight = 0
 	for _, b := range r.buckets {
@@ -185,6 +1179,9 @@ func (r *Ring) changeWeight(prev, next float64) {
 			r.updateWeight(b.weight)
 		}
 	}
+	for _, t := range r.tombs {
+		r.updateWeight(t.weight)
+	}
 }
 
 // r.mu must be held.
@@ -197,28 +1194,46 @@ func (r *Ring) updateWeight(w float64) {
 	}
 }
 
-func (r *Ring) digest(src io.WriterTo, suffix ...byte) uint64 {
-	h, _ := r.hashPool.Get().(hash.Hash64)
-	if h == nil {
-		if r.Hash != nil {
-			h = r.Hash()
-		} else {
-			h = xxhash.New()
+// checkWeight checks that w is a valid item weight.
+// It panics if w is not valid and r.Strict is false.
+func (r *Ring) checkWeight(w float64) error {
+	msg := "hashring: weight must be greater than zero"
+	if w > 0 {
+		if !r.exactWeights() || w == math.Trunc(w) {
+			return nil
 		}
+		msg = "hashring: weight must be integer"
 	}
-	defer func() {
-		h.Reset()
-		r.hashPool.Put(h)
-	}()
-
-	_, err := src.WriteTo(h)
-	if err == nil {
-		_, err = h.Write(suffix)
+	if !r.strict() {
+		panic(msg)
 	}
-	if err != nil {
-		panic(fmt.Sprintf("hashring: digest error: %v", err))
+	return errors.New(msg)
+}
+
+// itemDigest returns 64-bit digest of a user provided item.
+// It panics on digest error if r.Strict is false.
+//
+// r.mu must be held.
+func (r *Ring) itemDigest(x Item) (uint64, error) {
+	d, err := r.check(r.current().hasher.ident(x))
+	return d.hi, err
+}
+
+// check panics if err is non-nil and r.Strict is false.
+func (r *Ring) check(d value, err error) (value, error) {
+	return d, r.checkErr(err)
+}
+
+// checkErr is like check() but checks only the error.
+func (r *Ring) checkErr(err error) error {
+	if err != nil && !r.strict() {
+		panic(err.Error())
 	}
-	return h.Sum64()
+	return err
+}
+
+func (r *Ring) digest(src io.WriterTo, suffix ...byte) value {
+	return r.load().hasher.digest(src, suffix...)
 }
 
 // r.mu must be held.
@@ -228,7 +1243,15 @@ func (r *Ring) insertPoint(tree avl.Tree, p *point) (_ avl.Tree, inserted bool)
 		trace.onDone(inserted)
 	}()
 
+	switch r.conf.Collision {
+	case CollisionTieBreak:
+		return r.insertPointTieBreak(tree, p)
+	case CollisionStable:
+		return mustInsertTree(tree, p), true
+	}
+
 	if c := r.collisions[p.value()]; c.Size() != 0 {
+		r.collided(p, c.Min().(collision).point)
 		r.trace.onFixNeeded(p)
 		r.collisions[p.value()] = mustInsertTree(c, collision{p})
 		r.fix.PushBack(p)
@@ -240,6 +1263,7 @@ func (r *Ring) insertPoint(tree avl.Tree, p *point) (_ avl.Tree, inserted bool)
 	}
 	d := existing.(*point)
 	trace.onCollision(d)
+	r.collided(p, d)
 	// Collision detected.
 	tree, existed := tree.Delete(d)
 	if existed == nil {
@@ -247,7 +1271,7 @@ func (r *Ring) insertPoint(tree avl.Tree, p *point) (_ avl.Tree, inserted bool)
 	}
 
 	if r.collisions == nil {
-		r.collisions = make(map[uint64]avl.Tree)
+		r.collisions = make(map[value]avl.Tree)
 	}
 	c := r.collisions[p.value()]
 	c = mustInsertTree(c, collision{p})
@@ -271,6 +1295,15 @@ func (r *Ring) deletePoint(tree avl.Tree, p *point) (_ avl.Tree, removed bool) {
 		trace.onDone(removed)
 	}()
 
+	switch r.conf.Collision {
+	case CollisionTieBreak:
+		return r.deletePointTieBreak(tree, p)
+	case CollisionStable:
+		var item avl.Item
+		tree, item = tree.Delete(p)
+		return tree, item != nil
+	}
+
 	var item avl.Item
 	tree, item = tree.Delete(p)
 	if item == nil {
@@ -323,80 +1356,714 @@ func (r *Ring) deletePoint(tree avl.Tree, p *point) (_ avl.Tree, removed bool) {
 	for el := toInsert.Front(); el != nil; el = toInsert.Front() {
 		p := toInsert.Remove(el).(*point)
 		trace.onTwinRestore(p)
+		r.restored++
 		tree, _ = r.insertPoint(tree, p)
 	}
 
 	return tree, true
 }
 
+// collided calls r.Trace.OnCollision hook (if any) for collided points p and
+// q.
+func (r *Ring) collided(p, q *point) {
+	if fn := r.conf.Trace.OnCollision; fn != nil {
+		fn(p.bucket.item, p.index, q.bucket.item, q.index)
+	}
+}
+
+func (r *Ring) suffix(x Item, gen, index int) []byte {
+	if r.conf.Suffix != nil {
+		return r.conf.Suffix(x, gen, index)
+	}
+	return encodeSuffix(gen, index)
+}
+
+// appendSuffix is like suffix() but appends suffix bytes to p.
+func (r *Ring) appendSuffix(p []byte, x Item, gen, index int) []byte {
+	if r.conf.Suffix != nil {
+		return append(p, r.conf.Suffix(x, gen, index)...)
+	}
+	return appendSuffix(p, gen, index)
+}
+
+// newBucket creates new bucket according to r.Collision policy.
+func (r *Ring) newBucket(id, key uint64, x Item, w float64) *bucket {
+	b := newBucket(id, x, w)
+	b.key = key
+	b.stable = r.conf.Collision == CollisionStable
+	return b
+}
+
 func (r *Ring) magicFactor() float64 {
-	if m := r.MagicFactor; m > 0 {
+	if m := r.conf.MagicFactor; m > 0 {
 		return float64(m)
 	}
 	return DefaultMagicFactor
 }
 
+// numPoints returns a function calculating the number of points of a bucket
+// according to r.Allocation and r.MinPoints.
+//
+// r.mu must be held.
+func (r *Ring) numPoints() func(*bucket) int {
+	n := r.allocPoints()
+	if r.conf.MinPoints <= 0 {
+		return n
+	}
+	return func(b *bucket) int {
+		if x := n(b); b.weight == 0 || x >= r.conf.MinPoints {
+			return x
+		}
+		return r.conf.MinPoints
+	}
+}
+
+// clamped returns the number of items which number of points is raised to
+// r.MinPoints.
+//
+// r.mu must be held.
+func (r *Ring) clamped() (n int) {
+	if r.conf.MinPoints <= 0 {
+		return 0
+	}
+	alloc := r.allocPoints()
+	for _, b := range r.buckets {
+		if b.weight != 0 && alloc(b) < r.conf.MinPoints {
+			n++
+		}
+	}
+	return n
+}
+
+// Clamped returns the number of items which number of points was raised to
+// r.MinPoints because of their small weights. Non-zero value means that
+// shares of the hash space of these items are greater than their weights
+// imply.
+func (r *Ring) Clamped() int {
+	return r.load().clamped
+}
+
+// allocPoints returns a function calculating the number of points of a
+// bucket according to r.Allocator or r.Allocation.
+//
 // r.mu must be held.
-func (r *Ring) numPoints() func(float64) int {
+func (r *Ring) allocPoints() func(*bucket) int {
+	if r.conf.Allocator != nil {
+		return r.customPoints()
+	}
+	if r.conf.Allocation == AllocateExact {
+		return r.exactPoints()
+	}
 	if r.maxWeight == 0 {
-		return func(float64) int { return 0 }
+		return func(*bucket) int { return 0 }
 	}
-	return line(
+	n := line(
 		r.maxWeight, r.magicFactor(),
 		r.minWeight, math.Ceil(r.magicFactor())*(r.minWeight/r.maxWeight),
 	)
+	return func(b *bucket) int {
+		if b.weight == 0 {
+			return 0
+		}
+		return n(b.weight)
+	}
 }
 
+// rebuild applies buckets changes to the ring and publishes its new state.
+// It returns non-nil error if r.Collision is CollisionError and changes lead
+// to points collision, if some point exceeds r.MaxGeneration or if some item
+// can't be digested and r.Strict is true. In that case the ring is left
+// unchanged.
+//
 // r.mu must be held.
-func (r *Ring) rebuild() {
-	numPoints := r.numPoints()
+func (r *Ring) rebuild() error {
+	if r.deferred {
+		return nil
+	}
+	s := r.current()
+	if r.conf.Collision == CollisionError {
+		if err := r.checkCollisions(s.hasher, s.tree, r.buckets); err != nil {
+			return err
+		}
+	}
+	// Build may fail in the middle, so keep the buckets to restore.
+	buckets := make(map[uint64]*bucket, len(r.buckets))
+	for id, b := range r.buckets {
+		buckets[id] = b
+	}
+	if r.conf.RebuildBudget > 0 {
+		r.rebuilding = true
+		r.locked = time.Now()
+		defer func() {
+			r.rebuilding = false
+			r.idle.Broadcast()
+		}()
+	}
+	done := r.traceRebuild(s.tree.Size())
+	root := s.tree
+	if r.conf.MagicFactor != s.magicFactor {
+		// Number of points of every bucket changes, thus building the ring
+		// from scratch is faster than changing it point by point.
+		for _, b := range r.buckets {
+			r.removed += len(b.points)
+			b.points = nil
+			b.stacks = nil
+		}
+		r.collisions = nil
+		root = avl.Tree{}
+	}
+	before := r.marks(s.tree)
+	tree, err := r.build(s.hasher, root)
+	done()
+	if err != nil {
+		r.restore(s, buckets)
+		return err
+	}
+	r.publish(s.hasher, tree)
+	r.relocate(before)
 
-	r.ringMu.RLock()
-	root := r.ring
-	r.ringMu.RUnlock()
+	return nil
+}
 
-	for {
-		for id, b := range r.buckets {
-			var size int
-			if b.weight != 0 {
-				size = numPoints(b.weight)
-			}
-			for i := len(b.points); i > size; i-- {
-				p := b.points[i-1]
-				b.points = b.points[:i-1]
-				root, _ = r.deletePoint(root, p)
-			}
-			for i := len(b.points); i < size; i++ {
-				v := r.digest(b.item, encodeSuffix(0, i)...)
-				p := newPoint(b, i, v)
-				b.points = append(b.points, p)
-				root, _ = r.insertPoint(root, p)
-			}
-			if b.weight == 0 {
-				delete(r.buckets, id)
-			}
-		}
-		for el := r.fix.Front(); el != nil; el = r.fix.Front() {
-			p := r.fix.Remove(el).(*point)
+// restore makes ring's points equal to the points of state s after failed
+// build. Buckets are restored from the given map, keeping their current
+// data (such as weights) as is.
+//
+// Note that restored points are built from scratch, thus the tree of s is
+// replaced with the rebuilt one without changing the ring version.
+//
+// r.mu must be held.
+func (r *Ring) restore(s *ringState, buckets map[uint64]*bucket) {
+	weights := make(map[uint64]float64, len(buckets))
+	r.buckets = make(map[uint64]*bucket, len(buckets))
+	for id, b := range buckets {
+		weights[id] = b.weight
+		b.points = nil
+		b.stacks = nil
+		b.weight = s.members[id].weight
+		r.buckets[id] = b
+	}
+	var (
+		magicFactor   = r.conf.MagicFactor
+		maxGeneration = r.conf.MaxGeneration
+		tombs         = r.tombs
+	)
+	r.conf.MagicFactor = s.magicFactor
+	r.tombs = s.tombs
+	r.conf.MaxGeneration = 0
+	r.collisions = nil
+	r.fix.Init()
+	r.resetWeights()
+	tree, err := r.build(s.hasher, avl.Tree{})
+	if err != nil {
+		// Points of streamed items are calculated without reading them
+		// again, while other items are expected to be digested as they
+		// were before.
+		panic(fmt.Sprintf("hashring: can't restore the ring: %v", err))
+	}
+	r.conf.MagicFactor = magicFactor
+	r.conf.MaxGeneration = maxGeneration
+	r.tombs = tombs
+
+	for id, b := range buckets {
+		b.weight = weights[id]
+		r.buckets[id] = b
+	}
+	r.resetWeights()
 
-			trace := r.trace.onFix(p)
-			assertNotExists(root, p)
+	restored := *s
+	restored.tree = tree
+	restored.cache = s.cache.empty()
+	if s.index != nil {
+		restored.index = newSkipList(tree)
+	}
+	r.state.Store(&restored)
+}
 
-			g := p.generation()
-			v := r.digest(p.bucket.item, encodeSuffix(g+1, p.index)...)
-			p.proceed(v)
+// build applies buckets changes to the given tree using hash functions from
+// h. It returns the new version of the tree.
+// It returns non-nil error if some point exceeds r.MaxGeneration or if some
+// item can't be digested and r.Strict is true. In that case the ring's points
+// are left in inconsistent state.
+//
+// r.mu must be held.
+func (r *Ring) build(h *hasher, root avl.Tree) (avl.Tree, error) {
+	if root.Size() == 0 {
+		tree, ok, err := r.buildSorted(h)
+		if ok || err != nil {
+			return tree, err
+		}
+	}
+	var (
+		size = r.numPoints()
+		err  error
+	)
+	// Points are deleted before any insertion and collisions are fixed right
+	// after each bucket's deletions. Otherwise point being deleted may be
+	// waiting in r.fix for its next generation, that is, it may be absent on
+	// the tree, and get back to the tree after the deletion.
+	for id, b := range r.buckets {
+		r.yield()
+		n := size(b)
+		for i := len(b.points); i > n; i-- {
+			p := b.points[i-1]
+			b.points = b.points[:i-1]
+			root, _ = r.deletePoint(root, p)
+			r.removed++
+		}
+		if b.weight == 0 {
+			delete(r.buckets, id)
+		}
+		if root, err = r.fixPoints(h, root); err != nil {
+			return root, err
+		}
+	}
+	for _, b := range r.buckets {
+		r.yield()
+		chunk, err := r.makePoints(h, b, len(b.points), size(b))
+		if err != nil {
+			return root, err
+		}
+		r.added += len(chunk)
+		for i := range chunk {
+			p := &chunk[i]
+			b.points = append(b.points, p)
 			root, _ = r.insertPoint(root, p)
+		}
+	}
+	return r.fixPoints(h, root)
+}
+
+// fixPoints moves collided points waiting in r.fix to their next generation
+// and inserts them back to the given tree. It returns the new version of the
+// tree.
+// It returns non-nil error if some point exceeds r.MaxGeneration or if some
+// item can't be digested and r.Strict is true.
+//
+// r.mu must be held.
+func (r *Ring) fixPoints(h *hasher, root avl.Tree) (avl.Tree, error) {
+	for el := r.fix.Front(); el != nil; el = r.fix.Front() {
+		r.yield()
+		p := r.fix.Remove(el).(*point)
 
+		trace := r.trace.onFix(p)
+		assertNotExists(root, p)
+
+		g := p.generation()
+		if max := r.conf.MaxGeneration; max > 0 && g >= max {
+			if fn := r.conf.Trace.OnGenerationLimit; fn != nil {
+				fn(p.bucket.item, p.index)
+			}
 			trace.onDone()
+			return root, fmt.Errorf(
+				"hashring: point #%d of item %v exceeds max generation %d",
+				p.index, p.bucket.item, max,
+			)
 		}
-		if r.fix.Len() == 0 {
-			break
+		v, err := r.pointValue(h, p.bucket, g+1, p.index)
+		if err != nil {
+			trace.onDone()
+			return root, err
+		}
+		p.proceed(v)
+		if fn := r.conf.Trace.OnFix; fn != nil {
+			fn(p.bucket.item, p.index, p.gen)
+		}
+		root, _ = r.insertPoint(root, p)
+
+		trace.onDone()
+	}
+	return root, nil
+}
+
+// lock locks r.mu and waits for the cooperative rebuild (if any) to finish.
+// It panics if r is a copy of the ring which was already used or if r is
+// closed.
+func (r *Ring) lock() {
+	r.mu.Lock()
+	if r.addr == nil {
+		r.addr = r
+	} else if r.addr != r {
+		r.mu.Unlock()
+		panic("hashring: illegal use of the ring copied by value")
+	}
+	r.wait()
+	if r.closed {
+		r.mu.Unlock()
+		panic("hashring: use of closed ring")
+	}
+	r.configure()
+}
+
+// wait waits for the cooperative rebuild (if any) to finish.
+//
+// r.mu must be held.
+func (r *Ring) wait() {
+	for r.rebuilding {
+		if r.idle.L == nil {
+			r.idle.L = &r.mu
+		}
+		r.idle.Wait()
+	}
+}
+
+// yield releases r.mu for a while if cooperative rebuild holds it for longer
+// than r.RebuildBudget.
+//
+// r.mu must be held.
+func (r *Ring) yield() {
+	if !r.rebuilding || time.Since(r.locked) < r.conf.RebuildBudget {
+		return
+	}
+	r.mu.Unlock()
+	runtime.Gosched()
+	r.mu.Lock()
+	r.locked = time.Now()
+}
+
+// traceRebuild calls rebuild hooks with the number of points on the ring. It
+// returns a function which must be called right after the rebuild.
+//
+// r.mu must be held.
+func (r *Ring) traceRebuild(points int) func() {
+	r.added, r.removed, r.restored = 0, 0, 0
+	r.rebuilds++
+	var fn func(int, int, time.Duration)
+	if h := r.conf.Trace.OnRebuild; h != nil {
+		fn = h(points)
+	}
+	var (
+		trace = r.trace.onRebuild(points)
+		start = time.Now()
+	)
+	return func() {
+		d := time.Since(start)
+		if fn != nil {
+			fn(r.added, r.removed, d)
+		}
+		trace.onDone(r.added, r.removed, d)
+	}
+}
+
+// buildSorted builds the tree from scratch by sorting all points of the ring
+// at once instead of inserting them one by one, which takes O(n) time after
+// sorting. It returns false if some buckets already have points or if some
+// points collide and r.Collision is not CollisionStable. It returns non-nil
+// error if some item can't be digested and r.Strict is true. In both cases
+// ring's points are left unchanged.
+//
+// r.mu must be held.
+func (r *Ring) buildSorted(h *hasher) (avl.Tree, bool, error) {
+	if r.fix.Len() != 0 || len(r.collisions) != 0 {
+		return avl.Tree{}, false, nil
+	}
+	var (
+		numPoints = r.numPoints()
+		chunks    = make(map[*bucket][]point, len(r.buckets))
+		points    []*point
+	)
+	for _, b := range r.buckets {
+		if len(b.points) != 0 {
+			return avl.Tree{}, false, nil
+		}
+		if b.weight == 0 {
+			continue
+		}
+		r.yield()
+		chunk, err := r.makePoints(h, b, 0, numPoints(b))
+		if err != nil {
+			return avl.Tree{}, false, err
+		}
+		for i := range chunk {
+			points = append(points, &chunk[i])
+		}
+		chunks[b] = chunk
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Compare(points[j]) < 0
+	})
+	items := make([]avl.Item, len(points))
+	for i, p := range points {
+		if i > 0 && p.Compare(points[i-1]) == 0 {
+			return avl.Tree{}, false, nil
+		}
+		items[i] = p
+	}
+	for id, b := range r.buckets {
+		if b.weight == 0 {
+			delete(r.buckets, id)
+			continue
+		}
+		chunk := chunks[b]
+		b.points = make([]*point, len(chunk))
+		r.added += len(chunk)
+		for i := range chunk {
+			b.points[i] = &chunk[i]
+		}
+	}
+	return avl.Build(items), true, nil
+}
+
+// makePoints returns points of bucket b with indexes in [from, to) range at
+// zero generation.
+// It returns non-nil error if b's item can't be digested and r.Strict is
+// true.
+//
+// r.mu must be held.
+func (r *Ring) makePoints(h *hasher, b *bucket, from, to int) ([]point, error) {
+	if from >= to {
+		return nil, nil
+	}
+	// Item bytes are taken once for all of its new points.
+	sum, err := r.keySum(h, b)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		buf [2 * 8]byte
+		// New points are allocated at once to reduce the number of
+		// allocations and per-point memory overhead.
+		chunk = make([]point, to-from)
+	)
+	for i := range chunk {
+		chunk[i] = point{
+			bucket: b,
+			index:  from + i,
+			val:    sum(r.appendSuffix(buf[:0], b.item, 0, from+i)),
+		}
+	}
+	return chunk, nil
+}
+
+// keySum returns a function calculating digests of b's item bytes followed
+// by given suffix bytes (see hasher.keySum()).
+//
+// Functions which read bytes of KeyReader items once are kept by the bucket,
+// so streamed items are read only when they are put on the ring. Thus
+// changing their weights, fixing collisions of their points or restoring the
+// ring after failed rebuild never fails due to read errors.
+//
+// It returns non-nil error if b's item can't be digested and r.Strict is
+// true.
+//
+// r.mu must be held.
+func (r *Ring) keySum(h *hasher, b *bucket) (func([]byte) value, error) {
+	if b.stream != nil && b.streamHasher == h {
+		return b.stream, nil
+	}
+	sum, stream, err := h.keySum(b.item)
+	if err != nil {
+		return nil, r.checkErr(err)
+	}
+	if stream {
+		b.stream, b.streamHasher = sum, h
+	}
+	return sum, nil
+}
+
+// pointValue returns value of the point of bucket b with given index at
+// generation gen.
+// It returns non-nil error if b's item can't be digested and r.Strict is
+// true.
+//
+// r.mu must be held.
+func (r *Ring) pointValue(h *hasher, b *bucket, gen, index int) (value, error) {
+	suffix := r.suffix(b.item, gen, index)
+	if b.stream != nil && b.streamHasher == h {
+		return b.stream(suffix), nil
+	}
+	return r.check(h.sum(b.item, suffix))
+}
+
+// lookup returns item which hash value d is mapped to, taking pins into
+// account. It returns nil if the ring is empty.
+func (s *ringState) lookup(d value) Item {
+	_, x := s.owner(d)
+	return x
+}
+
+// owner returns item (along with its non-suffixed digest) which hash value d
+// is mapped to, taking pins into account. It returns nil if the ring is
+// empty.
+func (s *ringState) owner(d value) (uint64, Item) {
+	if s.cache != nil {
+		return s.cachedOwner(d)
+	}
+	if m, has := s.pinned(d); has {
+		if m.loads != nil {
+			m.loads.add()
+		}
+		return s.pins[d].target, m.item
+	}
+	b := s.get(d)
+	if b == nil {
+		return 0, nil
+	}
+	if b.loads != nil {
+		b.loads.add()
+	}
+	return b.id, b.item
+}
+
+// cachedOwner is like owner() but takes the result from s.cache if possible.
+func (s *ringState) cachedOwner(d value) (uint64, Item) {
+	e := s.cache.get(d)
+	if e == nil {
+		e = &cacheEntry{d: d}
+		if m, has := s.pinned(d); has {
+			e.id, e.item, e.loads = s.pins[d].target, m.item, m.loads
+		} else if b := s.get(d); b != nil {
+			e.id, e.item, e.loads = b.id, b.item, b.loads
+		} else {
+			return 0, nil
+		}
+		s.cache.put(e)
+	}
+	if e.loads != nil {
+		e.loads.add()
+	}
+	return e.id, e.item
+}
+
+// lookupN returns at most n distinct items which hash value d is mapped to,
+// taking pins into account.
+func (s *ringState) lookupN(d value, n int) []Item {
+	var (
+		items []Item
+		seen  = make(map[uint64]bool, n)
+	)
+	if m, has := s.pinned(d); has {
+		items = append(items, m.item)
+		seen[s.pins[d].target] = true
+	}
+	if len(items) == n {
+		return items
+	}
+	s.walk(d, func(p *point) bool {
+		if !seen[p.bucket.id] {
+			seen[p.bucket.id] = true
+			items = append(items, p.bucket.item)
+		}
+		return len(items) < n
+	})
+	return items
+}
+
+// lookupChain returns the first item accepted by fn among the distinct items
+// met while walking the ring from d. The pinned item, if any, goes first.
+func (s *ringState) lookupChain(d value, fn func(Item) bool) Item {
+	seen := make(map[uint64]bool)
+	if m, has := s.pinned(d); has {
+		if fn(m.item) {
+			return m.item
+		}
+		seen[s.pins[d].target] = true
+	}
+	var x Item
+	s.walk(d, func(p *point) bool {
+		b := p.bucket
+		if seen[b.id] {
+			return true
+		}
+		seen[b.id] = true
+		if fn(b.item) {
+			x = b.item
+			return false
+		}
+		return len(seen) < len(s.members)
+	})
+	return x
+}
+
+// get returns bucket owning hash value d.
+// It returns nil if the ring is empty.
+func (s *ringState) get(d value) *bucket {
+	if s.filtered {
+		var b *bucket
+		s.walk(d, func(p *point) bool {
+			b = p.bucket
+			return false
+		})
+		return b
+	}
+	if s.index != nil {
+		return s.index.get(d)
+	}
+	return get(s.tree, d)
+}
+
+// walk calls fn for each point of the ring in clockwise order starting from
+// the point which owns hash value d. It stops when all points are visited or
+// fn returns false.
+func (s *ringState) walk(d value, fn func(*point) bool) {
+	if s.filtered {
+		if len(s.members) == 0 {
+			return
+		}
+		next := fn
+		fn = func(p *point) bool {
+			if _, has := s.members[p.bucket.id]; !has {
+				return true
+			}
+			return next(p)
 		}
 	}
+	if s.index != nil {
+		s.index.walk(d, fn)
+		return
+	}
+	walk(s.tree, d, fn)
+}
 
-	r.ringMu.Lock()
-	r.ring = root
-	r.ringMu.Unlock()
+// get returns bucket owning hash value d.
+// It returns nil if tree is empty.
+func get(tree avl.Tree, d value) *bucket {
+	x := tree.Successor(upper(d))
+	if x == nil {
+		x = tree.Min()
+	}
+	if x == nil {
+		return nil
+	}
+	return x.(*point).bucket
+}
+
+// getCounterClockwise returns bucket owning the point having the greatest
+// value less or equal to d. Among the points having equal values (under
+// CollisionStable policy) the first one wins, like it does for clockwise
+// lookups.
+// It returns nil if tree is empty.
+func getCounterClockwise(tree avl.Tree, d value) *bucket {
+	x := tree.Predecessor(upper(d))
+	if x == nil {
+		x = tree.Max()
+	}
+	if x == nil {
+		return nil
+	}
+	if first := tree.Successor(lower(x.(*point).val)); first != nil {
+		x = first
+	}
+	return x.(*point).bucket
+}
+
+// walk calls fn for each point of the tree in clockwise order starting from
+// the point which owns hash value d. It stops when all points are visited or
+// fn returns false.
+func walk(tree avl.Tree, d value, fn func(*point) bool) {
+	x := tree.Successor(upper(d))
+	if x == nil {
+		x = tree.Min()
+	}
+	for n := tree.Size(); x != nil && n > 0; n-- {
+		p := x.(*point)
+		if !fn(p) {
+			return
+		}
+		if x = tree.Successor(p); x == nil {
+			x = tree.Min()
+		}
+	}
 }
 
 func line(x0, y0, x1, y1 float64) func(float64) int {
@@ -2,16 +2,18 @@ package hashring
 
 import (
 	"fmt"
+	"hash"
+	"hash/fnv"
 	"io"
 	"math"
 	"math/rand"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
-
-	"github.com/gobwas/avl"
 )
 
 func ExampleRing() {
@@ -598,226 +600,1944 @@ func TestRingHas(t *testing.T) {
 	}
 }
 
-func applyActions(t testing.TB, r *Ring, actions ...ringAction) {
-	for _, a := range actions {
-		if err := a.apply(r); err != nil {
-			t.Fatalf("can't apply action %s: %v", a, err)
-		}
+func TestRingHasDigest(t *testing.T) {
+	var ring Ring
+
+	d := xxDigest([]byte("server01"))
+	if ring.HasDigest(d) {
+		t.Error("has server on empty ring")
+	}
+	ring.Insert(StringItem("server01"), 1.0)
+	if !ring.HasDigest(d) {
+		t.Error("failed to find server")
+	}
+	if ring.HasDigest(xxDigest([]byte("key"))) {
+		t.Error("ring has not inserted key")
+	}
+	ring.Delete(StringItem("server01"))
+	if ring.HasDigest(d) {
+		t.Error("has deleted server")
 	}
 }
 
-func makeRing(t testing.TB, keys map[string]float64, actions ...ringAction) *Ring {
-	var r Ring
-	for key, weight := range keys {
-		err := r.Insert(StringItem(key), weight)
-		if err != nil {
-			t.Fatal(err)
-		}
+func TestRingWeight(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+	})
+	if w, has := r.Weight(StringItem("bar")); !has || w != 2 {
+		t.Errorf("unexpected weight of bar: %v %v", w, has)
+	}
+	if _, has := r.Weight(StringItem("baz")); has {
+		t.Errorf("unexpected weight of baz")
+	}
+	if n := r.Len(); n != 2 {
+		t.Errorf("unexpected length: %d", n)
+	}
+	if w := r.TotalWeight(); w != 3 {
+		t.Errorf("unexpected total weight: %v", w)
 	}
-	applyActions(t, &r, actions...)
-	return &r
-}
 
-func keyDistribution(r *Ring, fn func(Item, float64)) {
-	r.ringMu.RLock()
-	defer r.ringMu.RUnlock()
-	var (
-		prev float64
+	r.Update(StringItem("foo"), 5)
+	r.Delete(StringItem("bar"))
+	if w, has := r.Weight(StringItem("foo")); !has || w != 5 {
+		t.Errorf("unexpected weight of foo: %v %v", w, has)
+	}
+	if n := r.Len(); n != 1 {
+		t.Errorf("unexpected length: %d", n)
+	}
+	if w := r.TotalWeight(); w != 5 {
+		t.Errorf("unexpected total weight: %v", w)
+	}
+}
 
-		temp  = map[uint64]float64{}
-		index = map[uint64]Item{}
-	)
-	r.ring.InOrder(func(x avl.Item) bool {
-		p := x.(*point)
-		v := float64(p.val)
-		d := v - prev
-		prev = v
-		temp[p.bucket.id] += d
-		index[p.bucket.id] = p.bucket.item
-		return true
+func TestRingSetWeights(t *testing.T) {
+	items := map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	}
+	r0 := makeRing(t, items)
+	err := r0.SetWeights(map[Item]float64{
+		StringItem("foo"): 4,
+		StringItem("baz"): 1,
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1 := makeRing(t, map[string]float64{
+		"foo": 4,
+		"bar": 2,
+		"baz": 1,
+	})
+	assertRingsEqual(t, "set ?= built", r0, r1)
 
-	// All objects greater than r.root.Max() (prev hash value) falls into
-	// r.root.Min() bucket.
-	min := r.ring.Min().(*point).bucket.id
-	temp[min] += math.MaxUint64 - prev
-
-	for id, dist := range temp {
-		item := index[id]
-		fn(item, dist/float64(math.MaxUint64))
+	err = r0.SetWeights(map[Item]float64{
+		StringItem("foo"): 1,
+		StringItem("qux"): 1,
+	})
+	if err == nil {
+		t.Fatalf("want error")
+	}
+	if w, _ := r0.Weight(StringItem("foo")); w != 4 {
+		t.Fatalf("unexpected weight of foo after failed update: %v", w)
 	}
 }
 
-func assertDistribution(t testing.TB, act, exp map[string]float64, prec float64) {
-	for key, act := range act {
-		exp := exp[key]
-		diff := act - exp
-		if math.Abs(diff) > prec {
-			t.Errorf(
-				"unexpected distribution for %q key: %.2f; want %.2f "+
-					"(±%.2f%%, diff is %+.2f%%))",
-				key, act, exp, prec, diff,
-			)
+func TestRingPointsOf(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+	})
+	exp := make(map[Item][]uint64)
+	r.WalkRange(0, 0, func(p PointInfo) bool {
+		ps := exp[p.Item]
+		for len(ps) <= p.Index {
+			ps = append(ps, 0)
 		}
+		ps[p.Index] = p.Value
+		exp[p.Item] = ps
+		return true
+	})
+	for x, ps := range exp {
+		act := r.PointsOf(x)
+		if !reflect.DeepEqual(act, ps) {
+			t.Errorf("unexpected points of %s: %v; want %v", x, act, ps)
+		}
+	}
+	if ps := r.PointsOf(StringItem("baz")); ps != nil {
+		t.Errorf("unexpected points of non-existing item: %v", ps)
 	}
 }
 
-const mathMaxInt = int(^uint(0) >> 1) // math.MaxInt since Go 1.17.
+func TestRingSuffix(t *testing.T) {
+	r := Ring{
+		MagicFactor: 10,
+		Suffix: func(_ Item, gen, index int) []byte {
+			if gen == 0 {
+				return []byte("#" + strconv.Itoa(index))
+			}
+			return []byte("#" + strconv.Itoa(index) + "-" + strconv.Itoa(gen))
+		},
+	}
+	if err := r.Insert(StringItem("foo"), 1); err != nil {
+		t.Fatal(err)
+	}
+	ps := r.PointsOf(StringItem("foo"))
+	if n := len(ps); n != 10 {
+		t.Fatalf("unexpected number of points: %d", n)
+	}
+	for i, p := range ps {
+		exp := xxDigest([]byte("foo#" + strconv.Itoa(i)))
+		if p != exp {
+			t.Errorf("unexpected value of point #%d: %d; want %d", i, p, exp)
+		}
+	}
+}
 
-func getDistribution(t testing.TB, r *Ring, numGet int) map[string]float64 {
-	tmp := make(map[string]int)
-	act := make(map[string]float64)
-	for i := 0; i < numGet; i++ {
-		n := rand.Intn(mathMaxInt)
-		item := r.Get(IntItem(n))
-		if item == nil {
-			t.Fatalf("unexpected empty item")
+func TestRingFixedSuffix(t *testing.T) {
+	r := Ring{
+		MagicFactor: 10,
+		Suffix:      FixedSuffix,
+	}
+	if err := r.Insert(StringItem("foo"), 1); err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range r.PointsOf(StringItem("foo")) {
+		src := []byte("foo\x00\x00\x00\x00\x00\x00\x00\x00")
+		src = append(src, byte(i), 0, 0, 0, 0, 0, 0, 0)
+		if exp := xxDigest(src); p != exp {
+			t.Errorf("unexpected value of point #%d: %d; want %d", i, p, exp)
 		}
-		tmp[string(item.(StringItem))] += 1
 	}
-	for key, num := range tmp {
-		act[key] = float64(num) / float64(numGet) * 100
+	if intSize == 8 {
+		def := Ring{
+			MagicFactor: 10,
+		}
+		if err := def.Insert(StringItem("foo"), 1); err != nil {
+			t.Fatal(err)
+		}
+		assertRingsEqual(t, "fixed ?= default", &r, &def)
 	}
-	return act
 }
 
-type ringAction interface {
-	apply(*Ring) error
+func TestRingDeferred(t *testing.T) {
+	r0 := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+	})
+	r0.Begin()
+	for _, act := range []ringAction{
+		insertItem("baz", 3),
+		deleteItem("foo"),
+		insertItem("foo", 4),
+		updateItem("bar", 1),
+		deleteItem("baz"),
+	} {
+		if err := act.apply(r0); err != nil {
+			t.Fatalf("can't %s: %v", act, err)
+		}
+	}
+	if w, _ := r0.Weight(StringItem("bar")); w != 2 {
+		t.Fatalf("readers observe staged changes")
+	}
+	if err := r0.Update(StringItem("baz"), 1); err == nil {
+		t.Fatalf("want error on update of deleted item")
+	}
+	r0.Commit()
+
+	r1 := makeRing(t, map[string]float64{
+		"foo": 4,
+		"bar": 1,
+	})
+	assertRingsEqual(t, "deferred ?= built", r0, r1)
 }
 
-func permActions(actions ...ringAction) (ret [][]ringAction) {
-	var f func(x ringAction, xs []ringAction) [][]ringAction
-	f = func(x ringAction, xs []ringAction) (ret [][]ringAction) {
-		if len(xs) == 0 {
-			return [][]ringAction{{x}}
+func TestRingApply(t *testing.T) {
+	r0 := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+	})
+	err := r0.Apply(func() error {
+		for _, act := range []ringAction{
+			insertItem("baz", 3),
+			deleteItem("foo"),
+			updateItem("bar", 1),
+		} {
+			if err := act.apply(r0); err != nil {
+				t.Fatalf("can't %s: %v", act, err)
+			}
 		}
-		for _, ps := range f(xs[0], xs[1:]) {
-			// Append current action to the end of received actions.
-			// Below we will swap it with every element in the slice.
-			ps = append(ps, x)
-
-			last := len(ps) - 1
-			for i := 0; i < len(ps); i++ {
-				cp := append(([]ringAction)(nil), ps...)
-				cp[i], cp[last] = cp[last], cp[i]
-				ret = append(ret, cp)
+		if w, _ := r0.Weight(StringItem("bar")); w != 2 {
+			t.Fatalf("readers observe staged changes")
+		}
+		if err := r0.Apply(func() error { return nil }); err == nil {
+			t.Fatalf("want error on nested Apply()")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRingsEqual(t, "applied ?= built", r0, makeRing(t, map[string]float64{
+		"baz": 3,
+		"bar": 1,
+	}))
+
+	errApply := fmt.Errorf("apply error")
+	err = r0.Apply(func() error {
+		for _, act := range []ringAction{
+			insertItem("foo", 4),
+			deleteItem("baz"),
+			updateItem("bar", 5),
+		} {
+			if err := act.apply(r0); err != nil {
+				t.Fatalf("can't %s: %v", act, err)
 			}
 		}
-		return ret
+		return errApply
+	})
+	if err != errApply {
+		t.Fatalf("unexpected error: %v; want %v", err, errApply)
+	}
+	if err := r0.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	assertRingsEqual(t, "discarded ?= built", r0, makeRing(t, map[string]float64{
+		"baz": 3,
+		"bar": 1,
+	}))
+	if err := r0.Insert(StringItem("foo"), 1); err != nil {
+		t.Fatalf("can't insert discarded item: %v", err)
+	}
+	if w, _ := r0.Weight(StringItem("foo")); w != 1 {
+		t.Fatalf("ring stays in deferred mode after discard")
 	}
-	return f(actions[0], actions[1:])
-}
-
-type insertRingAction struct {
-	s string
-	w float64
 }
 
-func insertItem(s string, w float64) *insertRingAction {
-	return &insertRingAction{
-		s: s,
-		w: w,
+func TestRingTraceOnGet(t *testing.T) {
+	var (
+		digest uint64
+		chosen Item
+	)
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+	})
+	r.Trace.OnGet = func(d uint64) func(Item) {
+		digest = d
+		return func(x Item) {
+			chosen = x
+		}
+	}
+	key := StringItem("key")
+	for _, test := range []struct {
+		name   string
+		lookup func() Item
+	}{
+		{"Get", func() Item {
+			return r.Get(key)
+		}},
+		{"GetCounterClockwise", func() Item {
+			return r.GetCounterClockwise(key)
+		}},
+		{"GetSpread", func() Item {
+			return r.GetSpread(key, 1)
+		}},
+		{"GetN", func() Item {
+			return r.GetN(key, 2)[0]
+		}},
+		{"GetChain", func() Item {
+			return r.GetChain(key, func(Item) bool { return true })
+		}},
+		{"GetReplicas", func() Item {
+			return r.GetReplicas(key, 2)[0].Item
+		}},
+		{"Owner", func() Item {
+			x, _ := r.Owner(key)
+			return x
+		}},
+		{"View.Get", func() Item {
+			return r.View().Get(key)
+		}},
+		{"View.GetN", func() Item {
+			return r.View().GetN(key, 2)[0]
+		}},
+		{"View.GetChain", func() Item {
+			return r.View().GetChain(key, func(Item) bool { return true })
+		}},
+		{"View.GetReplicas", func() Item {
+			return r.View().GetReplicas(key, 2)[0].Item
+		}},
+	} {
+		digest, chosen = 0, nil
+		x := test.lookup()
+		if exp := xxDigest([]byte(key)); digest != exp {
+			t.Errorf("%s: unexpected key digest: %d; want %d", test.name, digest, exp)
+		}
+		if chosen != x {
+			t.Errorf("%s: unexpected chosen item: %v; want %v", test.name, chosen, x)
+		}
 	}
-}
 
-func (i insertRingAction) String() string {
-	return fmt.Sprintf("insert %s~%.2f", i.s, i.w)
+	r.Strict = true
+	called := false
+	r.Trace.OnGet = func(uint64) func(Item) {
+		called = true
+		return nil
+	}
+	if x := r.Get(errItem("key")); x != nil {
+		t.Fatalf("unexpected item: %v", x)
+	}
+	if called {
+		t.Errorf("OnGet called for the key which can't be digested")
+	}
 }
 
-func (i insertRingAction) apply(r *Ring) error {
-	return r.Insert(StringItem(i.s), i.w)
+func TestRingTraceOnRebuild(t *testing.T) {
+	type rebuild struct {
+		points, added, removed int
+	}
+	var calls []rebuild
+	r := Ring{
+		MagicFactor: 10,
+		Trace: RingTrace{
+			OnRebuild: func(points int) func(int, int, time.Duration) {
+				return func(added, removed int, d time.Duration) {
+					if d < 0 {
+						t.Errorf("unexpected negative duration: %s", d)
+					}
+					calls = append(calls, rebuild{points, added, removed})
+				}
+			},
+		},
+	}
+	mustInsert := func(x Item, w float64) {
+		if err := r.Insert(x, w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustInsert(StringItem("foo"), 1)
+	mustInsert(StringItem("bar"), 2)
+	if err := r.Delete(StringItem("bar")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SetMagicFactor(20); err != nil {
+		t.Fatal(err)
+	}
+	exp := []rebuild{
+		{0, 10, 0},   // Insert foo with 10 points.
+		{10, 10, 5},  // Insert bar with 10 points, foo gets 5 points.
+		{15, 5, 10},  // Delete bar, foo gets 10 points back.
+		{10, 20, 10}, // SetMagicFactor rebuilds from scratch.
+	}
+	if !reflect.DeepEqual(calls, exp) {
+		t.Fatalf("unexpected rebuild calls:\n%+v\nwant:\n%+v", calls, exp)
+	}
 }
 
-type updateRingAction struct {
-	s string
-	w float64
-}
+func TestRingRebuildBudget(t *testing.T) {
+	var (
+		r = Ring{
+			MagicFactor:   64,
+			RebuildBudget: time.Nanosecond,
+		}
+		rebuilds  int
+		rebuilt   bool
+		inspected = make(chan bool, 1)
+		updated   = make(chan bool, 1)
+	)
+	r.Trace.OnRebuild = func(int) func(int, int, time.Duration) {
+		if rebuilds++; rebuilds > 1 {
+			return nil
+		}
+		go func() {
+			// Must not wait for the whole rebuild.
+			r.ChangesSince(0)
+			inspected <- !rebuilt
+		}()
+		go func() {
+			// Must wait for the rebuild to finish.
+			if err := r.Update(StringItem("item00"), 2); err != nil {
+				t.Error(err)
+			}
+			updated <- rebuilt
+		}()
+		return func(int, int, time.Duration) {
+			rebuilt = true
+		}
+	}
+	items := make(map[string]float64)
+	r.Begin()
+	for i := 0; i < 100; i++ {
+		s := fmt.Sprintf("item%02d", i)
+		items[s] = 1
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if !<-inspected {
+		t.Errorf("ChangesSince() was blocked by rebuild")
+	}
+	if !<-updated {
+		t.Errorf("Update() was not blocked by rebuild")
+	}
 
-func updateItem(s string, w float64) *updateRingAction {
-	return &updateRingAction{
-		s: s,
-		w: w,
+	exp := Ring{MagicFactor: 64}
+	for s, w := range items {
+		if s == "item00" {
+			w = 2
+		}
+		if err := exp.Insert(StringItem(s), w); err != nil {
+			t.Fatal(err)
+		}
 	}
+	assertRingsEqual(t, "cooperative ?= built", &r, &exp)
 }
 
-func (i updateRingAction) String() string {
-	return fmt.Sprintf("update %s@%.2f", i.s, i.w)
-}
+func TestRingGetSpread(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 1,
+		"baz": 1,
+		"qux": 1,
+	})
+	key := StringItem("hot")
+	for i := 0; i < 100; i++ {
+		if x, exp := r.GetSpread(key, 1), r.Get(key); x != exp {
+			t.Fatalf("unexpected item: %v; want %v", x, exp)
+		}
+	}
+	seen := make(map[Item]bool)
+	for i := 0; i < 1000; i++ {
+		seen[r.GetSpread(key, 16)] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("key is not spread: %v", seen)
+	}
 
-func (i updateRingAction) apply(r *Ring) error {
-	return r.Update(StringItem(i.s), i.w)
+	// Pinned key is not spread.
+	target := StringItem("foo")
+	if r.Get(key) == target {
+		target = StringItem("bar")
+	}
+	if err := r.Pin(key, target); err != nil {
+		t.Fatal(err)
+	}
+	var traced int
+	r.Trace.OnGet = func(uint64) func(Item) {
+		traced++
+		return nil
+	}
+	if x, exp := r.GetSpread(key, 1), r.Get(key); x != exp || x != target {
+		t.Fatalf("unexpected item of pinned key: %v; want %v", x, target)
+	}
+	for i := 0; i < 100; i++ {
+		if x := r.GetSpread(key, 16); x != target {
+			t.Fatalf("unexpected item of pinned key: %v; want %v", x, target)
+		}
+	}
+	if traced != 102 {
+		t.Fatalf("unexpected number of traced lookups: %d; want 102", traced)
+	}
 }
 
-type deleteRingAction struct {
-	s string
+func TestRingMeta(t *testing.T) {
+	var r Ring
+	if err := r.Insert(StringItem("foo"), 1, WithMeta("10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Insert(StringItem("bar"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Update(StringItem("foo"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetHash(fnv.New64a); err != nil {
+		t.Fatal(err)
+	}
+	if m, has := r.Meta(StringItem("foo")); !has || m != "10.0.0.1" {
+		t.Errorf("unexpected meta of foo: %v %v", m, has)
+	}
+	if m, has := r.Meta(StringItem("bar")); !has || m != nil {
+		t.Errorf("unexpected meta of bar: %v %v", m, has)
+	}
+	if _, has := r.Meta(StringItem("baz")); has {
+		t.Errorf("unexpected meta of baz")
+	}
 }
 
-func deleteItem(s string) *deleteRingAction {
-	return &deleteRingAction{s}
+func TestRingGetN(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 1,
+		"baz": 1,
+	})
+	for i := 0; i < 1000; i++ {
+		key := IntItem(i)
+		items := r.GetN(key, 5)
+		if n := len(items); n != 3 {
+			t.Fatalf("unexpected number of items: %d", n)
+		}
+		if exp := r.Get(key); items[0] != exp {
+			t.Fatalf("unexpected first item: %v; want %v", items[0], exp)
+		}
+		if items[0] == items[1] || items[1] == items[2] || items[0] == items[2] {
+			t.Fatalf("items are not distinct: %v", items)
+		}
+	}
 }
 
-func (d deleteRingAction) String() string {
-	return fmt.Sprintf("delete %s", d.s)
-}
+func TestRingGetChain(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 1,
+		"baz": 1,
+	})
+	for i := 0; i < 1000; i++ {
+		key := IntItem(i)
+		chain := r.GetN(key, 3)
+
+		var offered []Item
+		act := r.GetChain(key, func(x Item) bool {
+			offered = append(offered, x)
+			return x != chain[0]
+		})
+		if exp := chain[1]; act != exp {
+			t.Fatalf("unexpected item: %v; want %v", act, exp)
+		}
+		if !reflect.DeepEqual(offered, chain[:2]) {
+			t.Fatalf("unexpected offered items: %v; want %v", offered, chain[:2])
+		}
 
-func (d deleteRingAction) apply(r *Ring) error {
-	return r.Delete(StringItem(d.s))
+		offered = offered[:0]
+		act = r.GetChain(key, func(x Item) bool {
+			offered = append(offered, x)
+			return false
+		})
+		if act != nil {
+			t.Fatalf("unexpected item: %v; want nil", act)
+		}
+		if !reflect.DeepEqual(offered, chain) {
+			t.Fatalf("unexpected offered items: %v; want %v", offered, chain)
+		}
+	}
+	var empty Ring
+	if x := empty.GetChain(IntItem(0), func(Item) bool { return true }); x != nil {
+		t.Fatalf("unexpected item from empty ring: %v", x)
+	}
 }
 
-func ringPoints(r *Ring) (ps []*point) {
-	r.ring.InOrder(func(x avl.Item) bool {
-		ps = append(ps, x.(*point))
-		return true
-	})
-	return ps
+func TestRingOwner(t *testing.T) {
+	var r Ring
+	if item, _ := r.Owner(StringItem("foo")); item != nil {
+		t.Fatalf("unexpected item from empty ring")
+	}
+	r.Insert(StringItem("server01"), 1)
+	r.Insert(StringItem("server02"), 2)
+	for i := 0; i < 1000; i++ {
+		key := IntItem(i)
+		item, rng := r.Owner(key)
+		if exp := r.Get(key); item != exp {
+			t.Fatalf("unexpected owner of %d: %v; want %v", i, item, exp)
+		}
+		if d := r.digest(key).hi; !rng.Contains(d) {
+			t.Fatalf(
+				"range [%d, %d) of %d doesn't contain its digest %d",
+				rng.Start, rng.End, i, d,
+			)
+		}
+	}
 }
 
-func assertRingsEqual(t *testing.T, spec string, r0, r1 *Ring) {
-	ps0 := ringPoints(r0)
+func TestRingGetCounterClockwise(t *testing.T) {
+	for _, c := range []CollisionPolicy{
+		CollisionRehash,
+		CollisionStable,
+	} {
+		t.Run(c.String(), func(t *testing.T) {
+			r := &Ring{
+				Hash: func() hash.Hash64 {
+					return maskHash{fnv.New64a(), 0xff}
+				},
+				MagicFactor: 16,
+				Collision:   c,
+			}
+			for _, s := range []string{"foo", "bar", "baz"} {
+				if err := r.Insert(StringItem(s), 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ps := ringPoints(r)
+			for i := 0; i < 1000; i++ {
+				key := IntItem(i)
+				d := r.digest(key).hi
+				// Find the first point of the greatest value less or equal
+				// to d, wrapping around the ring.
+				j := sort.Search(len(ps), func(j int) bool {
+					return ps[j].val.hi > d
+				})
+				if j == 0 {
+					j = len(ps)
+				}
+				v := ps[j-1].val.hi
+				for j > 1 && ps[j-2].val.hi == v {
+					j--
+				}
+				exp := ps[j-1].bucket.item
+				if act := r.GetCounterClockwise(key); act != exp {
+					t.Fatalf("unexpected item for %d: %v; want %v", i, act, exp)
+				}
+			}
+		})
+	}
+	var empty Ring
+	if x := empty.GetCounterClockwise(IntItem(0)); x != nil {
+		t.Fatalf("unexpected item from empty ring: %v", x)
+	}
+}
+
+func TestRingPointAt(t *testing.T) {
+	r := new(Ring)
+	if p := r.PointAt(0); p.Item != nil {
+		t.Fatalf("unexpected point of empty ring: %+v", p)
+	}
+	if p := r.RandomPoint(nil); p.Item != nil {
+		t.Fatalf("unexpected random point of empty ring: %+v", p)
+	}
+	r = makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	})
+	var points []PointInfo
+	r.WalkRange(0, 0, func(p PointInfo) bool {
+		points = append(points, p)
+		return true
+	})
+	if n := r.NumPoints(); n != len(points) {
+		t.Fatalf("unexpected number of points: %d; want %d", n, len(points))
+	}
+	for i, exp := range points {
+		if act := r.PointAt(i); act != exp {
+			t.Fatalf("unexpected point at %d: %+v; want %+v", i, act, exp)
+		}
+	}
+	for _, i := range []int{-1, len(points)} {
+		if p := r.PointAt(i); p.Item != nil {
+			t.Fatalf("unexpected point at %d: %+v", i, p)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(0))
+	seen := make(map[PointInfo]int)
+	for i := 0; i < len(points)*20; i++ {
+		p := r.RandomPoint(rng)
+		if p.Item == nil {
+			t.Fatalf("random point is empty")
+		}
+		seen[p]++
+	}
+	if n := len(seen); n < len(points)*9/10 {
+		t.Fatalf("random points hit only %d of %d points", n, len(points))
+	}
+}
+
+func TestRingRangesOf(t *testing.T) {
+	items := map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	}
+	r := makeRing(t, items)
+	ranges := make(map[Item][]Range, len(items))
+	for s := range items {
+		x := StringItem(s)
+		rs := r.RangesOf(x)
+		var size float64
+		for i, rng := range rs {
+			if i > 0 && rs[i-1].Start >= rng.Start {
+				t.Fatalf("ranges of %q are not ordered: %v", s, rs)
+			}
+			size += partitionSize(rng)
+		}
+		size /= math.Exp2(64)
+		if exp := r.LoadShare(x); math.Abs(size-exp) > 1e-9 {
+			t.Errorf("ranges of %q cover %v of the ring; want %v", s, size, exp)
+		}
+		if n := r.ArcCount(x); len(rs) != n {
+			t.Errorf("unexpected number of %q ranges: %d; want %d", s, len(rs), n)
+		}
+		ranges[x] = rs
+	}
+	for i := 0; i < 1000; i++ {
+		key := IntItem(i)
+		var (
+			d     = r.digest(key).hi
+			owner = r.Get(key)
+		)
+		for x, rs := range ranges {
+			var contains bool
+			for _, rng := range rs {
+				contains = contains || rng.Contains(d)
+			}
+			if contains != (x == owner) {
+				t.Fatalf(
+					"ranges of %v contain %d: %t; owner of %d is %v",
+					x, i, contains, i, owner,
+				)
+			}
+		}
+	}
+	if rs := r.RangesOf(StringItem("qux")); rs != nil {
+		t.Fatalf("unexpected ranges of unknown item: %v", rs)
+	}
+
+	var single Ring
+	single.Insert(StringItem("foo"), 1)
+	if rs := single.RangesOf(StringItem("foo")); !reflect.DeepEqual(rs, []Range{{}}) {
+		t.Fatalf("unexpected ranges of the only item: %v", rs)
+	}
+}
+
+func TestRingRangesOfNoPoints(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 10000,
+		"bar": 1,
+	})
+	if n := len(r.PointsOf(StringItem("bar"))); n != 0 {
+		t.Fatalf("unexpected number of points of %q: %d; want 0", "bar", n)
+	}
+	if rs := r.RangesOf(StringItem("foo")); !reflect.DeepEqual(rs, []Range{{}}) {
+		t.Errorf("unexpected ranges of %q: %v; want the whole ring", "foo", rs)
+	}
+	if rs := r.RangesOf(StringItem("bar")); rs != nil {
+		t.Errorf("unexpected ranges of item without points: %v", rs)
+	}
+}
+
+func TestRingWalkRange(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 1,
+	})
+	ps := ringPoints(r)
+	for _, test := range []struct {
+		name     string
+		from, to uint64
+		exp      []*point
+	}{
+		{
+			name: "all",
+			from: ps[3].val.hi,
+			to:   ps[3].val.hi,
+			exp:  append(ps[3:], ps[:3]...),
+		},
+		{
+			name: "inner",
+			from: ps[1].val.hi,
+			to:   ps[4].val.hi,
+			exp:  ps[1:4],
+		},
+		{
+			name: "wrap",
+			from: ps[len(ps)-2].val.hi + 1,
+			to:   ps[1].val.hi + 1,
+			exp:  append(ps[len(ps)-1:], ps[:2]...),
+		},
+		{
+			name: "empty",
+			from: ps[1].val.hi + 1,
+			to:   ps[2].val.hi,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var act []PointInfo
+			r.WalkRange(test.from, test.to, func(p PointInfo) bool {
+				act = append(act, p)
+				return true
+			})
+			if n, m := len(act), len(test.exp); n != m {
+				t.Fatalf("unexpected number of points: %d; want %d", n, m)
+			}
+			for i, p := range test.exp {
+				if act[i] != p.info() {
+					t.Fatalf(
+						"unexpected #%d point: %+v; want %+v",
+						i, act[i], p.info(),
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestRingSetHash(t *testing.T) {
+	items := map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	}
+	r0 := makeRing(t, items)
+	if err := r0.SetHash(fnv.New64a); err != nil {
+		t.Fatal(err)
+	}
+	r1 := Ring{
+		Hash: fnv.New64a,
+	}
+	for s, w := range items {
+		if err := r1.Insert(StringItem(s), w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertRingsEqual(t, "rehashed ?= built", r0, &r1)
+
+	ps := ringPoints(r0)
+	err := r0.SetHash(func() hash.Hash64 {
+		return constHash(42)
+	})
+	if err == nil {
+		t.Fatalf("want items digest collision error; got nothing")
+	}
+	for i, p := range ringPoints(r0) {
+		if p != ps[i] {
+			t.Fatalf("ring changed after failed SetHash()")
+		}
+	}
+}
+
+func TestRingHash128(t *testing.T) {
+	// Build up a 128-bit hash function which high bits depend only on the
+	// item bytes, making all points of an item to collide in 64-bit hash
+	// space.
+	r := Ring{
+		Hash128: func() Hash128 {
+			return &prefixHash128{
+				n: 3,
+			}
+		},
+	}
+	applyActions(t, &r,
+		insertItem("foo", 1),
+		insertItem("bar", 1),
+	)
+	ps := ringPoints(&r)
+	if n := len(ps); n != 2*DefaultMagicFactor {
+		t.Fatalf("unexpected number of points: %d", n)
+	}
+	for _, p := range ps {
+		if g := p.generation(); g != 0 {
+			t.Fatalf("unexpected point generation: %d", g)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if item := r.Get(IntItem(i)); item == nil {
+			t.Fatalf("want item, but return empty")
+		}
+	}
+}
+
+func TestRingStrict(t *testing.T) {
+	r := Ring{
+		Strict: true,
+	}
+	if err := r.Insert(StringItem("foo"), 0); err == nil {
+		t.Errorf("want error on zero weight insert; got nothing")
+	}
+	if err := r.Insert(errItem("foo"), 1); err == nil {
+		t.Errorf("want error on malformed item insert; got nothing")
+	}
+	if err := r.Insert(StringItem("foo"), 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Update(StringItem("foo"), -1); err == nil {
+		t.Errorf("want error on negative weight update; got nothing")
+	}
+	if err := r.Delete(errItem("foo")); err == nil {
+		t.Errorf("want error on malformed item delete; got nothing")
+	}
+	if item := r.Get(errItem("foo")); item != nil {
+		t.Errorf("unexpected item for malformed key: %v", item)
+	}
+	if item := r.Get(StringItem("bar")); item == nil {
+		t.Errorf("want item, but return empty")
+	}
+}
+
+func applyActions(t testing.TB, r *Ring, actions ...ringAction) {
+	for _, a := range actions {
+		if err := a.apply(r); err != nil {
+			t.Fatalf("can't apply action %s: %v", a, err)
+		}
+	}
+}
+
+func makeRing(t testing.TB, keys map[string]float64, actions ...ringAction) *Ring {
+	var r Ring
+	for key, weight := range keys {
+		err := r.Insert(StringItem(key), weight)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	applyActions(t, &r, actions...)
+	return &r
+}
+
+func keyDistribution(r *Ring, fn func(Item, float64)) {
+	var (
+		prev float64
+		min  Item
+
+		temp = map[Item]float64{}
+	)
+	r.WalkRange(0, 0, func(p PointInfo) bool {
+		if min == nil {
+			min = p.Item
+		}
+		v := float64(p.Value)
+		d := v - prev
+		prev = v
+		temp[p.Item] += d
+		return true
+	})
+	if min == nil {
+		return
+	}
+
+	// All objects greater than the greatest point (prev hash value) fall into
+	// the item of the least point.
+	temp[min] += math.MaxUint64 - prev
+
+	for item, dist := range temp {
+		fn(item, dist/float64(math.MaxUint64))
+	}
+}
+
+func assertDistribution(t testing.TB, act, exp map[string]float64, prec float64) {
+	for key, act := range act {
+		exp := exp[key]
+		diff := act - exp
+		if math.Abs(diff) > prec {
+			t.Errorf(
+				"unexpected distribution for %q key: %.2f; want %.2f "+
+					"(±%.2f%%, diff is %+.2f%%))",
+				key, act, exp, prec, diff,
+			)
+		}
+	}
+}
+
+const mathMaxInt = int(^uint(0) >> 1) // math.MaxInt since Go 1.17.
+
+func getDistribution(t testing.TB, r *Ring, numGet int) map[string]float64 {
+	tmp := make(map[string]int)
+	act := make(map[string]float64)
+	for i := 0; i < numGet; i++ {
+		n := rand.Intn(mathMaxInt)
+		item := r.Get(IntItem(n))
+		if item == nil {
+			t.Fatalf("unexpected empty item")
+		}
+		tmp[string(item.(StringItem))] += 1
+	}
+	for key, num := range tmp {
+		act[key] = float64(num) / float64(numGet) * 100
+	}
+	return act
+}
+
+type ringAction interface {
+	apply(*Ring) error
+}
+
+func permActions(actions ...ringAction) (ret [][]ringAction) {
+	var f func(x ringAction, xs []ringAction) [][]ringAction
+	f = func(x ringAction, xs []ringAction) (ret [][]ringAction) {
+		if len(xs) == 0 {
+			return [][]ringAction{{x}}
+		}
+		for _, ps := range f(xs[0], xs[1:]) {
+			// Append current action to the end of received actions.
+			// Below we will swap it with every element in the slice.
+			ps = append(ps, x)
+
+			last := len(ps) - 1
+			for i := 0; i < len(ps); i++ {
+				cp := append(([]ringAction)(nil), ps...)
+				cp[i], cp[last] = cp[last], cp[i]
+				ret = append(ret, cp)
+			}
+		}
+		return ret
+	}
+	return f(actions[0], actions[1:])
+}
+
+type insertRingAction struct {
+	s string
+	w float64
+}
+
+func insertItem(s string, w float64) *insertRingAction {
+	return &insertRingAction{
+		s: s,
+		w: w,
+	}
+}
+
+func (i insertRingAction) String() string {
+	return fmt.Sprintf("insert %s~%.2f", i.s, i.w)
+}
+
+func (i insertRingAction) apply(r *Ring) error {
+	return r.Insert(StringItem(i.s), i.w)
+}
+
+type updateRingAction struct {
+	s string
+	w float64
+}
+
+func updateItem(s string, w float64) *updateRingAction {
+	return &updateRingAction{
+		s: s,
+		w: w,
+	}
+}
+
+func (i updateRingAction) String() string {
+	return fmt.Sprintf("update %s@%.2f", i.s, i.w)
+}
+
+func (i updateRingAction) apply(r *Ring) error {
+	return r.Update(StringItem(i.s), i.w)
+}
+
+type deleteRingAction struct {
+	s string
+}
+
+func deleteItem(s string) *deleteRingAction {
+	return &deleteRingAction{s}
+}
+
+func (d deleteRingAction) String() string {
+	return fmt.Sprintf("delete %s", d.s)
+}
+
+func (d deleteRingAction) apply(r *Ring) error {
+	return r.Delete(StringItem(d.s))
+}
+
+// ringPoints returns points of the ring in the same order as they are
+// visited by WalkRange(0, 0, fn). Unlike PointInfo, returned points hold full
+// (possibly 128-bit) values and may be compared by identity.
+func ringPoints(r *Ring) (ps []*point) {
+	r.load().walk(value{hi: math.MaxUint64, lo: math.MaxUint64}, func(p *point) bool {
+		ps = append(ps, p)
+		return true
+	})
+	return ps
+}
+
+func assertRingsEqual(t *testing.T, spec string, r0, r1 *Ring) {
+	ps0 := ringPoints(r0)
 	ps1 := ringPoints(r1)
 	if n0, n1 := len(ps0), len(ps1); n0 != n1 {
 		t.Fatalf("%s: sizes are not equal: %d vs %d", spec, n0, n1)
 	}
-	for i, p0 := range ps0 {
-		p1 := ps1[i]
-		if p0.val != p1.val {
-			t.Fatalf(
-				"%s: #%d-th point values are not equal: %d (%s) vs %d (%s)",
-				spec, i,
-				p0.val, p0.bucket.item,
-				p1.val, p1.bucket.item,
-			)
+	for i, p0 := range ps0 {
+		p1 := ps1[i]
+		if p0.val != p1.val {
+			t.Fatalf(
+				"%s: #%d-th point values are not equal: %d (%s) vs %d (%s)",
+				spec, i,
+				p0.val, p0.bucket.item,
+				p1.val, p1.bucket.item,
+			)
+		}
+		i0 := itemString(p0.bucket.item)
+		i1 := itemString(p1.bucket.item)
+		if i0 != i1 {
+			t.Fatalf(
+				"%s: #%d-th point buckets are not equal: %s vs %s",
+				spec, i, i0, i1,
+			)
+		}
+	}
+}
+
+func itemString(x Item) string {
+	var sb strings.Builder
+	_, err := x.WriteTo(&sb)
+	if err != nil {
+		panic(fmt.Sprintf("item WriteTo() error: %v", err))
+	}
+	return sb.String()
+}
+
+type StringItem string
+
+func (s StringItem) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(s))
+	return int64(n), err
+}
+
+// prefixHash128 is a Hash128 implementation which high bits are calculated
+// from the first n bytes written.
+type prefixHash128 struct {
+	hash64
+	n int
+}
+
+func (h *prefixHash128) Sum128() (hi, lo uint64) {
+	p := h.buf.Bytes()
+	n := h.n
+	if n > len(p) {
+		n = len(p)
+	}
+	return xxDigest(p[:n]), xxDigest(p)
+}
+
+type errItem string
+
+func (e errItem) WriteTo(io.Writer) (int64, error) {
+	return 0, fmt.Errorf("malformed item %q", string(e))
+}
+
+type IntItem int
+
+func (n IntItem) WriteTo(w io.Writer) (int64, error) {
+	m, err := w.Write(encodeSuffix(int(n)))
+	return int64(m), err
+}
+
+func TestRingCollisionPolicy(t *testing.T) {
+	newRing := func(c CollisionPolicy) *Ring {
+		return &Ring{
+			Hash: func() hash.Hash64 {
+				return maskHash{fnv.New64a(), 0xff}
+			},
+			MagicFactor: 32,
+			Collision:   c,
+		}
+	}
+	items := []string{"foo", "bar", "baz", "qux"}
+
+	t.Run("tie-break", func(t *testing.T) {
+		r0 := newRing(CollisionTieBreak)
+		r1 := newRing(CollisionTieBreak)
+		for i := range items {
+			if err := r0.Insert(StringItem(items[i]), 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := r1.Insert(StringItem(items[len(items)-i-1]), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(r0.collisions) == 0 {
+			t.Fatalf("no collisions provoked")
+		}
+		assertRingsEqual(t, "straight ?= reversed", r0, r1)
+		for _, p := range ringPoints(r0) {
+			if p.generation() != 0 {
+				t.Fatalf("point %d moved to generation %d", p.val, p.generation())
+			}
+		}
+
+		r2 := newRing(CollisionTieBreak)
+		for _, s := range items[1:] {
+			if err := r2.Insert(StringItem(s), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := r0.Delete(StringItem(items[0])); err != nil {
+			t.Fatal(err)
+		}
+		assertRingsEqual(t, "deleted ?= built", r0, r2)
+	})
+	t.Run("stable", func(t *testing.T) {
+		r0 := newRing(CollisionStable)
+		r1 := newRing(CollisionStable)
+		tb := newRing(CollisionTieBreak)
+		for i := range items {
+			if err := r0.Insert(StringItem(items[i]), 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := r1.Insert(StringItem(items[len(items)-i-1]), 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := tb.Insert(StringItem(items[i]), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(r0.collisions) != 0 {
+			t.Fatalf("unexpected collisions bookkeeping")
+		}
+		ps := ringPoints(r0)
+		if n, exp := len(ps), 32*len(items); n != exp {
+			t.Fatalf("unexpected number of points: %d; want %d", n, exp)
+		}
+		for i, p := range ps {
+			if p.generation() != 0 {
+				t.Fatalf("point %d moved to generation %d", p.val, p.generation())
+			}
+			if i > 0 && p.Compare(ps[i-1]) <= 0 {
+				t.Fatalf("points are not ordered: %d-th point is not greater than previous", i)
+			}
+		}
+		assertRingsEqual(t, "straight ?= reversed", r0, r1)
+		for i := 0; i < 1024; i++ {
+			k := IntItem(i)
+			if a, b := itemString(r0.Get(k)), itemString(tb.Get(k)); a != b {
+				t.Fatalf("Get(%d): stable and tie-break mappings differ: %s vs %s", i, a, b)
+			}
+		}
+
+		r2 := newRing(CollisionStable)
+		for _, s := range items[1:] {
+			if err := r2.Insert(StringItem(s), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := r0.Delete(StringItem(items[0])); err != nil {
+			t.Fatal(err)
+		}
+		assertRingsEqual(t, "deleted ?= built", r0, r2)
+	})
+	t.Run("error", func(t *testing.T) {
+		r := newRing(CollisionError)
+		var (
+			err  error
+			last Item
+		)
+		for _, s := range items {
+			last = StringItem(s)
+			if err = r.Insert(last, 1); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			t.Fatalf("want points collision error; got nothing")
+		}
+		ps := ringPoints(r)
+		n := r.Len()
+		if err := r.Insert(last, 1); err == nil {
+			t.Fatalf("want points collision error; got nothing")
+		}
+		if r.Len() != n {
+			t.Fatalf("ring changed after failed Insert()")
+		}
+		for i, p := range ringPoints(r) {
+			if p != ps[i] {
+				t.Fatalf("ring changed after failed Insert()")
+			}
+		}
+	})
+}
+
+func TestRingMaxGeneration(t *testing.T) {
+	var limits int
+	newRing := func() *Ring {
+		return &Ring{
+			Hash: func() hash.Hash64 {
+				return maskHash{fnv.New64a(), 0xff}
+			},
+			MagicFactor:   32,
+			MaxGeneration: 1,
+			Trace: RingTrace{
+				OnGenerationLimit: func(Item, int) {
+					limits++
+				},
+			},
+		}
+	}
+	var (
+		r     = newRing()
+		items []string
+		err   error
+	)
+	for i := 0; i < 10; i++ {
+		s := fmt.Sprintf("item%02d", i)
+		// Points are changed in place, so keep their info.
+		var ps []PointInfo
+		for _, p := range ringPoints(r) {
+			ps = append(ps, p.info())
 		}
-		i0 := itemString(p0.bucket.item)
-		i1 := itemString(p1.bucket.item)
-		if i0 != i1 {
-			t.Fatalf(
-				"%s: #%d-th point buckets are not equal: %s vs %s",
-				spec, i, i0, i1,
-			)
+		v := r.Version()
+		if err = r.Insert(StringItem(s), 1); err != nil {
+			if limits == 0 {
+				t.Fatalf("OnGenerationLimit hook was not called")
+			}
+			if r.Version() != v {
+				t.Fatalf("ring version changed after failed Insert()")
+			}
+			act := ringPoints(r)
+			if len(act) != len(ps) {
+				t.Fatalf("ring changed after failed Insert()")
+			}
+			for i := range ps {
+				if act[i].info() != ps[i] {
+					t.Fatalf("ring changed after failed Insert()")
+				}
+			}
+			break
+		}
+		items = append(items, s)
+	}
+	if err == nil {
+		t.Fatalf("want generation limit error; got nothing")
+	}
+
+	// Ring must stay consistent after failure.
+	if err := r.Delete(StringItem(items[0])); err != nil {
+		t.Fatal(err)
+	}
+	exp := newRing()
+	for _, s := range items[1:] {
+		if err := exp.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
 		}
 	}
+	assertRingsEqual(t, "deleted ?= built", r, exp)
 }
 
-func itemString(x Item) string {
-	var sb strings.Builder
-	_, err := x.WriteTo(&sb)
+func TestRingBuildSorted(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ring func() *Ring
+	}{
+		{
+			name: "default",
+			ring: func() *Ring {
+				return &Ring{MagicFactor: 64}
+			},
+		},
+		{
+			name: "collisions",
+			ring: func() *Ring {
+				return &Ring{
+					Hash: func() hash.Hash64 {
+						return maskHash{fnv.New64a(), 0xff}
+					},
+					MagicFactor: 32,
+				}
+			},
+		},
+		{
+			name: "stable",
+			ring: func() *Ring {
+				return &Ring{
+					Hash: func() hash.Hash64 {
+						return maskHash{fnv.New64a(), 0xff}
+					},
+					MagicFactor: 32,
+					Collision:   CollisionStable,
+				}
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			items := []string{"foo", "bar", "baz", "qux"}
+			var (
+				r0 = test.ring()
+				r1 = test.ring()
+			)
+			for _, s := range items {
+				if err := r0.Insert(StringItem(s), 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r1.Begin()
+			for _, s := range items {
+				if err := r1.Insert(StringItem(s), 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r1.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			assertRingsEqual(t, "inserted ?= committed", r0, r1)
+
+			if _, err := r0.SetMagicFactor(16); err != nil {
+				t.Fatal(err)
+			}
+			r2 := test.ring()
+			r2.MagicFactor = 16
+			for _, s := range items {
+				if err := r2.Insert(StringItem(s), 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			assertRingsEqual(t, "changed ?= inserted", r0, r2)
+		})
+	}
+}
+
+func BenchmarkRingCommit(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var r Ring
+				r.Begin()
+				for j := 0; j < n; j++ {
+					r.Insert(IntItem(j), 1)
+				}
+				r.Commit()
+			}
+		})
+	}
+}
+
+func TestRingSetMagicFactor(t *testing.T) {
+	items := map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	}
+	r0 := makeRing(t, items)
+	moved, err := r0.SetMagicFactor(10)
 	if err != nil {
-		panic(fmt.Sprintf("item WriteTo() error: %v", err))
+		t.Fatal(err)
+	}
+	if moved <= 0 || moved >= 1 {
+		t.Fatalf("unexpected moved fraction: %f", moved)
+	}
+	r1 := Ring{
+		MagicFactor: 10,
+	}
+	for s, w := range items {
+		if err := r1.Insert(StringItem(s), w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertRingsEqual(t, "changed ?= built", r0, &r1)
+
+	if moved, _ = r0.SetMagicFactor(10); moved != 0 {
+		t.Fatalf("unexpected moved fraction for the same factor: %f", moved)
+	}
+	r0.Strict = true
+	if _, err := r0.SetMagicFactor(-1); err == nil {
+		t.Fatalf("want error; got nothing")
 	}
-	return sb.String()
 }
 
-type StringItem string
+func TestRingLoads(t *testing.T) {
+	r := Ring{
+		CountLoads: true,
+	}
+	for _, s := range []string{"foo", "bar", "baz"} {
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exp := make(map[Item]uint64)
+	for i := 0; i < 1000; i++ {
+		exp[r.Get(IntItem(i))]++
+	}
+	act := make(map[Item]uint64)
+	for _, l := range r.Loads() {
+		act[l.Item] = l.Count
+	}
+	if !reflect.DeepEqual(act, exp) {
+		t.Fatalf("unexpected loads: %v; want %v", act, exp)
+	}
+	// Items which can't be used as map keys are counted as well.
+	x := sliceItem("qux")
+	if err := r.Insert(x, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Loads()); n != 4 {
+		t.Fatalf("unexpected number of loads: %d; want 4", n)
+	}
 
-func (s StringItem) WriteTo(w io.Writer) (int64, error) {
-	n, err := io.WriteString(w, string(s))
+	var r0 Ring
+	if err := r0.Insert(StringItem("foo"), 1); err != nil {
+		t.Fatal(err)
+	}
+	r0.Get(IntItem(42))
+	if ls := r0.Loads(); ls != nil {
+		t.Fatalf("unexpected loads: %v; want nil", ls)
+	}
+}
+
+// sliceItem is an item which can't be used as a map key.
+type sliceItem []byte
+
+func (s sliceItem) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(s)
 	return int64(n), err
 }
 
-type IntItem int
+func TestRingPin(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 1,
+		"baz": 1,
+	})
+	key := StringItem("user01")
+	var target Item
+	for _, s := range []string{"foo", "bar", "baz"} {
+		if x := StringItem(s); x != r.Get(key) {
+			target = x
+		}
+	}
+	if err := r.Pin(key, target); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Pin(key, StringItem("qux")); err == nil {
+		t.Fatalf("want error on pin to not existing item")
+	}
+	if x := r.Get(key); x != target {
+		t.Fatalf("Get() = %v; want pinned %v", x, target)
+	}
+	if xs := r.GetN(key, 2); len(xs) != 2 || xs[0] != target || xs[1] == target {
+		t.Fatalf("GetN() = %v; want pinned %v first", xs, target)
+	}
+	if x, rng := r.Owner(key); x != target || rng != (Range{}) {
+		t.Fatalf("Owner() = %v, %v; want pinned %v with zero range", x, rng, target)
+	}
+	// Pins survive ring mutations.
+	if err := r.Insert(StringItem("qux"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if x := r.Get(key); x != target {
+		t.Fatalf("Get() = %v; want pinned %v", x, target)
+	}
+	if err := r.SetHash(fnv.New64a); err != nil {
+		t.Fatal(err)
+	}
+	if x := r.Get(key); x != target {
+		t.Fatalf("Get() = %v after SetHash(); want pinned %v", x, target)
+	}
+	if err := r.Unpin(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Unpin(key); err == nil {
+		t.Fatalf("want error on unpin of not pinned key")
+	}
+	if err := r.Pin(key, target); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(target); err != nil {
+		t.Fatal(err)
+	}
+	if x := r.Get(key); x == target {
+		t.Fatalf("Get() = %v; want pin removed with its target", x)
+	}
+}
 
-func (n IntItem) WriteTo(w io.Writer) (int64, error) {
-	m, err := w.Write(encodeSuffix(int(n)))
-	return int64(m), err
+func TestRingChangesSince(t *testing.T) {
+	r := Ring{
+		ChangeLog: 2,
+	}
+	if v := r.Version(); v != 0 {
+		t.Fatalf("unexpected initial version: %d", v)
+	}
+	if err := r.Insert(StringItem("foo"), 1); err != nil {
+		t.Fatal(err)
+	}
+	r.Begin()
+	r.Insert(StringItem("bar"), 2)
+	r.Delete(StringItem("foo"))
+	if v := r.Version(); v != 1 {
+		t.Fatalf("version changed by staged mutations: %d", v)
+	}
+	r.Commit()
+	if _, err := r.SetMagicFactor(10); err != nil {
+		t.Fatal(err)
+	}
+	if v := r.Version(); v != 3 {
+		t.Fatalf("unexpected version: %d; want 3", v)
+	}
+	if _, ok := r.ChangesSince(0); ok {
+		t.Fatalf("want evicted change sets to be reported")
+	}
+	cs, ok := r.ChangesSince(1)
+	if !ok {
+		t.Fatalf("want change sets since version 1")
+	}
+	exp := []ChangeSet{
+		{Version: 2, Changes: []Change{
+			{StringItem("bar"), 2},
+			{StringItem("foo"), 0},
+		}},
+		{Version: 3},
+	}
+	if !reflect.DeepEqual(cs, exp) {
+		t.Fatalf("unexpected change sets: %+v; want %+v", cs, exp)
+	}
+	if cs, ok := r.ChangesSince(3); !ok || len(cs) != 0 {
+		t.Fatalf("unexpected change sets since current version: %+v", cs)
+	}
+}
+
+func TestRingRollback(t *testing.T) {
+	type pointState struct {
+		val  value
+		gen  int
+		item string
+	}
+	state := func(r *Ring) (ps []pointState) {
+		for _, p := range ringPoints(r) {
+			ps = append(ps, pointState{
+				val:  p.val,
+				gen:  p.generation(),
+				item: itemString(p.bucket.item),
+			})
+		}
+		return ps
+	}
+	r := Ring{
+		Hash: func() hash.Hash64 {
+			return maskHash{fnv.New64a(), 0xff}
+		},
+		MagicFactor: 32,
+	}
+	for _, s := range []string{"foo", "bar", "baz"} {
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(r.collisions) == 0 {
+		t.Fatalf("no collisions provoked")
+	}
+	for _, mutate := range []func() error{
+		func() error { return r.Update(StringItem("foo"), 3) },
+		func() error { return r.Delete(StringItem("bar")) },
+		func() error { return r.Insert(StringItem("qux"), 2) },
+		func() error { _, err := r.SetMagicFactor(16); return err },
+	} {
+		exp := state(&r)
+		if err := mutate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if act := state(&r); !reflect.DeepEqual(act, exp) {
+			t.Fatalf("ring differs after rollback")
+		}
+		if err := r.Rollback(); err == nil {
+			t.Fatalf("want error on second Rollback()")
+		}
+	}
+}
+
+func TestRingGetReplicas(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	})
+	for i := 0; i < 1000; i++ {
+		key := IntItem(i)
+		rs := r.GetReplicas(key, 5)
+		exp := r.GetN(key, 5)
+		if n := len(rs); n != len(exp) {
+			t.Fatalf("unexpected number of replicas: %d; want %d", n, len(exp))
+		}
+		for j, x := range rs {
+			if x.Item != exp[j] {
+				t.Fatalf("unexpected #%d replica: %v; want %v", j, x.Item, exp[j])
+			}
+			if j > 0 && x.Distance <= rs[j-1].Distance {
+				t.Fatalf("replicas are not ordered by distance: %+v", rs)
+			}
+		}
+		_, rng := r.Owner(key)
+		if act, exp := rs[0].Distance, rng.End-r.digest(key).hi; act != exp {
+			t.Fatalf("unexpected primary distance: %d; want %d", act, exp)
+		}
+	}
+	if err := r.Pin(IntItem(0), StringItem("foo")); err != nil {
+		t.Fatal(err)
+	}
+	rs := r.GetReplicas(IntItem(0), 1)
+	if len(rs) != 1 || !rs[0].Pinned || rs[0].Item != StringItem("foo") {
+		t.Fatalf("unexpected replicas of pinned key: %+v", rs)
+	}
+}
+
+func TestRingDeleteReport(t *testing.T) {
+	r := &Ring{
+		Hash: func() hash.Hash64 {
+			return maskHash{fnv.New64a(), 0xff}
+		},
+		MagicFactor: 32,
+	}
+	for _, s := range []string{"foo", "bar", "baz", "qux"} {
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var (
+		x     = StringItem("foo")
+		share = r.LoadShare(x)
+		moved float64
+	)
+	r.OnRelocation = func(moves []RangeMove) {
+		for _, m := range moves {
+			moved += partitionSize(m.Range)
+		}
+	}
+	sum, err := r.DeleteReport(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Removed != 32 || sum.Added != 0 {
+		t.Errorf("unexpected number of points changed: %+v", sum)
+	}
+	if sum.Restored == 0 {
+		t.Errorf("no twins restored: %+v", sum)
+	}
+	if exp := moved / math.Exp2(64); sum.Moved != exp {
+		t.Errorf("unexpected moved fraction: %v; want %v", sum.Moved, exp)
+	}
+	if sum.Moved < share {
+		t.Errorf("moved fraction is less than item's share: %v < %v", sum.Moved, share)
+	}
+	if _, err := r.DeleteReport(x); err == nil {
+		t.Errorf("no error for missing item")
+	}
+}
+
+func TestRingCopy(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+	})
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("no panic on mutation of the copied ring")
+		}
+	}()
+	// Copy the ring through reflection to not make go vet complain.
+	cp := new(Ring)
+	reflect.ValueOf(cp).Elem().Set(reflect.ValueOf(r).Elem())
+	cp.Insert(StringItem("bar"), 1)
+}
+
+func TestRingAllocateExact(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		weights map[string]float64
+		exp     map[string]int
+	}{
+		{
+			name:    "double",
+			weights: map[string]float64{"foo": 2, "bar": 1},
+			exp:     map[string]int{"foo": 1360, "bar": 680},
+		},
+		{
+			name:    "ratio",
+			weights: map[string]float64{"foo": 7, "bar": 3, "baz": 3},
+			exp:     map[string]int{"foo": 1645, "bar": 705, "baz": 705},
+		},
+		{
+			// Sum of weights exceeds the budget, so points are allocated by
+			// largest remainder.
+			name:    "remainder",
+			weights: map[string]float64{"foo": 1000, "bar": 1000, "baz": 1101},
+			exp:     map[string]int{"foo": 987, "bar": 987, "baz": 1086},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := Ring{
+				Allocation: AllocateExact,
+			}
+			for s, w := range test.weights {
+				if err := r.Insert(StringItem(s), w); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for s, exp := range test.exp {
+				if act := len(r.PointsOf(StringItem(s))); act != exp {
+					t.Errorf("unexpected number of %q points: %d; want %d", s, act, exp)
+				}
+			}
+			if err := r.Verify(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	t.Run("non-integer", func(t *testing.T) {
+		r := Ring{
+			Allocation: AllocateExact,
+			Strict:     true,
+		}
+		if err := r.Insert(StringItem("foo"), 1.5); err == nil {
+			t.Fatalf("no error for non-integer weight")
+		}
+	})
+}
+
+func TestRingPointAllocator(t *testing.T) {
+	weights := map[string]float64{
+		"foo": 1,
+		"bar": 10,
+		"baz": 1000,
+	}
+	t.Run("linear", func(t *testing.T) {
+		r0 := makeRing(t, weights)
+		r1 := Ring{
+			Allocator: LinearAllocator{},
+		}
+		for s, w := range weights {
+			if err := r1.Insert(StringItem(s), w); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for s := range weights {
+			x := StringItem(s)
+			if act, exp := r1.PointsOf(x), r0.PointsOf(x); !reflect.DeepEqual(act, exp) {
+				t.Errorf("unexpected points of %q: %v; want %v", s, act, exp)
+			}
+		}
+	})
+	t.Run("log", func(t *testing.T) {
+		var states []AllocationState
+		r := Ring{
+			Allocator: PointAllocatorFunc(func(w float64, s AllocationState) int {
+				states = append(states, s)
+				return int(s.MagicFactor * (1 + math.Log10(w)) / (1 + math.Log10(s.MaxWeight)))
+			}),
+			MagicFactor: 100,
+		}
+		for s, w := range weights {
+			if err := r.Insert(StringItem(s), w); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for s, exp := range map[string]int{"foo": 25, "bar": 50, "baz": 100} {
+			if act := len(r.PointsOf(StringItem(s))); act != exp {
+				t.Errorf("unexpected number of %q points: %d; want %d", s, act, exp)
+			}
+		}
+		exp := AllocationState{
+			MagicFactor: 100,
+			MinWeight:   1,
+			MaxWeight:   1000,
+			TotalWeight: 1011,
+			Items:       3,
+		}
+		if act := states[len(states)-1]; act != exp {
+			t.Errorf("unexpected allocation state: %+v; want %+v", act, exp)
+		}
+		if err := r.Verify(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestRingMinPoints(t *testing.T) {
+	var (
+		foo = StringItem("foo")
+		bar = StringItem("bar")
+		r   Ring
+	)
+	r.MinPoints = 64
+	if err := r.Insert(foo, 10000); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Insert(bar, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.PointsOf(bar)); n != 64 {
+		t.Errorf("unexpected number of points: %d; want 64", n)
+	}
+	if n := len(r.PointsOf(foo)); n != DefaultMagicFactor {
+		t.Errorf("unexpected number of points: %d; want %d", n, DefaultMagicFactor)
+	}
+	if n := r.Clamped(); n != 1 {
+		t.Errorf("unexpected number of clamped items: %d; want 1", n)
+	}
+	if err := r.Update(bar, 5000); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Clamped(); n != 0 {
+		t.Errorf("unexpected number of clamped items: %d; want 0", n)
+	}
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRingAdjustWeight(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 1,
+	})
+	foo := StringItem("foo")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.AdjustWeight(foo, 0.5); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if w, _ := r.Weight(foo); w != 6 {
+		t.Fatalf("unexpected weight: %v; want 6", w)
+	}
+	w, err := r.AdjustWeight(foo, -6)
+	if err == nil {
+		t.Fatalf("no error for non-positive weight")
+	}
+	if w != 6 {
+		t.Fatalf("unexpected weight after error: %v; want 6", w)
+	}
+	if w, err = r.AdjustWeight(foo, -5); err != nil || w != 1 {
+		t.Fatalf("unexpected result: %v, %v; want 1", w, err)
+	}
+	if _, err := r.AdjustWeight(StringItem("baz"), 1); err == nil {
+		t.Fatalf("no error for missing item")
+	}
 }
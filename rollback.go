@@ -0,0 +1,77 @@
+package hashring
+
+import (
+	"fmt"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// Rollback reverts the most recent mutation of the ring, such as Insert(),
+// Update(), Delete(), SetWeights(), SetMagicFactor() or Commit(). Points of
+// the ring, including their generations, become exactly the same as they were
+// before the mutation. Rollback itself is a mutation, that is, it increases
+// the ring version and calls r.OnRelocation.
+//
+// Only one mutation can be reverted: calling Rollback() twice in a row
+// returns an error. It also returns non-nil error if the ring is in deferred
+// mode, if the most recent mutation was made by SetHash() or if some point of
+// the previous version exceeds r.MaxGeneration.
+func (r *Ring) Rollback() error {
+	r.lock()
+	defer r.mu.Unlock()
+
+	if r.deferred {
+		return fmt.Errorf("hashring: can't roll back in deferred mode")
+	}
+	prev := r.undo
+	if prev == nil {
+		return fmt.Errorf("hashring: nothing to roll back")
+	}
+	cur := r.current()
+	if prev.hasher != cur.hasher {
+		return fmt.Errorf("hashring: can't roll back hash function change")
+	}
+	buckets := make(map[uint64]*bucket, len(prev.members))
+	for id, m := range prev.members {
+		b := r.newBucket(id, m.key, m.item, m.weight)
+		b.meta = m.meta
+		b.loads = m.loads
+		buckets[id] = b
+	}
+	var (
+		prevTombs       = r.tombs
+		prevBuckets     = r.buckets
+		prevCollisions  = r.collisions
+		prevMagicFactor = r.conf.MagicFactor
+	)
+	r.buckets = buckets
+	r.tombs = prev.tombs
+	r.collisions = nil
+	r.conf.MagicFactor = prev.magicFactor
+	r.resetWeights()
+
+	// Ring's points don't depend on the order of mutations, thus building
+	// the previous version from scratch gives exactly the same points.
+	before := r.marks(cur.tree)
+	done := r.traceRebuild(cur.tree.Size())
+	// All points are replaced with the new ones.
+	r.removed = cur.tree.Size()
+	tree, err := r.build(cur.hasher, avl.Tree{})
+	done()
+	if err != nil {
+		// Points of the current buckets are left untouched.
+		r.buckets = prevBuckets
+		r.tombs = prevTombs
+		r.collisions = prevCollisions
+		r.conf.MagicFactor = prevMagicFactor
+		r.fix.Init()
+		r.resetWeights()
+		return err
+	}
+	r.MagicFactor = r.conf.MagicFactor
+	r.publish(cur.hasher, tree)
+	r.relocate(before)
+	r.undo = nil
+
+	return nil
+}
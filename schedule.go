@@ -0,0 +1,153 @@
+package hashring
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ScheduledWeight describes a pending weight change made by ScheduleWeight().
+type ScheduledWeight struct {
+	// ID identifies the change. It may be passed to CancelWeight().
+	ID uint64
+
+	// Item is the item which weight is going to be changed.
+	Item Item
+
+	// Weight is the new weight of the item.
+	Weight float64
+
+	// At is the time when the change is due.
+	At time.Time
+
+	// Probation is true if the change ends the item's probation (see
+	// Ring.Probation).
+	Probation bool
+
+	// digest is the non-suffixed digest of the item.
+	digest uint64
+}
+
+// ScheduleWeight schedules the change of item's x weight to w at the given
+// time, e.g. to shift traffic during a maintenance window. The change is
+// applied by the first Tick() call made at or after that time. It returns the
+// id of the change, which may be passed to CancelWeight().
+//
+// It returns non-nil error when x doesn't exist on the ring.
+// If weight is less or equal to zero ScheduleWeight() panics (or returns an
+// error if r.Strict is true).
+func (r *Ring) ScheduleWeight(x Item, w float64, at time.Time) (uint64, error) {
+	if err := r.checkWeight(w); err != nil {
+		return 0, err
+	}
+	r.lock()
+	defer r.mu.Unlock()
+
+	id, err := r.itemDigest(x)
+	if err != nil {
+		return 0, err
+	}
+	if b, has := r.buckets[id]; !has || b.weight == 0 {
+		return 0, fmt.Errorf("hashring: item doesn't exist")
+	}
+	return r.schedule(ScheduledWeight{
+		Item:   x,
+		Weight: w,
+		At:     at,
+		digest: id,
+	}), nil
+}
+
+// schedule adds weight change s to the pending ones and returns its id.
+//
+// r.mu must be held.
+func (r *Ring) schedule(s ScheduledWeight) uint64 {
+	r.scheduleID++
+	s.ID = r.scheduleID
+
+	// Keep changes ordered by time and then by id, so changes of the same
+	// item due at the same time are applied in order of scheduling.
+	i := sort.Search(len(r.schedules), func(i int) bool {
+		return r.schedules[i].At.After(s.At)
+	})
+	r.schedules = append(r.schedules, ScheduledWeight{})
+	copy(r.schedules[i+1:], r.schedules[i:])
+	r.schedules[i] = s
+
+	return s.ID
+}
+
+// Schedules returns pending weight changes ordered by their time.
+func (r *Ring) Schedules() []ScheduledWeight {
+	r.lock()
+	defer r.mu.Unlock()
+	return append([]ScheduledWeight(nil), r.schedules...)
+}
+
+// CancelWeight cancels the pending weight change having the given id. It
+// returns false if there is no such change, e.g. if it's already applied.
+func (r *Ring) CancelWeight(id uint64) bool {
+	r.lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.schedules {
+		if s.ID == id {
+			r.schedules = append(r.schedules[:i], r.schedules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Tick applies weight changes due at the given time, rebuilding the ring once
+// for all of them. If there are multiple changes of the same item, the latest
+// one wins. Changes of the items which left the ring are dropped.
+// It returns the number of items which weights were changed.
+//
+// It returns non-nil error when new points of the ring collide and r.Collision
+// is CollisionError. In that case the changes are left pending and are
+// retried by the next Tick() call.
+func (r *Ring) Tick(now time.Time) (int, error) {
+	r.lock()
+	defer r.mu.Unlock()
+
+	n := sort.Search(len(r.schedules), func(i int) bool {
+		return r.schedules[i].At.After(now)
+	})
+	if n == 0 {
+		return 0, nil
+	}
+	bs := make(map[*bucket]float64, n)
+	for _, s := range r.schedules[:n] {
+		if b, has := r.buckets[s.digest]; has && b.weight != 0 {
+			bs[b] = s.Weight
+		}
+	}
+	if len(bs) > 0 {
+		if err := r.setWeights(bs); err != nil {
+			return 0, err
+		}
+	}
+	r.schedules = append(r.schedules[:0], r.schedules[n:]...)
+
+	return len(bs), nil
+}
+
+// RunSchedules calls Tick() with the given interval until ctx is done. The
+// onError function, if non-nil, is called when Tick() fails.
+// It returns the ctx error.
+func (r *Ring) RunSchedules(ctx context.Context, interval time.Duration, onError func(error)) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-t.C:
+			if _, err := r.Tick(now); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package hashring
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRingScheduleWeight(t *testing.T) {
+	var (
+		foo = StringItem("foo")
+		bar = StringItem("bar")
+		baz = StringItem("baz")
+		now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 1,
+		"baz": 1,
+	})
+	schedule := func(x Item, w float64, d time.Duration) uint64 {
+		id, err := r.ScheduleWeight(x, w, now.Add(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	schedule(foo, 2, 2*time.Hour)
+	schedule(foo, 3, time.Hour)
+	schedule(bar, 4, time.Hour)
+	cancel := schedule(baz, 5, time.Hour)
+	schedule(baz, 6, 3*time.Hour)
+
+	if _, err := r.ScheduleWeight(StringItem("qux"), 1, now); err == nil {
+		t.Fatalf("no error for unknown item")
+	}
+	ss := r.Schedules()
+	if n := len(ss); n != 5 {
+		t.Fatalf("unexpected number of schedules: %d", n)
+	}
+	for i := 1; i < len(ss); i++ {
+		if ss[i].At.Before(ss[i-1].At) {
+			t.Fatalf("schedules are not ordered: %v", ss)
+		}
+	}
+	if !r.CancelWeight(cancel) {
+		t.Fatalf("can't cancel schedule")
+	}
+	if r.CancelWeight(cancel) {
+		t.Fatalf("schedule canceled twice")
+	}
+
+	tick := func(d time.Duration, n int, exp map[Item]float64, pending int) {
+		t.Helper()
+		act, err := r.Tick(now.Add(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if act != n {
+			t.Errorf("Tick(+%s) changed %d items; want %d", d, act, n)
+		}
+		for x, exp := range exp {
+			if w, _ := r.Weight(x); w != exp {
+				t.Errorf("Tick(+%s): unexpected weight of %v: %v; want %v", d, x, w, exp)
+			}
+		}
+		if act := len(r.Schedules()); act != pending {
+			t.Errorf("Tick(+%s): %d pending schedules; want %d", d, act, pending)
+		}
+	}
+	v := r.Version()
+	tick(0, 0, map[Item]float64{foo: 1, bar: 1, baz: 1}, 4)
+	if r.Version() != v {
+		t.Fatalf("ring is changed by Tick() having no due changes")
+	}
+	tick(time.Hour, 2, map[Item]float64{foo: 3, bar: 4, baz: 1}, 2)
+	if r.Version() != v+1 {
+		t.Fatalf("ring is rebuilt more than once by Tick()")
+	}
+	// Item left the ring, thus its change is dropped.
+	if err := r.Delete(baz); err != nil {
+		t.Fatal(err)
+	}
+	tick(4*time.Hour, 1, map[Item]float64{foo: 2, bar: 4, baz: 0}, 0)
+}
+
+func TestRingRunSchedules(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+	})
+	if _, err := r.ScheduleWeight(StringItem("foo"), 2, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.RunSchedules(ctx, time.Millisecond, nil)
+	}()
+	for len(r.Schedules()) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w, _ := r.Weight(StringItem("foo")); w != 2 {
+		t.Fatalf("unexpected weight: %v; want 2", w)
+	}
+}
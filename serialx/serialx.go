@@ -0,0 +1,233 @@
+// Package serialx provides a migration shim mirroring the API of the
+// github.com/serialx/hashring package.
+//
+// HashRing created by New() or NewWithWeights() is backed by the
+// hashring.Ring, thus nodes are mapped differently than by the original
+// package. HashRing created by NewCompat() or NewCompatWithWeights() instead
+// reproduces the hashing scheme of the original package (MD5 based, with 40
+// points per node scaled by weight), so mappings of the keys are preserved
+// while the code base is migrated.
+//
+// Like in the original package, HashRing is immutable: methods changing nodes
+// return a new HashRing.
+package serialx
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/gobwas/hashring"
+)
+
+// HashRing is a consistent hashing ring of the nodes.
+type HashRing struct {
+	compat  bool
+	nodes   []string
+	weights map[string]int
+
+	// ring is used when compat is false.
+	ring *hashring.Ring
+
+	// keys and owners are used when compat is true.
+	keys   []uint32
+	owners map[uint32]string
+}
+
+// New creates a ring of the nodes having weight of 1.
+func New(nodes []string) *HashRing {
+	return newRing(false, nodes, nil)
+}
+
+// NewWithWeights creates a ring of the weighted nodes.
+func NewWithWeights(weights map[string]int) *HashRing {
+	return newRing(false, sortedNodes(weights), weights)
+}
+
+// NewCompat is like New() but the ring maps keys the same way as the
+// original package does.
+func NewCompat(nodes []string) *HashRing {
+	return newRing(true, nodes, nil)
+}
+
+// NewCompatWithWeights is like NewWithWeights() but the ring maps keys the
+// same way as the original package does.
+func NewCompatWithWeights(weights map[string]int) *HashRing {
+	return newRing(true, sortedNodes(weights), weights)
+}
+
+func newRing(compat bool, nodes []string, weights map[string]int) *HashRing {
+	h := &HashRing{
+		compat:  compat,
+		nodes:   append([]string(nil), nodes...),
+		weights: make(map[string]int, len(nodes)),
+	}
+	for _, node := range h.nodes {
+		w, has := weights[node]
+		if !has {
+			w = 1
+		}
+		h.weights[node] = w
+	}
+	if compat {
+		h.generateCircle()
+	} else {
+		h.ring = new(hashring.Ring)
+		h.ring.Begin()
+		for _, node := range h.nodes {
+			if w := h.weights[node]; w > 0 {
+				_ = h.ring.Insert(member(node), float64(w))
+			}
+		}
+		// Constructors of the original package don't return errors, and the
+		// ring can't be used if it's left in deferred mode.
+		if err := h.ring.Commit(); err != nil {
+			panic(fmt.Sprintf("serialx: can't build the ring: %v", err))
+		}
+	}
+	return h
+}
+
+// Size returns the number of nodes of the ring.
+func (h *HashRing) Size() int {
+	return len(h.nodes)
+}
+
+// GetNode returns the node which key is mapped to.
+// It returns false if the ring is empty.
+func (h *HashRing) GetNode(key string) (node string, ok bool) {
+	nodes, ok := h.GetNodes(key, 1)
+	if !ok {
+		return "", false
+	}
+	return nodes[0], true
+}
+
+// GetNodes returns size distinct nodes which key is mapped to.
+// It returns false if the ring has less than size nodes.
+func (h *HashRing) GetNodes(key string, size int) (nodes []string, ok bool) {
+	if size > len(h.nodes) || size <= 0 {
+		return nil, false
+	}
+	if !h.compat {
+		for _, x := range h.ring.GetN(member(key), size) {
+			nodes = append(nodes, string(x.(member)))
+		}
+		return nodes, len(nodes) == size
+	}
+	if len(h.keys) == 0 {
+		return nil, false
+	}
+	d := md5.Sum([]byte(key))
+	k := hashVal(d[:4])
+	pos := sort.Search(len(h.keys), func(i int) bool {
+		return h.keys[i] > k
+	})
+	seen := make(map[string]bool, size)
+	for i := 0; i < len(h.keys) && len(nodes) < size; i++ {
+		node := h.owners[h.keys[(pos+i)%len(h.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, len(nodes) == size
+}
+
+// AddNode returns a new ring with node added with weight of 1.
+func (h *HashRing) AddNode(node string) *HashRing {
+	return h.AddWeightedNode(node, 1)
+}
+
+// AddWeightedNode returns a new ring with node added with weight w. It
+// returns h if node already exists or w is not positive.
+func (h *HashRing) AddWeightedNode(node string, w int) *HashRing {
+	if _, has := h.weights[node]; has || w <= 0 {
+		return h
+	}
+	return h.with(append(append([]string(nil), h.nodes...), node), node, w)
+}
+
+// UpdateWeightedNode returns a new ring with weight of the node changed to w.
+// It returns h if node doesn't exist or w is not positive.
+func (h *HashRing) UpdateWeightedNode(node string, w int) *HashRing {
+	if _, has := h.weights[node]; !has || w <= 0 {
+		return h
+	}
+	return h.with(h.nodes, node, w)
+}
+
+// RemoveNode returns a new ring without the node. It returns h if node
+// doesn't exist.
+func (h *HashRing) RemoveNode(node string) *HashRing {
+	if _, has := h.weights[node]; !has {
+		return h
+	}
+	nodes := make([]string, 0, len(h.nodes)-1)
+	for _, n := range h.nodes {
+		if n != node {
+			nodes = append(nodes, n)
+		}
+	}
+	return h.with(nodes, "", 0)
+}
+
+// with returns a new ring of the nodes having the same weights as in h,
+// except the node which gets weight w.
+func (h *HashRing) with(nodes []string, node string, w int) *HashRing {
+	weights := make(map[string]int, len(nodes))
+	for _, n := range nodes {
+		weights[n] = h.weights[n]
+	}
+	if node != "" {
+		weights[node] = w
+	}
+	return newRing(h.compat, nodes, weights)
+}
+
+// generateCircle places points of the nodes as the original package does.
+// Note that only three of four words of each MD5 digest are used, and that
+// the point of the later node wins on collision.
+func (h *HashRing) generateCircle() {
+	var total int
+	for _, node := range h.nodes {
+		total += h.weights[node]
+	}
+	h.owners = make(map[uint32]string)
+	for _, node := range h.nodes {
+		factor := math.Floor(float64(40*len(h.nodes)*h.weights[node]) / float64(total))
+		for j := 0; j < int(factor); j++ {
+			d := md5.Sum([]byte(fmt.Sprintf("%s-%d", node, j)))
+			for i := 0; i < 3; i++ {
+				k := hashVal(d[i*4 : i*4+4])
+				h.owners[k] = node
+				h.keys = append(h.keys, k)
+			}
+		}
+	}
+	sort.Slice(h.keys, func(i, j int) bool {
+		return h.keys[i] < h.keys[j]
+	})
+}
+
+func hashVal(b []byte) uint32 {
+	return uint32(b[3])<<24 | uint32(b[2])<<16 | uint32(b[1])<<8 | uint32(b[0])
+}
+
+func sortedNodes(weights map[string]int) []string {
+	nodes := make([]string, 0, len(weights))
+	for node := range weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+type member string
+
+func (m member) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(m))
+	return int64(n), err
+}
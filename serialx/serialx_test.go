@@ -0,0 +1,67 @@
+package serialx
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashRing(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		new  func(map[string]int) *HashRing
+	}{
+		{"ring", NewWithWeights},
+		{"compat", NewCompatWithWeights},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h := test.new(map[string]int{
+				"a": 1,
+				"b": 1,
+				"c": 1,
+			})
+			if n := h.Size(); n != 3 {
+				t.Fatalf("unexpected size: %d", n)
+			}
+			if _, ok := h.GetNodes("key", 4); ok {
+				t.Fatalf("want GetNodes() to fail for size greater than ring size")
+			}
+			nodes, ok := h.GetNodes("key", 3)
+			if !ok || len(nodes) != 3 {
+				t.Fatalf("unexpected GetNodes() result: %v, %v", nodes, ok)
+			}
+			if node, _ := h.GetNode("key"); node != nodes[0] {
+				t.Fatalf("GetNode() = %q; want %q", node, nodes[0])
+			}
+			h1 := h.RemoveNode("b")
+			if h.Size() != 3 || h1.Size() != 2 {
+				t.Fatalf("ring is mutated by RemoveNode()")
+			}
+			for i := 0; i < 1000; i++ {
+				k := strconv.Itoa(i)
+				n0, _ := h.GetNode(k)
+				n1, _ := h1.GetNode(k)
+				if n0 != "b" && n0 != n1 {
+					t.Fatalf("key %q moved from %q to %q", k, n0, n1)
+				}
+			}
+			if h2 := h1.AddWeightedNode("b", 2); h2.Size() != 3 {
+				t.Fatalf("unexpected size after AddWeightedNode(): %d", h2.Size())
+			}
+			if h2 := h.UpdateWeightedNode("b", 2); h2.weights["b"] != 2 || h.weights["b"] != 1 {
+				t.Fatalf("unexpected weights after UpdateWeightedNode()")
+			}
+		})
+	}
+}
+
+func TestHashRingCompatPoints(t *testing.T) {
+	h := NewCompat([]string{"a", "b"})
+	// Each node gets 40 * 2 nodes * 1 / 2 = 40 digests of 3 points each.
+	if n := len(h.keys); n != 2*40*3 {
+		t.Fatalf("unexpected number of points: %d", n)
+	}
+	var empty HashRing
+	if _, ok := empty.GetNode("key"); ok {
+		t.Fatalf("want GetNode() to fail on empty ring")
+	}
+}
@@ -0,0 +1,102 @@
+package hashring
+
+import (
+	"math"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// LoadShare returns the fraction of the hash space owned by item x. It is
+// calculated exactly from the positions of the ring points.
+// It returns zero if x doesn't exist on the ring or, if r.Strict is true, when
+// x can't be digested.
+func (r *Ring) LoadShare(x Item) float64 {
+	s, d, err := r.locateItem(x)
+	if err != nil {
+		return 0
+	}
+	if _, has := s.members[d.hi]; !has {
+		return 0
+	}
+	return s.shares()[d.hi]
+}
+
+// LoadEstimate describes predicted number of keys mapped to an item when keys
+// are uniformly distributed over the hash space.
+type LoadEstimate struct {
+	// Share is the fraction of the hash space owned by the item.
+	Share float64
+
+	// Mean is the expected number of keys mapped to the item.
+	Mean float64
+
+	// Variance is the variance of the number of keys mapped to the item.
+	Variance float64
+}
+
+// Stddev returns standard deviation of the number of keys mapped to the item.
+func (e LoadEstimate) Stddev() float64 {
+	return math.Sqrt(e.Variance)
+}
+
+// Bounds returns the interval of z standard deviations around the expected
+// number of keys. For example, z of 1.96 gives approximately 95% confidence
+// interval for large number of keys.
+func (e LoadEstimate) Bounds(z float64) (lo, hi float64) {
+	d := z * e.Stddev()
+	return math.Max(0, e.Mean-d), e.Mean + d
+}
+
+// EstimateLoad returns predicted number of keys mapped to each item of the
+// ring given the total number of keys. Number of keys mapped to an item
+// follows binomial distribution with the item's share of the hash space as
+// probability.
+func (r *Ring) EstimateLoad(keys int) map[Item]LoadEstimate {
+	s := r.load()
+	n := float64(keys)
+	m := make(map[Item]LoadEstimate, len(s.members))
+	for id, p := range s.shares() {
+		m[s.members[id].item] = LoadEstimate{
+			Share:    p,
+			Mean:     n * p,
+			Variance: n * p * (1 - p),
+		}
+	}
+	return m
+}
+
+// shares returns a mapping of a non-suffixed digest of each item on the ring
+// to the fraction of the hash space it owns.
+func (s *ringState) shares() map[uint64]float64 {
+	share := make(map[uint64]float64, len(s.members))
+	var (
+		first *point
+		prev  *point
+	)
+	s.tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		if s.filtered {
+			if _, has := s.members[p.bucket.id]; !has {
+				// Point of the item filtered out from the state.
+				return true
+			}
+		}
+		if prev != nil {
+			share[p.bucket.id] += float64(p.val.hi-prev.val.hi) / (1 << 64)
+		} else {
+			first = p
+		}
+		prev = p
+		return true
+	})
+	if first == nil {
+		return share
+	}
+	if first == prev {
+		// Single point owns the whole ring.
+		share[first.bucket.id] = 1
+		return share
+	}
+	share[first.bucket.id] += float64(first.val.hi-prev.val.hi) / (1 << 64)
+	return share
+}
@@ -0,0 +1,39 @@
+package hashring
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRingEstimateLoad(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	})
+	const keys = 100000
+	act := make(map[Item]float64)
+	for i := 0; i < keys; i++ {
+		act[r.Get(IntItem(i))]++
+	}
+	var sum float64
+	for x, e := range r.EstimateLoad(keys) {
+		if s := r.LoadShare(x); s != e.Share {
+			t.Errorf("LoadShare(%v) = %v; want %v", x, s, e.Share)
+		}
+		sum += e.Share
+		// Use wide bounds to not depend on the keys sample.
+		if lo, hi := e.Bounds(5); act[x] < lo || act[x] > hi {
+			t.Errorf(
+				"number of keys of %v is out of bounds: %v not in [%.0f, %.0f]",
+				x, act[x], lo, hi,
+			)
+		}
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Fatalf("shares sum up to %v; want 1", sum)
+	}
+	if s := r.LoadShare(StringItem("qux")); s != 0 {
+		t.Fatalf("unexpected share of not existing item: %v", s)
+	}
+}
@@ -0,0 +1,138 @@
+package hashring
+
+import (
+	"fmt"
+	"math"
+)
+
+// ItemWeight is an item along with its weight.
+type ItemWeight struct {
+	Item   Item
+	Weight float64
+}
+
+// Op is a ring mutation simulated by Simulate(). If Weight is zero, the item
+// is deleted from the ring. If the item doesn't exist on the ring, it is
+// inserted. Otherwise its weight is updated.
+type Op Change
+
+// SimStep describes the ring right after a simulated mutation.
+type SimStep struct {
+	// Op is the applied mutation.
+	Op Op
+
+	// Moved is the fraction of the hash space which changed its owner due
+	// to the mutation.
+	Moved float64
+
+	// Balance describes distribution of the hash space after the mutation.
+	Balance Balance
+}
+
+// Balance describes how evenly the hash space is distributed among the
+// ring's items with respect to their weights.
+type Balance struct {
+	// Deviation is the standard deviation (in percents) of the items shares
+	// of the hash space from their expected (weighted) shares.
+	Deviation float64
+
+	// MaxLoad is the maximum ratio of the item's share of the hash space to
+	// its expected share. That is, MaxLoad of 1.1 means that the most loaded
+	// item receives 10% more keys than it should.
+	MaxLoad float64
+}
+
+// SimReport is a result of Simulate().
+type SimReport struct {
+	// Base describes distribution of the hash space of the base ring.
+	Base Balance
+
+	// Steps holds results of each simulated mutation in order.
+	Steps []SimStep
+
+	// Moved is the fraction of the hash space which changed its owner after
+	// all mutations compared to the base ring. It may be less than the sum
+	// of the steps' Moved fractions since ranges may move back and forth.
+	Moved float64
+}
+
+// Simulate computes how mutations affect the ring built of base items. It
+// builds the ring with the default settings and applies ops one by one,
+// calculating exactly (that is, from positions of the ring's points, without
+// any sample keys) the fraction of the hash space moved by each mutation and
+// the resulting balance of the ring.
+//
+// If some item is given twice in base or some weight is negative,
+// Simulate() panics.
+func Simulate(base []ItemWeight, ops []Op) SimReport {
+	var r Ring
+	r.Begin()
+	for _, x := range base {
+		if err := r.Insert(x.Item, x.Weight); err != nil {
+			panic(err.Error())
+		}
+	}
+	if err := r.Commit(); err != nil {
+		panic(err.Error())
+	}
+	var (
+		rep = SimReport{
+			Base:  r.balance(),
+			Steps: make([]SimStep, 0, len(ops)),
+		}
+		first = treeMarks(r.tree())
+	)
+	for _, op := range ops {
+		if op.Weight < 0 {
+			panic(fmt.Sprintf("hashring: malformed weight: %g", op.Weight))
+		}
+		prev := treeMarks(r.tree())
+		var err error
+		switch _, has := r.Weight(op.Item); {
+		case op.Weight == 0 && has:
+			err = r.Delete(op.Item)
+		case op.Weight == 0:
+			// Nothing to delete.
+		case has:
+			err = r.Update(op.Item, op.Weight)
+		default:
+			err = r.Insert(op.Item, op.Weight)
+		}
+		if err != nil {
+			panic(err.Error())
+		}
+		rep.Steps = append(rep.Steps, SimStep{
+			Op:      op,
+			Moved:   movedFraction(prev, treeMarks(r.tree())),
+			Balance: r.balance(),
+		})
+	}
+	rep.Moved = movedFraction(first, treeMarks(r.tree()))
+
+	return rep
+}
+
+// movedFraction returns the fraction of the hash space which changed its
+// owner between rings having points marks a and b.
+func movedFraction(a, b []mark) (moved float64) {
+	for _, m := range relocations(a, b) {
+		moved += partitionSize(m.Range)
+	}
+	return moved / math.Exp2(64)
+}
+
+// balance returns current balance of the ring.
+func (r *Ring) balance() (b Balance) {
+	s := r.load()
+	if len(s.members) == 0 {
+		return b
+	}
+	share := s.shares()
+	for id, m := range s.members {
+		if x := share[id] / (m.weight / s.total); x > b.MaxLoad {
+			b.MaxLoad = x
+		}
+	}
+	b.Deviation = r.deviation()
+	return b
+}
@@ -0,0 +1,45 @@
+package hashring
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	base := []ItemWeight{
+		{StringItem("foo"), 1},
+		{StringItem("bar"), 1},
+		{StringItem("baz"), 1},
+	}
+	rep := Simulate(base, []Op{
+		{StringItem("qux"), 1},
+		{StringItem("qux"), 2},
+		{StringItem("qux"), 0},
+		{StringItem("qux"), 0},
+	})
+	if n := len(rep.Steps); n != 4 {
+		t.Fatalf("unexpected number of steps: %d", n)
+	}
+	if rep.Base.MaxLoad < 1 {
+		t.Errorf("unexpected base max load: %v", rep.Base.MaxLoad)
+	}
+	for i, s := range rep.Steps[:3] {
+		if s.Moved <= 0 || s.Moved >= 1 {
+			t.Errorf("step #%d: unexpected moved fraction: %v", i, s.Moved)
+		}
+	}
+	// Inserting an item with weight w into a ring with total weight W must
+	// move roughly w/(W+w) of keys.
+	if m := rep.Steps[0].Moved; math.Abs(m-0.25) > 0.1 {
+		t.Errorf("unexpected moved fraction after insertion: %v", m)
+	}
+	if m := rep.Steps[3].Moved; m != 0 {
+		t.Errorf("unexpected moved fraction after no-op deletion: %v", m)
+	}
+	if rep.Moved != 0 {
+		t.Errorf("unexpected total moved fraction: %v; want 0", rep.Moved)
+	}
+	if act, exp := rep.Steps[3].Balance, rep.Base; act != exp {
+		t.Errorf("unexpected final balance: %+v; want %+v", act, exp)
+	}
+}
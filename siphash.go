@@ -0,0 +1,145 @@
+package hashring
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math/bits"
+)
+
+// SipHash returns a constructor of the SipHash-2-4 hash function keyed by
+// k0 and k1, suitable to be used as Ring.Hash:
+//
+//	r := hashring.Ring{
+//		Hash: hashring.SipHash(k0, k1),
+//	}
+//
+// Keyed hashing protects the ring from engineered collisions and hot-spots
+// when items or keys are controlled by an attacker (e.g. user ids or URLs).
+// Note that the key must be kept secret and be the same on all processes
+// which need consistent mapping.
+func SipHash(k0, k1 uint64) func() hash.Hash64 {
+	return func() hash.Hash64 {
+		h := &sipHash{
+			k0: k0,
+			k1: k1,
+		}
+		h.Reset()
+		return h
+	}
+}
+
+// NewSeed returns a random seed to be used with WithSeed(). Unlike seeds of
+// the hash/maphash package, the seed is a plain number, so it can be
+// persisted and passed to other processes which need the same mapping.
+func NewSeed() uint64 {
+	var p [8]byte
+	if _, err := rand.Read(p[:]); err != nil {
+		panic(fmt.Sprintf("hashring: can't make random seed: %v", err))
+	}
+	return binary.LittleEndian.Uint64(p[:])
+}
+
+// SeededHash returns a constructor of the SipHash-2-4 hash function keyed by
+// the key derived from seed. It's like SipHash() but takes a single
+// 64-bit seed, e.g. the one returned by NewSeed().
+//
+// Note that the 128-bit key is derived from the 64-bit seed, thus the key
+// strength is 64 bits rather than 128 bits of SipHash. Use SipHash() with
+// two random words when the full key strength is needed.
+func SeededHash(seed uint64) func() hash.Hash64 {
+	return SipHash(seed, mix64(seed, 0))
+}
+
+// sipHash is a streaming implementation of the SipHash-2-4 hash function.
+type sipHash struct {
+	k0, k1         uint64
+	v0, v1, v2, v3 uint64
+
+	// buf holds n bytes of the last incomplete message block.
+	buf [8]byte
+	n   int
+
+	// size is a total number of bytes written.
+	size uint64
+}
+
+func (h *sipHash) Reset() {
+	h.v0 = h.k0 ^ 0x736f6d6570736575
+	h.v1 = h.k1 ^ 0x646f72616e646f6d
+	h.v2 = h.k0 ^ 0x6c7967656e657261
+	h.v3 = h.k1 ^ 0x7465646279746573
+	h.n = 0
+	h.size = 0
+}
+
+func (h *sipHash) Write(p []byte) (int, error) {
+	n := len(p)
+	h.size += uint64(n)
+	if h.n > 0 {
+		m := copy(h.buf[h.n:], p)
+		h.n += m
+		p = p[m:]
+		if h.n < len(h.buf) {
+			return n, nil
+		}
+		h.block(binary.LittleEndian.Uint64(h.buf[:]))
+		h.n = 0
+	}
+	for ; len(p) >= 8; p = p[8:] {
+		h.block(binary.LittleEndian.Uint64(p))
+	}
+	h.n = copy(h.buf[:], p)
+	return n, nil
+}
+
+func (h *sipHash) Sum64() uint64 {
+	// Copy state to not affect further writes.
+	cp := *h
+
+	b := cp.size << 56
+	for i := cp.n - 1; i >= 0; i-- {
+		b |= uint64(cp.buf[i]) << (8 * uint(i))
+	}
+	cp.block(b)
+	cp.v2 ^= 0xff
+	cp.round()
+	cp.round()
+	cp.round()
+	cp.round()
+	return cp.v0 ^ cp.v1 ^ cp.v2 ^ cp.v3
+}
+
+func (h *sipHash) Sum(b []byte) []byte {
+	var p [8]byte
+	binary.BigEndian.PutUint64(p[:], h.Sum64())
+	return append(b, p[:]...)
+}
+
+func (h *sipHash) Size() int      { return 8 }
+func (h *sipHash) BlockSize() int { return 8 }
+
+func (h *sipHash) block(m uint64) {
+	h.v3 ^= m
+	h.round()
+	h.round()
+	h.v0 ^= m
+}
+
+func (h *sipHash) round() {
+	h.v0 += h.v1
+	h.v1 = bits.RotateLeft64(h.v1, 13)
+	h.v1 ^= h.v0
+	h.v0 = bits.RotateLeft64(h.v0, 32)
+	h.v2 += h.v3
+	h.v3 = bits.RotateLeft64(h.v3, 16)
+	h.v3 ^= h.v2
+	h.v0 += h.v3
+	h.v3 = bits.RotateLeft64(h.v3, 21)
+	h.v3 ^= h.v0
+	h.v2 += h.v1
+	h.v1 = bits.RotateLeft64(h.v1, 17)
+	h.v1 ^= h.v2
+	h.v2 = bits.RotateLeft64(h.v2, 32)
+}
@@ -0,0 +1,49 @@
+package hashring
+
+import (
+	"testing"
+)
+
+func TestSipHash(t *testing.T) {
+	const (
+		k0 = 0x0706050403020100
+		k1 = 0x0f0e0d0c0b0a0908
+	)
+	msg := make([]byte, 15)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	for _, test := range []struct {
+		name  string
+		parts [][]byte
+		exp   uint64
+	}{
+		{
+			name: "empty",
+			exp:  0x726fdb47dd0e0e31,
+		},
+		{
+			name:  "single",
+			parts: [][]byte{msg},
+			exp:   0xa129ca6149be45e5,
+		},
+		{
+			name:  "chunked",
+			parts: [][]byte{msg[:3], msg[3:5], msg[5:14], msg[14:]},
+			exp:   0xa129ca6149be45e5,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h := SipHash(k0, k1)()
+			for i := 0; i < 2; i++ {
+				for _, p := range test.parts {
+					h.Write(p)
+				}
+				if act := h.Sum64(); act != test.exp {
+					t.Fatalf("unexpected sum: %#x; want %#x", act, test.exp)
+				}
+				h.Reset()
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package hashring
+
+import "github.com/gobwas/hashring/internal/avl"
+
+// skipFanout is the number of keys of a skip list level per each key of the
+// level above it.
+const skipFanout = 16
+
+// skiplist is an immutable deterministic skip list of the ring's points.
+//
+// Unlike the tree, skip list holds its keys in contiguous arrays, so the
+// lookup scans at most skipFanout neighbour keys per level instead of chasing
+// pointers to the tree nodes.
+type skiplist struct {
+	// levels holds keys of the skip list. The first level holds values of
+	// all points in ascending order; each next level holds every
+	// skipFanout-th key of the previous one.
+	levels [][]value
+
+	// points holds points in the same order as the first level keys.
+	points []*point
+}
+
+func newSkipList(tree avl.Tree) *skiplist {
+	var (
+		n    = tree.Size()
+		keys = make([]value, 0, n)
+		s    = &skiplist{
+			points: make([]*point, 0, n),
+		}
+	)
+	tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		s.points = append(s.points, p)
+		keys = append(keys, p.val)
+		return true
+	})
+	s.levels = append(s.levels, keys)
+	for len(keys) > skipFanout {
+		upper := make([]value, 0, len(keys)/skipFanout)
+		for i := skipFanout - 1; i < len(keys); i += skipFanout {
+			upper = append(upper, keys[i])
+		}
+		s.levels = append(s.levels, upper)
+		keys = upper
+	}
+	return s
+}
+
+// successor returns index of the first point which value is greater than d.
+// It returns len(s.points) if there is no such point.
+func (s *skiplist) successor(d value) int {
+	lo, hi := 0, len(s.levels[len(s.levels)-1])
+	for l := len(s.levels) - 1; ; l-- {
+		keys := s.levels[l]
+		i := lo
+		for i < hi && keys[i].compare(d) <= 0 {
+			i++
+		}
+		if l == 0 {
+			return i
+		}
+		// Key i of level l is the last key of the i-th window of the level
+		// below, and key i-1 is not greater than d. Thus the successor is
+		// within the i-th window.
+		lo = i * skipFanout
+		hi = lo + skipFanout
+		if n := len(s.levels[l-1]); hi > n {
+			hi = n
+		}
+	}
+}
+
+// get returns bucket owning hash value d.
+// It returns nil if skip list is empty.
+func (s *skiplist) get(d value) *bucket {
+	n := len(s.points)
+	if n == 0 {
+		return nil
+	}
+	return s.points[s.successor(d)%n].bucket
+}
+
+// walk calls fn for each point of the skip list in clockwise order starting
+// from the point which owns hash value d. It stops when all points are
+// visited or fn returns false.
+func (s *skiplist) walk(d value, fn func(*point) bool) {
+	n := len(s.points)
+	if n == 0 {
+		return
+	}
+	for i, j := s.successor(d), 0; j < n; i, j = i+1, j+1 {
+		if !fn(s.points[i%n]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package hashring
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+func TestSkipList(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 15, 16, 17, 255, 256, 257, 5000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			r := Ring{
+				MagicFactor: 1,
+			}
+			for i := 0; i < n; i++ {
+				if err := r.Insert(IntItem(i), 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var (
+				tree = r.tree()
+				s    = newSkipList(tree)
+			)
+			ds := []value{{}, {hi: ^uint64(0)}}
+			for i := 0; i < 1000; i++ {
+				ds = append(ds, value{hi: rand.Uint64()})
+			}
+			tree.InOrder(func(x avl.Item) bool {
+				v := x.(*point).val
+				ds = append(ds, v, value{hi: v.hi - 1})
+				return true
+			})
+			for _, d := range ds {
+				if act, exp := s.get(d), get(tree, d); act != exp {
+					t.Fatalf("unexpected bucket for %v: %v; want %v", d, act, exp)
+				}
+				var act, exp []*point
+				s.walk(d, func(p *point) bool {
+					act = append(act, p)
+					return len(act) < 3
+				})
+				walk(tree, d, func(p *point) bool {
+					exp = append(exp, p)
+					return len(exp) < 3
+				})
+				if !equalPoints(act, exp) {
+					t.Fatalf("unexpected walk from %v: %v; want %v", d, act, exp)
+				}
+			}
+		})
+	}
+}
+
+func TestRingSkipList(t *testing.T) {
+	for _, test := range distCases {
+		t.Run(test.name, func(t *testing.T) {
+			r := makeRing(t, test.ring, test.actions...)
+			s := Ring{
+				SkipList: true,
+			}
+			for _, m := range r.load().members {
+				if err := s.Insert(m.item, m.weight); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 10000; i++ {
+				key := IntItem(i)
+				if act, exp := s.Get(key), r.Get(key); act != exp {
+					t.Fatalf("unexpected item for %d: %v; want %v", i, act, exp)
+				}
+			}
+		})
+	}
+}
+
+func equalPoints(a, b []*point) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func BenchmarkRingGet(b *testing.B) {
+	for _, skip := range []bool{false, true} {
+		for _, n := range []int{10, 100, 1000} {
+			name := "tree"
+			if skip {
+				name = "skiplist"
+			}
+			b.Run(name+"/"+strconv.Itoa(n), func(b *testing.B) {
+				r := Ring{
+					SkipList: skip,
+				}
+				r.Begin()
+				for i := 0; i < n; i++ {
+					r.Insert(IntItem(i), 1)
+				}
+				r.Commit()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					r.Get(IntItem(i))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,87 @@
+//go:build go1.21
+
+package hashring
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SlogTrace returns RingTrace hooks which log ring events to l. Items changes
+// are logged with slog.LevelInfo, rebuilds, points collisions and generation
+// changes with slog.LevelDebug, and failures due to Ring.MaxGeneration with
+// slog.LevelWarn. Items are logged as strings of their bytes.
+//
+// Attributes are built only if l is enabled for the event's level, so the
+// hooks are cheap to keep in production with debug level disabled.
+func SlogTrace(l *slog.Logger) RingTrace {
+	ctx := context.Background()
+	return RingTrace{
+		OnChange: func(cs ChangeSet) {
+			if !l.Enabled(ctx, slog.LevelInfo) {
+				return
+			}
+			for _, c := range cs.Changes {
+				msg := "hashring: item weight changed"
+				if c.Weight == 0 {
+					msg = "hashring: item deleted"
+				}
+				l.LogAttrs(ctx, slog.LevelInfo, msg,
+					slogItem("item", c.Item),
+					slog.Float64("weight", c.Weight),
+					slog.Uint64("version", cs.Version),
+				)
+			}
+		},
+		OnRebuild: func(points int) func(int, int, time.Duration) {
+			if !l.Enabled(ctx, slog.LevelDebug) {
+				return nil
+			}
+			return func(added, removed int, d time.Duration) {
+				l.LogAttrs(ctx, slog.LevelDebug, "hashring: ring rebuilt",
+					slog.Int("points", points),
+					slog.Int("added", added),
+					slog.Int("removed", removed),
+					slog.Duration("duration", d),
+				)
+			}
+		},
+		OnCollision: func(x Item, index int, y Item, yindex int) {
+			if !l.Enabled(ctx, slog.LevelDebug) {
+				return
+			}
+			l.LogAttrs(ctx, slog.LevelDebug, "hashring: points collided",
+				slogItem("item", x),
+				slog.Int("index", index),
+				slogItem("other_item", y),
+				slog.Int("other_index", yindex),
+			)
+		},
+		OnFix: func(x Item, index, gen int) {
+			if !l.Enabled(ctx, slog.LevelDebug) {
+				return
+			}
+			l.LogAttrs(ctx, slog.LevelDebug, "hashring: point moved",
+				slogItem("item", x),
+				slog.Int("index", index),
+				slog.Int("generation", gen),
+			)
+		},
+		OnGenerationLimit: func(x Item, index int) {
+			l.LogAttrs(ctx, slog.LevelWarn, "hashring: point exceeds max generation",
+				slogItem("item", x),
+				slog.Int("index", index),
+			)
+		},
+	}
+}
+
+func slogItem(key string, x Item) slog.Attr {
+	var buf bytes.Buffer
+	if _, err := x.WriteTo(&buf); err != nil {
+		return slog.String(key, "!"+err.Error())
+	}
+	return slog.String(key, buf.String())
+}
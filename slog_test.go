@@ -0,0 +1,46 @@
+//go:build go1.21
+
+package hashring
+
+import (
+	"bytes"
+	"hash"
+	"hash/fnv"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogTrace(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+	r := Ring{
+		Hash: func() hash.Hash64 {
+			return maskHash{fnv.New64a(), 0xff}
+		},
+		MagicFactor: 32,
+		Trace:       SlogTrace(l),
+	}
+	for _, s := range []string{"foo", "bar", "baz", "qux"} {
+		if err := r.Insert(StringItem(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Delete(StringItem("foo")); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, exp := range []string{
+		`level=INFO msg="hashring: item weight changed" item=bar weight=1 version=2`,
+		`level=INFO msg="hashring: item deleted" item=foo weight=0 version=5`,
+		`level=DEBUG msg="hashring: ring rebuilt" points=0 added=32 removed=0`,
+		`level=DEBUG msg="hashring: points collided" item=`,
+		`level=DEBUG msg="hashring: point moved" item=`,
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("no %q in log output:\n%s", exp, out)
+		}
+	}
+}
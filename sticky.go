@@ -0,0 +1,132 @@
+package hashring
+
+import (
+	"sync"
+	"time"
+)
+
+// Sticky is a wrapper around the ring which remembers key to item
+// assignments for a while. Remembered item is returned for the key even if
+// the ring's topology changed and the key is mapped to another item now,
+// until the assignment expires or the item leaves the ring. That is, Sticky
+// smooths relocations for session-affinity workloads.
+//
+// Sticky is goroutine safe. Sticky instances must not be copied.
+type Sticky struct {
+	// Ring is a ring consulted for keys having no assignment.
+	// It must not be changed after Sticky's first use.
+	Ring *Ring
+
+	// TTL is a duration for which assignment is remembered since the last
+	// Get() call for the key. That is, assignments of keys accessed more
+	// often than TTL never expire while their items are on the ring.
+	TTL time.Duration
+
+	// now is an optional function returning current time.
+	now func() time.Time
+
+	mu      sync.Mutex
+	hasher  *hasher
+	assigns map[value]stickyAssign
+	swept   time.Time
+}
+
+type stickyAssign struct {
+	id      uint64 // Non-suffixed digest of the item.
+	item    Item
+	expires time.Time
+}
+
+// Get returns the item remembered for the key v or, if there is no such
+// item, mapping of v to the ring's item which is then remembered.
+// Returned item is nil only when ring is empty or, if Ring.Strict is true,
+// when v can't be digested.
+func (s *Sticky) Get(v Item) Item {
+	rs, d, err := s.Ring.locate(v)
+	if err != nil {
+		return nil
+	}
+	now := s.timeNow()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasher != rs.hasher {
+		// Ring's hash function changed, so digests of remembered keys and
+		// items are not valid anymore.
+		s.hasher = rs.hasher
+		s.assigns = nil
+	}
+	s.sweep(now)
+
+	a, has := s.assigns[d]
+	if has && now.Before(a.expires) {
+		_, has = rs.members[a.id]
+	} else {
+		has = false
+	}
+	if !has {
+		id, x := rs.owner(d)
+		if x == nil {
+			delete(s.assigns, d)
+			return nil
+		}
+		a = stickyAssign{
+			id:   id,
+			item: x,
+		}
+	}
+	a.expires = now.Add(s.TTL)
+	if s.assigns == nil {
+		s.assigns = make(map[value]stickyAssign)
+	}
+	s.assigns[d] = a
+
+	return a.item
+}
+
+// Forget removes assignment of the key v, if any. Next Get() call for v
+// consults the ring.
+func (s *Sticky) Forget(v Item) {
+	rs, d, err := s.Ring.locate(v)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasher == rs.hasher {
+		delete(s.assigns, d)
+	}
+}
+
+// Len returns the number of remembered assignments, including expired ones
+// which were not removed yet.
+func (s *Sticky) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.assigns)
+}
+
+// sweep removes expired assignments. To amortize the cost it does nothing if
+// less than TTL passed since the last sweep.
+//
+// s.mu must be held.
+func (s *Sticky) sweep(now time.Time) {
+	if now.Sub(s.swept) < s.TTL {
+		return
+	}
+	s.swept = now
+	for d, a := range s.assigns {
+		if !now.Before(a.expires) {
+			delete(s.assigns, d)
+		}
+	}
+}
+
+func (s *Sticky) timeNow() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
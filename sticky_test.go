@@ -0,0 +1,69 @@
+package hashring
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSticky(t *testing.T) {
+	var (
+		r   = makeRing(t, map[string]float64{"foo": 1})
+		now = time.Unix(0, 0)
+		s   = Sticky{
+			Ring: r,
+			TTL:  time.Minute,
+			now: func() time.Time {
+				return now
+			},
+		}
+		key = StringItem("session")
+	)
+	assertGet := func(exp string) {
+		t.Helper()
+		if act := s.Get(key); act != StringItem(exp) {
+			t.Fatalf("unexpected item: %v; want %v", act, exp)
+		}
+	}
+	assertGet("foo")
+
+	// Make key mapped to another item on the ring.
+	if err := r.Insert(StringItem("bar"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Pin(key, StringItem("bar")); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	assertGet("foo")
+	now = now.Add(50 * time.Second) // TTL is prolonged by previous Get().
+	assertGet("foo")
+
+	now = now.Add(time.Minute)
+	assertGet("bar")
+
+	if err := r.Unpin(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Pin(key, StringItem("foo")); err != nil {
+		t.Fatal(err)
+	}
+	assertGet("bar")
+	if err := r.Delete(StringItem("bar")); err != nil {
+		t.Fatal(err)
+	}
+	assertGet("foo")
+
+	s.Forget(key)
+	if n := s.Len(); n != 0 {
+		t.Fatalf("unexpected number of assignments: %d", n)
+	}
+
+	for i := 0; i < 10; i++ {
+		s.Get(IntItem(i))
+	}
+	now = now.Add(2 * time.Minute)
+	assertGet("foo")
+	if n := s.Len(); n != 1 {
+		t.Fatalf("expired assignments were not removed: %d remain", n)
+	}
+}
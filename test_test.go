@@ -128,3 +128,23 @@ func decodeInt(src []byte) int {
 		panic("unexpected int size")
 	}
 }
+
+// constHash is a hash.Hash64 implementation which Sum64() always returns the
+// same value.
+type constHash uint64
+
+func (h constHash) Write(p []byte) (int, error) { return len(p), nil }
+func (h constHash) Sum(b []byte) []byte         { panic("not implemented") }
+func (h constHash) Reset()                      {}
+func (h constHash) Size() int                   { return 8 }
+func (h constHash) BlockSize() int              { return 1 }
+func (h constHash) Sum64() uint64               { return uint64(h) }
+
+// maskHash is a hash.Hash64 implementation which Sum64() returns only masked
+// bits of the underlying hash. It is used to provoke points collisions.
+type maskHash struct {
+	hash.Hash64
+	mask uint64
+}
+
+func (h maskHash) Sum64() uint64 { return h.Hash64.Sum64() & h.mask }
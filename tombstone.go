@@ -0,0 +1,159 @@
+package hashring
+
+import "fmt"
+
+// RemoveMode describes how Remove() deletes an item from the ring.
+type RemoveMode int
+
+const (
+	// Purge deletes the item completely, as Delete() does.
+	Purge RemoveMode = iota
+
+	// Tombstone deletes the item's points from the ring but keeps its weight
+	// recorded until the item is inserted back or Compact() is called.
+	//
+	// Since the number of points of each item depends on the minimum and
+	// maximum weights among the ring's items, deleting an item having such
+	// weight changes points of other items, and inserting it back changes
+	// them again. Tombstone keeps the points of other items untouched, so
+	// flapping items cause no relocations other than of their own keys. Once
+	// the item is inserted back with the same weight, ring's points are
+	// exactly the same as before the removal.
+	Tombstone
+)
+
+func (m RemoveMode) String() string {
+	switch m {
+	case Purge:
+		return "purge"
+	case Tombstone:
+		return "tombstone"
+	default:
+		return fmt.Sprintf("RemoveMode(%d)", int(m))
+	}
+}
+
+// tombstone holds an item removed with Tombstone mode.
+type tombstone struct {
+	item   Item
+	weight float64
+}
+
+// Remove removes item x from the ring according to mode m.
+// It returns non-nil error when x doesn't exist on the ring or when new
+// points of the ring collide and r.Collision is CollisionError.
+func (r *Ring) Remove(x Item, m RemoveMode) error {
+	switch m {
+	case Purge:
+		return r.Delete(x)
+	case Tombstone:
+	default:
+		return fmt.Errorf("hashring: unknown remove mode: %v", m)
+	}
+	r.lock()
+	defer r.mu.Unlock()
+
+	id, err := r.itemDigest(x)
+	if err != nil {
+		return err
+	}
+	b, has := r.buckets[id]
+	if !has || b.weight == 0 {
+		return fmt.Errorf("hashring: item doesn't exist")
+	}
+	var (
+		prev  = b.weight
+		tombs = r.tombs
+	)
+	b.weight = 0
+	// Weight of the tombstone keeps min and max weights of the ring
+	// unchanged.
+	r.tombs = withTomb(tombs, id, tombstone{
+		item:   b.item,
+		weight: prev,
+	})
+	if err := r.rebuild(); err != nil {
+		b.weight = prev
+		r.tombs = tombs
+		return err
+	}
+	return nil
+}
+
+// Compact purges tombstones of the items removed with Tombstone mode. Points
+// of the remaining items are rebuilt as if the items were removed with Purge
+// mode.
+// It returns non-nil error when new points of the ring collide and
+// r.Collision is CollisionError. In that case tombstones are left intact.
+func (r *Ring) Compact() error {
+	r.lock()
+	defer r.mu.Unlock()
+
+	if len(r.tombs) == 0 {
+		return nil
+	}
+	tombs := r.tombs
+	r.tombs = nil
+	r.resetWeights()
+	if err := r.rebuild(); err != nil {
+		r.tombs = tombs
+		r.resetWeights()
+		return err
+	}
+	return nil
+}
+
+// Tombstones returns items removed with Tombstone mode which were not
+// inserted back or compacted yet.
+func (r *Ring) Tombstones() []Item {
+	r.lock()
+	defer r.mu.Unlock()
+
+	if len(r.tombs) == 0 {
+		return nil
+	}
+	xs := make([]Item, 0, len(r.tombs))
+	for _, t := range r.tombs {
+		xs = append(xs, t.item)
+	}
+	return xs
+}
+
+// withTomb returns a copy of tombs with tombstone t of the item having
+// non-suffixed digest id added. If t is the zero value, the tombstone is
+// removed instead.
+// Tombstones maps are never changed in place since they are shared with the
+// published versions of the ring.
+func withTomb(tombs map[uint64]tombstone, id uint64, t tombstone) map[uint64]tombstone {
+	cp := make(map[uint64]tombstone, len(tombs)+1)
+	for i, t := range tombs {
+		cp[i] = t
+	}
+	if t.item != nil {
+		cp[id] = t
+	} else {
+		delete(cp, id)
+	}
+	if len(cp) == 0 {
+		return nil
+	}
+	return cp
+}
+
+// tombsWithHash returns tombstones digested with h.
+//
+// r.mu must be held.
+func (r *Ring) tombsWithHash(h *hasher) (map[uint64]tombstone, error) {
+	if len(r.tombs) == 0 {
+		return nil, nil
+	}
+	tombs := make(map[uint64]tombstone, len(r.tombs))
+	for _, t := range r.tombs {
+		d, err := h.ident(t.item)
+		if err != nil {
+			return nil, err
+		}
+		tombs[d.hi] = t
+	}
+	return tombs, nil
+}
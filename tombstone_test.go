@@ -0,0 +1,83 @@
+package hashring
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRingRemoveTombstone(t *testing.T) {
+	items := map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	}
+	var (
+		r    = makeRing(t, items)
+		foo  = StringItem("foo")
+		baz  = StringItem("baz")
+		base = dumpRing(t, r)
+		pts  = r.PointsOf(foo)
+	)
+	if err := r.Remove(baz, Tombstone); err != nil {
+		t.Fatal(err)
+	}
+	if r.Has(baz) {
+		t.Fatalf("removed item is still on the ring")
+	}
+	if act := r.PointsOf(foo); !reflect.DeepEqual(act, pts) {
+		t.Fatalf("points of other item changed after removal")
+	}
+	if act := r.Tombstones(); !reflect.DeepEqual(act, []Item{baz}) {
+		t.Fatalf("unexpected tombstones: %v", act)
+	}
+	removed := dumpRing(t, r)
+
+	if err := r.Insert(baz, 3); err != nil {
+		t.Fatal(err)
+	}
+	if act := dumpRing(t, r); act != base {
+		t.Fatalf("ring differs after re-insertion:\n%s\nwant:\n%s", act, base)
+	}
+	if act := r.Tombstones(); act != nil {
+		t.Fatalf("unexpected tombstones after re-insertion: %v", act)
+	}
+	if err := r.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if act := dumpRing(t, r); act != removed {
+		t.Fatalf("ring differs after rollback:\n%s\nwant:\n%s", act, removed)
+	}
+	if act := r.Tombstones(); !reflect.DeepEqual(act, []Item{baz}) {
+		t.Fatalf("unexpected tombstones after rollback: %v", act)
+	}
+
+	if err := r.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if act := r.Tombstones(); act != nil {
+		t.Fatalf("unexpected tombstones after compaction: %v", act)
+	}
+	delete(items, "baz")
+	exp := makeRing(t, items)
+	assertRingsEqual(t, "compacted ?= built", r, exp)
+	if err := r.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRingRemovePurge(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+	})
+	if err := r.Remove(StringItem("bar"), Purge); err != nil {
+		t.Fatal(err)
+	}
+	exp := makeRing(t, map[string]float64{
+		"foo": 1,
+	})
+	assertRingsEqual(t, "removed ?= built", r, exp)
+	if err := r.Remove(StringItem("bar"), Tombstone); err == nil {
+		t.Fatalf("no error for missing item")
+	}
+}
@@ -0,0 +1,59 @@
+package hashring
+
+import "time"
+
+// RingTrace contains hooks called by the Ring methods. Any of the hooks may
+// be nil.
+//
+// Unlike debug tracing enabled by the hashring_trace build tag, RingTrace
+// hooks are always called and are intended to be used in production, e.g.
+// for metrics collection.
+type RingTrace struct {
+	// OnGet is called when a lookup of the key starts with the 64-bit digest
+	// of the key. Returned function, if non-nil, is called with the item
+	// chosen for the key when the lookup finishes. Chosen item is nil if the
+	// ring is empty.
+	//
+	// It's called by Get(), GetCounterClockwise(), GetSpread(), GetN(),
+	// GetChain(), GetReplicas() and Owner() methods of the Ring and by the
+	// lookup methods of its Views. For lookups of many items the chosen item
+	// is the first one. OnGet is not called if the key can't be digested
+	// (see Ring.Strict).
+	OnGet func(keyDigest uint64) func(chosen Item)
+
+	// OnGenerationLimit is called when the point of item x with given index
+	// can't be moved due to hash collision because of Ring.MaxGeneration
+	// limit. The ring mutation fails in that case.
+	OnGenerationLimit func(x Item, index int)
+
+	// OnRebuild is called when the ring starts to rebuild its points after
+	// mutation with the number of points on the ring. Returned function, if
+	// non-nil, is called when rebuild finishes with the number of points
+	// added and removed by the rebuild and its duration.
+	OnRebuild func(points int) func(added, removed int, duration time.Duration)
+
+	// OnChange is called when a new version of the ring is published with
+	// the set of items changes made by the mutation.
+	// It is called while the ring is locked for writes, thus it must not call
+	// ring's mutation methods.
+	OnChange func(cs ChangeSet)
+
+	// OnCollision is called when the point of item x with given index
+	// collides with the point of item y with index yindex, that is, when they
+	// get the same hash value.
+	OnCollision func(x Item, index int, y Item, yindex int)
+
+	// OnFix is called when the point of item x with given index is moved to
+	// the next generation gen due to collision (see CollisionRehash).
+	OnFix func(x Item, index, gen int)
+}
+
+// traceGet calls Trace.OnGet hook, if any, with digest d of the key being
+// looked up. Returned function, if non-nil, must be called with the chosen
+// item.
+func (r *Ring) traceGet(d value) func(Item) {
+	if fn := r.onGet(); fn != nil {
+		return fn(d.hi)
+	}
+	return nil
+}
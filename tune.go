@@ -0,0 +1,120 @@
+package hashring
+
+import (
+	"fmt"
+	"math"
+)
+
+// TuneOptions contains options for TuneMagicFactor().
+type TuneOptions struct {
+	// Ring is an optional ring which hash settings (that is, Hash, Hash128,
+	// Suffix and Collision fields) are used to estimate distribution of the
+	// hash space.
+	Ring *Ring
+
+	// Apply makes TuneMagicFactor() to set found magic factor to the Ring.
+	// The Ring is rebuilt only once in that case.
+	Apply bool
+
+	// MinMagicFactor and MaxMagicFactor are optional bounds of the search.
+	// If MinMagicFactor is zero, then 1 is used. If MaxMagicFactor is zero,
+	// then eight times DefaultMagicFactor is used.
+	MinMagicFactor int
+	MaxMagicFactor int
+}
+
+// TuneMagicFactor returns minimal magic factor for a ring of given items and
+// weights which makes standard deviation of items shares of the hash space to
+// be less or equal to target percents of their expected (weighted) shares.
+//
+// Distribution is calculated exactly by placing items points, so no sample
+// keys are involved. Search assumes that deviation decreases as magic factor
+// grows.
+//
+// It returns non-nil error if target can't be reached within the search
+// bounds or if opts.Apply is true and the ring can't be rebuilt.
+// opts may be nil.
+func TuneMagicFactor(items map[Item]float64, target float64, opts *TuneOptions) (int, error) {
+	if len(items) == 0 {
+		return 0, fmt.Errorf("hashring: no items to tune magic factor for")
+	}
+	var o TuneOptions
+	if opts != nil {
+		o = *opts
+	}
+	lo, hi := o.MinMagicFactor, o.MaxMagicFactor
+	if lo <= 0 {
+		lo = 1
+	}
+	if hi <= 0 {
+		hi = 8 * DefaultMagicFactor
+	}
+	if lo > hi {
+		return 0, fmt.Errorf("hashring: malformed magic factor bounds: [%d, %d]", lo, hi)
+	}
+	dev := func(m int) (float64, error) {
+		var r Ring
+		if o.Ring != nil {
+			r.Hash = o.Ring.Hash
+			r.Hash128 = o.Ring.Hash128
+			r.Suffix = o.Ring.Suffix
+			r.Collision = o.Ring.Collision
+		}
+		r.MagicFactor = m
+		r.Strict = true
+		r.Begin()
+		for x, w := range items {
+			if err := r.Insert(x, w); err != nil {
+				return 0, err
+			}
+		}
+		if err := r.Commit(); err != nil {
+			return 0, err
+		}
+		return r.deviation(), nil
+	}
+	d, err := dev(hi)
+	if err != nil {
+		return 0, err
+	}
+	if d > target {
+		return 0, fmt.Errorf(
+			"hashring: can't reach %.2f%% deviation with magic factor up to %d (got %.2f%%)",
+			target, hi, d,
+		)
+	}
+	for lo < hi {
+		m := lo + (hi-lo)/2
+		d, err := dev(m)
+		if err != nil {
+			return 0, err
+		}
+		if d <= target {
+			hi = m
+		} else {
+			lo = m + 1
+		}
+	}
+	if o.Apply && o.Ring != nil {
+		if _, err := o.Ring.SetMagicFactor(hi); err != nil {
+			return 0, err
+		}
+	}
+	return hi, nil
+}
+
+// deviation returns standard deviation (in percents) of the ring's items
+// shares of the hash space from their expected shares.
+func (r *Ring) deviation() float64 {
+	s := r.load()
+	if len(s.members) == 0 {
+		return 0
+	}
+	share := s.shares()
+	var sum float64
+	for id, m := range s.members {
+		d := share[id]/(m.weight/s.total) - 1
+		sum += d * d
+	}
+	return 100 * math.Sqrt(sum/float64(len(s.members)))
+}
@@ -0,0 +1,46 @@
+package hashring
+
+import "testing"
+
+func TestTuneMagicFactor(t *testing.T) {
+	items := map[Item]float64{
+		StringItem("foo"): 1,
+		StringItem("bar"): 2,
+		StringItem("baz"): 3,
+		StringItem("qux"): 1,
+	}
+	var r Ring
+	for x, w := range items {
+		if err := r.Insert(x, w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const target = 10.0
+	m, err := TuneMagicFactor(items, target, &TuneOptions{
+		Ring:  &r,
+		Apply: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.MagicFactor != m {
+		t.Fatalf("magic factor was not applied: %d; want %d", r.MagicFactor, m)
+	}
+	if d := r.deviation(); d > target {
+		t.Fatalf("unexpected deviation: %.2f%%; want at most %.2f%%", d, target)
+	}
+	r1 := Ring{MagicFactor: m}
+	for x, w := range items {
+		if err := r1.Insert(x, w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertRingsEqual(t, "tuned ?= built", &r, &r1)
+
+	_, err = TuneMagicFactor(items, 0.0001, &TuneOptions{
+		MaxMagicFactor: 10,
+	})
+	if err == nil {
+		t.Fatalf("want error; got nothing")
+	}
+}
@@ -0,0 +1,156 @@
+package hashring
+
+import (
+	"fmt"
+
+	"github.com/gobwas/hashring/internal/avl"
+)
+
+// Verify checks the ring's internal invariants and returns non-nil error
+// describing the first violated one. It takes O(n) time and holds the ring's
+// lock, so it's intended for tests and fuzzing rather than for production
+// use.
+//
+// The following invariants are checked:
+//   - points are ordered by their values and (unless r.Collision is
+//     CollisionStable) have no equal values;
+//   - each point belongs to an item on the ring and its value is the digest
+//     of the item with the point's generation and index;
+//   - each moved point (under CollisionRehash) is registered as collided at
+//     every previous value it had;
+//   - each item has the number of points its weight implies (unless the ring
+//     is in deferred mode) and all of them are on the ring (unless
+//     r.Collision is CollisionTieBreak).
+func (r *Ring) Verify() error {
+	r.lock()
+	defer r.mu.Unlock()
+
+	var (
+		s    = r.current()
+		prev *point
+		size int
+		err  error
+	)
+	s.tree.InOrder(func(x avl.Item) bool {
+		p := x.(*point)
+		size++
+		if prev != nil {
+			err = verifyOrder(prev, p)
+		}
+		if err == nil {
+			err = r.verifyPoint(s, p)
+		}
+		prev = p
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if !r.deferred && len(s.members) != len(r.buckets) {
+		return fmt.Errorf(
+			"hashring: ring has %d items but %d buckets",
+			len(s.members), len(r.buckets),
+		)
+	}
+	var (
+		numPoints = r.numPoints()
+		total     int
+	)
+	for id, b := range r.buckets {
+		if b.id != id {
+			return fmt.Errorf(
+				"hashring: bucket of item %v is indexed by wrong digest",
+				b.item,
+			)
+		}
+		if !r.deferred {
+			if n := numPoints(b); len(b.points) != n {
+				return fmt.Errorf(
+					"hashring: item %v has %d points; want %d",
+					b.item, len(b.points), n,
+				)
+			}
+		}
+		for i, p := range b.points {
+			if p.bucket != b || p.index != i {
+				return fmt.Errorf(
+					"hashring: point #%d of item %v is misplaced",
+					i, b.item,
+				)
+			}
+		}
+		total += len(b.points)
+	}
+	if r.deferred {
+		return nil
+	}
+	if size > total || (size < total && r.conf.Collision != CollisionTieBreak) {
+		return fmt.Errorf(
+			"hashring: ring has %d points; items have %d",
+			size, total,
+		)
+	}
+	return nil
+}
+
+// verifyOrder returns non-nil error if point p0 is not ordered before point
+// p1.
+func verifyOrder(p0, p1 *point) error {
+	if c := p0.Compare(p1); c < 0 {
+		return nil
+	}
+	return fmt.Errorf(
+		"hashring: point #%d of item %v (%x) is not ordered before "+
+			"point #%d of item %v (%x)",
+		p0.index, p0.bucket.item, p0.val.hi,
+		p1.index, p1.bucket.item, p1.val.hi,
+	)
+}
+
+// verifyPoint returns non-nil error if point p on the ring state s has
+// inconsistent value or bucket.
+//
+// r.mu must be held.
+func (r *Ring) verifyPoint(s *ringState, p *point) error {
+	b := p.bucket
+	if _, has := s.members[b.id]; !has {
+		return fmt.Errorf(
+			"hashring: point #%d belongs to item %v which is not on the ring",
+			p.index, b.item,
+		)
+	}
+	stack := p.stack()
+	if len(stack) != p.generation() {
+		return fmt.Errorf(
+			"hashring: point #%d of item %v has generation %d but %d "+
+				"previous values",
+			p.index, b.item, p.generation(), len(stack),
+		)
+	}
+	values := append(stack[:len(stack):len(stack)], p.val)
+	for gen, v := range values {
+		d, err := r.pointValue(s.hasher, b, gen, p.index)
+		if err != nil {
+			return err
+		}
+		if d != v {
+			return fmt.Errorf(
+				"hashring: point #%d of item %v has value %x at generation "+
+					"%d; want %x",
+				p.index, b.item, v.hi, gen, d.hi,
+			)
+		}
+		if gen == len(stack) {
+			break
+		}
+		c := r.collisions[v]
+		if c.Search(collision{p}) == nil {
+			return fmt.Errorf(
+				"hashring: point #%d of item %v is not registered as "+
+					"collided at generation %d",
+				p.index, b.item, gen,
+			)
+		}
+	}
+	return nil
+}
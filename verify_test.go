@@ -0,0 +1,65 @@
+package hashring
+
+import (
+	"testing"
+)
+
+func TestRingVerify(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		corrupt func(*Ring)
+	}{
+		{
+			name:    "ok",
+			corrupt: func(*Ring) {},
+		},
+		{
+			name: "value",
+			corrupt: func(r *Ring) {
+				p := r.tree().Min().(*point)
+				p.val.hi++
+			},
+		},
+		{
+			name: "generation",
+			corrupt: func(r *Ring) {
+				p := r.tree().Min().(*point)
+				p.gen++
+			},
+		},
+		{
+			name: "orphan",
+			corrupt: func(r *Ring) {
+				b := r.buckets[r.tree().Min().(*point).bucket.id]
+				b.points = b.points[:len(b.points)-1]
+			},
+		},
+		{
+			name: "missing",
+			corrupt: func(r *Ring) {
+				s := r.load()
+				s.tree, _ = s.tree.Delete(s.tree.Max())
+			},
+		},
+		{
+			name: "order",
+			corrupt: func(r *Ring) {
+				ps := ringPoints(r)
+				ps[0].val, ps[1].val = ps[1].val, ps[0].val
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := makeRing(t, map[string]float64{
+				"foo": 1,
+				"bar": 2,
+				"baz": 3,
+			})
+			test.corrupt(r)
+			err := r.Verify()
+			if act, exp := err != nil, test.name != "ok"; act != exp {
+				t.Fatalf("unexpected Verify() error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package hashring
+
+// ChangeSet describes changes of the ring items made by a single mutation.
+type ChangeSet struct {
+	// Version is the ring version after the mutation.
+	Version uint64
+
+	// Changes holds changed items along with their new weights. Deleted
+	// items have zero weight.
+	//
+	// Changes is empty for mutations which don't change items or weights,
+	// such as SetHash() or SetMagicFactor().
+	Changes []Change
+}
+
+// Version returns the number of mutations made to the ring. It is increased
+// each time new version of the ring becomes observable by readers, so two
+// calls returning the same number observe the same ring topology.
+func (r *Ring) Version() uint64 {
+	return r.load().version
+}
+
+// ChangesSince returns change sets of the mutations made after version v, in
+// order of their versions.
+// It returns false if some of these change sets are not kept anymore (or were
+// never recorded because r.ChangeLog is zero). In that case the caller should
+// resynchronize with the ring as a whole.
+func (r *Ring) ChangesSince(v uint64) ([]ChangeSet, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cur := r.current().version
+	if v >= cur {
+		return nil, true
+	}
+	if len(r.log) == 0 || r.log[0].Version > v+1 {
+		return nil, false
+	}
+	i := int(v + 1 - r.log[0].Version)
+	return append([]ChangeSet(nil), r.log[i:]...), true
+}
+
+// record appends changes made between states prev and next to the change log.
+//
+// r.mu must be held.
+func (r *Ring) record(prev, next *ringState) {
+	fn := r.conf.Trace.OnChange
+	if r.conf.ChangeLog <= 0 && fn == nil {
+		return
+	}
+	cs := ChangeSet{
+		Version: next.version,
+	}
+	if prev.hasher == next.hasher {
+		for id, m := range next.members {
+			if p, has := prev.members[id]; !has || p.weight != m.weight {
+				cs.Changes = append(cs.Changes, Change{m.item, m.weight})
+			}
+		}
+		for id, p := range prev.members {
+			if _, has := next.members[id]; !has {
+				cs.Changes = append(cs.Changes, Change{p.item, 0})
+			}
+		}
+	}
+	if fn != nil {
+		fn(cs)
+	}
+	if r.conf.ChangeLog <= 0 {
+		return
+	}
+	if len(r.log) == r.conf.ChangeLog {
+		copy(r.log, r.log[1:])
+		r.log = r.log[:len(r.log)-1]
+	}
+	r.log = append(r.log, cs)
+}
@@ -0,0 +1,139 @@
+package hashring
+
+import "sort"
+
+// View is an immutable read-only snapshot of the ring. Mutations of the ring
+// made after the View was taken are not visible through it.
+// View is goroutine safe.
+type View struct {
+	ring  *Ring
+	state *ringState
+}
+
+// View returns a snapshot of the current version of the ring. Taking the
+// snapshot is cheap and doesn't block ring mutations.
+func (r *Ring) View() *View {
+	return &View{
+		ring:  r,
+		state: r.load(),
+	}
+}
+
+// Filter returns a snapshot of the current version of the ring restricted to
+// the items for which pred returns true, e.g. to the items of a single
+// region. Lookups on the returned View map keys as if other items were
+// removed from the ring, except that points of the remaining items never
+// change their generations.
+//
+// Filtered View shares points with the ring, so it's cheap to make, but its
+// lookups skip points of other items and thus are slower when pred rejects
+// most of the items. Pred is called once for each item of the ring.
+func (r *Ring) Filter(pred func(Item) bool) *View {
+	return r.View().Filter(pred)
+}
+
+// Filter returns a snapshot restricted to the items of v for which pred
+// returns true.
+// See Ring.Filter() for details.
+func (v *View) Filter(pred func(Item) bool) *View {
+	return &View{
+		ring:  v.ring,
+		state: v.state.filter(pred),
+	}
+}
+
+// Version returns the version of the ring the snapshot was taken at.
+// See Ring.Version() for details.
+func (v *View) Version() uint64 {
+	return v.state.version
+}
+
+// Get returns mapping of v to an item of the snapshot.
+// See Ring.Get() for details.
+func (v *View) Get(x Item) (y Item) {
+	d, err := v.ring.check(v.state.hasher.sum(x, nil))
+	if err != nil {
+		return nil
+	}
+	if done := v.ring.traceGet(d); done != nil {
+		defer func() {
+			done(y)
+		}()
+	}
+	return v.state.lookup(d)
+}
+
+// GetN returns at most n distinct items of the snapshot which x maps to.
+// See Ring.GetN() for details.
+func (v *View) GetN(x Item, n int) (xs []Item) {
+	d, err := v.ring.check(v.state.hasher.sum(x, nil))
+	if err != nil || n <= 0 {
+		return nil
+	}
+	if done := v.ring.traceGet(d); done != nil {
+		defer func() {
+			done(first(xs))
+		}()
+	}
+	return v.state.lookupN(d, n)
+}
+
+// GetChain returns the first item of the snapshot accepted by accept among
+// the distinct items which x maps to.
+// See Ring.GetChain() for details.
+func (v *View) GetChain(x Item, accept func(Item) bool) (y Item) {
+	d, err := v.ring.check(v.state.hasher.sum(x, nil))
+	if err != nil {
+		return nil
+	}
+	if done := v.ring.traceGet(d); done != nil {
+		defer func() {
+			done(y)
+		}()
+	}
+	return v.state.lookupChain(d, accept)
+}
+
+// Items returns items of the snapshot ordered by their digests.
+func (v *View) Items() []Item {
+	ids := make([]uint64, 0, len(v.state.members))
+	for id := range v.state.members {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	items := make([]Item, len(ids))
+	for i, id := range ids {
+		items[i] = v.state.members[id].item
+	}
+	return items
+}
+
+// Distribution returns a mapping of each item of the snapshot to the fraction
+// of the hash space it owns. Fractions are calculated exactly from the points
+// positions and sum up to one for non-empty snapshot.
+func (v *View) Distribution() map[Item]float64 {
+	share := v.state.shares()
+	m := make(map[Item]float64, len(share))
+	for id, s := range share {
+		m[v.state.members[id].item] = s
+	}
+	return m
+}
+
+// filter returns a copy of s having only members for which pred returns true.
+func (s *ringState) filter(pred func(Item) bool) *ringState {
+	c := *s
+	c.filtered = true
+	c.cache = s.cache.empty()
+	c.members = make(map[uint64]member)
+	c.total = 0
+	for id, m := range s.members {
+		if pred(m.item) {
+			c.members[id] = m
+			c.total += m.weight
+		}
+	}
+	return &c
+}
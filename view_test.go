@@ -0,0 +1,114 @@
+package hashring
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRingView(t *testing.T) {
+	r := makeRing(t, map[string]float64{
+		"foo": 1,
+		"bar": 2,
+		"baz": 3,
+	})
+	v := r.View()
+
+	const keys = 1000
+	exp := make([]Item, keys)
+	for i := range exp {
+		exp[i] = r.Get(IntItem(i))
+	}
+	if err := r.Delete(StringItem("baz")); err != nil {
+		t.Fatal(err)
+	}
+	for i := range exp {
+		if act := v.Get(IntItem(i)); act != exp[i] {
+			t.Fatalf("view changed after ring mutation: %v; want %v", act, exp[i])
+		}
+	}
+	if xs := v.GetN(IntItem(0), 3); len(xs) != 3 {
+		t.Fatalf("unexpected GetN() result: %v", xs)
+	}
+	if n := len(v.Items()); n != 3 {
+		t.Fatalf("unexpected number of items: %d; want 3", n)
+	}
+	if xs := r.View().Items(); !reflect.DeepEqual(xs, r.View().Items()) || len(xs) != 2 {
+		t.Fatalf("unexpected items: %v", xs)
+	}
+	weights := map[Item]float64{
+		StringItem("foo"): 1,
+		StringItem("bar"): 2,
+		StringItem("baz"): 3,
+	}
+	var sum float64
+	for x, s := range v.Distribution() {
+		w := weights[x]
+		if math.Abs(s-w/6) > 0.05 {
+			t.Errorf("unexpected share of %v: %.4f; want ~%.4f", x, s, w/6)
+		}
+		sum += s
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Fatalf("shares sum up to %v; want 1", sum)
+	}
+}
+
+func TestRingFilter(t *testing.T) {
+	var (
+		all = map[string]float64{
+			"foo": 1,
+			"bar": 1,
+			"baz": 1,
+			"qux": 1,
+		}
+		sub = map[string]float64{
+			"foo": 1,
+			"bar": 1,
+		}
+	)
+	r := makeRing(t, all)
+	if err := r.Pin(IntItem(0), StringItem("baz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Pin(IntItem(1), StringItem("foo")); err != nil {
+		t.Fatal(err)
+	}
+	exp := makeRing(t, sub)
+	if err := exp.Pin(IntItem(1), StringItem("foo")); err != nil {
+		t.Fatal(err)
+	}
+	v := r.Filter(func(x Item) bool {
+		_, has := sub[string(x.(StringItem))]
+		return has
+	})
+	for i := 0; i < 1000; i++ {
+		key := IntItem(i)
+		if act, exp := v.Get(key), exp.Get(key); act != exp {
+			t.Fatalf("unexpected item for %d: %v; want %v", i, act, exp)
+		}
+		if act, exp := v.GetN(key, 3), exp.GetN(key, 3); !reflect.DeepEqual(act, exp) {
+			t.Fatalf("unexpected items for %d: %v; want %v", i, act, exp)
+		}
+	}
+	if act, exp := v.Items(), exp.View().Items(); !reflect.DeepEqual(act, exp) {
+		t.Fatalf("unexpected items: %v; want %v", act, exp)
+	}
+	expShares := exp.View().Distribution()
+	for x, s := range v.Distribution() {
+		if math.Abs(s-expShares[x]) > 1e-9 {
+			t.Errorf("unexpected share of %v: %v; want %v", x, s, expShares[x])
+		}
+	}
+	if n := len(r.View().Items()); n != 4 {
+		t.Fatalf("filter changed the ring: %d items", n)
+	}
+
+	none := v.Filter(func(Item) bool { return false })
+	if x := none.Get(IntItem(0)); x != nil {
+		t.Fatalf("unexpected item from empty view: %v", x)
+	}
+	if xs := none.GetN(IntItem(0), 2); len(xs) != 0 {
+		t.Fatalf("unexpected items from empty view: %v", xs)
+	}
+}
@@ -0,0 +1,194 @@
+// Package viz renders hashring as an SVG image.
+//
+// Ring is drawn as a circle split into arcs which are proportional to the
+// parts of the hash space owned by the items. Arcs of the same item share the
+// same color. Hash value zero is at the top and values grow clockwise.
+package viz
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/gobwas/hashring"
+)
+
+// DefaultSize is the default size of the image in pixels.
+const DefaultSize = 480
+
+// Options contains options of the ring rendering.
+type Options struct {
+	// Size is an optional size of the ring circle in pixels.
+	// If Size is zero, then DefaultSize is used.
+	Size int
+}
+
+// arc is a part of the hash space (from, to] owned by the item.
+type arc struct {
+	from, to uint64
+	item     int
+}
+
+type legend struct {
+	name  string
+	share float64
+}
+
+// WriteSVG renders the ring r as an SVG image to w.
+// opts may be nil.
+func WriteSVG(w io.Writer, r *hashring.Ring, opts *Options) error {
+	arcs, items, err := layout(r)
+	if err != nil {
+		return err
+	}
+	size := DefaultSize
+	if opts != nil && opts.Size > 0 {
+		size = opts.Size
+	}
+	var (
+		bw      = bufio.NewWriter(w)
+		radius  = float64(size) / 2
+		lineH   = 18
+		height  = size + lineH*len(items) + lineH
+		colorOf = func(i int) string {
+			return fmt.Sprintf("hsl(%d,65%%,55%%)", i*360/len(items))
+		}
+	)
+	fmt.Fprintf(bw,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		size, height, size, height,
+	)
+	if len(arcs) == 1 {
+		fmt.Fprintf(bw,
+			`<circle cx="%g" cy="%g" r="%g" fill="%s"/>`+"\n",
+			radius, radius, radius, colorOf(arcs[0].item),
+		)
+	}
+	for _, a := range arcs {
+		if len(arcs) == 1 {
+			break
+		}
+		var (
+			x0, y0 = point(radius, a.from)
+			x1, y1 = point(radius, a.to)
+			large  = 0
+		)
+		if a.to-a.from > math.MaxUint64/2 {
+			large = 1
+		}
+		fmt.Fprintf(bw,
+			`<path d="M%g,%g L%.2f,%.2f A%g,%g 0 %d 1 %.2f,%.2f Z" fill="%s"/>`+"\n",
+			radius, radius, x0, y0, radius, radius, large, x1, y1,
+			colorOf(a.item),
+		)
+	}
+	for i, l := range items {
+		y := size + lineH*(i+1)
+		fmt.Fprintf(bw,
+			`<rect x="0" y="%d" width="12" height="12" fill="%s"/>`+"\n",
+			y-11, colorOf(i),
+		)
+		fmt.Fprintf(bw,
+			`<text x="18" y="%d" font-family="monospace" font-size="12">%s %.2f%%</text>`+"\n",
+			y, html.EscapeString(l.name), 100*l.share,
+		)
+	}
+	fmt.Fprintln(bw, "</svg>")
+
+	return bw.Flush()
+}
+
+// Handler returns HTTP handler serving rendered ring r.
+// It serves an HTML page with the image, or the SVG image itself if the
+// request has "format=svg" query parameter.
+func Handler(r *hashring.Ring, opts *Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		if err := WriteSVG(&buf, r, opts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if req.URL.Query().Get("format") == "svg" {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			buf.WriteTo(w)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<!DOCTYPE html>\n<html><head><title>hashring</title></head><body>\n")
+		buf.WriteTo(w)
+		io.WriteString(w, "</body></html>\n")
+	})
+}
+
+// layout returns arcs of the ring merged by owners along with the ring items
+// ordered by their names.
+func layout(r *hashring.Ring) ([]arc, []legend, error) {
+	type owner struct {
+		pos  uint64
+		name string
+	}
+	var (
+		owners []owner
+		buf    bytes.Buffer
+		err    error
+	)
+	r.WalkRange(0, 0, func(p hashring.PointInfo) bool {
+		buf.Reset()
+		if _, err = p.Item.WriteTo(&buf); err != nil {
+			return false
+		}
+		owners = append(owners, owner{p.Value, buf.String()})
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	index := make(map[string]int)
+	for _, o := range owners {
+		index[o.name] = 0
+	}
+	items := make([]legend, 0, len(index))
+	for name := range index {
+		items = append(items, legend{name: name})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].name < items[j].name
+	})
+	for i, l := range items {
+		index[l.name] = i
+	}
+	var arcs []arc
+	for i, o := range owners {
+		var (
+			from = owners[(i+len(owners)-1)%len(owners)].pos
+			item = index[o.name]
+		)
+		size := float64(o.pos - from)
+		if len(owners) == 1 {
+			size = math.Exp2(64)
+		}
+		items[item].share += size / math.Exp2(64)
+		if n := len(arcs); n > 0 && arcs[n-1].item == item {
+			arcs[n-1].to = o.pos
+			continue
+		}
+		arcs = append(arcs, arc{from, o.pos, item})
+	}
+	// Merge the last arc with the first one if they have the same owner.
+	if n := len(arcs); n > 1 && arcs[n-1].item == arcs[0].item {
+		arcs[0].from = arcs[n-1].from
+		arcs = arcs[:n-1]
+	}
+	return arcs, items, nil
+}
+
+// point returns coordinates of the hash value v on the circle of radius r.
+func point(r float64, v uint64) (x, y float64) {
+	a := 2*math.Pi*float64(v)/math.Exp2(64) - math.Pi/2
+	return r + r*math.Cos(a), r + r*math.Sin(a)
+}
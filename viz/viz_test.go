@@ -0,0 +1,80 @@
+package viz
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobwas/hashring"
+)
+
+type item string
+
+func (s item) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(s))
+	return int64(n), err
+}
+
+func TestLayout(t *testing.T) {
+	var r hashring.Ring
+	for _, s := range []string{"foo", "bar", "baz"} {
+		if err := r.Insert(item(s), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	arcs, items, err := layout(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || items[0].name != "bar" {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+	var sum float64
+	for _, l := range items {
+		sum += l.share
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Fatalf("shares sum up to %v; want 1", sum)
+	}
+	for i, a := range arcs {
+		next := arcs[(i+1)%len(arcs)]
+		if a.to != next.from || a.item == next.item {
+			t.Fatalf("arcs are not merged or not adjacent: %+v %+v", a, next)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var r hashring.Ring
+	if err := r.Insert(item("<foo>"), 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		url    string
+		ctype  string
+		prefix string
+	}{
+		{"/", "text/html; charset=utf-8", "<!DOCTYPE html>"},
+		{"/?format=svg", "image/svg+xml", "<svg"},
+	} {
+		w := httptest.NewRecorder()
+		Handler(&r, nil).ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+		if ct := w.Header().Get("Content-Type"); ct != test.ctype {
+			t.Errorf("%s: unexpected content type: %q", test.url, ct)
+		}
+		body := w.Body.String()
+		if !strings.HasPrefix(body, test.prefix) {
+			t.Errorf("%s: unexpected body:\n%s", test.url, body)
+		}
+		if !strings.Contains(body, "&lt;foo&gt; 100.00%") || !strings.Contains(body, "<circle") {
+			t.Errorf("%s: unexpected body:\n%s", test.url, body)
+		}
+	}
+	var buf bytes.Buffer
+	if err := WriteSVG(&buf, new(hashring.Ring), nil); err != nil {
+		t.Fatal(err)
+	}
+}